@@ -0,0 +1,136 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	sqlc "github.com/samanthatb1/beadBashStorage/db/sqlc"
+	"github.com/samanthatb1/beadBashStorage/util"
+)
+
+// API key as shown to clients, the hash is never sent back
+type apiKeyResponse struct {
+	ID          int64      `json:"id"`
+	Name        string     `json:"name"`
+	KeyPrefix   string     `json:"key_prefix"`
+	Scopes      []string   `json:"scopes"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+	RevokedAt   *time.Time `json:"revoked_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+func newApiKeyResponse(apiKey sqlc.ApiKey) apiKeyResponse {
+	response := apiKeyResponse{
+		ID: apiKey.ID,
+		Name: apiKey.Name,
+		KeyPrefix: apiKey.KeyPrefix,
+		Scopes: apiKey.Scopes,
+		ExpiresAt: apiKey.ExpiresAt,
+		CreatedAt: apiKey.CreatedAt,
+	}
+	if apiKey.LastUsedAt.Valid {
+		response.LastUsedAt = &apiKey.LastUsedAt.Time
+	}
+	if apiKey.RevokedAt.Valid {
+		response.RevokedAt = &apiKey.RevokedAt.Time
+	}
+	return response
+}
+
+/**** CREATE API KEY ****/
+type createApiKeyRequest struct {
+	Name       string    `json:"name" binding:"required"`
+	Scopes     []string  `json:"scopes" binding:"required,min=1,dive,oneof=users:read users:write orders:read orders:write"`
+	ExpiresAt  time.Time `json:"expires_at" binding:"required"`
+}
+
+type createApiKeyResponse struct {
+	Key      string          `json:"key"` // Only ever returned here, it can't be recovered later
+	ApiKey   apiKeyResponse  `json:"api_key"`
+}
+
+// Add createApiKey function to the server instance
+func (server *Server) createApiKey(ctx *gin.Context){
+	var reqBody createApiKeyRequest
+
+	// If params are invalid
+	if err := ctx.ShouldBindJSON(&reqBody); err != nil {
+		sendInvalid(ctx, err)
+		return
+	}
+	if !reqBody.ExpiresAt.After(time.Now()) {
+		sendInvalid(ctx, errors.New("expires_at must be in the future"))
+		return
+	}
+
+	key, prefix, err := util.GenerateAPIKey()
+	if err != nil {
+		sendError(ctx, err)
+		return
+	}
+
+	// Only the hash of the key is stored
+	apiKey, err := server.store.CreateApiKey(ctx, sqlc.CreateApiKeyParams{
+		Name: reqBody.Name,
+		KeyPrefix: prefix,
+		HashedKey: util.HashAPIKey(key),
+		Scopes: reqBody.Scopes,
+		ExpiresAt: reqBody.ExpiresAt,
+	})
+	if err != nil {
+		sendError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, createApiKeyResponse{Key: key, ApiKey: newApiKeyResponse(apiKey)})
+}
+
+/**** LIST API KEYS ****/
+
+// Add listApiKeys function to the server instance
+func (server *Server) listApiKeys(ctx *gin.Context){
+	apiKeys, err := server.store.ListApiKeys(ctx)
+	if err != nil {
+		sendError(ctx, err)
+		return
+	}
+
+	response := make([]apiKeyResponse, 0, len(apiKeys))
+	for _, apiKey := range apiKeys {
+		response = append(response, newApiKeyResponse(apiKey))
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+/**** REVOKE API KEY ****/
+type revokeApiKeyRequest struct {
+	ID    int64 `uri:"id" binding:"required,min=1"`
+}
+
+// Add revokeApiKey function to the server instance
+func (server *Server) revokeApiKey(ctx *gin.Context){
+	var reqBody revokeApiKeyRequest
+
+	// If params are invalid
+	if err := ctx.ShouldBindUri(&reqBody); err != nil {
+		sendInvalid(ctx, err)
+		return
+	}
+
+	// Keys are kept after revoking so their usage stays visible
+	apiKey, err := server.store.RevokeApiKey(ctx, reqBody.ID)
+	if err != nil {
+		if err == sql.ErrNoRows { // If that id doesnt exist or is already revoked
+			sendProblem(ctx, http.StatusNotFound, codeApiKeyNotFound, "Active api key doesn't exist")
+			return
+		}
+		sendError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, newApiKeyResponse(apiKey))
+}
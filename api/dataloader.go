@@ -0,0 +1,76 @@
+package api
+
+import (
+	"context"
+)
+
+// Loads the values of many keys with one query
+// Keys missing from the result have no value, e.g. a user without orders
+type batchFetch func(ctx context.Context, keys []string) (map[string]interface{}, error)
+
+// Collects the keys resolvers ask for and fetches them in one batch when the first value is needed
+// graphql-go calls every resolver of a level before it runs any of the level's thunks,
+// so all the users of a list share one query for their orders instead of one query each
+// Made for a single request, graphql-go resolves a request on one goroutine so there's no locking
+type dataLoader struct {
+	fetch   batchFetch
+	pending []string               // Keys asked for since the last batch
+	values  map[string]interface{} // Every key fetched so far, so repeated keys aren't fetched again
+	errs    map[string]error       // Keys whose batch failed
+}
+
+func newDataLoader(fetch batchFetch) *dataLoader {
+	return &dataLoader{
+		fetch: fetch,
+		values: map[string]interface{}{},
+		errs: map[string]error{},
+	}
+}
+
+// Queues the key and returns a thunk for graphql-go, the thunk gives nil if the key has no value
+func (loader *dataLoader) load(ctx context.Context, key string) func() (interface{}, error) {
+	if !loader.loaded(key) {
+		loader.pending = append(loader.pending, key)
+	}
+
+	return func() (interface{}, error) {
+		if !loader.loaded(key) {
+			loader.fetchPending(ctx)
+		}
+		if err := loader.errs[key]; err != nil {
+			return nil, err
+		}
+		return loader.values[key], nil
+	}
+}
+
+func (loader *dataLoader) loaded(key string) bool {
+	_, hasValue := loader.values[key]
+	_, hasErr := loader.errs[key]
+	return hasValue || hasErr
+}
+
+// Fetches every queued key that isn't loaded yet in one batch
+func (loader *dataLoader) fetchPending(ctx context.Context) {
+	keys := []string{}
+	seen := map[string]bool{}
+	for _, key := range loader.pending {
+		if !seen[key] && !loader.loaded(key) {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	loader.pending = nil
+	if len(keys) == 0 {
+		return
+	}
+
+	values, err := loader.fetch(ctx, keys)
+	for _, key := range keys {
+		if err != nil {
+			loader.errs[key] = err
+			continue
+		}
+		loader.values[key] = values[key] // nil if the key has no value
+	}
+}
@@ -0,0 +1,105 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ETag for a row version, e.g. "3"
+func versionETag(version int64) string {
+	return fmt.Sprintf("%q", strconv.FormatInt(version, 10))
+}
+
+// Reads the versions the client expects from the If-Match header, a list like "3", "4" matches any of them
+// ok is false if the header is missing or "*" (any version), versions is empty if none of the ETags are ours
+func ifMatchVersions(ctx *gin.Context) (versions []int64, ok bool) {
+	ifMatch := strings.TrimSpace(ctx.GetHeader("If-Match"))
+	if ifMatch == "" || ifMatch == "*" {
+		return nil, false
+	}
+
+	for _, etag := range strings.Split(ifMatch, ",") {
+		// Weak ETags never match for If-Match
+		unquoted, err := strconv.Unquote(strings.TrimSpace(etag))
+		if err != nil {
+			continue
+		}
+		version, err := strconv.ParseInt(unquoted, 10, 64)
+		if err != nil || version <= 0 {
+			continue
+		}
+		versions = append(versions, version)
+	}
+	return versions, true
+}
+
+/**** CONDITIONAL GET ****/
+
+// Clients may keep responses but must ask again every time, with If-None-Match or If-Modified-Since
+const revalidateCacheControl = "private, no-cache"
+
+// Weak ETag from a hash of the JSON body, for responses that aren't a single row as it's stored
+// Weak so it never passes an If-Match on a write
+func bodyETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return fmt.Sprintf("W/%q", hex.EncodeToString(sum[:16]))
+}
+
+// Sends the body as JSON with its ETag and Last-Modified, or 304 Not Modified if the client has it already
+// etag is the body's hash if empty, Last-Modified is left out if lastModified is zero
+func sendConditional(ctx *gin.Context, etag string, lastModified time.Time, body interface{}) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		sendError(ctx, err)
+		return
+	}
+	if etag == "" {
+		etag = bodyETag(data)
+	}
+
+	ctx.Header("ETag", etag)
+	ctx.Header("Cache-Control", revalidateCacheControl)
+	if !lastModified.IsZero() {
+		ctx.Header("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+	if notModified(ctx.Request, etag, lastModified) {
+		ctx.Status(http.StatusNotModified)
+		return
+	}
+	ctx.Data(http.StatusOK, gin.MIMEJSON+"; charset=utf-8", data)
+}
+
+// Whether the client's copy is current, If-Modified-Since is only used without If-None-Match (RFC 9110 13.2.2)
+func notModified(req *http.Request, etag string, lastModified time.Time) bool {
+	if ifNoneMatch := req.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		return etagMatches(ifNoneMatch, etag)
+	}
+	if lastModified.IsZero() {
+		return false
+	}
+	since, err := http.ParseTime(req.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	return !lastModified.Truncate(time.Second).After(since) // HTTP dates have whole seconds
+}
+
+// Weak comparison against a list of ETags: W/"3" matches "3"
+func etagMatches(list string, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+// Unit tests for ETag, If-Match and conditional GET handling
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Scenario: parse the versions out of If-Match
+func TestIfMatchVersions(t *testing.T){
+	gin.SetMode(gin.TestMode)
+	require.Equal(t, `"7"`, versionETag(7))
+
+	testCases := []struct {
+		ifMatch  string
+		versions []int64
+		ok       bool
+	}{
+		{"", nil, false},      // No precondition
+		{"*", nil, false},     // Any version
+		{`"7"`, []int64{7}, true},
+		{`W/"7"`, nil, true},  // Weak ETags never match
+		{`"abc"`, nil, true},  // Not one of ours
+		{`"-2"`, nil, true},
+		{`"3", "4"`, []int64{3, 4}, true}, // A list matches any of them
+		{`"3",W/"4","abc"`, []int64{3}, true},
+	}
+
+	for _, tc := range testCases {
+		ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+		ctx.Request = httptest.NewRequest(http.MethodPatch, "/orders", nil)
+		if tc.ifMatch != "" {
+			ctx.Request.Header.Set("If-Match", tc.ifMatch)
+		}
+
+		versions, ok := ifMatchVersions(ctx)
+		require.Equal(t, tc.versions, versions, tc.ifMatch)
+		require.Equal(t, tc.ok, ok, tc.ifMatch)
+	}
+}
+
+// Test Scenario: reads answer 304 while the client's ETag or date is current
+func TestSendConditional(t *testing.T){
+	gin.SetMode(gin.TestMode)
+	updatedAt := time.Date(2026, 3, 2, 10, 30, 15, 500, time.UTC)
+	body := gin.H{"username": "jane"}
+	hashed := bodyETag([]byte(`{"username":"jane"}`))
+
+	testCases := []struct {
+		name    string
+		etag    string
+		headers map[string]string
+		status  int
+	}{
+		{"NoHeaders", `"3"`, nil, http.StatusOK},
+		{"SameVersion", `"3"`, map[string]string{"If-None-Match": `"3"`}, http.StatusNotModified},
+		{"WeakMatches", `"3"`, map[string]string{"If-None-Match": `"2", W/"3"`}, http.StatusNotModified},
+		{"Any", `"3"`, map[string]string{"If-None-Match": "*"}, http.StatusNotModified},
+		{"OldVersion", `"3"`, map[string]string{"If-None-Match": `"2"`}, http.StatusOK},
+		{"SameBody", "", map[string]string{"If-None-Match": hashed}, http.StatusNotModified},
+		{"NotModifiedSince", `"3"`, map[string]string{"If-Modified-Since": "Mon, 02 Mar 2026 10:30:15 GMT"}, http.StatusNotModified},
+		{"ModifiedSince", `"3"`, map[string]string{"If-Modified-Since": "Mon, 02 Mar 2026 10:30:14 GMT"}, http.StatusOK},
+		{"BadDate", `"3"`, map[string]string{"If-Modified-Since": "yesterday"}, http.StatusOK},
+		{"ETagWins", `"3"`, map[string]string{"If-None-Match": `"2"`, "If-Modified-Since": "Mon, 02 Mar 2026 10:30:15 GMT"}, http.StatusOK},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			router := gin.New()
+			router.GET("/users/jane", func(ctx *gin.Context) {
+				sendConditional(ctx, tc.etag, updatedAt, body)
+			})
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodGet, "/users/jane", nil)
+			for key, value := range tc.headers {
+				request.Header.Set(key, value)
+			}
+			router.ServeHTTP(recorder, request)
+
+			require.Equal(t, tc.status, recorder.Code)
+			require.Equal(t, "Mon, 02 Mar 2026 10:30:15 GMT", recorder.Header().Get("Last-Modified"))
+			require.Equal(t, revalidateCacheControl, recorder.Header().Get("Cache-Control"))
+			if tc.etag == "" {
+				require.Equal(t, hashed, recorder.Header().Get("ETag"))
+			} else {
+				require.Equal(t, tc.etag, recorder.Header().Get("ETag"))
+			}
+			if tc.status == http.StatusNotModified {
+				require.Empty(t, recorder.Body.Bytes())
+			} else {
+				require.JSONEq(t, `{"username": "jane"}`, recorder.Body.String())
+			}
+		})
+	}
+}
+
+// Test Scenario: picked fields and embedded resources don't send the version as the ETag
+func TestFieldSetValidators(t *testing.T){
+	updatedAt := time.Now()
+
+	etag, lastModified := fieldSet{}.validators(3, updatedAt)
+	require.Equal(t, `"3"`, etag)
+	require.Equal(t, updatedAt, lastModified)
+
+	etag, lastModified = fieldSet{fields: map[string]bool{"username": true}}.validators(3, updatedAt)
+	require.Empty(t, etag) // The body is hashed
+	require.Equal(t, updatedAt, lastModified)
+
+	etag, lastModified = fieldSet{includes: map[string]bool{"orders": true}}.validators(3, updatedAt)
+	require.Empty(t, etag)
+	require.True(t, lastModified.IsZero())
+}
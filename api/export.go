@@ -0,0 +1,218 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	sqlc "github.com/samanthatb1/beadBashStorage/db/sqlc"
+	"github.com/samanthatb1/beadBashStorage/export"
+)
+
+// A column clients can pick, value reads it from the row (a sqlc.User or a sqlc.Order)
+type exportColumn struct {
+	name  string
+	value func(row interface{}) interface{}
+}
+
+// Columns in the order they're exported when the client doesn't pick
+var userExportColumns = []exportColumn{
+	{"id", func(row interface{}) interface{} { return row.(sqlc.User).ID }},
+	{"username", func(row interface{}) interface{} { return row.(sqlc.User).Username }},
+	{"full_name", func(row interface{}) interface{} { return row.(sqlc.User).FullName }},
+	{"total_orders", func(row interface{}) interface{} { return row.(sqlc.User).TotalOrders }},
+	{"role", func(row interface{}) interface{} { return row.(sqlc.User).Role }},
+	{"created_at", func(row interface{}) interface{} { return row.(sqlc.User).CreatedAt }},
+	{"erased_at", func(row interface{}) interface{} {
+		if erasedAt := row.(sqlc.User).ErasedAt; erasedAt.Valid {
+			return erasedAt.Time
+		}
+		return nil
+	}},
+	{"updated_at", func(row interface{}) interface{} { return row.(sqlc.User).UpdatedAt }},
+	{"version", func(row interface{}) interface{} { return row.(sqlc.User).Version }},
+}
+
+var orderExportColumns = []exportColumn{
+	{"order_id", func(row interface{}) interface{} { return row.(sqlc.Order).OrderID }},
+	{"account_id", func(row interface{}) interface{} { return row.(sqlc.Order).AccountID }},
+	{"username", func(row interface{}) interface{} { return row.(sqlc.Order).Username }},
+	{"full_name", func(row interface{}) interface{} { return row.(sqlc.Order).FullName }},
+	{"purchase_amount", func(row interface{}) interface{} { return row.(sqlc.Order).PurchaseAmount }},
+	{"purchased_item", func(row interface{}) interface{} { return row.(sqlc.Order).PurchasedItem }},
+	{"shipping_location", func(row interface{}) interface{} { return row.(sqlc.Order).ShippingLocation }},
+	{"currency", func(row interface{}) interface{} { return row.(sqlc.Order).Currency }},
+	{"date_ordered", func(row interface{}) interface{} { return row.(sqlc.Order).DateOrdered }},
+	{"created_at", func(row interface{}) interface{} { return row.(sqlc.Order).CreatedAt }},
+	{"external_source", func(row interface{}) interface{} { return row.(sqlc.Order).ExternalSource }},
+	{"external_id", func(row interface{}) interface{} { return row.(sqlc.Order).ExternalID }},
+	{"updated_at", func(row interface{}) interface{} { return row.(sqlc.Order).UpdatedAt }},
+	{"version", func(row interface{}) interface{} { return row.(sqlc.Order).Version }},
+}
+
+type exportRequest struct {
+	Format  string `form:"format" binding:"omitempty,oneof=csv ndjson xlsx"` // csv if empty
+	Columns string `form:"columns"` // Comma separated, every column if empty
+}
+
+// Columns the client picked, in the order they were asked for
+func (req exportRequest) columns(available []exportColumn) ([]exportColumn, error) {
+	if req.Columns == "" {
+		return available, nil
+	}
+	var picked []exportColumn
+	for _, name := range strings.Split(req.Columns, ",") {
+		column, ok := findExportColumn(available, strings.TrimSpace(name))
+		if !ok {
+			return nil, fmt.Errorf("columns can only have %s, %q isn't one", exportColumnNames(available), strings.TrimSpace(name))
+		}
+		picked = append(picked, column)
+	}
+	return picked, nil
+}
+
+func findExportColumn(columns []exportColumn, name string) (exportColumn, bool) {
+	for _, column := range columns {
+		if column.name == name {
+			return column, true
+		}
+	}
+	return exportColumn{}, false
+}
+
+func exportColumnNames(columns []exportColumn) string {
+	names := make([]string, len(columns))
+	for i, column := range columns {
+		names[i] = column.name
+	}
+	return strings.Join(names, ", ")
+}
+
+// Sends the rows to the client as they're read
+// Nothing is sent until the first row, so errors before it still get a problem response
+type exportStream struct {
+	ctx     *gin.Context
+	format  string
+	name    string // File name without the extension
+	columns []exportColumn
+	writer  export.Writer // nil until the first row
+	values  []interface{} // Reused for every row
+}
+
+func newExportStream(ctx *gin.Context, req exportRequest, name string, columns []exportColumn) *exportStream {
+	format := req.Format
+	if format == "" {
+		format = export.CSV
+	}
+	return &exportStream{ctx: ctx, format: format, name: name, columns: columns, values: make([]interface{}, len(columns))}
+}
+
+// Sends the headers and starts the file
+func (stream *exportStream) start() error {
+	names := make([]string, len(stream.columns))
+	for i, column := range stream.columns {
+		names[i] = column.name
+	}
+
+	stream.ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, stream.name, stream.format))
+	stream.ctx.Header("Content-Type", export.ContentType(stream.format))
+	stream.ctx.Header("Cache-Control", "no-store")
+	stream.ctx.Status(http.StatusOK)
+
+	var err error
+	stream.writer, err = export.NewWriter(stream.format, stream.ctx.Writer, names)
+	return err
+}
+
+func (stream *exportStream) write(row interface{}) error {
+	if stream.writer == nil {
+		if err := stream.start(); err != nil {return err}
+	}
+	for i, column := range stream.columns {
+		stream.values[i] = column.value(row)
+	}
+	return stream.writer.WriteRow(stream.values)
+}
+
+// Ends the file, or sends the error if nothing was sent yet
+func (stream *exportStream) finish(err error) {
+	if err != nil {
+		if stream.writer == nil {
+			sendError(stream.ctx, err)
+			return
+		}
+		stream.ctx.Error(err) // Headers are already sent, the client gets a file that stops early
+		return
+	}
+
+	// No rows, the file only has the header
+	if stream.writer == nil {
+		if err := stream.start(); err != nil {
+			stream.ctx.Error(err)
+			return
+		}
+	}
+	if err := stream.writer.Close(); err != nil {
+		stream.ctx.Error(err)
+	}
+}
+
+/**** EXPORT USERS ****/
+type exportUsersRequest struct {
+	exportRequest
+	Tag string `form:"tag"` // Optional: only users with this tag
+}
+
+// Add exportUsers function to the server instance
+// Streams every user matching the filters as CSV, NDJSON or XLSX
+func (server *Server) exportUsers(ctx *gin.Context){
+	var reqBody exportUsersRequest
+
+	// If params are invalid
+	if err := ctx.ShouldBindQuery(&reqBody); err != nil {
+		sendInvalid(ctx, err)
+		return
+	}
+	columns, err := reqBody.columns(userExportColumns)
+	if err != nil {
+		sendInvalid(ctx, err)
+		return
+	}
+
+	stream := newExportStream(ctx, reqBody.exportRequest, "users", columns)
+	err = server.store.StreamUsers(ctx, sqlc.UserFilter{Tag: normalizeTag(reqBody.Tag)}, func(user sqlc.User) error {
+		return stream.write(user)
+	})
+	stream.finish(err)
+}
+
+/**** EXPORT ORDERS ****/
+type exportOrdersRequest struct {
+	exportRequest
+	orderFilterRequest
+	Username string `form:"username"` // Optional: only orders of this user
+}
+
+// Add exportOrders function to the server instance
+// Streams every order matching the filters as CSV, NDJSON or XLSX
+func (server *Server) exportOrders(ctx *gin.Context){
+	var reqBody exportOrdersRequest
+
+	// If params are invalid
+	if err := ctx.ShouldBindQuery(&reqBody); err != nil {
+		sendInvalid(ctx, err)
+		return
+	}
+	columns, err := reqBody.columns(orderExportColumns)
+	if err != nil {
+		sendInvalid(ctx, err)
+		return
+	}
+
+	stream := newExportStream(ctx, reqBody.exportRequest, "orders", columns)
+	err = server.store.StreamOrders(ctx, reqBody.filter(reqBody.Username), func(order sqlc.Order) error {
+		return stream.write(order)
+	})
+	stream.finish(err)
+}
@@ -0,0 +1,114 @@
+// Unit tests for the user and order exports, the parts that don't need the DB
+
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	sqlc "github.com/samanthatb1/beadBashStorage/db/sqlc"
+	"github.com/samanthatb1/beadBashStorage/export"
+	"github.com/samanthatb1/beadBashStorage/util"
+	"github.com/stretchr/testify/require"
+)
+
+/* Helper Functions */
+
+func newExportContext(t *testing.T) (*gin.Context, *httptest.ResponseRecorder) {
+	recorder := httptest.NewRecorder()
+	ctx, _ := gin.CreateTestContext(recorder)
+	ctx.Request = httptest.NewRequest(http.MethodGet, "/v2/exports/orders", nil)
+	return ctx, recorder
+}
+
+/* Test Functions */
+
+// Test Scenario: params that can't be exported are rejected before the DB is read
+func TestExportParams(t *testing.T){
+	server := newTestServer(t)
+	tokenMaker, err := newTestTokenMaker()
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name string
+		url  string
+	}{
+		{"UnknownFormat", "/v2/exports/orders?format=pdf"},
+		{"UnknownColumn", "/v2/exports/orders?columns=order_id,password"},
+		{"UserColumnOnOrders", "/v2/exports/orders?columns=total_orders"},
+		{"BadFilter", "/v2/exports/orders?min_amount=20&max_amount=10"},
+		{"UnknownUserColumn", "/v2/exports/users?format=xlsx&columns=purchase_amount"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodGet, tc.url, nil)
+			addAuthorization(t, request, tokenMaker, testCustomer, util.ReadOnlyRole)
+			server.router.ServeHTTP(recorder, request)
+			require.Equal(t, http.StatusBadRequest, recorder.Code, recorder.Body.String())
+
+			var body problem
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+			require.Equal(t, codeInvalidRequest, body.Code)
+		})
+	}
+}
+
+// Test Scenario: picked columns keep the order they were asked in
+func TestExportColumns(t *testing.T){
+	columns, err := exportRequest{Columns: "purchase_amount, order_id"}.columns(orderExportColumns)
+	require.NoError(t, err)
+	require.Equal(t, "purchase_amount, order_id", exportColumnNames(columns))
+
+	columns, err = exportRequest{}.columns(userExportColumns)
+	require.NoError(t, err)
+	require.Len(t, columns, len(userExportColumns))
+
+	erased := userExportColumns[6]
+	require.Equal(t, "erased_at", erased.name)
+	require.Nil(t, erased.value(sqlc.User{}))
+}
+
+// Test Scenario: rows are sent as a file named after the export, in the picked format
+func TestExportStream(t *testing.T){
+	ctx, recorder := newExportContext(t)
+	columns, err := exportRequest{Columns: "order_id,purchased_item"}.columns(orderExportColumns)
+	require.NoError(t, err)
+
+	stream := newExportStream(ctx, exportRequest{Format: export.NDJSON}, "orders", columns)
+	require.NoError(t, stream.write(sqlc.Order{OrderID: 1, PurchasedItem: "Anklet"}))
+	require.NoError(t, stream.write(sqlc.Order{OrderID: 2, PurchasedItem: "Ring"}))
+	stream.finish(nil)
+
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "application/x-ndjson", recorder.Header().Get("Content-Type"))
+	require.Equal(t, `attachment; filename="orders.ndjson"`, recorder.Header().Get("Content-Disposition"))
+	require.Equal(t, "{\"order_id\":1,\"purchased_item\":\"Anklet\"}\n{\"order_id\":2,\"purchased_item\":\"Ring\"}\n", recorder.Body.String())
+}
+
+// Test Scenario: an export with no rows still has the header, CSV is the default
+func TestExportStreamEmpty(t *testing.T){
+	ctx, recorder := newExportContext(t)
+	stream := newExportStream(ctx, exportRequest{}, "users", userExportColumns[:2])
+	stream.finish(nil)
+
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "text/csv; charset=utf-8", recorder.Header().Get("Content-Type"))
+	require.Equal(t, "id,username\n", recorder.Body.String())
+}
+
+// Test Scenario: an error before the first row is sent as a problem instead of a file
+func TestExportStreamError(t *testing.T){
+	ctx, recorder := newExportContext(t)
+	stream := newExportStream(ctx, exportRequest{Format: export.XLSX}, "orders", orderExportColumns)
+	stream.finish(errors.New("connection refused"))
+
+	require.Equal(t, http.StatusInternalServerError, recorder.Code)
+	require.Equal(t, problemContentType, recorder.Header().Get("Content-Type"))
+	require.Empty(t, recorder.Header().Get("Content-Disposition"))
+}
@@ -0,0 +1,306 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	sqlc "github.com/samanthatb1/beadBashStorage/db/sqlc"
+	"github.com/samanthatb1/beadBashStorage/util"
+)
+
+// Fields clients can pick, the JSON names of the resource
+var (
+	userFields  = jsonFieldNames(sqlc.User{})
+	orderFields = jsonFieldNames(sqlc.Order{})
+)
+
+// A resource that can be embedded
+type relation struct {
+	fields []string // Fields clients can pick from it
+	scope  string   // API keys need it to embed the resource, as if they read it on its own
+}
+
+var (
+	userRelations  = map[string]relation{"orders": {orderFields, util.OrdersReadScope}}
+	orderRelations = map[string]relation{"user": {userFields, util.UsersReadScope}}
+)
+
+// Only for the docs: a user with include=orders, fields can leave any field out
+type userWithOrders struct {
+	sqlc.User
+	Orders []sqlc.Order `json:"orders,omitempty"`
+}
+
+// Only for the docs: an order with include=user, fields can leave any field out
+type orderWithUser struct {
+	sqlc.Order
+	User *sqlc.User `json:"user,omitempty"`
+}
+
+/**** FIELDS AND INCLUDE ****/
+
+// Query params of the user and order reads
+type fieldsRequest struct {
+	Fields  string `form:"fields"`  // Comma separated fields to send, every field if empty. user.{field} or orders.{field} pick the fields of an included resource
+	Include string `form:"include"` // Comma separated resources to embed: user on orders, orders on users
+}
+
+// What the client asked to be sent
+type fieldSet struct {
+	fields   map[string]bool            // Fields of the resource, every field if empty
+	includes map[string]bool            // Relations to embed
+	nested   map[string]map[string]bool // Fields of each embedded relation, every field if empty
+}
+
+// Reads what the client asked for, sends a problem if the resource doesn't have it or an API key can't read it
+func bindFieldSet(ctx *gin.Context, req fieldsRequest, fields []string, relations map[string]relation) (fieldSet, bool) {
+	set, err := req.fieldSet(fields, relations)
+	if err != nil {
+		sendInvalid(ctx, err)
+		return set, false
+	}
+
+	if apiKey, isApiKey := ctx.Get(authorizationApiKeyKey); isApiKey {
+		for name := range set.includes {
+			if !containsString(apiKey.(sqlc.ApiKey).Scopes, relations[name].scope) {
+				sendProblem(ctx, http.StatusForbidden, codeForbidden, fmt.Sprintf("api key %s needs the %s scope to include %s", apiKey.(sqlc.ApiKey).Name, relations[name].scope, name))
+				return set, false
+			}
+		}
+	}
+	return set, true
+}
+
+// Checks the params against the resource's fields and relations
+func (req fieldsRequest) fieldSet(fields []string, relations map[string]relation) (fieldSet, error) {
+	set := fieldSet{fields: map[string]bool{}, includes: map[string]bool{}, nested: map[string]map[string]bool{}}
+
+	for _, name := range splitParam(req.Include) {
+		if _, ok := relations[name]; !ok {
+			return set, fmt.Errorf("include can only have %s, %q isn't one", strings.Join(relationNames(relations), ", "), name)
+		}
+		set.includes[name] = true
+	}
+
+	for _, name := range splitParam(req.Fields) {
+		relation, field, nested := strings.Cut(name, ".")
+		if !nested {
+			if !containsString(fields, name) {
+				return set, fmt.Errorf("fields can only have %s, %q isn't one", strings.Join(fields, ", "), name)
+			}
+			set.fields[name] = true
+			continue
+		}
+
+		if !set.includes[relation] {
+			return set, fmt.Errorf("fields has %q but %s isn't included", name, relation)
+		}
+		if !containsString(relations[relation].fields, field) {
+			return set, fmt.Errorf("fields of %s can only have %s, %q isn't one", relation, strings.Join(relations[relation].fields, ", "), field)
+		}
+		if set.nested[relation] == nil {
+			set.nested[relation] = map[string]bool{}
+		}
+		set.nested[relation][field] = true
+	}
+	return set, nil
+}
+
+// Whether the response differs from the plain resource
+func (set fieldSet) active() bool {
+	return len(set.fields) > 0 || len(set.includes) > 0
+}
+
+// ETag and Last-Modified of a row sent as the client asked for it
+// Picked fields change the body but not the version, so it's hashed instead, and embedded resources change on their own
+func (set fieldSet) validators(version int64, updatedAt time.Time) (etag string, lastModified time.Time) {
+	if !set.active() {
+		return versionETag(version), updatedAt
+	}
+	if len(set.includes) > 0 {
+		return "", time.Time{}
+	}
+	return "", updatedAt
+}
+
+// The resource with only the picked fields, and the related resources under their relation's name
+// The plain value is sent back when nothing was picked, so the usual responses aren't re-encoded
+func (set fieldSet) render(value interface{}, embedded map[string]interface{}) (interface{}, error) {
+	if !set.active() {
+		return value, nil
+	}
+	row, err := pickFields(value, set.fields)
+	if err != nil {
+		return nil, err
+	}
+	for relation, related := range embedded {
+		if row[relation], err = pickRelated(related, set.nested[relation]); err != nil {
+			return nil, err
+		}
+	}
+	return row, nil
+}
+
+// The JSON object of the value with only the fields, every field if empty
+func pickFields(value interface{}, fields map[string]bool) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var row map[string]json.RawMessage
+	if err := json.Unmarshal(data, &row); err != nil {
+		return nil, err
+	}
+	if len(fields) > 0 {
+		for name := range row {
+			if !fields[name] {
+				delete(row, name)
+			}
+		}
+	}
+	return row, nil
+}
+
+// An embedded resource, or list of them, with only the fields
+func pickRelated(related interface{}, fields map[string]bool) (json.RawMessage, error) {
+	if len(fields) == 0 {
+		return json.Marshal(related)
+	}
+	switch value := reflect.ValueOf(related); value.Kind() {
+	case reflect.Slice:
+		rows := make([]map[string]json.RawMessage, value.Len())
+		for i := range rows {
+			row, err := pickFields(value.Index(i).Interface(), fields)
+			if err != nil {
+				return nil, err
+			}
+			rows[i] = row
+		}
+		related = rows
+	case reflect.Ptr:
+		if !value.IsNil() {
+			row, err := pickFields(related, fields)
+			if err != nil {
+				return nil, err
+			}
+			related = row
+		}
+	}
+	return json.Marshal(related)
+}
+
+/**** EMBEDDED RESOURCES ****/
+
+// The users as the client asked for them, the orders of all of them are read with one query
+// Only the first DEFAULT_PAGE_SIZE orders of each user are embedded, a page of big customers would be too large otherwise
+func (server *Server) renderUsers(ctx context.Context, set fieldSet, users []sqlc.User) ([]interface{}, error) {
+	var ordersOf map[string][]sqlc.Order
+	if set.includes["orders"] && len(users) > 0 {
+		usernames := make([]string, len(users))
+		for i, user := range users {
+			usernames[i] = user.Username
+		}
+		orders, err := server.store.ListFirstOrdersByUsernames(ctx, usernames, server.config.DefaultPageSize)
+		if err != nil {
+			return nil, err
+		}
+		ordersOf = map[string][]sqlc.Order{}
+		for _, order := range orders {
+			ordersOf[order.Username] = append(ordersOf[order.Username], order)
+		}
+	}
+
+	rendered := make([]interface{}, len(users))
+	for i, user := range users {
+		embedded := map[string]interface{}{}
+		if set.includes["orders"] {
+			orders := ordersOf[user.Username]
+			if orders == nil {
+				orders = []sqlc.Order{}
+			}
+			embedded["orders"] = orders
+		}
+		var err error
+		if rendered[i], err = set.render(user, embedded); err != nil {
+			return nil, err
+		}
+	}
+	return rendered, nil
+}
+
+// The orders as the client asked for them, the users of all of them are read with one query
+func (server *Server) renderOrders(ctx context.Context, set fieldSet, orders []sqlc.Order) ([]interface{}, error) {
+	var userOf map[string]*sqlc.User
+	if set.includes["user"] && len(orders) > 0 {
+		usernames := []string{}
+		seen := map[string]bool{}
+		for _, order := range orders {
+			if !seen[order.Username] {
+				seen[order.Username] = true
+				usernames = append(usernames, order.Username)
+			}
+		}
+		users, err := server.store.ListUsersByUsernames(ctx, usernames)
+		if err != nil {
+			return nil, err
+		}
+		userOf = map[string]*sqlc.User{}
+		for i := range users {
+			userOf[users[i].Username] = &users[i]
+		}
+	}
+
+	rendered := make([]interface{}, len(orders))
+	for i, order := range orders {
+		embedded := map[string]interface{}{}
+		if set.includes["user"] {
+			embedded["user"] = userOf[order.Username] // null if the user is gone
+		}
+		var err error
+		if rendered[i], err = set.render(order, embedded); err != nil {
+			return nil, err
+		}
+	}
+	return rendered, nil
+}
+
+/**** HELPERS ****/
+
+// JSON names of the struct's fields, in order, without the ones that are never sent
+func jsonFieldNames(value interface{}) []string {
+	t := reflect.TypeOf(value)
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		if name, ok := fieldName(t.Field(i), "json"); ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func relationNames(relations map[string]relation) []string {
+	names := make([]string, 0, len(relations))
+	for name := range relations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Comma separated values without spaces and empty ones
+func splitParam(param string) []string {
+	var values []string
+	for _, value := range strings.Split(param, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
@@ -0,0 +1,144 @@
+// Unit tests for sparse fieldsets and embedded relations, the parts that don't need the DB
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	sqlc "github.com/samanthatb1/beadBashStorage/db/sqlc"
+	"github.com/samanthatb1/beadBashStorage/util"
+	"github.com/stretchr/testify/require"
+)
+
+/* Helper Functions */
+
+func renderJSON(t *testing.T, value interface{}) string {
+	data, err := json.Marshal(value)
+	require.NoError(t, err)
+	return string(data)
+}
+
+/* Test Functions */
+
+// Test Scenario: fields and include are checked against the resource
+func TestFieldSet(t *testing.T){
+	testCases := []struct {
+		name    string
+		req     fieldsRequest
+		valid   bool
+	}{
+		{"Empty", fieldsRequest{}, true},
+		{"Fields", fieldsRequest{Fields: "order_id, purchase_amount,,currency"}, true},
+		{"Include", fieldsRequest{Include: "user"}, true},
+		{"NestedFields", fieldsRequest{Fields: "order_id,user.username", Include: "user"}, true},
+		{"UnknownField", fieldsRequest{Fields: "order_id,secret"}, false},
+		{"NeverSentField", fieldsRequest{Fields: "full_name_bidx"}, false},
+		{"UnknownInclude", fieldsRequest{Include: "tags"}, false},
+		{"NestedNotIncluded", fieldsRequest{Fields: "user.username"}, false},
+		{"UnknownNestedField", fieldsRequest{Fields: "user.hashed_password", Include: "user"}, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := tc.req.fieldSet(orderFields, orderRelations)
+			if tc.valid {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
+
+// Test Scenario: only the picked fields are sent, embedded resources keep theirs
+func TestFieldSetRender(t *testing.T){
+	order := sqlc.Order{OrderID: 4, Username: "jane", PurchaseAmount: 12.5, Currency: "CAD"}
+	user := &sqlc.User{ID: 2, Username: "jane", TotalOrders: 3}
+
+	set, err := fieldsRequest{}.fieldSet(orderFields, orderRelations)
+	require.NoError(t, err)
+	plain, err := set.render(order, nil)
+	require.NoError(t, err)
+	require.Equal(t, order, plain) // Untouched
+
+	set, err = fieldsRequest{Fields: "order_id,currency"}.fieldSet(orderFields, orderRelations)
+	require.NoError(t, err)
+	picked, err := set.render(order, nil)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"order_id": 4, "currency": "CAD"}`, renderJSON(t, picked))
+
+	set, err = fieldsRequest{Fields: "order_id,user.username,user.total_orders", Include: "user"}.fieldSet(orderFields, orderRelations)
+	require.NoError(t, err)
+	embedded, err := set.render(order, map[string]interface{}{"user": user})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"order_id": 4, "user": {"username": "jane", "total_orders": 3}}`, renderJSON(t, embedded))
+
+	missing, err := set.render(order, map[string]interface{}{"user": (*sqlc.User)(nil)})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"order_id": 4, "user": null}`, renderJSON(t, missing))
+
+	set, err = fieldsRequest{Fields: "username,orders.order_id", Include: "orders"}.fieldSet(userFields, userRelations)
+	require.NoError(t, err)
+	withOrders, err := set.render(*user, map[string]interface{}{"orders": []sqlc.Order{order, {OrderID: 5}}})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"username": "jane", "orders": [{"order_id": 4}, {"order_id": 5}]}`, renderJSON(t, withOrders))
+}
+
+// Test Scenario: bad fields and include are rejected before the DB is used
+func TestFieldSetParams(t *testing.T){
+	server := newTestServer(t)
+	tokenMaker, err := newTestTokenMaker()
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name string
+		url  string
+	}{
+		{"UserField", "/users/" + testCustomer + "?fields=password"},
+		{"UserInclude", "/users/all?include=user"},
+		{"OrderField", "/v2/orders?fields=order_id,price"},
+		{"OrderInclude", "/orders/all?include=orders"},
+		{"NestedNotIncluded", "/orders/all?fields=user.username"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodGet, tc.url, nil)
+			addAuthorization(t, request, tokenMaker, testCustomer, util.AdminRole)
+			server.router.ServeHTTP(recorder, request)
+			require.Equal(t, http.StatusBadRequest, recorder.Code)
+		})
+	}
+}
+
+// Test Scenario: API keys can only embed resources their scopes can read
+func TestBindFieldSetApiKey(t *testing.T){
+	testCases := []struct {
+		name   string
+		scopes []string
+		status int
+	}{
+		{"UsersRead", []string{util.OrdersReadScope, util.UsersReadScope}, http.StatusOK},
+		{"OrdersOnly", []string{util.OrdersReadScope}, http.StatusForbidden},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			ctx, _ := gin.CreateTestContext(recorder)
+			ctx.Request = httptest.NewRequest(http.MethodGet, "/v2/orders?include=user", nil)
+			ctx.Set(authorizationApiKeyKey, sqlc.ApiKey{Name: "storefront", Scopes: tc.scopes})
+
+			_, ok := bindFieldSet(ctx, fieldsRequest{Include: "user"}, orderFields, orderRelations)
+			require.Equal(t, tc.status == http.StatusOK, ok)
+			if !ok {
+				require.Equal(t, tc.status, recorder.Code)
+			}
+		})
+	}
+}
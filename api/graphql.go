@@ -0,0 +1,150 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/graphql-go/graphql"
+	db "github.com/samanthatb1/beadBashStorage/db/sqlc"
+	"github.com/samanthatb1/beadBashStorage/util"
+)
+
+// DB operations the GraphQL API uses, *db.Store in production and a fake in the tests
+type graphStore interface {
+	GetUserById(ctx context.Context, id int64) (db.User, error)
+	GetUserByUsername(ctx context.Context, username string) (db.User, error)
+	GetOrderById(ctx context.Context, orderID int64) (db.Order, error)
+	ListUsersPage(ctx context.Context, filter db.UserFilter, params db.PageParams) (db.UserPage, error)
+	ListOrdersPage(ctx context.Context, filter db.OrderFilter, params db.PageParams) (db.OrderPage, error)
+	ListUsersByUsernames(ctx context.Context, usernames []string) ([]db.User, error)
+	ListFirstOrdersByUsernames(ctx context.Context, usernames []string, maxPerUser int32) ([]db.Order, error)
+	NewOrderTx(ctx context.Context, args db.NewOrderTxParams) (db.NewOrderTxResult, error)
+	DeleteOrderTx(ctx context.Context, args db.DeleteOrderTxParams) (db.DeleteOrderTxResult, error)
+}
+
+// Runs GraphQL requests against the schema, after checking they aren't too expensive
+type graphQLAPI struct {
+	schema graphql.Schema
+	store graphStore
+	config util.Config // Depth and complexity limits
+}
+
+func newGraphQLAPI(config util.Config, store graphStore) (*graphQLAPI, error) {
+	schema, err := newGraphQLSchema(config, store)
+	if err != nil {
+		return nil, err
+	}
+	return &graphQLAPI{schema: schema, store: store, config: config}, nil
+}
+
+/**** Data Loaders ****/
+
+// Loaders of one request, so nested fields cost one query per level instead of one per parent
+type graphLoaders struct {
+	store        graphStore
+	ordersOfUser map[int32]*dataLoader // Orders by username, one loader per page size so the DB only reads that many
+	users        *dataLoader           // Users by username
+}
+
+type graphLoadersKey struct{}
+
+func (api *graphQLAPI) newLoaders() *graphLoaders {
+	return &graphLoaders{
+		store: api.store,
+		ordersOfUser: map[int32]*dataLoader{},
+		users: newDataLoader(func(ctx context.Context, usernames []string) (map[string]interface{}, error) {
+			users, err := api.store.ListUsersByUsernames(ctx, usernames)
+			if err != nil {
+				return nil, err
+			}
+			values := map[string]interface{}{}
+			for _, user := range users {
+				values[user.Username] = user
+			}
+			return values, nil
+		}),
+	}
+}
+
+// Loader of the first orders of users, shared by every orders field asking for the same number
+func (loaders *graphLoaders) ordersOfUserLoader(first int32) *dataLoader {
+	if loader, ok := loaders.ordersOfUser[first]; ok {
+		return loader
+	}
+	loader := newDataLoader(func(ctx context.Context, usernames []string) (map[string]interface{}, error) {
+		orders, err := loaders.store.ListFirstOrdersByUsernames(ctx, usernames, first)
+		if err != nil {
+			return nil, err
+		}
+		values := map[string]interface{}{}
+		for _, order := range orders {
+			userOrders, _ := values[order.Username].([]db.Order)
+			values[order.Username] = append(userOrders, order)
+		}
+		return values, nil
+	})
+	loaders.ordersOfUser[first] = loader
+	return loader
+}
+
+func graphLoadersFrom(ctx context.Context) *graphLoaders {
+	return ctx.Value(graphLoadersKey{}).(*graphLoaders)
+}
+
+/**** Execution ****/
+
+type graphQLRequest struct {
+	Query         string                 `json:"query" binding:"required"`
+	OperationName string                 `json:"operationName"`
+	Variables     map[string]interface{} `json:"variables"`
+}
+
+// Runs the request, errors are for requests that were rejected before they ran
+// Limits of 0 are turned off
+func (api *graphQLAPI) execute(ctx context.Context, req graphQLRequest) (*graphql.Result, error) {
+	cost, err := measureQuery(req.Query, req.OperationName, req.Variables, int(api.config.DefaultPageSize))
+	if err != nil {
+		return nil, err
+	}
+	if api.config.GraphQLMaxDepth > 0 && cost.depth > api.config.GraphQLMaxDepth {
+		return nil, fmt.Errorf("query is %d levels deep, the limit is %d", cost.depth, api.config.GraphQLMaxDepth)
+	}
+	if api.config.GraphQLMaxComplexity > 0 && cost.complexity > api.config.GraphQLMaxComplexity {
+		return nil, fmt.Errorf("query complexity is %d, the limit is %d, ask for fewer fields or smaller pages", cost.complexity, api.config.GraphQLMaxComplexity)
+	}
+
+	return graphql.Do(graphql.Params{
+		Schema: api.schema,
+		RequestString: req.Query,
+		VariableValues: req.Variables,
+		OperationName: req.OperationName,
+		Context: context.WithValue(ctx, graphLoadersKey{}, api.newLoaders()),
+	}), nil
+}
+
+// Add graphQLQuery function to the server instance
+func (server *Server) graphQLQuery(ctx *gin.Context){
+	var reqBody graphQLRequest
+
+	// If params are invalid
+	if err := ctx.ShouldBindJSON(&reqBody); err != nil {
+		ctx.JSON(http.StatusBadRequest, graphQLErrors(err))
+		return
+	}
+
+	result, err := server.graphQL.execute(ctx, reqBody)
+	if err != nil { // Parse errors and requests over the limits
+		ctx.JSON(http.StatusBadRequest, graphQLErrors(err))
+		return
+	}
+
+	// Errors of single fields come back next to the data, like every GraphQL server
+	ctx.JSON(http.StatusOK, result)
+}
+
+// Error body in the shape GraphQL clients expect
+func graphQLErrors(err error) gin.H {
+	return gin.H{"errors": []gin.H{{"message": err.Error()}}}
+}
@@ -0,0 +1,217 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+)
+
+// Fields that return a list, their selection is paid for once per item
+// The items are the field's `first` argument, or the default page size without it
+var graphQLListFields = map[string]bool{
+	"users":  true, // Query.users
+	"orders": true, // Query.orders and User.orders
+}
+
+// How much work a GraphQL request asks for, checked before it runs
+type queryCost struct {
+	complexity int // Every field costs 1, list fields multiply the cost of their selection
+	depth      int // Deepest nesting of selections
+}
+
+// Walks the operation the request runs, fragments are counted wherever they are spread
+type costWalker struct {
+	fragments       map[string]*ast.FragmentDefinition
+	variables       map[string]interface{}
+	defaultListSize int
+	spreading       map[string]bool // Fragments being walked, to catch fragments that spread themselves
+	fragmentCosts   map[fragmentAt]queryCost // Fragments already walked, so spreading one many times doesn't walk it again
+}
+
+// A fragment spread at a depth, its cost only depends on the two
+type fragmentAt struct {
+	name  string
+	depth int
+}
+
+// Measures the operation of the request
+// Errors are for requests that can't be parsed, graphql-go reports the rest when it validates the request
+func measureQuery(query string, operationName string, variables map[string]interface{}, defaultListSize int) (queryCost, error) {
+	document, err := parser.Parse(parser.ParseParams{Source: query})
+	if err != nil {
+		return queryCost{}, err
+	}
+
+	walker := &costWalker{
+		fragments: map[string]*ast.FragmentDefinition{},
+		variables: variables,
+		defaultListSize: defaultListSize,
+		spreading: map[string]bool{},
+		fragmentCosts: map[fragmentAt]queryCost{},
+	}
+	var operations []*ast.OperationDefinition
+	for _, definition := range document.Definitions {
+		switch definition := definition.(type) {
+		case *ast.OperationDefinition:
+			operations = append(operations, definition)
+		case *ast.FragmentDefinition:
+			walker.fragments[definition.Name.Value] = definition
+		}
+	}
+
+	operation, err := pickOperation(operations, operationName)
+	if err != nil {
+		return queryCost{}, err
+	}
+	return walker.selectionSet(operation.SelectionSet, 1)
+}
+
+// The operation graphql-go will run
+func pickOperation(operations []*ast.OperationDefinition, operationName string) (*ast.OperationDefinition, error) {
+	if operationName == "" {
+		if len(operations) != 1 {
+			return nil, errors.New("operationName is required when the query has more than one operation")
+		}
+		return operations[0], nil
+	}
+	for _, operation := range operations {
+		if operation.Name != nil && operation.Name.Value == operationName {
+			return operation, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown operation %s", operationName)
+}
+
+// Cost of the selections, depth is the level they're at
+func (walker *costWalker) selectionSet(set *ast.SelectionSet, depth int) (queryCost, error) {
+	cost := queryCost{depth: depth - 1} // An empty selection doesn't add a level
+	if set == nil {
+		return cost, nil
+	}
+
+	for _, selection := range set.Selections {
+		var selectionCost queryCost
+		var err error
+		switch selection := selection.(type) {
+		case *ast.Field:
+			selectionCost, err = walker.field(selection, depth)
+		case *ast.InlineFragment:
+			selectionCost, err = walker.selectionSet(selection.SelectionSet, depth)
+		case *ast.FragmentSpread:
+			selectionCost, err = walker.fragmentSpread(selection, depth)
+		}
+		if err != nil {
+			return cost, err
+		}
+
+		cost.complexity = addCost(cost.complexity, selectionCost.complexity)
+		if selectionCost.depth > cost.depth {
+			cost.depth = selectionCost.depth
+		}
+	}
+	return cost, nil
+}
+
+func (walker *costWalker) field(field *ast.Field, depth int) (queryCost, error) {
+	name := field.Name.Value
+	if strings.HasPrefix(name, "__") { // Introspection is cheap and nests deeply, count the field only
+		return queryCost{complexity: 1, depth: depth}, nil
+	}
+
+	children, err := walker.selectionSet(field.SelectionSet, depth+1) // At least this field's depth
+	if err != nil {
+		return queryCost{}, err
+	}
+
+	if graphQLListFields[name] {
+		children.complexity = multiplyCost(children.complexity, walker.listSize(field))
+	}
+	children.complexity = addCost(children.complexity, 1)
+	return children, nil
+}
+
+func (walker *costWalker) fragmentSpread(spread *ast.FragmentSpread, depth int) (queryCost, error) {
+	name := spread.Name.Value
+	fragment, ok := walker.fragments[name]
+	if !ok {
+		return queryCost{}, fmt.Errorf("unknown fragment %s", name)
+	}
+	if walker.spreading[name] {
+		return queryCost{}, fmt.Errorf("fragment %s spreads itself", name)
+	}
+	if cost, ok := walker.fragmentCosts[fragmentAt{name, depth}]; ok {
+		return cost, nil
+	}
+
+	walker.spreading[name] = true
+	defer delete(walker.spreading, name)
+	cost, err := walker.selectionSet(fragment.SelectionSet, depth)
+	if err == nil {
+		walker.fragmentCosts[fragmentAt{name, depth}] = cost
+	}
+	return cost, err
+}
+
+// Items a list field can return, from its `first` argument
+func (walker *costWalker) listSize(field *ast.Field) int {
+	for _, argument := range field.Arguments {
+		if argument.Name.Value != "first" {
+			continue
+		}
+		switch value := argument.Value.(type) {
+		case *ast.IntValue:
+			if n, err := strconv.Atoi(value.Value); err == nil && n > 0 {
+				return n
+			}
+		case *ast.Variable:
+			if n, ok := variableInt(walker.variables[value.Name.Value]); ok && n > 0 {
+				return n
+			}
+		}
+	}
+	return walker.defaultListSize
+}
+
+// Variables are decoded from JSON, so numbers are float64 or json.Number
+func variableInt(value interface{}) (int, bool) {
+	switch value := value.(type) {
+	case float64:
+		if value > math.MaxInt32 {
+			return math.MaxInt32, true
+		}
+		return int(value), true
+	case json.Number:
+		n, err := value.Int64()
+		if err != nil {
+			return 0, false
+		}
+		if n > math.MaxInt32 {
+			return math.MaxInt32, true
+		}
+		return int(n), true
+	case int:
+		return value, true
+	}
+	return 0, false
+}
+
+// Costs stop growing at MaxInt32, far over any limit, so nested lists can't overflow
+func addCost(a int, b int) int {
+	if a+b > math.MaxInt32 {
+		return math.MaxInt32
+	}
+	return a + b
+}
+
+func multiplyCost(a int, b int) int {
+	if b != 0 && a > math.MaxInt32/b {
+		return math.MaxInt32
+	}
+	return a * b
+}
@@ -0,0 +1,464 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/graphql-go/graphql"
+	db "github.com/samanthatb1/beadBashStorage/db/sqlc"
+	"github.com/samanthatb1/beadBashStorage/token"
+	"github.com/samanthatb1/beadBashStorage/util"
+)
+
+// Builds the GraphQL schema, resolvers read and write through the store
+func newGraphQLSchema(config util.Config, store graphStore) (graphql.Schema, error) {
+	resolver := &graphQLResolver{config: config, store: store}
+
+	currencyEnum := graphql.NewEnum(graphql.EnumConfig{
+		Name: "Currency",
+		Values: graphql.EnumValueConfigMap{
+			"USD": &graphql.EnumValueConfig{Value: "USD"},
+			"EUR": &graphql.EnumValueConfig{Value: "EUR"},
+			"CAD": &graphql.EnumValueConfig{Value: "CAD"},
+		},
+	})
+
+	/**** Types ****/
+	userType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "User",
+		Fields: graphql.Fields{
+			"id":          userField(graphql.NewNonNull(graphql.ID), func(user db.User) interface{} { return user.ID }),
+			"username":    userField(graphql.NewNonNull(graphql.String), func(user db.User) interface{} { return user.Username }),
+			"fullName":    userField(graphql.NewNonNull(graphql.String), func(user db.User) interface{} { return user.FullName }),
+			"totalOrders": userField(graphql.NewNonNull(graphql.Int), func(user db.User) interface{} { return user.TotalOrders }),
+			"role":        userField(graphql.NewNonNull(graphql.String), func(user db.User) interface{} { return user.Role }),
+			"version":     userField(graphql.NewNonNull(graphql.Int), func(user db.User) interface{} { return user.Version }),
+			"createdAt":   userField(graphql.NewNonNull(graphql.DateTime), func(user db.User) interface{} { return user.CreatedAt }),
+			"erasedAt": userField(graphql.DateTime, func(user db.User) interface{} {
+				if !user.ErasedAt.Valid {
+					return nil
+				}
+				return user.ErasedAt.Time
+			}),
+		},
+	})
+
+	orderType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Order",
+		Fields: graphql.Fields{
+			"id":               orderField(graphql.NewNonNull(graphql.ID), func(order db.Order) interface{} { return order.OrderID }),
+			"username":         orderField(graphql.NewNonNull(graphql.String), func(order db.Order) interface{} { return order.Username }),
+			"fullName":         orderField(graphql.NewNonNull(graphql.String), func(order db.Order) interface{} { return order.FullName }),
+			"purchaseAmount":   orderField(graphql.NewNonNull(graphql.Float), func(order db.Order) interface{} { return order.PurchaseAmount }),
+			"purchasedItem":    orderField(graphql.NewNonNull(graphql.String), func(order db.Order) interface{} { return order.PurchasedItem }),
+			"shippingLocation": orderField(graphql.NewNonNull(graphql.String), func(order db.Order) interface{} { return order.ShippingLocation }),
+			"currency":         orderField(graphql.NewNonNull(currencyEnum), func(order db.Order) interface{} { return order.Currency }),
+			"dateOrdered":      orderField(graphql.NewNonNull(graphql.String), func(order db.Order) interface{} { return order.DateOrdered }),
+			"version":          orderField(graphql.NewNonNull(graphql.Int), func(order db.Order) interface{} { return order.Version }),
+			"createdAt":        orderField(graphql.NewNonNull(graphql.DateTime), func(order db.Order) interface{} { return order.CreatedAt }),
+		},
+	})
+
+	// Nested fields, added once both types exist
+	userType.AddFieldConfig("orders", &graphql.Field{
+		Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(orderType))),
+		Description: "Oldest orders first, loaded for every user of the response in one query",
+		Args: graphql.FieldConfigArgument{
+			"first": &graphql.ArgumentConfig{Type: graphql.Int, Description: "Defaults to DEFAULT_PAGE_SIZE"},
+		},
+		Resolve: resolver.ordersOfUser,
+	})
+	orderType.AddFieldConfig("customer", &graphql.Field{
+		Type: userType, // null once the customer's account is gone
+		Description: "Loaded for every order of the response in one query",
+		Resolve: resolver.customerOfOrder,
+	})
+
+	userPageType := pageType("UserPage", userType)
+	orderPageType := pageType("OrderPage", orderType)
+
+	/**** Queries ****/
+	pageArgs := func(extra graphql.FieldConfigArgument) graphql.FieldConfigArgument {
+		args := graphql.FieldConfigArgument{
+			"first": &graphql.ArgumentConfig{Type: graphql.Int, Description: "Page size, defaults to DEFAULT_PAGE_SIZE"},
+			"after": &graphql.ArgumentConfig{Type: graphql.String, Description: "nextCursor of the previous page"},
+			"sort":  &graphql.ArgumentConfig{Type: graphql.String, DefaultValue: "id"},
+			"desc":  &graphql.ArgumentConfig{Type: graphql.Boolean, DefaultValue: false},
+			"tag":   &graphql.ArgumentConfig{Type: graphql.String},
+		}
+		for name, arg := range extra {
+			args[name] = arg
+		}
+		return args
+	}
+
+	queryType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"user": &graphql.Field{
+				Type: userType,
+				Description: "User by id or username",
+				Args: graphql.FieldConfigArgument{
+					"id":       &graphql.ArgumentConfig{Type: graphql.ID},
+					"username": &graphql.ArgumentConfig{Type: graphql.String},
+				},
+				Resolve: resolver.user,
+			},
+			"users": &graphql.Field{
+				Type: graphql.NewNonNull(userPageType),
+				Description: "Sorted by id, date or name",
+				Args: pageArgs(nil),
+				Resolve: resolver.users,
+			},
+			"order": &graphql.Field{
+				Type: orderType,
+				Args: graphql.FieldConfigArgument{
+					"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				},
+				Resolve: resolver.order,
+			},
+			"orders": &graphql.Field{
+				Type: graphql.NewNonNull(orderPageType),
+				Description: "Sorted by id, date, amount or name",
+				Args: pageArgs(graphql.FieldConfigArgument{
+					"username": &graphql.ArgumentConfig{Type: graphql.String},
+					"currency": &graphql.ArgumentConfig{Type: currencyEnum},
+				}),
+				Resolve: resolver.orders,
+			},
+		},
+	})
+
+	/**** Mutations ****/
+	createOrderInput := graphql.NewInputObject(graphql.InputObjectConfig{
+		Name: "CreateOrderInput",
+		Fields: graphql.InputObjectConfigFieldMap{
+			"username":         &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"fullName":         &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"purchaseAmount":   &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.Float)},
+			"purchasedItem":    &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"shippingLocation": &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+			"currency":         &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(currencyEnum)},
+			"dateOrdered":      &graphql.InputObjectFieldConfig{Type: graphql.NewNonNull(graphql.String)},
+		},
+	})
+
+	createOrderPayload := graphql.NewObject(graphql.ObjectConfig{
+		Name: "CreateOrderPayload",
+		Fields: graphql.Fields{
+			"user": &graphql.Field{
+				Type: graphql.NewNonNull(userType),
+				Description: "The order's customer, created if they didn't have an account",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(db.NewOrderTxResult).EditedUser, nil
+				},
+			},
+			"order": &graphql.Field{
+				Type: graphql.NewNonNull(orderType),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(db.NewOrderTxResult).OrderMade, nil
+				},
+			},
+		},
+	})
+
+	deleteOrderPayload := graphql.NewObject(graphql.ObjectConfig{
+		Name: "DeleteOrderPayload",
+		Fields: graphql.Fields{
+			"status": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.String),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(db.DeleteOrderTxResult).Status, nil
+				},
+			},
+			"deletedItem": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.String),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(db.DeleteOrderTxResult).DeletedItem, nil
+				},
+			},
+		},
+	})
+
+	mutationType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"createOrder": &graphql.Field{
+				Type: graphql.NewNonNull(createOrderPayload),
+				Description: "Same as POST /v2/orders",
+				Args: graphql.FieldConfigArgument{
+					"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(createOrderInput)},
+				},
+				Resolve: resolver.createOrder,
+			},
+			"deleteOrder": &graphql.Field{
+				Type: graphql.NewNonNull(deleteOrderPayload),
+				Description: "Same as DELETE /v2/orders/:order_id",
+				Args: graphql.FieldConfigArgument{
+					"id":      &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+					"version": &graphql.ArgumentConfig{Type: graphql.Int, Description: "Only delete the order if it's still at this version"},
+				},
+				Resolve: resolver.deleteOrder,
+			},
+		},
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{
+		Query: queryType,
+		Mutation: mutationType,
+	})
+}
+
+/**** Type Helpers ****/
+
+func userField(fieldType graphql.Output, get func(db.User) interface{}) *graphql.Field {
+	return &graphql.Field{
+		Type: fieldType,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return get(p.Source.(db.User)), nil
+		},
+	}
+}
+
+func orderField(fieldType graphql.Output, get func(db.Order) interface{}) *graphql.Field {
+	return &graphql.Field{
+		Type: fieldType,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return get(p.Source.(db.Order)), nil
+		},
+	}
+}
+
+// A page of a list, resolved from a pageResponse
+func pageType(name string, itemType *graphql.Object) *graphql.Object {
+	return graphql.NewObject(graphql.ObjectConfig{
+		Name: name,
+		Fields: graphql.Fields{
+			"nodes": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(itemType))),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(pageResponse).Data, nil
+				},
+			},
+			"nextCursor": &graphql.Field{
+				Type: graphql.String,
+				Description: "null on the last page",
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if cursor := p.Source.(pageResponse).NextCursor; cursor != "" {
+						return cursor, nil
+					}
+					return nil, nil
+				},
+			},
+			"totalCount": &graphql.Field{
+				Type: graphql.NewNonNull(graphql.Int),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return p.Source.(pageResponse).TotalCount, nil
+				},
+			},
+		},
+	})
+}
+
+/**** Resolvers ****/
+
+type graphQLResolver struct {
+	config util.Config // Page sizes
+	store graphStore
+}
+
+func (resolver *graphQLResolver) user(p graphql.ResolveParams) (interface{}, error) {
+	var user db.User
+	var err error
+	if id, ok := p.Args["id"].(string); ok {
+		userId, parseErr := parseGraphQLID(id)
+		if parseErr != nil {
+			return nil, parseErr
+		}
+		user, err = resolver.store.GetUserById(p.Context, userId)
+	} else if username, ok := p.Args["username"].(string); ok {
+		user, err = resolver.store.GetUserByUsername(p.Context, username)
+	} else {
+		return nil, errors.New("id or username is required")
+	}
+
+	if err == sql.ErrNoRows { // null, like any missing object
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (resolver *graphQLResolver) users(p graphql.ResolveParams) (interface{}, error) {
+	params, err := resolver.pageParams(p.Args, db.IsUserSort)
+	if err != nil {
+		return nil, err
+	}
+	tag, _ := p.Args["tag"].(string)
+
+	page, err := resolver.store.ListUsersPage(p.Context, db.UserFilter{Tag: normalizeTag(tag)}, params)
+	if err != nil {
+		return nil, err
+	}
+	return newPageResponse(page.Users, params, page.Next, page.Total), nil
+}
+
+func (resolver *graphQLResolver) order(p graphql.ResolveParams) (interface{}, error) {
+	orderId, err := parseGraphQLID(p.Args["id"].(string))
+	if err != nil {
+		return nil, err
+	}
+
+	order, err := resolver.store.GetOrderById(p.Context, orderId)
+	if err == sql.ErrNoRows { // null, like any missing object
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+func (resolver *graphQLResolver) orders(p graphql.ResolveParams) (interface{}, error) {
+	params, err := resolver.pageParams(p.Args, db.IsOrderSort)
+	if err != nil {
+		return nil, err
+	}
+	filter := db.OrderFilter{}
+	filter.Username, _ = p.Args["username"].(string)
+	filter.Currency, _ = p.Args["currency"].(string)
+	tag, _ := p.Args["tag"].(string)
+	filter.Tag = normalizeTag(tag)
+
+	page, err := resolver.store.ListOrdersPage(p.Context, filter, params)
+	if err != nil {
+		return nil, err
+	}
+	return newPageResponse(page.Orders, params, page.Next, page.Total), nil
+}
+
+// Turns the page args of a list field into DB page params
+func (resolver *graphQLResolver) pageParams(args map[string]interface{}, isSort func(string) bool) (db.PageParams, error) {
+	sort, _ := args["sort"].(string)
+	if !isSort(sort) {
+		return db.PageParams{}, fmt.Errorf("can't sort by %s", sort)
+	}
+
+	req := pageRequest{}
+	req.Cursor, _ = args["after"].(string)
+	if desc, _ := args["desc"].(bool); desc {
+		req.Order = "desc"
+	}
+	if first, ok := args["first"].(int); ok {
+		if first < 1 {
+			return db.PageParams{}, errors.New("first must be at least 1")
+		}
+		req.PageSize = int32(first)
+	}
+	return newPageParams(resolver.config, req, sort)
+}
+
+func (resolver *graphQLResolver) ordersOfUser(p graphql.ResolveParams) (interface{}, error) {
+	first := int(resolver.config.DefaultPageSize)
+	if n, ok := p.Args["first"].(int); ok {
+		first = n
+	}
+	if first < 1 || first > int(resolver.config.MaxPageSize) {
+		return nil, fmt.Errorf("first must be between 1 and %d", resolver.config.MaxPageSize)
+	}
+
+	load := graphLoadersFrom(p.Context).ordersOfUserLoader(int32(first)).load(p.Context, p.Source.(db.User).Username)
+	return func() (interface{}, error) {
+		value, err := load()
+		if err != nil {
+			return nil, err
+		}
+		orders, _ := value.([]db.Order) // nil if the user has no orders
+		if orders == nil {
+			orders = []db.Order{}
+		}
+		return orders, nil
+	}, nil
+}
+
+func (resolver *graphQLResolver) customerOfOrder(p graphql.ResolveParams) (interface{}, error) {
+	return graphLoadersFrom(p.Context).users.load(p.Context, p.Source.(db.Order).Username), nil
+}
+
+func (resolver *graphQLResolver) createOrder(p graphql.ResolveParams) (interface{}, error) {
+	if err := authorizeMutation(p.Context, "POST /v2/orders"); err != nil {
+		return nil, err
+	}
+
+	input := p.Args["input"].(map[string]interface{})
+	args := db.NewOrderTxParams{
+		Username: input["username"].(string),
+		FullName: input["fullName"].(string),
+		PurchaseAmount: input["purchaseAmount"].(float64),
+		PurchasedItem: input["purchasedItem"].(string),
+		ShippingLocation: input["shippingLocation"].(string),
+		Currency: input["currency"].(string),
+		DateOrdered: input["dateOrdered"].(string),
+	}
+	if args.Username == "" || args.FullName == "" || args.PurchasedItem == "" || args.ShippingLocation == "" || args.DateOrdered == "" {
+		return nil, errors.New("username, fullName, purchasedItem, shippingLocation and dateOrdered can't be empty")
+	}
+	if args.PurchaseAmount <= 0 {
+		return nil, errors.New("purchaseAmount must be more than 0")
+	}
+	if err := util.CheckUsername(args.Username); err != nil {
+		return nil, err
+	}
+
+	return resolver.store.NewOrderTx(p.Context, args)
+}
+
+func (resolver *graphQLResolver) deleteOrder(p graphql.ResolveParams) (interface{}, error) {
+	if err := authorizeMutation(p.Context, "DELETE /v2/orders/:order_id"); err != nil {
+		return nil, err
+	}
+
+	orderId, err := parseGraphQLID(p.Args["id"].(string))
+	if err != nil {
+		return nil, err
+	}
+	args := db.DeleteOrderTxParams{OrderID: orderId}
+	if version, ok := p.Args["version"].(int); ok {
+		args.Versions = []int64{int64(version)}
+	}
+
+	result, err := resolver.store.DeleteOrderTx(p.Context, args)
+	if err == sql.ErrNoRows {
+		return nil, errors.New("order doesn't exist")
+	}
+	if err == db.ErrVersionMismatch {
+		return nil, errors.New("order was changed by someone else, fetch it again")
+	}
+	return result, err
+}
+
+// Mutations follow the policy of the REST route that does the same thing
+func authorizeMutation(ctx context.Context, route string) error {
+	payload, ok := ctx.Value(authorizationPayloadKey).(*token.Payload)
+	if !ok {
+		return errors.New("not logged in")
+	}
+	if !routePolicies[route].allowsRole(payload.Role) {
+		return fmt.Errorf("role %s is not allowed to %s", payload.Role, route)
+	}
+	return nil
+}
+
+// IDs are strings in GraphQL and numbers in the DB
+func parseGraphQLID(id string) (int64, error) {
+	n, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("invalid id %q", id)
+	}
+	return n, nil
+}
@@ -0,0 +1,368 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/graphql-go/graphql"
+	db "github.com/samanthatb1/beadBashStorage/db/sqlc"
+	"github.com/samanthatb1/beadBashStorage/token"
+	"github.com/samanthatb1/beadBashStorage/util"
+	"github.com/stretchr/testify/require"
+)
+
+/* Helper Functions */
+
+// Keeps users and orders in memory and records the batch queries
+type fakeGraphStore struct {
+	users         []db.User
+	orders        []db.Order
+	orderBatches  [][]string // Usernames of every ListFirstOrdersByUsernames call
+	orderLimits   []int32    // Orders per user asked for by every ListFirstOrdersByUsernames call
+	userBatches   [][]string // Usernames of every ListUsersByUsernames call
+	newOrderArgs  []db.NewOrderTxParams
+	deleteArgs    []db.DeleteOrderTxParams
+}
+
+func (store *fakeGraphStore) GetUserById(ctx context.Context, id int64) (db.User, error) {
+	for _, user := range store.users {
+		if user.ID == id {
+			return user, nil
+		}
+	}
+	return db.User{}, sql.ErrNoRows
+}
+
+func (store *fakeGraphStore) GetUserByUsername(ctx context.Context, username string) (db.User, error) {
+	for _, user := range store.users {
+		if user.Username == username {
+			return user, nil
+		}
+	}
+	return db.User{}, sql.ErrNoRows
+}
+
+func (store *fakeGraphStore) GetOrderById(ctx context.Context, orderID int64) (db.Order, error) {
+	for _, order := range store.orders {
+		if order.OrderID == orderID {
+			return order, nil
+		}
+	}
+	return db.Order{}, sql.ErrNoRows
+}
+
+func (store *fakeGraphStore) ListUsersPage(ctx context.Context, filter db.UserFilter, params db.PageParams) (db.UserPage, error) {
+	return db.UserPage{Users: store.users, Total: int64(len(store.users))}, nil
+}
+
+func (store *fakeGraphStore) ListOrdersPage(ctx context.Context, filter db.OrderFilter, params db.PageParams) (db.OrderPage, error) {
+	return db.OrderPage{Orders: store.orders, Total: int64(len(store.orders))}, nil
+}
+
+func (store *fakeGraphStore) ListUsersByUsernames(ctx context.Context, usernames []string) ([]db.User, error) {
+	store.userBatches = append(store.userBatches, sortedCopy(usernames))
+	users := []db.User{}
+	for _, user := range store.users {
+		if containsString(usernames, user.Username) {
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
+func (store *fakeGraphStore) ListFirstOrdersByUsernames(ctx context.Context, usernames []string, maxPerUser int32) ([]db.Order, error) {
+	store.orderBatches = append(store.orderBatches, sortedCopy(usernames))
+	store.orderLimits = append(store.orderLimits, maxPerUser)
+	orders := []db.Order{}
+	perUser := map[string]int32{}
+	for _, order := range store.orders {
+		if containsString(usernames, order.Username) && perUser[order.Username] < maxPerUser {
+			perUser[order.Username]++
+			orders = append(orders, order)
+		}
+	}
+	return orders, nil
+}
+
+func (store *fakeGraphStore) NewOrderTx(ctx context.Context, args db.NewOrderTxParams) (db.NewOrderTxResult, error) {
+	store.newOrderArgs = append(store.newOrderArgs, args)
+	return db.NewOrderTxResult{
+		EditedUser: db.User{ID: 9, Username: args.Username, FullName: args.FullName, TotalOrders: 1},
+		OrderMade: db.Order{OrderID: 99, Username: args.Username, PurchasedItem: args.PurchasedItem, Currency: args.Currency},
+	}, nil
+}
+
+func (store *fakeGraphStore) DeleteOrderTx(ctx context.Context, args db.DeleteOrderTxParams) (db.DeleteOrderTxResult, error) {
+	store.deleteArgs = append(store.deleteArgs, args)
+	order, err := store.GetOrderById(ctx, args.OrderID)
+	if err != nil {
+		return db.DeleteOrderTxResult{}, err
+	}
+	if len(args.Versions) > 0 && args.Versions[0] != order.Version {
+		return db.DeleteOrderTxResult{}, db.ErrVersionMismatch
+	}
+	return db.DeleteOrderTxResult{Status: "deleted", DeletedItem: order.PurchasedItem}, nil
+}
+
+func sortedCopy(values []string) []string {
+	sorted := append([]string{}, values...)
+	sort.Strings(sorted)
+	return sorted
+}
+
+// Three customers, the last one without orders
+func newFakeGraphStore() *fakeGraphStore {
+	return &fakeGraphStore{
+		users: []db.User{
+			{ID: 1, Username: "ann", Role: util.CustomerRole},
+			{ID: 2, Username: "bob", Role: util.CustomerRole},
+			{ID: 3, Username: "cat", Role: util.CustomerRole},
+		},
+		orders: []db.Order{
+			{OrderID: 1, Username: "ann", PurchasedItem: "seed beads", Currency: "USD", Version: 1},
+			{OrderID: 2, Username: "bob", PurchasedItem: "bugle beads", Currency: "CAD", Version: 1},
+			{OrderID: 3, Username: "ann", PurchasedItem: "wire", Currency: "USD", Version: 2},
+		},
+	}
+}
+
+func newTestGraphQLAPI(t *testing.T, store graphStore) *graphQLAPI {
+	api, err := newGraphQLAPI(util.Config{
+		DefaultPageSize: 20,
+		MaxPageSize: 100,
+		GraphQLMaxDepth: 6,
+		GraphQLMaxComplexity: 5000,
+	}, store)
+	require.NoError(t, err)
+	return api
+}
+
+// Context of a request from a logged in user with the role
+func graphQLContext(role string) context.Context {
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Set(authorizationPayloadKey, &token.Payload{Username: "staff", Role: role})
+	return ctx
+}
+
+func runGraphQL(t *testing.T, api *graphQLAPI, role string, query string, variables map[string]interface{}) *graphql.Result {
+	result, err := api.execute(graphQLContext(role), graphQLRequest{Query: query, Variables: variables})
+	require.NoError(t, err)
+	return result
+}
+
+// Query whose fragments each spread the next one twice, so fragment 0 spreads the last one 2^n times
+func nestedFragmentsQuery(n int) string {
+	var query strings.Builder
+	query.WriteString(`{ user(id: 1) { ...f0 } }`)
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&query, ` fragment f%d on User { ...f%d ...f%d }`, i, i+1, i+1)
+	}
+	fmt.Fprintf(&query, ` fragment f%d on User { username }`, n)
+	return query.String()
+}
+
+/* Test Functions */
+
+// Test Scenario: nested fields are loaded with one query per level, not one per parent
+func TestGraphQLBatchesNestedFields(t *testing.T){
+	store := newFakeGraphStore()
+	api := newTestGraphQLAPI(t, store)
+
+	result := runGraphQL(t, api, util.ReadOnlyRole, `{
+		users { totalCount nodes { username orders { id purchasedItem customer { username } } } }
+	}`, nil)
+	require.Empty(t, result.Errors)
+
+	// One query for the orders of every user, one for the customers of every order
+	require.Equal(t, [][]string{{"ann", "bob", "cat"}}, store.orderBatches)
+	require.Equal(t, [][]string{{"ann", "bob"}}, store.userBatches)
+
+	users := result.Data.(map[string]interface{})["users"].(map[string]interface{})
+	require.Equal(t, 3, users["totalCount"])
+	nodes := users["nodes"].([]interface{})
+	annOrders := nodes[0].(map[string]interface{})["orders"].([]interface{})
+	require.Len(t, annOrders, 2)
+	require.Equal(t, "1", annOrders[0].(map[string]interface{})["id"])
+	require.Equal(t, "ann", annOrders[1].(map[string]interface{})["customer"].(map[string]interface{})["username"])
+	require.Empty(t, nodes[2].(map[string]interface{})["orders"]) // Users without orders get an empty list
+}
+
+// Test Scenario: `first` limits the orders the DB reads for each user, fields asking for different numbers get their own query
+func TestGraphQLNestedOrdersFirst(t *testing.T){
+	store := newFakeGraphStore()
+	api := newTestGraphQLAPI(t, store)
+
+	result := runGraphQL(t, api, util.AdminRole, `{ user(username: "ann") { orders(first: 1) { id } } }`, nil)
+	require.Empty(t, result.Errors)
+	orders := result.Data.(map[string]interface{})["user"].(map[string]interface{})["orders"].([]interface{})
+	require.Len(t, orders, 1)
+	require.Equal(t, []int32{1}, store.orderLimits)
+
+	store.orderLimits = nil
+	result = runGraphQL(t, api, util.AdminRole, `{ user(username: "ann") { one: orders(first: 1) { id } all: orders { id } } }`, nil)
+	require.Empty(t, result.Errors)
+	user := result.Data.(map[string]interface{})["user"].(map[string]interface{})
+	require.Len(t, user["one"], 1)
+	require.Len(t, user["all"], 2)
+	require.ElementsMatch(t, []int32{1, 20}, store.orderLimits)
+
+	result = runGraphQL(t, api, util.AdminRole, `{ user(username: "ann") { orders(first: 101) { id } } }`, nil)
+	require.NotEmpty(t, result.Errors)
+}
+
+// Test Scenario: missing objects are null
+func TestGraphQLMissingObjects(t *testing.T){
+	api := newTestGraphQLAPI(t, newFakeGraphStore())
+
+	result := runGraphQL(t, api, util.AdminRole, `{ user(id: 42) { username } order(id: "42") { id } }`, nil)
+	require.Empty(t, result.Errors)
+	require.Nil(t, result.Data.(map[string]interface{})["user"])
+	require.Nil(t, result.Data.(map[string]interface{})["order"])
+}
+
+// Test Scenario: mutations need the roles of the REST route they match
+func TestGraphQLMutations(t *testing.T){
+	store := newFakeGraphStore()
+	api := newTestGraphQLAPI(t, store)
+
+	createOrder := `mutation($input: CreateOrderInput!) { createOrder(input: $input) { user { username } order { id currency } } }`
+	input := map[string]interface{}{"input": map[string]interface{}{
+		"username": "dee",
+		"fullName": "Dee Bead",
+		"purchaseAmount": 12.5,
+		"purchasedItem": "clasps",
+		"shippingLocation": "Toronto",
+		"currency": "CAD",
+		"dateOrdered": "2022-08-01",
+	}}
+
+	// Read only staff can't create orders
+	result := runGraphQL(t, api, util.ReadOnlyRole, createOrder, input)
+	require.NotEmpty(t, result.Errors)
+	require.Empty(t, store.newOrderArgs)
+
+	result = runGraphQL(t, api, util.FulfillmentRole, createOrder, input)
+	require.Empty(t, result.Errors)
+	require.Len(t, store.newOrderArgs, 1)
+	require.Equal(t, db.NewOrderTxParams{
+		Username: "dee",
+		FullName: "Dee Bead",
+		PurchaseAmount: 12.5,
+		PurchasedItem: "clasps",
+		ShippingLocation: "Toronto",
+		Currency: "CAD",
+		DateOrdered: "2022-08-01",
+	}, store.newOrderArgs[0])
+	order := result.Data.(map[string]interface{})["createOrder"].(map[string]interface{})["order"].(map[string]interface{})
+	require.Equal(t, "99", order["id"])
+	require.Equal(t, "CAD", order["currency"])
+
+	// Only admins delete orders
+	result = runGraphQL(t, api, util.FulfillmentRole, `mutation { deleteOrder(id: 2) { status } }`, nil)
+	require.NotEmpty(t, result.Errors)
+	require.Empty(t, store.deleteArgs)
+
+	result = runGraphQL(t, api, util.AdminRole, `mutation { deleteOrder(id: 2, version: 5) { status } }`, nil)
+	require.Equal(t, "order was changed by someone else, fetch it again", result.Errors[0].Message)
+
+	result = runGraphQL(t, api, util.AdminRole, `mutation { deleteOrder(id: 2, version: 1) { status deletedItem } }`, nil)
+	require.Empty(t, result.Errors)
+	require.Equal(t, "bugle beads", result.Data.(map[string]interface{})["deleteOrder"].(map[string]interface{})["deletedItem"])
+	require.Equal(t, db.DeleteOrderTxParams{OrderID: 2, Versions: []int64{1}}, store.deleteArgs[len(store.deleteArgs)-1])
+}
+
+// Test Scenario: every field costs 1 and list fields multiply their selection by their page size
+func TestMeasureQuery(t *testing.T){
+	testCases := []struct {
+		name       string
+		query      string
+		variables  map[string]interface{}
+		complexity int
+		depth      int
+	}{
+		{"single field", `{ user(id: 1) { username } }`, nil, 2, 2},
+		{"default page size", `{ users { nodes { id } } }`, nil, 1 + 20*2, 3},
+		{"first", `{ users(first: 5) { nodes { id orders(first: 3) { id } } } }`, nil, 1 + 5*(1+1+(1+3*1)), 4},
+		{"first from a variable", `query($n: Int) { users(first: $n) { totalCount } }`, map[string]interface{}{"n": float64(10)}, 1 + 10*1, 2},
+		{"fragments", `{ user(id: 1) { ...names } } fragment names on User { username fullName }`, nil, 3, 2},
+		{"introspection", `{ __schema { types { name fields { name type { ofType { name } } } } } }`, nil, 1, 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cost, err := measureQuery(tc.query, "", tc.variables, 20)
+			require.NoError(t, err)
+			require.Equal(t, tc.complexity, cost.complexity)
+			require.Equal(t, tc.depth, cost.depth)
+		})
+	}
+
+	// Walked once per fragment, not 2^30 times
+	cost, err := measureQuery(nestedFragmentsQuery(30), "", nil, 20)
+	require.NoError(t, err)
+	require.Equal(t, 1+1<<30, cost.complexity)
+
+	_, err = measureQuery(`{ user(id: 1) { ...a } } fragment a on User { ...a }`, "", nil, 20)
+	require.Error(t, err)
+	_, err = measureQuery(`query A { users { totalCount } } query B { orders { totalCount } }`, "", nil, 20)
+	require.Error(t, err)
+	_, err = measureQuery(`{ users {`, "", nil, 20)
+	require.Error(t, err)
+}
+
+// Test Scenario: queries over the depth or complexity limits don't run
+func TestGraphQLLimits(t *testing.T){
+	store := newFakeGraphStore()
+	api := newTestGraphQLAPI(t, store)
+
+	_, err := api.execute(graphQLContext(util.AdminRole), graphQLRequest{
+		Query: `{ users(first: 100) { nodes { orders(first: 100) { id } } } }`,
+	})
+	require.ErrorContains(t, err, "complexity")
+
+	_, err = api.execute(graphQLContext(util.AdminRole), graphQLRequest{
+		Query: `{ orders(first: 1) { nodes { customer { orders(first: 1) { customer { orders(first: 1) { id } } } } } } }`,
+	})
+	require.ErrorContains(t, err, "levels deep")
+	require.Empty(t, store.orderBatches)
+
+	_, err = api.execute(graphQLContext(util.AdminRole), graphQLRequest{Query: nestedFragmentsQuery(30)})
+	require.ErrorContains(t, err, "complexity")
+}
+
+// Test Scenario: the route runs queries for staff and rejects bad queries before they run
+func TestGraphQLRoute(t *testing.T){
+	server := newTestServer(t)
+	tokenMaker, err := newTestTokenMaker()
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name   string
+		role   string
+		body   string
+		status int
+	}{
+		{"query", util.ReadOnlyRole, `{"query": "{ __typename }", "variables": null}`, http.StatusOK},
+		{"customer", util.CustomerRole, `{"query": "{ __typename }"}`, http.StatusForbidden},
+		{"missing query", util.AdminRole, `{"variables": {}}`, http.StatusBadRequest},
+		{"syntax error", util.AdminRole, `{"query": "{ users {"}`, http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(tc.body))
+			request.Header.Set("Content-Type", "application/json")
+			addAuthorization(t, request, tokenMaker, testCustomer, tc.role)
+			server.router.ServeHTTP(recorder, request)
+			require.Equal(t, tc.status, recorder.Code, recorder.Body.String())
+		})
+	}
+}
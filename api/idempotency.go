@@ -0,0 +1,220 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	db "github.com/samanthatb1/beadBashStorage/db/sqlc"
+)
+
+const (
+	idempotencyKeyHeader      = "Idempotency-Key"
+	idempotencyReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength   = 255
+	idempotencyStoreTimeout   = 5 * time.Second // Saving the response shouldn't depend on the client still being connected
+	idempotencyLease          = time.Minute     // Longer than requests to the idempotent routes take, a retry takes over the key after it
+)
+
+// Headers kept with a response and sent again when it's replayed
+var replayedHeaders = []string{"Content-Type", "ETag", "Last-Modified"}
+
+// DB operations the middleware uses, *db.Store in production and a fake in the tests
+type idempotencyStore interface {
+	CreateIdempotencyKey(ctx context.Context, arg db.CreateIdempotencyKeyParams) (db.IdempotencyKey, error)
+	TakeOverIdempotencyKey(ctx context.Context, arg db.TakeOverIdempotencyKeyParams) (db.IdempotencyKey, error)
+	GetIdempotencyKey(ctx context.Context, arg db.GetIdempotencyKeyParams) (db.IdempotencyKey, error)
+	CompleteIdempotencyKey(ctx context.Context, arg db.CompleteIdempotencyKeyParams) error
+	DeleteIdempotencyKey(ctx context.Context, arg db.DeleteIdempotencyKeyParams) error
+}
+
+// Keeps a copy of everything the handler writes so it can be replayed
+type responseRecorder struct {
+	gin.ResponseWriter
+	body *bytes.Buffer
+}
+
+func (w responseRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// The replayed headers the handler set, as a JSON object
+func recordHeaders(header http.Header) json.RawMessage {
+	saved := map[string]string{}
+	for _, name := range replayedHeaders {
+		if value := header.Get(name); value != "" {
+			saved[name] = value
+		}
+	}
+	encoded, _ := json.Marshal(saved)
+	return encoded
+}
+
+// Sends a stored response back the way the handler first sent it
+func replayResponse(ctx *gin.Context, record db.IdempotencyKey) {
+	var headers map[string]string
+	json.Unmarshal(record.ResponseHeaders, &headers)
+
+	contentType := gin.MIMEJSON
+	for name, value := range headers {
+		if name == "Content-Type" {
+			contentType = value
+			continue
+		}
+		ctx.Header(name, value)
+	}
+	ctx.Header(idempotencyReplayedHeader, "true")
+	ctx.Data(int(record.ResponseStatus), contentType, record.ResponseBody)
+	ctx.Abort()
+}
+
+// Hash of everything that makes two requests the same request
+func hashRequest(ctx *gin.Context, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(ctx.Request.Method + " " + ctx.Request.URL.Path + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Claims the key for this request
+// Returns the existing record and false if another request already claimed it
+// A claim whose lease ran out without a response (the server crashed) is taken over by a retry of the same request
+func claimIdempotencyKey(ctx *gin.Context, store idempotencyStore, args db.CreateIdempotencyKeyParams) (db.IdempotencyKey, bool, error) {
+	// Try twice: the second time after clearing an expired key or losing a takeover
+	for attempt := 0; attempt < 2; attempt++ {
+		claimed, err := store.CreateIdempotencyKey(ctx, args)
+		if err == nil {
+			return claimed, true, nil
+		}
+		if err != sql.ErrNoRows {
+			return claimed, false, err
+		}
+
+		// Key already exists
+		existing, err := store.GetIdempotencyKey(ctx, db.GetIdempotencyKeyParams{Owner: args.Owner, Key: args.Key})
+		if err == sql.ErrNoRows { // Deleted in the meantime, try again
+			continue
+		}
+		if err != nil {
+			return existing, false, err
+		}
+		if time.Now().Before(existing.ExpiresAt) {
+			if existing.ResponseStatus != 0 || existing.RequestHash != args.RequestHash || time.Now().Before(existing.LockedUntil) {
+				return existing, false, nil
+			}
+			taken, err := store.TakeOverIdempotencyKey(ctx, db.TakeOverIdempotencyKeyParams{
+				Owner: args.Owner,
+				Key: args.Key,
+				RequestHash: args.RequestHash,
+				LockedUntil: args.LockedUntil,
+			})
+			if err == sql.ErrNoRows { // Another retry took it over, or the response was saved in the meantime
+				continue
+			}
+			return taken, err == nil, err
+		}
+
+		// Expired keys can be reused
+		err = store.DeleteIdempotencyKey(ctx, db.DeleteIdempotencyKeyParams{Owner: args.Owner, Key: args.Key})
+		if err != nil {
+			return existing, false, err
+		}
+	}
+	return db.IdempotencyKey{}, false, sql.ErrNoRows
+}
+
+// Makes retries with the same "Idempotency-Key" header return the first response instead of running the handler again
+// Keys are per client and expire after the ttl, must run after authMiddleware
+func idempotencyMiddleware(store idempotencyStore, ttl time.Duration) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		key := ctx.GetHeader(idempotencyKeyHeader)
+		if key == "" { // Header is optional
+			ctx.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			sendProblem(ctx, http.StatusBadRequest, codeInvalidRequest, "Idempotency-Key is too long")
+			return
+		}
+
+		// Read the body to hash it, then put it back for the handler
+		body, err := io.ReadAll(ctx.Request.Body)
+		if err != nil {
+			sendInvalid(ctx, err)
+			return
+		}
+		ctx.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		owner := clientIdentity(ctx)
+		requestHash := hashRequest(ctx, body)
+
+		record, claimed, err := claimIdempotencyKey(ctx, store, db.CreateIdempotencyKeyParams{
+			Owner: owner,
+			Key: key,
+			RequestHash: requestHash,
+			ExpiresAt: time.Now().Add(ttl),
+			LockedUntil: time.Now().Add(idempotencyLease),
+		})
+		if err != nil {
+			sendError(ctx, err)
+			return
+		}
+
+		if !claimed {
+			switch {
+			case record.RequestHash != requestHash:
+				sendProblem(ctx, http.StatusUnprocessableEntity, codeIdempotencyReuse, "Idempotency-Key was already used with a different request")
+			case record.ResponseStatus == 0: // First request hasn't finished yet
+				sendProblem(ctx, http.StatusConflict, codeIdempotencyBusy, "A request with this Idempotency-Key is still being processed")
+			default: // Send back the original response
+				replayResponse(ctx, record)
+			}
+			return
+		}
+
+		// Run the handler and keep its response
+		recorder := responseRecorder{ResponseWriter: ctx.Writer, body: &bytes.Buffer{}}
+		ctx.Writer = recorder
+		finished := false
+
+		// Deferred so the key is released when the handler panics too, gin.Recovery answers for it
+		defer func() {
+			storeCtx, cancel := context.WithTimeout(context.Background(), idempotencyStoreTimeout)
+			defer cancel()
+
+			var err error
+			status := recorder.Status()
+			if !finished || status >= http.StatusInternalServerError || !json.Valid(recorder.body.Bytes()) {
+				// Nothing to replay, let the client retry with the same key
+				err = store.DeleteIdempotencyKey(storeCtx, db.DeleteIdempotencyKeyParams{Owner: owner, Key: key})
+			} else {
+				err = store.CompleteIdempotencyKey(storeCtx, db.CompleteIdempotencyKeyParams{
+					Owner: owner,
+					Key: key,
+					ResponseStatus: int32(status),
+					ResponseBody: recorder.body.Bytes(),
+					ResponseHeaders: recordHeaders(recorder.Header()),
+				})
+			}
+			if err != nil {
+				ctx.Error(err) // Response was already sent, just log it
+			}
+		}()
+
+		ctx.Next()
+		finished = true
+	}
+}
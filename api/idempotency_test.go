@@ -0,0 +1,297 @@
+// Unit tests for the idempotency middleware, keys are kept by a fake store instead of the DB
+
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	db "github.com/samanthatb1/beadBashStorage/db/sqlc"
+	"github.com/samanthatb1/beadBashStorage/util"
+	"github.com/stretchr/testify/require"
+)
+
+/* Helper Functions */
+
+// Keeps the keys in memory like the idempotency_keys table
+type fakeIdempotencyStore struct {
+	mu   sync.Mutex
+	keys map[db.GetIdempotencyKeyParams]db.IdempotencyKey
+}
+
+func newFakeIdempotencyStore() *fakeIdempotencyStore {
+	return &fakeIdempotencyStore{keys: map[db.GetIdempotencyKeyParams]db.IdempotencyKey{}}
+}
+
+func (store *fakeIdempotencyStore) CreateIdempotencyKey(ctx context.Context, arg db.CreateIdempotencyKeyParams) (db.IdempotencyKey, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	id := db.GetIdempotencyKeyParams{Owner: arg.Owner, Key: arg.Key}
+	if _, ok := store.keys[id]; ok {
+		return db.IdempotencyKey{}, sql.ErrNoRows // ON CONFLICT DO NOTHING returns no row
+	}
+	record := db.IdempotencyKey{Owner: arg.Owner, Key: arg.Key, RequestHash: arg.RequestHash, ExpiresAt: arg.ExpiresAt, LockedUntil: arg.LockedUntil}
+	store.keys[id] = record
+	return record, nil
+}
+
+func (store *fakeIdempotencyStore) TakeOverIdempotencyKey(ctx context.Context, arg db.TakeOverIdempotencyKeyParams) (db.IdempotencyKey, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	id := db.GetIdempotencyKeyParams{Owner: arg.Owner, Key: arg.Key}
+	record, ok := store.keys[id]
+	if !ok || record.RequestHash != arg.RequestHash || record.ResponseStatus != 0 || !record.LockedUntil.Before(time.Now()) {
+		return db.IdempotencyKey{}, sql.ErrNoRows
+	}
+	record.LockedUntil = arg.LockedUntil
+	store.keys[id] = record
+	return record, nil
+}
+
+// Makes the claim on a key look like it was left behind by a server that died mid-request
+func (store *fakeIdempotencyStore) expireLease(owner string, key string) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	id := db.GetIdempotencyKeyParams{Owner: owner, Key: key}
+	record := store.keys[id]
+	record.LockedUntil = time.Now().Add(-time.Second)
+	store.keys[id] = record
+}
+
+func (store *fakeIdempotencyStore) GetIdempotencyKey(ctx context.Context, arg db.GetIdempotencyKeyParams) (db.IdempotencyKey, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	record, ok := store.keys[arg]
+	if !ok {
+		return record, sql.ErrNoRows
+	}
+	return record, nil
+}
+
+func (store *fakeIdempotencyStore) CompleteIdempotencyKey(ctx context.Context, arg db.CompleteIdempotencyKeyParams) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	id := db.GetIdempotencyKeyParams{Owner: arg.Owner, Key: arg.Key}
+	record := store.keys[id]
+	record.ResponseStatus, record.ResponseBody, record.ResponseHeaders = arg.ResponseStatus, arg.ResponseBody, arg.ResponseHeaders
+	store.keys[id] = record
+	return nil
+}
+
+func (store *fakeIdempotencyStore) DeleteIdempotencyKey(ctx context.Context, arg db.DeleteIdempotencyKeyParams) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	delete(store.keys, db.GetIdempotencyKeyParams{Owner: arg.Owner, Key: arg.Key})
+	return nil
+}
+
+// Router with the handler behind the idempotency middleware
+func newIdempotencyRouter(t *testing.T, store idempotencyStore, handler gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	tokenMaker, err := newTestTokenMaker()
+	require.NoError(t, err)
+
+	router := gin.New()
+	router.POST("/orders", authMiddleware(tokenMaker, nil), idempotencyMiddleware(store, time.Hour), handler)
+	return router
+}
+
+// Router with an idempotent route that counts how often its handler runs
+// If hold is set the handler sends on it once it runs, then waits to receive from it, so a request can be kept in flight
+func newIdempotencyTestRouter(t *testing.T, store idempotencyStore, calls *int, hold chan struct{}) *gin.Engine {
+	return newIdempotencyRouter(t, store, func(ctx *gin.Context) {
+		*calls++
+		if hold != nil {
+			hold <- struct{}{}
+			<-hold
+		}
+		ctx.JSON(http.StatusOK, gin.H{"order_id": *calls})
+	})
+}
+
+func sendIdempotent(t *testing.T, router *gin.Engine, key string, body string) *httptest.ResponseRecorder {
+	tokenMaker, err := newTestTokenMaker()
+	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(body))
+	request.Header.Set(idempotencyKeyHeader, key)
+	addAuthorization(t, request, tokenMaker, testCustomer, util.AdminRole)
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+/* Test Functions */
+
+// Test Scenario: a retry with the same key and body gets the first response back without running the handler again
+func TestIdempotencyReplay(t *testing.T){
+	calls := 0
+	router := newIdempotencyTestRouter(t, newFakeIdempotencyStore(), &calls, nil)
+
+	first := sendIdempotent(t, router, "order-1", `{"purchased_item": "bracelet"}`)
+	require.Equal(t, http.StatusOK, first.Code)
+	require.Empty(t, first.Header().Get(idempotencyReplayedHeader))
+
+	retry := sendIdempotent(t, router, "order-1", `{"purchased_item": "bracelet"}`)
+	require.Equal(t, http.StatusOK, retry.Code)
+	require.Equal(t, "true", retry.Header().Get(idempotencyReplayedHeader))
+	require.JSONEq(t, first.Body.String(), retry.Body.String())
+	require.Equal(t, 1, calls)
+
+	// Another key is another request
+	other := sendIdempotent(t, router, "order-2", `{"purchased_item": "bracelet"}`)
+	require.Equal(t, http.StatusOK, other.Code)
+	require.Equal(t, 2, calls)
+}
+
+// Test Scenario: a replay keeps the Content-Type and caching headers of the original response
+func TestIdempotencyReplayHeaders(t *testing.T){
+	testCases := []struct {
+		name    string
+		handler gin.HandlerFunc
+		check   func(t *testing.T, first *httptest.ResponseRecorder, retry *httptest.ResponseRecorder)
+	}{
+		{
+			name: "Problem",
+			handler: func(ctx *gin.Context) {
+				sendProblem(ctx, http.StatusUnprocessableEntity, codeInvalidRequest, "purchase_amount must be positive")
+			},
+			check: func(t *testing.T, first *httptest.ResponseRecorder, retry *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusUnprocessableEntity, retry.Code)
+				require.Equal(t, problemContentType, retry.Header().Get("Content-Type"))
+			},
+		},
+		{
+			name: "ETag",
+			handler: func(ctx *gin.Context) {
+				ctx.Header("ETag", versionETag(3))
+				ctx.JSON(http.StatusOK, gin.H{"version": 3})
+			},
+			check: func(t *testing.T, first *httptest.ResponseRecorder, retry *httptest.ResponseRecorder) {
+				require.Equal(t, http.StatusOK, retry.Code)
+				require.Equal(t, versionETag(3), retry.Header().Get("ETag"))
+				require.Contains(t, retry.Header().Get("Content-Type"), gin.MIMEJSON)
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			router := newIdempotencyRouter(t, newFakeIdempotencyStore(), tc.handler)
+
+			first := sendIdempotent(t, router, "order-1", `{"purchased_item": "bracelet"}`)
+			retry := sendIdempotent(t, router, "order-1", `{"purchased_item": "bracelet"}`)
+			require.Equal(t, "true", retry.Header().Get(idempotencyReplayedHeader))
+			require.Equal(t, first.Body.String(), retry.Body.String())
+			tc.check(t, first, retry)
+		})
+	}
+}
+
+// Test Scenario: a key reused with a different body is rejected
+func TestIdempotencyDifferentBody(t *testing.T){
+	calls := 0
+	router := newIdempotencyTestRouter(t, newFakeIdempotencyStore(), &calls, nil)
+
+	require.Equal(t, http.StatusOK, sendIdempotent(t, router, "order-1", `{"purchased_item": "bracelet"}`).Code)
+
+	recorder := sendIdempotent(t, router, "order-1", `{"purchased_item": "necklace"}`)
+	require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+	var body problem
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+	require.Equal(t, codeIdempotencyReuse, body.Code)
+	require.Equal(t, 1, calls)
+}
+
+// Test Scenario: a retry while the first request is still running is told to wait, and can be replayed once it's done
+func TestIdempotencyInFlight(t *testing.T){
+	calls := 0
+	hold := make(chan struct{})
+	router := newIdempotencyTestRouter(t, newFakeIdempotencyStore(), &calls, hold)
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		done <- sendIdempotent(t, router, "order-1", `{"purchased_item": "bracelet"}`)
+	}()
+	<-hold // The first request's handler is running
+
+	recorder := sendIdempotent(t, router, "order-1", `{"purchased_item": "bracelet"}`)
+	require.Equal(t, http.StatusConflict, recorder.Code)
+	var body problem
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+	require.Equal(t, codeIdempotencyBusy, body.Code)
+
+	hold <- struct{}{}
+	first := <-done
+	require.Equal(t, http.StatusOK, first.Code)
+
+	retry := sendIdempotent(t, router, "order-1", `{"purchased_item": "bracelet"}`)
+	require.Equal(t, "true", retry.Header().Get(idempotencyReplayedHeader))
+	require.JSONEq(t, first.Body.String(), retry.Body.String())
+	require.Equal(t, 1, calls)
+}
+
+// Test Scenario: a handler that panics releases the key, so the client can retry with it
+func TestIdempotencyPanic(t *testing.T){
+	tokenMaker, err := newTestTokenMaker()
+	require.NoError(t, err)
+
+	calls := 0
+	router := gin.New()
+	router.Use(gin.Recovery())
+	router.POST("/orders", authMiddleware(tokenMaker, nil), idempotencyMiddleware(newFakeIdempotencyStore(), time.Hour), func(ctx *gin.Context) {
+		calls++
+		if calls == 1 {
+			panic("lost the DB connection")
+		}
+		ctx.JSON(http.StatusOK, gin.H{"order_id": calls})
+	})
+
+	first := sendIdempotent(t, router, "order-1", `{"purchased_item": "bracelet"}`)
+	require.Equal(t, http.StatusInternalServerError, first.Code)
+
+	retry := sendIdempotent(t, router, "order-1", `{"purchased_item": "bracelet"}`)
+	require.Equal(t, http.StatusOK, retry.Code)
+	require.Empty(t, retry.Header().Get(idempotencyReplayedHeader))
+	require.Equal(t, 2, calls)
+}
+
+// Test Scenario: once the lease on a claim runs out a retry of the same request takes the key over, a different request still can't
+func TestIdempotencyExpiredLease(t *testing.T){
+	started := make(chan struct{})
+	release := make(chan struct{})
+	store := newFakeIdempotencyStore()
+	router := newIdempotencyRouter(t, store, func(ctx *gin.Context) {
+		started <- struct{}{}
+		<-release
+		ctx.JSON(http.StatusOK, gin.H{"order_id": 1})
+	})
+
+	first := make(chan *httptest.ResponseRecorder)
+	go func() {
+		first <- sendIdempotent(t, router, "order-1", `{"purchased_item": "bracelet"}`)
+	}()
+	<-started // The first request's handler is running, act like its server died
+	store.expireLease(db.UserIdentity(testCustomer), "order-1")
+
+	recorder := sendIdempotent(t, router, "order-1", `{"purchased_item": "necklace"}`)
+	require.Equal(t, http.StatusUnprocessableEntity, recorder.Code)
+
+	retry := make(chan *httptest.ResponseRecorder)
+	go func() {
+		retry <- sendIdempotent(t, router, "order-1", `{"purchased_item": "bracelet"}`)
+	}()
+	<-started // The retry's handler runs too
+
+	close(release)
+	require.Equal(t, http.StatusOK, (<-first).Code)
+	require.Equal(t, http.StatusOK, (<-retry).Code)
+}
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	db "github.com/samanthatb1/beadBashStorage/db/sqlc"
+	"github.com/samanthatb1/beadBashStorage/token"
+	"github.com/samanthatb1/beadBashStorage/util"
+)
+
+const (
+	authorizationHeaderKey  = "authorization"
+	authorizationTypeBearer = "bearer"
+	authorizationTypeApiKey = "apikey"
+	authorizationPayloadKey = "authorization_payload" // Key the verified token payload is stored under in the gin context
+	authorizationApiKeyKey  = "authorization_api_key" // Key the verified API key is stored under in the gin context
+	ticketQueryKey          = "ticket"                // Query param browsers send their feed ticket in
+)
+
+// Rejects requests without a valid "Authorization: Bearer <access token>" or "Authorization: ApiKey <key>" header
+func authMiddleware(tokenMaker token.Maker, store *db.Store) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		authorizationHeader := ctx.GetHeader(authorizationHeaderKey)
+		if len(authorizationHeader) == 0 {
+			err := errors.New("authorization header is not provided")
+			sendProblem(ctx, http.StatusUnauthorized, codeUnauthorized, err.Error())
+			return
+		}
+
+		// Header must look like "Bearer <token>" or "ApiKey <key>"
+		fields := strings.Fields(authorizationHeader)
+		if len(fields) < 2 {
+			err := errors.New("invalid authorization header format")
+			sendProblem(ctx, http.StatusUnauthorized, codeUnauthorized, err.Error())
+			return
+		}
+
+		authorizationType := strings.ToLower(fields[0])
+		switch authorizationType {
+		case authorizationTypeBearer: // Human login
+			payload, err := tokenMaker.VerifyToken(fields[1])
+			if err == nil {
+				err = payload.CheckType(token.AccessToken) // Refresh tokens live longer and can't be blocked here
+			}
+			if err != nil {
+				sendProblem(ctx, http.StatusUnauthorized, codeUnauthorized, err.Error())
+				return
+			}
+
+			// Handlers can read who is making the request from the context
+			ctx.Set(authorizationPayloadKey, payload)
+
+		case authorizationTypeApiKey: // Integration
+			apiKey, status, err := verifyApiKey(ctx, store, fields[1])
+			if err != nil {
+				if status == http.StatusUnauthorized {
+					sendProblem(ctx, status, codeUnauthorized, err.Error())
+				} else {
+					sendError(ctx, err)
+				}
+				return
+			}
+
+			// Handlers can read which key is making the request from the context
+			ctx.Set(authorizationApiKeyKey, apiKey)
+
+		default:
+			err := fmt.Errorf("unsupported authorization type %s", authorizationType)
+			sendProblem(ctx, http.StatusUnauthorized, codeUnauthorized, err.Error())
+			return
+		}
+
+		ctx.Next()
+	}
+}
+
+// Same as authMiddleware, but also takes a feed ticket from POST /v2/events/orders/tickets as ?ticket=
+// for browsers, which can't send headers with EventSource or WebSocket
+func ticketAuthMiddleware(tokenMaker token.Maker, store *db.Store) gin.HandlerFunc {
+	authenticate := authMiddleware(tokenMaker, store)
+	return func(ctx *gin.Context) {
+		ticket := ctx.Query(ticketQueryKey)
+		if ticket == "" || ctx.GetHeader(authorizationHeaderKey) != "" {
+			authenticate(ctx)
+			return
+		}
+
+		payload, err := tokenMaker.VerifyToken(ticket)
+		if err == nil {
+			err = payload.CheckType(token.FeedTicket) // Access tokens don't belong in URLs, they end up in logs
+		}
+		if err != nil {
+			sendProblem(ctx, http.StatusUnauthorized, codeUnauthorized, err.Error())
+			return
+		}
+
+		ctx.Set(authorizationPayloadKey, payload)
+		ctx.Next()
+	}
+}
+
+// Looks up the API key by its hash and records that it was used
+// Returns the status code to respond with if the key can't be used
+func verifyApiKey(ctx *gin.Context, store *db.Store, key string) (db.ApiKey, int, error) {
+	apiKey, err := store.GetApiKeyByHash(ctx, util.HashAPIKey(key))
+	if err != nil {
+		if err == sql.ErrNoRows { // If that key doesnt exist
+			return apiKey, http.StatusUnauthorized, errors.New("api key is invalid")
+		}
+		return apiKey, http.StatusInternalServerError, err
+	}
+
+	if apiKey.RevokedAt.Valid {
+		return apiKey, http.StatusUnauthorized, errors.New("api key has been revoked")
+	}
+	if time.Now().After(apiKey.ExpiresAt) {
+		return apiKey, http.StatusUnauthorized, errors.New("api key has expired")
+	}
+
+	if err = store.TouchApiKey(ctx, apiKey.ID); err != nil {
+		return apiKey, http.StatusInternalServerError, err
+	}
+
+	return apiKey, http.StatusOK, nil
+}
+
+// Who is making the request: the logged in user, the API key or the client IP
+func clientIdentity(ctx *gin.Context) string {
+	if payload, ok := ctx.Get(authorizationPayloadKey); ok {
+		return db.UserIdentity(payload.(*token.Payload).Username)
+	}
+	if apiKey, ok := ctx.Get(authorizationApiKeyKey); ok {
+		return fmt.Sprintf("apikey:%d", apiKey.(db.ApiKey).ID)
+	}
+	return "ip:" + ctx.ClientIP()
+}
@@ -0,0 +1,530 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/graphql-go/graphql"
+	db "github.com/samanthatb1/beadBashStorage/db/sqlc"
+	"github.com/samanthatb1/beadBashStorage/export"
+	"github.com/samanthatb1/beadBashStorage/feed"
+	"github.com/samanthatb1/beadBashStorage/importer"
+)
+
+// Documentation of a route, the OpenAPI document is built from the same structs the handler binds
+type routeDoc struct {
+	summary  string
+	uri      interface{} // Struct with `uri` tags, must cover every param in the path
+	query    interface{} // Struct with `form` tags
+	body     interface{} // Struct with `json` tags, sent as JSON
+	response interface{} // Sent back on success: a value, a reflect.Type, a pageOf or a fileResponse
+	itemsByHandler bool // Items of the body's arrays aren't validated, the handler checks them one by one
+	upload string // Form field of the file, for routes that take a multipart upload instead of a JSON body
+	mergePatch interface{} // Struct with `json` tags, sent as application/merge-patch+json instead of body
+	conditional bool // Sends an ETag and answers If-None-Match or If-Modified-Since with 304 Not Modified
+}
+
+// Response of the list routes: a pageResponse with items like item
+type pageOf struct {
+	item interface{}
+}
+
+// Response that isn't JSON, the value is its content type
+// Routes that can send several formats separate them with commas
+type fileResponse string
+
+// Exports are sent in the format the client picks
+var exportResponse = fileResponse(strings.Join([]string{export.ContentType(export.CSV), export.ContentType(export.NDJSON), export.ContentType(export.XLSX)}, ","))
+
+// Type of the first value the function returns, so responses follow the store's result types
+func returnOf(fn interface{}) reflect.Type {
+	return reflect.TypeOf(fn).Out(0)
+}
+
+// Docs for every route, keyed like routePolicies
+var routeDocs = map[string]routeDoc{
+	/* Docs */
+	"GET /openapi.json": {summary: "This document", response: fileResponse(gin.MIMEJSON)},
+	"GET /docs":         {summary: "Page for browsing this document", response: fileResponse(gin.MIMEHTML)},
+
+	/* Session */
+	"POST /v2/users":            {summary: "Create a customer", body: createUserRequest{}, response: db.User{}},
+	"POST /v2/sessions":         {summary: "Log in", body: loginUserRequest{}, response: loginUserResponse{}},
+	"POST /v2/sessions/refresh": {summary: "Get a new access token from a refresh token", body: renewAccessTokenRequest{}, response: renewAccessTokenResponse{}},
+
+	/* User */
+	"GET /v2/users":                       {summary: "List users", query: listUsersRequest{}, response: pageOf{userWithOrders{}}, conditional: true},
+	"GET /v2/users/:user_id":              {summary: "Get a user", uri: userIdUri{}, query: fieldsRequest{}, response: userWithOrders{}, conditional: true},
+	"DELETE /v2/users/:user_id":           {summary: "Delete a user", uri: userIdUri{}, response: map[string]string{}},
+	"PATCH /v2/users/:user_id/role":       {summary: "Change a user's role", uri: userIdUri{}, body: updateUserRoleRequest{}, response: db.User{}},
+	"GET /v2/users/:user_id/export":       {summary: "Download everything stored about a user as a ZIP", uri: userIdUri{}, response: fileResponse("application/zip")},
+	"POST /v2/users/:user_id/erase":       {summary: "Erase a customer's PII, keeping their orders", uri: userIdUri{}, response: returnOf((*db.Store).EraseUserTx)},
+	"POST /v2/users/:user_id/tags":        {summary: "Tag a user", uri: userIdUri{}, body: tagRequest{}, response: returnOf((*db.Store).AddUserTagTx)},
+	"DELETE /v2/users/:user_id/tags/:tag": {summary: "Remove a tag from a user", uri: userTagUri{}, response: returnOf((*db.Store).RemoveUserTagTx)},
+	"GET /v2/users/:user_id/orders":       {summary: "List a user's orders", uri: userIdUri{}, query: listOrdersRequest{}, response: pageOf{orderWithUser{}}, conditional: true},
+	"GET /v2/exports/users":               {summary: "Download every user matching the filters as CSV, NDJSON or XLSX", query: exportUsersRequest{}, response: exportResponse},
+
+	/* Order */
+	"GET /v2/orders":                        {summary: "List orders", query: listOrdersRequest{}, response: pageOf{orderWithUser{}}, conditional: true},
+	"POST /v2/orders":                       {summary: "Create an order, and its customer if they're new", body: createOrderRequest{}, response: returnOf((*db.Store).NewOrderTx)},
+	"POST /v2/orders/batch":                 {summary: "Create up to 500 orders, all or nothing unless mode is best_effort", body: batchOrdersRequest{}, response: batchOrdersResponse{}, itemsByHandler: true},
+	"POST /v2/orders/import":                {summary: "Import an Etsy or Shopify CSV export, orders imported before are skipped", query: importOrdersRequest{}, upload: importFileField, response: importer.Report{}},
+	"GET /v2/orders/:order_id":              {summary: "Get an order", uri: getOrderRequest{}, query: fieldsRequest{}, response: orderWithUser{}, conditional: true},
+	"PATCH /v2/orders/:order_id":            {summary: "Change an order with a JSON Merge Patch, or a JSON body whose empty fields are kept", uri: updateOrderUriRequest{}, body: updateOrderFields{}, mergePatch: orderMergePatch{}, response: db.Order{}},
+	"DELETE /v2/orders/:order_id":           {summary: "Delete an order", uri: deleteOrderRequest{}, response: returnOf((*db.Store).DeleteOrderTx)},
+	"POST /v2/orders/:order_id/tags":        {summary: "Tag an order", uri: orderTagUriRequest{}, body: tagRequest{}, response: returnOf((*db.Store).AddOrderTagTx)},
+	"DELETE /v2/orders/:order_id/tags/:tag": {summary: "Remove a tag from an order", uri: removeOrderTagRequest{}, response: returnOf((*db.Store).RemoveOrderTagTx)},
+	"GET /v2/exports/orders":                {summary: "Download every order matching the filters as CSV, NDJSON or XLSX", query: exportOrdersRequest{}, response: exportResponse},
+
+	/* Search */
+	"GET /v2/search": {summary: "Search users and orders", query: searchRequest{}, response: searchResponse{}},
+
+	/* Live Feed */
+	"GET /v2/events/orders":          {summary: "Stream order.created, order.updated and order.deleted events as Server-Sent Events", query: orderFeedRequest{}, response: fileResponse("text/event-stream")},
+	"GET /v2/events/orders/ws":       {summary: "Same events as /v2/events/orders over a WebSocket, one JSON message each", query: orderFeedRequest{}, response: feed.Event{}},
+	"POST /v2/events/orders/tickets": {summary: "Get a short-lived ticket a browser can open the order feed with", response: orderFeedTicketResponse{}},
+
+	/* API Key */
+	"POST /v2/api_keys":       {summary: "Create an API key", body: createApiKeyRequest{}, response: createApiKeyResponse{}},
+	"GET /v2/api_keys":        {summary: "List API keys", response: []apiKeyResponse{}},
+	"DELETE /v2/api_keys/:id": {summary: "Revoke an API key", uri: revokeApiKeyRequest{}, response: apiKeyResponse{}},
+
+	/* Webhook */
+	"POST /v2/webhooks":                                    {summary: "Subscribe a URL to events, deliveries are signed with the returned secret", body: createWebhookRequest{}, response: createWebhookResponse{}},
+	"GET /v2/webhooks":                                     {summary: "List webhooks", response: []webhookResponse{}},
+	"DELETE /v2/webhooks/:id":                              {summary: "Delete a webhook and its deliveries", uri: webhookIdUri{}, response: webhookResponse{}},
+	"GET /v2/webhooks/:id/deliveries":                      {summary: "List a webhook's deliveries, newest first", uri: webhookIdUri{}, query: listWebhookDeliveriesRequest{}, response: webhookDeliveriesResponse{}},
+	"POST /v2/webhooks/:id/deliveries/:delivery_id/replay": {summary: "Send a delivery again as a new delivery", uri: replayWebhookDeliveryRequest{}, response: webhookDeliveryResponse{}},
+
+	/* GraphQL */
+	"POST /graphql": {summary: "Run a GraphQL query or mutation, see the schema with an introspection query", body: graphQLRequest{}, response: graphql.Result{}},
+}
+
+// Docs for the v1 routes, marked as deprecated in the document
+var v1RouteDocs = map[string]routeDoc{
+	/* Session */
+	"POST /users":               {summary: "Create a customer", body: createUserRequest{}, response: db.User{}},
+	"POST /users/login":         {summary: "Log in", body: loginUserRequest{}, response: loginUserResponse{}},
+	"POST /tokens/renew_access": {summary: "Get a new access token from a refresh token", body: renewAccessTokenRequest{}, response: renewAccessTokenResponse{}},
+
+	/* User */
+	"GET /users/:identifier":            {summary: "Get a user by username or id", uri: getUserUsernameRequest{}, query: fieldsRequest{}, response: userWithOrders{}, conditional: true},
+	"GET /users/all":                    {summary: "List users", query: listUsersRequest{}, response: pageOf{userWithOrders{}}, conditional: true},
+	"DELETE /users/:username":           {summary: "Delete a user", uri: deleteUserByUsernameRequest{}, response: map[string]string{}},
+	"PATCH /users/:username/role":       {summary: "Change a user's role", uri: updateUserRoleUriRequest{}, body: updateUserRoleRequest{}, response: db.User{}},
+	"GET /users/:identifier/export":     {summary: "Download everything stored about a user as a ZIP", uri: exportUserDataRequest{}, response: fileResponse("application/zip")},
+	"POST /users/:username/erase":       {summary: "Erase a customer's PII, keeping their orders", uri: eraseUserRequest{}, response: returnOf((*db.Store).EraseUserTx)},
+	"POST /users/:username/tags":        {summary: "Tag a user", uri: userTagUriRequest{}, body: tagRequest{}, response: returnOf((*db.Store).AddUserTagTx)},
+	"DELETE /users/:username/tags/:tag": {summary: "Remove a tag from a user", uri: removeUserTagRequest{}, response: returnOf((*db.Store).RemoveUserTagTx)},
+
+	/* Order */
+	"GET /orders/:username":              {summary: "List a user's orders", uri: listOrdersOfUserRequest{}, query: listOrdersRequest{}, response: pageOf{orderWithUser{}}, conditional: true},
+	"GET /orders/all":                    {summary: "List orders", query: listOrdersRequest{}, response: pageOf{orderWithUser{}}, conditional: true},
+	"POST /orders":                       {summary: "Create an order, and its customer if they're new", body: createOrderRequest{}, response: returnOf((*db.Store).NewOrderTx)},
+	"POST /orders/batch":                 {summary: "Create up to 500 orders, all or nothing unless mode is best_effort", body: batchOrdersRequest{}, response: batchOrdersResponse{}, itemsByHandler: true},
+	"DELETE /orders/:order_id":           {summary: "Delete an order", uri: deleteOrderRequest{}, response: returnOf((*db.Store).DeleteOrderTx)},
+	"PATCH /orders":                      {summary: "Change an order, empty fields are kept", body: updateOrderByIdRequest{}, response: db.Order{}},
+	"POST /orders/:order_id/tags":        {summary: "Tag an order", uri: orderTagUriRequest{}, body: tagRequest{}, response: returnOf((*db.Store).AddOrderTagTx)},
+	"DELETE /orders/:order_id/tags/:tag": {summary: "Remove a tag from an order", uri: removeOrderTagRequest{}, response: returnOf((*db.Store).RemoveOrderTagTx)},
+
+	/* Search */
+	"GET /search": {summary: "Search users and orders", query: searchRequest{}, response: searchResponse{}},
+
+	/* API Key */
+	"POST /api_keys":       {summary: "Create an API key", body: createApiKeyRequest{}, response: createApiKeyResponse{}},
+	"GET /api_keys":        {summary: "List API keys", response: []apiKeyResponse{}},
+	"DELETE /api_keys/:id": {summary: "Revoke an API key", uri: revokeApiKeyRequest{}, response: apiKeyResponse{}},
+}
+
+/**** DOCUMENT ****/
+
+type openAPIDocument struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       openAPIInfo                             `json:"info"`
+	Paths      map[string]map[string]*openAPIOperation `json:"paths"` // Path -> lowercase method -> operation
+	Components openAPIComponents                       `json:"components"`
+
+	operations map[string]*openAPIOperation // Keyed like routePolicies, for the validation middleware
+}
+
+type openAPIInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type openAPIOperation struct {
+	Summary     string                      `json:"summary"`
+	Description string                      `json:"description,omitempty"`
+	Tags        []string                    `json:"tags,omitempty"`
+	Deprecated  bool                        `json:"deprecated,omitempty"`
+	Parameters  []*openAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *openAPIRequestBody         `json:"requestBody,omitempty"`
+	Responses   map[string]*openAPIResponse `json:"responses"`
+	Security    []map[string][]string       `json:"security,omitempty"`
+
+	bodySchema *openAPISchema // What the validation middleware checks the body against
+	mergePatchSchema *openAPISchema // Same for application/merge-patch+json bodies
+}
+
+type openAPIParameter struct {
+	Name     string         `json:"name"`
+	In       string         `json:"in"` // path or query
+	Required bool           `json:"required,omitempty"`
+	Schema   *openAPISchema `json:"schema"`
+}
+
+type openAPIRequestBody struct {
+	Required bool                        `json:"required"`
+	Content  map[string]openAPIMediaType `json:"content"`
+}
+
+type openAPIResponse struct {
+	Description string                      `json:"description"`
+	Content     map[string]openAPIMediaType `json:"content,omitempty"`
+}
+
+type openAPIMediaType struct {
+	Schema *openAPISchema `json:"schema,omitempty"`
+}
+
+type openAPIComponents struct {
+	SecuritySchemes map[string]openAPISecurityScheme `json:"securitySchemes"`
+}
+
+type openAPISecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	In           string `json:"in,omitempty"`
+	Name         string `json:"name,omitempty"`
+	Description  string `json:"description,omitempty"`
+}
+
+// Body of every error response, see problem.go
+var errorSchema = schemaOf(reflect.TypeOf(problem{}))
+
+// Builds the OpenAPI document, fails if a doc's uri struct doesn't match its path
+func newOpenAPIDocument(docs map[string]routeDoc, deprecatedDocs map[string]routeDoc) (*openAPIDocument, error) {
+	doc := &openAPIDocument{
+		OpenAPI: "3.0.3",
+		Info: openAPIInfo{
+			Title: "Studio Storage API",
+			Version: "2",
+			Description: "Routes outside /v2 are deprecated, see the Deprecation and Sunset headers",
+		},
+		Paths: map[string]map[string]*openAPIOperation{},
+		Components: openAPIComponents{SecuritySchemes: map[string]openAPISecurityScheme{
+			"accessToken": {Type: "http", Scheme: "bearer", BearerFormat: "PASETO"},
+			"apiKey": {Type: "apiKey", In: "header", Name: authorizationHeaderKey, Description: "ApiKey {key}"},
+		}},
+		operations: map[string]*openAPIOperation{},
+	}
+
+	for _, group := range []struct {
+		docs       map[string]routeDoc
+		deprecated bool
+	}{{docs, false}, {deprecatedDocs, true}} {
+		for route, routeDoc := range group.docs {
+			operation, err := newOpenAPIOperation(route, routeDoc)
+			if err != nil {
+				return nil, err
+			}
+			operation.Deprecated = group.deprecated
+
+			fields := strings.SplitN(route, " ", 2)
+			path := openAPIPath(fields[1])
+			if doc.Paths[path] == nil {
+				doc.Paths[path] = map[string]*openAPIOperation{}
+			}
+			doc.Paths[path][strings.ToLower(fields[0])] = operation
+			doc.operations[route] = operation
+		}
+	}
+	return doc, nil
+}
+
+func newOpenAPIOperation(route string, routeDoc routeDoc) (*openAPIOperation, error) {
+	fields := strings.SplitN(route, " ", 2)
+	operation := &openAPIOperation{
+		Summary: routeDoc.summary,
+		Tags: []string{routeTag(fields[1])},
+		Responses: map[string]*openAPIResponse{
+			"200": newOpenAPIResponse(routeDoc.response),
+			"default": {Description: "Error", Content: map[string]openAPIMediaType{problemContentType: {Schema: errorSchema}}},
+		},
+	}
+	if routeDoc.conditional {
+		operation.Responses["304"] = &openAPIResponse{Description: "Not Modified, the ETag in If-None-Match is still current, or nothing changed since If-Modified-Since"}
+	}
+
+	// Path params must match the uri struct exactly
+	pathParams := routeParams(routeDoc.uri, "uri", "path")
+	names := map[string]bool{}
+	for _, param := range pathParams {
+		names[param.Name] = true
+	}
+	for _, segment := range strings.Split(fields[1], "/") {
+		if strings.HasPrefix(segment, ":") {
+			if !names[segment[1:]] {
+				return nil, fmt.Errorf("%s: path param %s isn't in the uri struct", route, segment[1:])
+			}
+			delete(names, segment[1:])
+		}
+	}
+	for name := range names {
+		return nil, fmt.Errorf("%s: uri struct has %s but the path doesn't", route, name)
+	}
+	operation.Parameters = append(pathParams, routeParams(routeDoc.query, "form", "query")...)
+
+	if routeDoc.body != nil {
+		operation.RequestBody = &openAPIRequestBody{
+			Required: true,
+			Content: map[string]openAPIMediaType{gin.MIMEJSON: {Schema: schemaOf(reflect.TypeOf(routeDoc.body))}},
+		}
+		operation.bodySchema = operation.RequestBody.Content[gin.MIMEJSON].Schema
+		if routeDoc.itemsByHandler {
+			operation.bodySchema = operation.bodySchema.withoutItems()
+		}
+	}
+	if routeDoc.mergePatch != nil {
+		if operation.RequestBody == nil {
+			operation.RequestBody = &openAPIRequestBody{Required: true, Content: map[string]openAPIMediaType{}}
+		}
+		operation.mergePatchSchema = schemaOf(reflect.TypeOf(routeDoc.mergePatch))
+		operation.RequestBody.Content[mergePatchContentType] = openAPIMediaType{Schema: operation.mergePatchSchema}
+	}
+	if routeDoc.upload != "" { // The handler reads the file, only JSON bodies are validated
+		operation.RequestBody = &openAPIRequestBody{
+			Required: true,
+			Content: map[string]openAPIMediaType{gin.MIMEMultipartPOSTForm: {Schema: &openAPISchema{
+				Type: "object",
+				Properties: map[string]*openAPISchema{routeDoc.upload: {Type: "string", Format: "binary"}},
+				Required: []string{routeDoc.upload},
+			}}},
+		}
+	}
+
+	// Who may call it
+	if policy, ok := routePolicies[route]; ok {
+		operation.Description = policy.describe()
+		operation.Security = []map[string][]string{{"accessToken": {}}}
+		if policy.scope != "" {
+			operation.Security = append(operation.Security, map[string][]string{"apiKey": {}})
+		}
+	}
+	return operation, nil
+}
+
+func newOpenAPIResponse(response interface{}) *openAPIResponse {
+	var schema *openAPISchema
+	switch response := response.(type) {
+	case nil:
+		return &openAPIResponse{Description: "OK"}
+	case fileResponse:
+		content := map[string]openAPIMediaType{}
+		for _, contentType := range strings.Split(string(response), ",") {
+			content[contentType] = openAPIMediaType{}
+		}
+		return &openAPIResponse{Description: "OK", Content: content}
+	case pageOf:
+		schema = schemaOf(reflect.TypeOf(pageResponse{}))
+		schema.Properties["data"] = &openAPISchema{Type: "array", Items: schemaOf(reflect.TypeOf(response.item))}
+	case reflect.Type:
+		schema = schemaOf(response)
+	default:
+		schema = schemaOf(reflect.TypeOf(response))
+	}
+	return &openAPIResponse{Description: "OK", Content: map[string]openAPIMediaType{gin.MIMEJSON: {Schema: schema}}}
+}
+
+// Params from the struct's fields with the tag, embedded structs are flattened
+func routeParams(params interface{}, tag string, in string) []*openAPIParameter {
+	if params == nil {
+		return nil
+	}
+	var result []*openAPIParameter
+	var addFields func(t reflect.Type)
+	addFields = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.Anonymous && field.Type.Kind() == reflect.Struct {
+				addFields(field.Type)
+				continue
+			}
+			name, ok := fieldName(field, tag)
+			if !ok {
+				continue
+			}
+			schema := schemaOf(field.Type)
+			required := applyBinding(schema, field.Tag.Get("binding"))
+			result = append(result, &openAPIParameter{Name: name, In: in, Required: required || in == "path", Schema: schema})
+		}
+	}
+	addFields(reflect.TypeOf(params))
+	return result
+}
+
+// Gin path to OpenAPI path, e.g. /v2/orders/:order_id -> /v2/orders/{order_id}
+func openAPIPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// Groups routes by resource, e.g. /v2/orders/:order_id/tags -> orders
+func routeTag(path string) string {
+	segments := strings.Split(strings.TrimPrefix(strings.TrimPrefix(path, "/v2"), "/"), "/")
+	return strings.TrimSuffix(segments[0], ".json")
+}
+
+// Policy in words, for the operation's description
+func (policy routePolicy) describe() string {
+	roles := append([]string{}, policy.roles...)
+	sort.Strings(roles)
+	description := "Roles: " + strings.Join(roles, ", ") + "."
+	if policy.ownerParam != "" {
+		description += " Customers may call it on their own resources."
+	}
+	if policy.scope != "" {
+		description += " API key scope: " + policy.scope + "."
+	}
+	return description
+}
+
+/**** VALIDATION ****/
+
+// Bodies are read into memory to be checked, so their size is limited
+var errBodyTooLarge = errors.New("request body is too large")
+
+// Rejects requests that don't match the route's operation in the document before they reach the handler
+func requestValidationMiddleware(doc *openAPIDocument, maxBodySize int64) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		operation, ok := doc.operations[ctx.Request.Method+" "+ctx.FullPath()]
+		if ok {
+			err := operation.validateRequest(ctx, maxBodySize)
+			if err == errBodyTooLarge {
+				sendProblem(ctx, http.StatusRequestEntityTooLarge, codeBodyTooLarge, fmt.Sprintf("Request bodies can be at most %d bytes", maxBodySize))
+				return
+			}
+			if err != nil {
+				sendInvalid(ctx, err)
+				return
+			}
+		}
+		ctx.Next()
+	}
+}
+
+func (operation *openAPIOperation) validateRequest(ctx *gin.Context, maxBodySize int64) error {
+	for _, param := range operation.Parameters {
+		var raw string
+		var ok bool
+		if param.In == "path" {
+			raw, ok = ctx.Param(param.Name), true
+		} else {
+			raw, ok = ctx.GetQuery(param.Name)
+		}
+		if !ok || raw == "" {
+			if param.Required {
+				return fmt.Errorf("%s is required", param.Name)
+			}
+			continue
+		}
+		if err := param.validate(raw); err != nil {
+			return err
+		}
+	}
+
+	bodySchema := operation.bodySchema
+	if operation.mergePatchSchema != nil && ctx.ContentType() == mergePatchContentType {
+		bodySchema = operation.mergePatchSchema
+	}
+	if bodySchema == nil {
+		return nil
+	}
+
+	// Bodies without a length are cut off while they're read, a limit of 0 is turned off
+	if maxBodySize > 0 {
+		if ctx.Request.ContentLength > maxBodySize {
+			return errBodyTooLarge
+		}
+		ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, maxBodySize)
+	}
+	body, err := io.ReadAll(ctx.Request.Body)
+	if err != nil && maxBodySize > 0 && int64(len(body)) >= maxBodySize {
+		return errBodyTooLarge
+	}
+	if err != nil {
+		return err
+	}
+	ctx.Request.Body = io.NopCloser(bytes.NewReader(body)) // Put it back for the handler
+
+	if len(bytes.TrimSpace(body)) == 0 {
+		return fmt.Errorf("request body is required")
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return fmt.Errorf("body isn't valid JSON: %w", err)
+	}
+	return bodySchema.validate("", value)
+}
+
+// Params arrive as strings, numbers and booleans are parsed before they're checked
+func (param *openAPIParameter) validate(raw string) error {
+	var value interface{} = raw
+	switch param.Schema.Type {
+	case "integer", "number":
+		value = json.Number(raw)
+	case "boolean":
+		switch raw {
+		case "true":
+			value = true
+		case "false":
+			value = false
+		}
+	}
+	return param.Schema.validate(param.Name, value)
+}
+
+/**** HANDLERS ****/
+
+// Sends the OpenAPI document
+func (server *Server) openAPISpec(ctx *gin.Context){
+	ctx.JSON(http.StatusOK, server.openAPI)
+}
+
+// Swagger UI pointed at /openapi.json
+const docsPage = `<!DOCTYPE html>
+<html>
+<head>
+  <meta charset="utf-8">
+  <title>Studio Storage API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5.17.14/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5.17.14/swagger-ui-bundle.js"></script>
+  <script>SwaggerUIBundle({ url: "/openapi.json", dom_id: "#swagger-ui" });</script>
+</body>
+</html>
+`
+
+// Sends the docs page
+func (server *Server) openAPIDocs(ctx *gin.Context){
+	ctx.Data(http.StatusOK, gin.MIMEHTML, []byte(docsPage))
+}
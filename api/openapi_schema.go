@@ -0,0 +1,355 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// The part of JSON Schema the OpenAPI document uses
+type openAPISchema struct {
+	Type                 string                    `json:"type,omitempty"` // Empty for any value
+	Format               string                    `json:"format,omitempty"`
+	Nullable             bool                      `json:"nullable,omitempty"`
+	Enum                 []string                  `json:"enum,omitempty"`
+	Minimum              *float64                  `json:"minimum,omitempty"`
+	ExclusiveMinimum     bool                      `json:"exclusiveMinimum,omitempty"`
+	Maximum              *float64                  `json:"maximum,omitempty"`
+	ExclusiveMaximum     bool                      `json:"exclusiveMaximum,omitempty"`
+	MinLength            *int                      `json:"minLength,omitempty"`
+	MaxLength            *int                      `json:"maxLength,omitempty"`
+	MinItems             *int                      `json:"minItems,omitempty"`
+	MaxItems             *int                      `json:"maxItems,omitempty"`
+	Items                *openAPISchema            `json:"items,omitempty"`
+	Properties           map[string]*openAPISchema `json:"properties,omitempty"`
+	AdditionalProperties *openAPISchema            `json:"additionalProperties,omitempty"`
+	Required             []string                  `json:"required,omitempty"`
+}
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	uuidType = reflect.TypeOf(uuid.UUID{})
+)
+
+/**** BUILDING ****/
+
+// Schema of the JSON encoding/json produces for the type
+func schemaOf(t reflect.Type) *openAPISchema {
+	return schemaFor(t, map[reflect.Type]bool{})
+}
+
+func schemaFor(t reflect.Type, seen map[reflect.Type]bool) *openAPISchema {
+	nullable := false
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+		nullable = true
+	}
+
+	schema := &openAPISchema{Nullable: nullable}
+	switch {
+	case t == timeType:
+		schema.Type, schema.Format = "string", "date-time"
+	case t == uuidType:
+		schema.Type, schema.Format = "string", "uuid"
+	default:
+		switch t.Kind() {
+		case reflect.String:
+			schema.Type = "string"
+		case reflect.Bool:
+			schema.Type = "boolean"
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+			schema.Type, schema.Format = "integer", "int32"
+		case reflect.Int64, reflect.Uint64:
+			schema.Type, schema.Format = "integer", "int64"
+		case reflect.Float32:
+			schema.Type, schema.Format = "number", "float"
+		case reflect.Float64:
+			schema.Type, schema.Format = "number", "double"
+		case reflect.Slice, reflect.Array:
+			schema.Type = "array"
+			schema.Items = schemaFor(t.Elem(), seen)
+		case reflect.Map:
+			schema.Type = "object"
+			schema.Nullable = true // Free-form objects are optional, e.g. GraphQL variables
+			schema.AdditionalProperties = schemaFor(t.Elem(), seen)
+		case reflect.Struct:
+			schema.Type = "object"
+			if seen[t] { // Recursive type, stop here
+				break
+			}
+			seen[t] = true
+			schema.Properties = map[string]*openAPISchema{}
+			addStructProperties(schema, t, seen)
+			delete(seen, t)
+		}
+	}
+	return schema
+}
+
+// Adds the struct's JSON fields to the object schema, embedded structs are flattened like encoding/json does
+func addStructProperties(schema *openAPISchema, t reflect.Type, seen map[reflect.Type]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if field.Anonymous && tag == "" && field.Type.Kind() == reflect.Struct {
+			addStructProperties(schema, field.Type, seen)
+			continue
+		}
+		if tag == "-" || !field.IsExported() {
+			continue
+		}
+		name, ok := fieldName(field, "json")
+		if !ok { // encoding/json falls back to the field's name
+			name = field.Name
+		}
+
+		property := schemaFor(field.Type, seen)
+		if applyBinding(property, field.Tag.Get("binding")) {
+			schema.Required = append(schema.Required, name)
+		}
+		schema.Properties[name] = property
+	}
+}
+
+// Name of the field under the struct tag, false if the tag is missing or "-"
+func fieldName(field reflect.StructField, tag string) (string, bool) {
+	name := strings.Split(field.Tag.Get(tag), ",")[0]
+	if name == "" || name == "-" {
+		return "", false
+	}
+	return name, true
+}
+
+// Adds the validator rules of a `binding` tag to the schema, returns whether the field is required
+// Only the rules the request structs use are understood, the rest are left to the handlers
+func applyBinding(schema *openAPISchema, binding string) (required bool) {
+	if binding == "" {
+		return false
+	}
+	rules := strings.Split(binding, ",")
+	for i, rule := range rules {
+		name, arg, _ := strings.Cut(rule, "=")
+		switch name {
+		case "required":
+			required = true
+		case "dive": // The rest apply to every item
+			if schema.Items != nil {
+				applyBinding(schema.Items, strings.Join(rules[i+1:], ","))
+			}
+			return required
+		case "oneof":
+			schema.Enum = strings.Fields(arg)
+		case "min", "gte":
+			schema.setMin(arg, false)
+		case "gt":
+			schema.setMin(arg, true)
+		case "max", "lte":
+			schema.setMax(arg, false)
+		case "lt":
+			schema.setMax(arg, true)
+		}
+	}
+	return required
+}
+
+// min and max count characters for strings and items for arrays, like the validator
+func (schema *openAPISchema) setMin(arg string, exclusive bool) {
+	limit, err := strconv.ParseFloat(arg, 64)
+	if err != nil {
+		return
+	}
+	switch schema.Type {
+	case "string":
+		schema.MinLength = intLimit(limit, exclusive, 1)
+	case "array":
+		schema.MinItems = intLimit(limit, exclusive, 1)
+	default:
+		schema.Minimum, schema.ExclusiveMinimum = &limit, exclusive
+	}
+}
+
+func (schema *openAPISchema) setMax(arg string, exclusive bool) {
+	limit, err := strconv.ParseFloat(arg, 64)
+	if err != nil {
+		return
+	}
+	switch schema.Type {
+	case "string":
+		schema.MaxLength = intLimit(limit, exclusive, -1)
+	case "array":
+		schema.MaxItems = intLimit(limit, exclusive, -1)
+	default:
+		schema.Maximum, schema.ExclusiveMaximum = &limit, exclusive
+	}
+}
+
+func intLimit(limit float64, exclusive bool, step int) *int {
+	n := int(limit)
+	if exclusive {
+		n += step
+	}
+	return &n
+}
+
+// Copy of the object schema whose arrays accept any items, for bodies the handler checks item by item
+func (schema *openAPISchema) withoutItems() *openAPISchema {
+	lenient := *schema
+	lenient.Properties = map[string]*openAPISchema{}
+	for name, property := range schema.Properties {
+		if property.Type == "array" {
+			array := *property
+			array.Items = &openAPISchema{}
+			property = &array
+		}
+		lenient.Properties[name] = property
+	}
+	return &lenient
+}
+
+/**** VALIDATION ****/
+
+// Checks a decoded JSON value against the schema, numbers must be decoded as json.Number
+// name is used in the error, e.g. "purchase_amount must be a number"
+func (schema *openAPISchema) validate(name string, value interface{}) error {
+	if value == nil {
+		if schema.Nullable || schema.Type == "" {
+			return nil
+		}
+		return fmt.Errorf("%s can't be null", name)
+	}
+
+	switch schema.Type {
+	case "string":
+		s, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%s must be a string", name)
+		}
+		if len(schema.Enum) > 0 && !containsString(schema.Enum, s) {
+			return fmt.Errorf("%s must be one of: %s", name, strings.Join(schema.Enum, ", "))
+		}
+		length := utf8.RuneCountInString(s)
+		if schema.MinLength != nil && length < *schema.MinLength {
+			return fmt.Errorf("%s must be at least %d characters", name, *schema.MinLength)
+		}
+		if schema.MaxLength != nil && length > *schema.MaxLength {
+			return fmt.Errorf("%s must be at most %d characters", name, *schema.MaxLength)
+		}
+		if schema.Format == "date-time" {
+			if _, err := time.Parse(time.RFC3339Nano, s); err != nil {
+				return fmt.Errorf("%s must be an RFC 3339 date-time", name)
+			}
+		}
+
+	case "integer", "number":
+		number, ok := value.(json.Number)
+		if !ok {
+			return fmt.Errorf("%s must be a %s", name, schema.Type)
+		}
+		var n float64
+		if schema.Type == "integer" {
+			i, err := number.Int64()
+			if err != nil {
+				return fmt.Errorf("%s must be an integer", name)
+			}
+			n = float64(i)
+		} else {
+			f, err := number.Float64()
+			if err != nil {
+				return fmt.Errorf("%s must be a number", name)
+			}
+			n = f
+		}
+		return schema.validateRange(name, n)
+
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s must be true or false", name)
+		}
+
+	case "array":
+		items, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s must be an array", name)
+		}
+		if schema.MinItems != nil && len(items) < *schema.MinItems {
+			return fmt.Errorf("%s must have at least %d items", name, *schema.MinItems)
+		}
+		if schema.MaxItems != nil && len(items) > *schema.MaxItems {
+			return fmt.Errorf("%s must have at most %d items", name, *schema.MaxItems)
+		}
+		for i, item := range items {
+			if err := schema.Items.validate(fmt.Sprintf("%s[%d]", name, i), item); err != nil {
+				return err
+			}
+		}
+
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			if name == "" {
+				return fmt.Errorf("body must be a JSON object")
+			}
+			return fmt.Errorf("%s must be an object", name)
+		}
+		for _, required := range schema.Required {
+			if _, ok := object[required]; !ok {
+				return fmt.Errorf("%s is required", joinFieldName(name, required))
+			}
+		}
+		// Fields that aren't in the schema are ignored, like the handlers do
+		for key, property := range schema.Properties {
+			if fieldValue, ok := object[key]; ok {
+				if err := property.validate(joinFieldName(name, key), fieldValue); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func (schema *openAPISchema) validateRange(name string, n float64) error {
+	if schema.Minimum != nil {
+		if schema.ExclusiveMinimum && n <= *schema.Minimum {
+			return fmt.Errorf("%s must be greater than %s", name, formatLimit(*schema.Minimum))
+		}
+		if n < *schema.Minimum {
+			return fmt.Errorf("%s must be at least %s", name, formatLimit(*schema.Minimum))
+		}
+	}
+	if schema.Maximum != nil {
+		if schema.ExclusiveMaximum && n >= *schema.Maximum {
+			return fmt.Errorf("%s must be less than %s", name, formatLimit(*schema.Maximum))
+		}
+		if n > *schema.Maximum {
+			return fmt.Errorf("%s must be at most %s", name, formatLimit(*schema.Maximum))
+		}
+	}
+	return nil
+}
+
+func formatLimit(limit float64) string {
+	return strconv.FormatFloat(limit, 'f', -1, 64)
+}
+
+func joinFieldName(parent string, field string) string {
+	if parent == "" {
+		return field
+	}
+	return parent + "." + field
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
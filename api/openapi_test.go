@@ -0,0 +1,168 @@
+// Unit tests for the OpenAPI document and the request validation
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+/* Test Functions */
+
+// Test Scenario: every route is in the document and every operation in the document has a route
+func TestOpenAPICoversAllRoutes(t *testing.T){
+	server := newTestServer(t)
+
+	registered := map[string]bool{}
+	for _, route := range server.router.Routes() {
+		key := route.Method + " " + route.Path
+		registered[key] = true
+		require.Contains(t, server.openAPI.operations, key, "route isn't documented, add it to routeDocs")
+	}
+	for key := range server.openAPI.operations {
+		require.True(t, registered[key], "documented route %s doesn't exist", key)
+	}
+}
+
+// Test Scenario: docs whose uri struct doesn't match the path are rejected
+func TestOpenAPIPathParams(t *testing.T){
+	_, err := newOpenAPIDocument(map[string]routeDoc{
+		"GET /v2/orders/:order_id": {uri: userIdUri{}},
+	}, nil)
+	require.Error(t, err)
+
+	_, err = newOpenAPIDocument(map[string]routeDoc{
+		"GET /v2/users": {uri: userIdUri{}},
+	}, nil)
+	require.Error(t, err)
+
+	_, err = newOpenAPIDocument(map[string]routeDoc{
+		"DELETE /v2/users/:user_id/tags/:tag": {uri: userTagUri{}},
+	}, nil)
+	require.NoError(t, err)
+}
+
+// Test Scenario: the document is served and built from the request structs
+func TestOpenAPIDocument(t *testing.T){
+	server := newTestServer(t)
+
+	recorder := httptest.NewRecorder()
+	server.router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+
+	var doc openAPIDocument
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &doc))
+	require.Equal(t, "3.0.3", doc.OpenAPI)
+
+	// Body follows createOrderRequest
+	createOrder := doc.Paths["/v2/orders"]["post"]
+	require.NotNil(t, createOrder)
+	body := createOrder.RequestBody.Content[gin.MIMEJSON].Schema
+	require.ElementsMatch(t, []string{"username", "full_name", "purchase_amount", "purchased_item", "shipping_location", "currency", "date_ordered"}, body.Required)
+	require.Equal(t, []string{"USD", "EUR", "CAD"}, body.Properties["currency"].Enum)
+	require.Equal(t, "number", body.Properties["purchase_amount"].Type)
+	require.Len(t, createOrder.Security, 2)
+	require.False(t, createOrder.Deprecated)
+
+	// Params follow listUsersRequest, including the embedded pageRequest
+	listUsers := doc.Paths["/v2/users"]["get"]
+	params := map[string]*openAPIParameter{}
+	for _, param := range listUsers.Parameters {
+		params[param.Name] = param
+	}
+	require.Contains(t, params, "cursor")
+	require.Equal(t, "query", params["page_size"].In)
+	require.Equal(t, float64(1), *params["page_size"].Schema.Minimum)
+	require.Equal(t, []string{"id", "date", "name"}, params["sort"].Schema.Enum)
+
+	// Path params are in braces, v1 is deprecated
+	getOrder := doc.Paths["/v2/orders/{order_id}"]["get"]
+	require.Equal(t, "order_id", getOrder.Parameters[0].Name)
+	require.Equal(t, "integer", getOrder.Parameters[0].Schema.Type)
+	require.True(t, doc.Paths["/orders/all"]["get"].Deprecated)
+
+	// Public routes don't need a token
+	require.Empty(t, doc.Paths["/v2/sessions"]["post"].Security)
+
+	recorder = httptest.NewRecorder()
+	server.router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/docs", nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Contains(t, recorder.Body.String(), "/openapi.json")
+}
+
+// Largest body the validation tests accept
+const testMaxBodySize = 1024
+
+// Test Scenario: requests that don't match the document never reach the handler
+func TestRequestValidation(t *testing.T){
+	doc, err := newOpenAPIDocument(routeDocs, v1RouteDocs)
+	require.NoError(t, err)
+
+	router := gin.New()
+	routes := router.Group("/").Use(requestValidationMiddleware(doc, testMaxBodySize))
+	ok := func(ctx *gin.Context) { ctx.Status(http.StatusOK) }
+	routes.POST("/v2/orders", ok)
+	routes.GET("/v2/orders", ok)
+	routes.GET("/v2/orders/:order_id", ok)
+	routes.POST("/v2/api_keys", ok)
+	routes.GET("/v2/search", ok)
+	routes.POST("/v2/users", ok)
+
+	validOrder := `{"username": "bead_lover", "full_name": "Jane Doe", "purchase_amount": 24.5, "purchased_item": "bracelet",
+		"shipping_location": "Halifax", "currency": "CAD", "date_ordered": "2022-08-01"}`
+
+	testCases := []struct {
+		name    string
+		method  string
+		url     string
+		body    string
+		code    int
+		message string // Part of the error
+	}{
+		{"valid body", http.MethodPost, "/v2/orders", validOrder, http.StatusOK, ""},
+		{"missing field", http.MethodPost, "/v2/orders", strings.Replace(validOrder, `"currency": "CAD",`, "", 1), http.StatusBadRequest, "currency is required"},
+		{"wrong type", http.MethodPost, "/v2/orders", strings.Replace(validOrder, "24.5", `"24.5"`, 1), http.StatusBadRequest, "purchase_amount must be a number"},
+		{"not in enum", http.MethodPost, "/v2/orders", strings.Replace(validOrder, "CAD", "GBP", 1), http.StatusBadRequest, "currency must be one of"},
+		{"empty body", http.MethodPost, "/v2/orders", "", http.StatusBadRequest, "request body is required"},
+		{"not JSON", http.MethodPost, "/v2/orders", "{", http.StatusBadRequest, "valid JSON"},
+		{"not an object", http.MethodPost, "/v2/orders", "[]", http.StatusBadRequest, "body must be a JSON object"},
+		{"too short", http.MethodPost, "/v2/users", `{"full_name": "Jane", "username": "jane", "password": "123"}`, http.StatusBadRequest, "password must be at least 6 characters"},
+		{"array items", http.MethodPost, "/v2/api_keys", `{"name": "shop", "scopes": ["orders:delete"], "expires_at": "2030-01-01T00:00:00Z"}`, http.StatusBadRequest, "scopes[0] must be one of"},
+		{"empty array", http.MethodPost, "/v2/api_keys", `{"name": "shop", "scopes": [], "expires_at": "2030-01-01T00:00:00Z"}`, http.StatusBadRequest, "scopes must have at least 1 items"},
+		{"bad date-time", http.MethodPost, "/v2/api_keys", `{"name": "shop", "scopes": ["orders:read"], "expires_at": "tomorrow"}`, http.StatusBadRequest, "expires_at must be an RFC 3339 date-time"},
+		{"valid query", http.MethodGet, "/v2/orders?page_size=10&sort=amount&min_amount=2.5", "", http.StatusOK, ""},
+		{"query not an integer", http.MethodGet, "/v2/orders?page_size=ten", "", http.StatusBadRequest, "page_size must be an integer"},
+		{"query below minimum", http.MethodGet, "/v2/orders?page_size=0", "", http.StatusBadRequest, "page_size must be at least 1"},
+		{"exclusive minimum", http.MethodGet, "/v2/orders?min_amount=0", "", http.StatusBadRequest, "min_amount must be greater than 0"},
+		{"query not in enum", http.MethodGet, "/v2/orders?order=sideways", "", http.StatusBadRequest, "order must be one of"},
+		{"required query", http.MethodGet, "/v2/search", "", http.StatusBadRequest, "q is required"},
+		{"path not an integer", http.MethodGet, "/v2/orders/abc", "", http.StatusBadRequest, "order_id must be an integer"},
+		{"body too large", http.MethodPost, "/v2/orders", validOrder + strings.Repeat(" ", testMaxBodySize), http.StatusRequestEntityTooLarge, codeBodyTooLarge},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(tc.method, tc.url, strings.NewReader(tc.body))
+			router.ServeHTTP(recorder, request)
+
+			require.Equal(t, tc.code, recorder.Code, recorder.Body.String())
+			if tc.message != "" {
+				require.Contains(t, recorder.Body.String(), tc.message)
+			}
+		})
+	}
+
+	// Bodies sent without a length are cut off at the limit
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPost, "/v2/orders", strings.NewReader(validOrder+strings.Repeat(" ", testMaxBodySize)))
+	request.ContentLength = -1
+	router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code)
+}
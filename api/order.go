@@ -1,11 +1,19 @@
 package api
 
 import (
+	"bytes"
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	sqlc "github.com/samanthatb1/beadBashStorage/db/sqlc"
+	"github.com/samanthatb1/beadBashStorage/util"
 )
 
 /**** CREATE ORDER ****/
@@ -19,18 +27,14 @@ type createOrderRequest struct {
 	DateOrdered      string  `json:"date_ordered" binding:"required"`
 }
 
-// Add createOrder function to the server instance
-func (server *Server) createOrder(ctx *gin.Context){
-	var reqBody createOrderRequest;
-
-	// If params are invalid
-	if err := ctx.ShouldBindJSON(&reqBody); err != nil { 
-		ctx.JSON(http.StatusBadRequest, errResponseToJSON(err))
-		return
-	}
+// Checks the rules the binding tags can't express
+func (reqBody createOrderRequest) validate() error {
+	return util.CheckUsername(reqBody.Username)
+}
 
-	// Create DB params
-	newOrderParams := sqlc.NewOrderTxParams{
+// DB params of the order
+func (reqBody createOrderRequest) txParams() sqlc.NewOrderTxParams {
+	return sqlc.NewOrderTxParams{
 		Username: reqBody.Username,
 		FullName: reqBody.FullName,
 		PurchaseAmount: reqBody.PurchaseAmount,
@@ -39,13 +43,28 @@ func (server *Server) createOrder(ctx *gin.Context){
 		Currency: reqBody.Currency,
 		DateOrdered: reqBody.DateOrdered,
 	}
+}
+
+// Add createOrder function to the server instance
+func (server *Server) createOrder(ctx *gin.Context){
+	var reqBody createOrderRequest;
+
+	// If params are invalid
+	if err := ctx.ShouldBindJSON(&reqBody); err != nil { 
+		sendInvalid(ctx, err)
+		return
+	}
+	if err := reqBody.validate(); err != nil {
+		sendInvalid(ctx, err)
+		return
+	}
 
 	// Access the store we constructed through the server instance
-	result, err := server.store.NewOrderTx(ctx, newOrderParams)
+	result, err := server.store.NewOrderTx(ctx, reqBody.txParams())
 
 	// Check if the DB insertion was successful 
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, errResponseToJSON(err))
+		sendError(ctx, err)
 		return
 	}
 	ctx.JSON(http.StatusOK, result)
@@ -62,137 +81,343 @@ func (server *Server) deleteOrderById(ctx *gin.Context){
 
 	// If params are invalid
 	if err := ctx.ShouldBindUri(&reqBody); err != nil { 
-		ctx.JSON(http.StatusBadRequest, errResponseToJSON(err))
+		sendInvalid(ctx, err)
 		return
 	}
 
+	// Only delete the version the client has seen, if it sent If-Match
+	deleteParams := sqlc.DeleteOrderTxParams{OrderID: reqBody.OrderId}
+	if versions, ok := ifMatchVersions(ctx); ok {
+		deleteParams.Versions = versions
+		if len(versions) == 0 { // None of our ETags, can't match
+			sendProblem(ctx, http.StatusPreconditionFailed, codeVersionMismatch, "Order was changed by someone else, fetch it again")
+			return
+		}
+	}
+
 	// Access the store we constructed through the server instance
-	result, err := server.store.DeleteOrderTx(ctx, sqlc.DeleteOrderTxParams{OrderID: reqBody.OrderId})
+	result, err := server.store.DeleteOrderTx(ctx, deleteParams)
 	// Check if the DB deletion was successful 
 	if err != nil {
 		if err == sql.ErrNoRows { // If that id doesnt exist
-			ctx.JSON(http.StatusNotFound, gin.H{"error" : "Order doesn't exist"})
+			sendProblem(ctx, http.StatusNotFound, codeOrderNotFound, "Order doesn't exist")
+			return
+		}
+		if err == sqlc.ErrVersionMismatch { // Changed since the client read it
+			sendProblem(ctx, http.StatusPreconditionFailed, codeVersionMismatch, "Order was changed by someone else, fetch it again")
 			return
 		}
-		ctx.JSON(http.StatusInternalServerError, errResponseToJSON(err))
+		sendError(ctx, err)
 		return
 	}
 
 	ctx.JSON(http.StatusOK, result)
 }
 
-/**** DELETE ORDER ****/
-type updateOrderByIdRequest struct {
-	OrderId  				 int64  `json:"order_id" binding:"required"`
-	PurchaseAmount   float64 `json:"purchase_amount"`
-	PurchasedItem    string  `json:"purchased_item"`
-	ShippingLocation string  `json:"shipping_location"`
+/**** GET ORDER ****/
+type getOrderRequest struct {
+	OrderId   int64  `uri:"order_id" binding:"required"`
 }
 
-// Add deleteOrder function to the server instance
-func (server *Server) updateOrderById(ctx *gin.Context){
-	var reqBody updateOrderByIdRequest;
+// Add getOrderById function to the server instance
+func (server *Server) getOrderById(ctx *gin.Context){
+	var reqBody getOrderRequest
+	var reqQuery fieldsRequest
 
 	// If params are invalid
-	if err := ctx.ShouldBindJSON(&reqBody); err != nil { 
-		ctx.JSON(http.StatusBadRequest, errResponseToJSON(err))
+	if err := ctx.ShouldBindUri(&reqBody); err != nil {
+		sendInvalid(ctx, err)
+		return
+	}
+	if err := ctx.ShouldBindQuery(&reqQuery); err != nil {
+		sendInvalid(ctx, err)
+		return
+	}
+	set, ok := bindFieldSet(ctx, reqQuery, orderFields, orderRelations)
+	if !ok {
 		return
 	}
 
-	// Get order to update
-	orderToUpdate, err := server.store.GetOrderById(ctx, reqBody.OrderId)
-	// Check if DB search was successful
+	order, err := server.store.GetOrderById(ctx, reqBody.OrderId)
 	if err != nil {
 		if err == sql.ErrNoRows { // If that id doesnt exist
-			ctx.JSON(http.StatusNotFound, gin.H{"error" : "Order doesn't exist"})
+			sendProblem(ctx, http.StatusNotFound, codeOrderNotFound, "Order doesn't exist")
 			return
 		}
-		ctx.JSON(http.StatusInternalServerError, errResponseToJSON(err))
+		sendError(ctx, err)
+		return
+	}
+
+	// Embed the user and leave out the fields the client didn't pick
+	rendered, err := server.renderOrders(ctx, set, []sqlc.Order{order})
+	if err != nil {
+		sendError(ctx, err)
 		return
 	}
 
-	updateOrderParams := sqlc.UpdateOrderParams{}
-	updateOrderParams.OrderID = reqBody.OrderId
+	// Send the order, or 304 if it hasn't changed since the client read it
+	etag, lastModified := set.validators(order.Version, order.UpdatedAt)
+	sendConditional(ctx, etag, lastModified, rendered[0])
+}
 
-	// If user sent data to update, change it; if not, keep the same
-	if reqBody.PurchaseAmount == 0 { 
-		updateOrderParams.PurchaseAmount = orderToUpdate.PurchaseAmount
-	} else { updateOrderParams.PurchaseAmount = reqBody.PurchaseAmount }
+/**** UPDATE ORDER ****/
 
-	if reqBody.PurchasedItem == "" { 
-		updateOrderParams.PurchasedItem = orderToUpdate.PurchasedItem
-	} else { updateOrderParams.PurchasedItem = reqBody.PurchasedItem }
+// JSON Merge Patch (RFC 7396), PATCH /v2/orders/:order_id takes it
+const mergePatchContentType = "application/merge-patch+json"
 
-	if reqBody.ShippingLocation == "" { 
-		updateOrderParams.ShippingLocation = orderToUpdate.ShippingLocation
-	} else { updateOrderParams.ShippingLocation = reqBody.ShippingLocation }
+// Fields that can be changed, empty fields are kept
+// v1 bodies and v2 bodies sent as application/json, so a field can't be set to 0 or ""
+type updateOrderFields struct {
+	PurchaseAmount   float64 `json:"purchase_amount"`
+	PurchasedItem    string  `json:"purchased_item"`
+	ShippingLocation string  `json:"shipping_location"`
+}
 
-	result, err := server.store.UpdateOrder(ctx, updateOrderParams)
-	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, errResponseToJSON(err))
+// The fields that aren't empty
+func (fields updateOrderFields) txParams(orderId int64) sqlc.PatchOrderTxParams {
+	params := sqlc.PatchOrderTxParams{OrderID: orderId}
+	if fields.PurchaseAmount != 0 {
+		params.PurchaseAmount = &fields.PurchaseAmount
+	}
+	if fields.PurchasedItem != "" {
+		params.PurchasedItem = &fields.PurchasedItem
+	}
+	if fields.ShippingLocation != "" {
+		params.ShippingLocation = &fields.ShippingLocation
+	}
+	return params
+}
+
+// Body of PATCH /v2/orders/:order_id sent as application/merge-patch+json
+// Members that are left out are kept, null removes the value and only shipping_location can be removed
+type orderMergePatch struct {
+	PurchaseAmount   *float64 `json:"purchase_amount" binding:"omitempty,gt=0"`
+	PurchasedItem    *string  `json:"purchased_item" binding:"omitempty,min=1"`
+	ShippingLocation *string  `json:"shipping_location"` // null or "" clears it
+	Currency         *string  `json:"currency" binding:"omitempty,oneof=USD EUR CAD"`
+	DateOrdered      *string  `json:"date_ordered" binding:"omitempty,min=1"`
+	FullName         *string  `json:"full_name" binding:"omitempty,min=1"`
+}
+
+// Order fields a patch can't change
+var readOnlyOrderFields = []string{"order_id", "account_id", "username", "version", "created_at", "external_source", "external_id"}
+
+// Reads the merge patch in the body, members with the wrong type or value are rejected
+func readOrderMergePatch(ctx *gin.Context, orderId int64) (sqlc.PatchOrderTxParams, error) {
+	params := sqlc.PatchOrderTxParams{OrderID: orderId}
+	body, err := io.ReadAll(ctx.Request.Body)
+	if err != nil {return params, err}
+
+	// null and a missing member both decode to nil, so nulls are found first
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(body, &members); err != nil || members == nil {
+		return params, errors.New("body must be a JSON object")
+	}
+	for _, name := range readOnlyOrderFields {
+		if _, ok := members[name]; ok {
+			return params, fmt.Errorf("%s can't be changed", name)
+		}
+	}
+	if value, ok := members["shipping_location"]; ok && isJSONNull(value) {
+		params.ShippingLocation = new(string)
+	}
+	for _, name := range []string{"purchase_amount", "purchased_item", "currency", "date_ordered", "full_name"} {
+		if value, ok := members[name]; ok && isJSONNull(value) {
+			return params, fmt.Errorf("%s can't be removed", name)
+		}
+	}
+
+	var patch orderMergePatch
+	if err := json.Unmarshal(body, &patch); err != nil {return params, err}
+	if err := binding.Validator.ValidateStruct(patch); err != nil {return params, err} // Pointers that aren't nil are checked, so 0 and "" fail
+
+	params.PurchaseAmount = patch.PurchaseAmount
+	params.PurchasedItem = patch.PurchasedItem
+	params.Currency = patch.Currency
+	params.DateOrdered = patch.DateOrdered
+	params.FullName = patch.FullName
+	if patch.ShippingLocation != nil {
+		params.ShippingLocation = patch.ShippingLocation
+	}
+	return params, nil
+}
+
+func isJSONNull(value json.RawMessage) bool {
+	return string(bytes.TrimSpace(value)) == "null"
+}
+
+type updateOrderByIdRequest struct {
+	OrderId  				 int64  `json:"order_id" binding:"required"`
+	updateOrderFields
+}
+
+// Add updateOrderById function to the server instance
+// v1: the order id is in the body
+func (server *Server) updateOrderById(ctx *gin.Context){
+	var reqBody updateOrderByIdRequest;
+
+	// If params are invalid
+	if err := ctx.ShouldBindJSON(&reqBody); err != nil { 
+		sendInvalid(ctx, err)
 		return
 	}
 
-	ctx.JSON(http.StatusOK, result)
+	server.patchOrder(ctx, reqBody.updateOrderFields.txParams(reqBody.OrderId))
 }
 
-/**** LIST ORDERS FROM USER ****/
-type listOrdersOfUserRequest struct {
-	Username   string  `uri:"username" binding:"required"`
+type updateOrderUriRequest struct {
+	OrderId   int64  `uri:"order_id" binding:"required"`
 }
 
-// Add listOrdersOfUser function to the server instance
-func (server *Server) listOrdersOfUser(ctx *gin.Context){
-	var reqBody listOrdersOfUserRequest;
+// Add updateOrderByUri function to the server instance
+// v2: the order id is in the path, the body is a merge patch if it's sent as application/merge-patch+json
+func (server *Server) updateOrderByUri(ctx *gin.Context){
+	var uriParams updateOrderUriRequest
 
 	// If params are invalid
-	if err := ctx.ShouldBindUri(&reqBody); err != nil {
-		ctx.JSON(http.StatusBadRequest, errResponseToJSON(err))
+	if err := ctx.ShouldBindUri(&uriParams); err != nil {
+		sendInvalid(ctx, err)
+		return
+	}
+
+	if ctx.ContentType() == mergePatchContentType {
+		params, err := readOrderMergePatch(ctx, uriParams.OrderId)
+		if err != nil {
+			sendInvalid(ctx, err)
+			return
+		}
+		server.patchOrder(ctx, params)
+		return
+	}
+
+	var reqBody updateOrderFields
+	if err := ctx.ShouldBindJSON(&reqBody); err != nil {
+		sendInvalid(ctx, err)
 		return
 	}
-	orders, err := server.store.ListOrdersByUsername(ctx, reqBody.Username)
-	// Check if DB search was successful
+	server.patchOrder(ctx, reqBody.txParams(uriParams.OrderId))
+}
+
+// Changes the order's fields in one write and sends the updated order to the client
+func (server *Server) patchOrder(ctx *gin.Context, params sqlc.PatchOrderTxParams){
+	// Only change the version the client has seen, if it sent If-Match
+	if versions, ok := ifMatchVersions(ctx); ok {
+		if len(versions) == 0 { // None of our ETags, can't match
+			sendProblem(ctx, http.StatusPreconditionFailed, codeVersionMismatch, "Order was changed by someone else, fetch it again")
+			return
+		}
+		params.Versions = versions
+	}
+
+	result, err := server.store.PatchOrderTx(ctx, params)
 	if err != nil {
 		if err == sql.ErrNoRows { // If that id doesnt exist
-			ctx.JSON(http.StatusNotFound, gin.H{"error" : "User doesn't exist"})
+			sendProblem(ctx, http.StatusNotFound, codeOrderNotFound, "Order doesn't exist")
+			return
+		}
+		if err == sqlc.ErrVersionMismatch { // Changed since the client read it
+			sendProblem(ctx, http.StatusPreconditionFailed, codeVersionMismatch, "Order was changed by someone else, fetch it again")
 			return
 		}
-		ctx.JSON(http.StatusInternalServerError, errResponseToJSON(err))
+		sendError(ctx, err)
 		return
 	}
 
-	ctx.JSON(http.StatusOK, orders)
+	ctx.Header("ETag", versionETag(result.Version))
+	ctx.JSON(http.StatusOK, result)
 }
 
 /**** LIST ORDERS ****/
+
+// Filters shared by both order lists
 type listOrdersRequest struct {
-	PageId    int32 `form:"page_id" binding:"required"`
-	PageSize  int32 `form:"page_size" binding:"required,min=5,max=10"`
+	pageRequest
+	orderFilterRequest
+	fieldsRequest
+	Sort              string  `form:"sort" binding:"omitempty,oneof=id date amount name"` // name sorts by username
 }
 
-// Add listUsers function to the server instance
-func (server *Server) listAllOrders(ctx *gin.Context){
-	var reqBody listUsersRequest;
+// Filters of the order lists, exports take the same ones
+type orderFilterRequest struct {
+	Tag               string  `form:"tag"` // Optional: only orders with this tag
+	Currency          string  `form:"currency" binding:"omitempty,oneof=USD EUR CAD"`
+	MinAmount         float64 `form:"min_amount" binding:"omitempty,gt=0"`
+	MaxAmount         float64 `form:"max_amount" binding:"omitempty,gt=0,gtefield=MinAmount"`
+	ShippingLocation  string  `form:"shipping_location"` // Exact match, case is ignored
+	Item              string  `form:"item"` // Purchased item contains this, case is ignored
+}
+
+func (req orderFilterRequest) filter(username string) sqlc.OrderFilter {
+	return sqlc.OrderFilter{
+		Username: username,
+		Tag: normalizeTag(req.Tag),
+		Currency: req.Currency,
+		MinAmount: req.MinAmount,
+		MaxAmount: req.MaxAmount,
+		ShippingLocation: req.ShippingLocation,
+		Item: req.Item,
+	}
+}
+
+// Lists a page of orders and sends it to the client
+func (server *Server) listOrdersPage(ctx *gin.Context, username string){
+	var reqBody listOrdersRequest
 
 	// If params are invalid
-	if err := ctx.ShouldBindQuery(&reqBody); err != nil { 
-		ctx.JSON(http.StatusBadRequest, errResponseToJSON(err))
+	if err := ctx.ShouldBindQuery(&reqBody); err != nil {
+		sendInvalid(ctx, err)
 		return
 	}
-
-	args := sqlc.ListAllOrdersParams{
-		Limit: reqBody.PageSize,
-		Offset: (reqBody.PageId - 1) * reqBody.PageSize,
+	params, err := server.pageParams(reqBody.pageRequest, reqBody.Sort)
+	if err != nil {
+		sendInvalid(ctx, err)
+		return
+	}
+	set, ok := bindFieldSet(ctx, reqBody.fieldsRequest, orderFields, orderRelations)
+	if !ok {
+		return
 	}
 
 	// Access the store we constructed through the server instance
-	orders, err := server.store.ListAllOrders(ctx, args)
+	page, err := server.store.ListOrdersPage(ctx, reqBody.filter(username), params)
 	// Check if the DB fetch was successful 
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, errResponseToJSON(err))
+		sendError(ctx, err)
+		return
+	}
+	// The users of the whole page are read with one query
+	orders, err := server.renderOrders(ctx, set, page.Orders)
+	if err != nil {
+		sendError(ctx, err)
+		return
+	}
+
+	// Success, send orders back to client, or 304 if the page hasn't changed
+	// No Last-Modified, a row leaving the page or a new total wouldn't move it
+	sendConditional(ctx, "", time.Time{}, newPageResponse(orders, params, page.Next, page.Total))
+}
+
+/**** LIST ORDERS FROM USER ****/
+type listOrdersOfUserRequest struct {
+	Username   string  `uri:"username" binding:"required"`
+}
+
+// Add listOrdersOfUser function to the server instance
+func (server *Server) listOrdersOfUser(ctx *gin.Context){
+	var reqBody listOrdersOfUserRequest;
+
+	// If params are invalid
+	if err := ctx.ShouldBindUri(&reqBody); err != nil {
+		sendInvalid(ctx, err)
 		return
 	}
 
-	// Success, send user back to client
-	ctx.JSON(http.StatusOK, orders)
+	server.listOrdersPage(ctx, reqBody.Username)
+}
+
+/**** LIST ALL ORDERS ****/
+
+// Add listAllOrders function to the server instance
+func (server *Server) listAllOrders(ctx *gin.Context){
+	server.listOrdersPage(ctx, "")
 }
\ No newline at end of file
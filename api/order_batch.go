@@ -0,0 +1,145 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	sqlc "github.com/samanthatb1/beadBashStorage/db/sqlc"
+)
+
+/**** BATCH ORDERS ****/
+const (
+	batchAllOrNothing = "all_or_nothing" // Every order is created or none, the default
+	batchBestEffort   = "best_effort"    // Orders are created one by one, failed ones are reported next to the others
+)
+
+type batchOrdersRequest struct {
+	Mode   string               `json:"mode" binding:"omitempty,oneof=all_or_nothing best_effort"`
+	Orders []createOrderRequest `json:"orders" binding:"required,min=1,max=500"` // Checked one by one, so each gets its own error
+}
+
+// Outcome of one order of the batch
+type batchOrderResult struct {
+	Index  int          `json:"index"`  // Position of the order in the request
+	Status int          `json:"status"` // Status the order would get on its own
+	Order  *sqlc.Order  `json:"order,omitempty"`
+	Error  *itemProblem `json:"error,omitempty"`
+}
+
+type batchOrdersResponse struct {
+	Mode        string             `json:"mode"`
+	Created     int                `json:"created"`
+	Failed      int                `json:"failed"`
+	Results     []batchOrderResult `json:"results"`      // Same order as the request
+	EditedUsers []sqlc.User        `json:"edited_users"` // Every user the batch touched, with their final total_orders
+}
+
+// Add createOrders function to the server instance
+func (server *Server) createOrders(ctx *gin.Context){
+	var reqBody batchOrdersRequest
+
+	// If params are invalid
+	if err := ctx.ShouldBindJSON(&reqBody); err != nil {
+		sendInvalid(ctx, err)
+		return
+	}
+
+	// Check every order before touching the DB
+	invalid := map[int]*itemProblem{}
+	for i, order := range reqBody.Orders {
+		err := binding.Validator.ValidateStruct(order)
+		if err == nil {
+			err = order.validate()
+		}
+		if err != nil {
+			invalid[i] = &itemProblem{Index: i, Status: http.StatusBadRequest, Code: codeInvalidRequest, Detail: err.Error()}
+		}
+	}
+
+	if reqBody.Mode == batchBestEffort {
+		server.createOrdersBestEffort(ctx, reqBody.Orders, invalid)
+		return
+	}
+	server.createOrdersAllOrNothing(ctx, reqBody.Orders, invalid)
+}
+
+// Creates every order in one transaction, any invalid or failing order rejects the batch
+func (server *Server) createOrdersAllOrNothing(ctx *gin.Context, orders []createOrderRequest, invalid map[int]*itemProblem){
+	if len(invalid) > 0 {
+		items := make([]itemProblem, 0, len(invalid))
+		for _, item := range invalid {
+			items = append(items, *item)
+		}
+		sort.Slice(items, func(i, j int) bool { return items[i].Index < items[j].Index })
+		detail := fmt.Sprintf("%d of %d orders are invalid, none were created", len(items), len(orders))
+		sendItemProblems(ctx, http.StatusBadRequest, codeInvalidRequest, detail, items)
+		return
+	}
+
+	params := make([]sqlc.NewOrderTxParams, len(orders))
+	for i, order := range orders {
+		params[i] = order.txParams()
+	}
+
+	result, err := server.store.BatchOrderTx(ctx, params)
+	if err != nil {
+		var orderErr *sqlc.BatchOrderError
+		if !errors.As(err, &orderErr) { // Not caused by one of the orders, e.g. the DB is down
+			sendError(ctx, err)
+			return
+		}
+		// The batch fails with the status and code of the order that failed
+		status, code, detail := describeError(ctx, orderErr.Err)
+		item := itemProblem{Index: orderErr.Index, Status: status, Code: code, Detail: detail}
+		sendItemProblems(ctx, status, code, fmt.Sprintf("Order %d failed, none were created: %s", orderErr.Index, detail), []itemProblem{item})
+		return
+	}
+
+	response := batchOrdersResponse{Mode: batchAllOrNothing, Created: len(result.Orders), EditedUsers: result.EditedUsers}
+	for i := range result.Orders {
+		response.Results = append(response.Results, batchOrderResult{Index: i, Status: http.StatusOK, Order: &result.Orders[i]})
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// Creates the valid orders one by one, each in its own transaction
+// 207 Multi-Status if some of them failed
+func (server *Server) createOrdersBestEffort(ctx *gin.Context, orders []createOrderRequest, invalid map[int]*itemProblem){
+	response := batchOrdersResponse{Mode: batchBestEffort, Results: make([]batchOrderResult, len(orders))}
+	users := map[string]sqlc.User{} // Latest state of each user, orders run in sequence
+
+	for i, order := range orders {
+		if problem, ok := invalid[i]; ok {
+			response.Results[i] = batchOrderResult{Index: i, Status: problem.Status, Error: problem}
+			response.Failed++
+			continue
+		}
+
+		result, err := server.store.NewOrderTx(ctx, order.txParams())
+		if err != nil {
+			status, code, detail := describeError(ctx, err)
+			response.Results[i] = batchOrderResult{Index: i, Status: status, Error: &itemProblem{Index: i, Status: status, Code: code, Detail: detail}}
+			response.Failed++
+			continue
+		}
+		response.Results[i] = batchOrderResult{Index: i, Status: http.StatusOK, Order: &result.OrderMade}
+		response.Created++
+		users[result.EditedUser.Username] = result.EditedUser
+	}
+
+	response.EditedUsers = make([]sqlc.User, 0, len(users))
+	for _, user := range users {
+		response.EditedUsers = append(response.EditedUsers, user)
+	}
+	sort.Slice(response.EditedUsers, func(i, j int) bool { return response.EditedUsers[i].Username < response.EditedUsers[j].Username })
+
+	status := http.StatusOK
+	if response.Failed > 0 {
+		status = http.StatusMultiStatus
+	}
+	ctx.JSON(status, response)
+}
@@ -0,0 +1,96 @@
+// Unit tests for checking the orders of a batch, before any of them reach the DB
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/samanthatb1/beadBashStorage/util"
+	"github.com/stretchr/testify/require"
+)
+
+/* Helper Functions */
+
+const validBatchOrder = `{"username": "bead_lover", "full_name": "Bea Lover", "purchase_amount": 12.5, "purchased_item": "Necklace", "shipping_location": "Toronto", "currency": "CAD", "date_ordered": "2022-10-01"}`
+
+func postBatch(t *testing.T, server *Server, body string) *httptest.ResponseRecorder {
+	tokenMaker, err := newTestTokenMaker()
+	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPost, "/v2/orders/batch", strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	addAuthorization(t, request, tokenMaker, testCustomer, util.FulfillmentRole)
+	server.router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+/* Test Functions */
+
+// Test Scenario: one invalid order rejects an all or nothing batch, with every invalid order listed
+func TestBatchOrdersAllOrNothingInvalid(t *testing.T){
+	server := newTestServer(t)
+
+	body := fmt.Sprintf(`{"orders": [%s, {"username": "bead_lover"}, %s, {"username": "x", "full_name": "X", "purchase_amount": 1, "purchased_item": "Ring", "shipping_location": "Paris", "currency": "GBP", "date_ordered": "2022-10-01"}]}`, validBatchOrder, validBatchOrder)
+	recorder := postBatch(t, server, body)
+	require.Equal(t, http.StatusBadRequest, recorder.Code, recorder.Body.String())
+	require.Equal(t, problemContentType, recorder.Header().Get("Content-Type"))
+
+	var response problem
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	require.Equal(t, codeInvalidRequest, response.Code)
+	require.Len(t, response.Items, 2)
+	require.Equal(t, 1, response.Items[0].Index)
+	require.Equal(t, 3, response.Items[1].Index)
+	require.Contains(t, response.Items[1].Detail, "Currency")
+}
+
+// Test Scenario: invalid orders of a best effort batch are reported one by one
+func TestBatchOrdersBestEffortInvalid(t *testing.T){
+	server := newTestServer(t)
+
+	recorder := postBatch(t, server, `{"mode": "best_effort", "orders": [{"username": "a"}, {"currency": "USD"}]}`)
+	require.Equal(t, http.StatusMultiStatus, recorder.Code, recorder.Body.String())
+
+	var response batchOrdersResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	require.Equal(t, batchBestEffort, response.Mode)
+	require.Equal(t, 0, response.Created)
+	require.Equal(t, 2, response.Failed)
+	require.Empty(t, response.EditedUsers)
+	for i, result := range response.Results {
+		require.Equal(t, i, result.Index)
+		require.Equal(t, http.StatusBadRequest, result.Status)
+		require.Nil(t, result.Order)
+		require.Equal(t, codeInvalidRequest, result.Error.Code)
+	}
+}
+
+// Test Scenario: the batch itself has to be well formed
+func TestBatchOrdersRequest(t *testing.T){
+	server := newTestServer(t)
+
+	tooMany := strings.TrimSuffix(strings.Repeat(validBatchOrder+",", 501), ",")
+	testCases := []struct {
+		name string
+		body string
+	}{
+		{"NoOrders", `{"orders": []}`},
+		{"MissingOrders", `{"mode": "best_effort"}`},
+		{"UnknownMode", fmt.Sprintf(`{"mode": "some", "orders": [%s]}`, validBatchOrder)},
+		{"TooMany", fmt.Sprintf(`{"orders": [%s]}`, tooMany)},
+		{"WrongType", `{"mode": "best_effort", "orders": [{"purchase_amount": "twelve"}]}`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := postBatch(t, server, tc.body)
+			require.Equal(t, http.StatusBadRequest, recorder.Code, recorder.Body.String())
+		})
+	}
+}
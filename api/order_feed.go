@@ -0,0 +1,229 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samanthatb1/beadBashStorage/feed"
+	"github.com/samanthatb1/beadBashStorage/token"
+	"golang.org/x/net/websocket"
+)
+
+const (
+	orderFeedKeepAlive = 15 * time.Second // Proxies close connections that stay quiet for too long
+	orderFeedRetry     = 3 * time.Second  // How long EventSource waits before reconnecting
+	orderFeedReset     = "reset"          // Sent instead of the missed events when they can't all be resent
+	orderFeedPing      = "ping"           // WebSocket keep alive, SSE uses a comment
+)
+
+/**** ORDER FEED ****/
+type orderFeedRequest struct {
+	LastEventID int64 `form:"last_event_id" binding:"omitempty,min=1"` // Resume after this event, the Last-Event-ID header wins
+	Ticket string `form:"ticket"` // From POST /v2/events/orders/tickets, for browsers instead of the Authorization header
+}
+
+// A client's feed: the events it missed, then the live ones
+type orderFeedStream struct {
+	sub     *feed.Subscription
+	backlog []feed.Event
+	reset   bool // Some missed events are gone, the client should reload the orders
+}
+
+// Browsers send the origin of the page, only ORDER_FEED_ALLOWED_ORIGINS may open the feed
+// Without the check any site could open the WebSocket for a logged in staff member; other clients don't send an Origin
+func orderFeedOriginMiddleware(allowed map[string]bool) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		origin := ctx.GetHeader("Origin")
+		if origin != "" {
+			if !allowed[origin] {
+				sendProblem(ctx, http.StatusForbidden, codeForbidden, fmt.Sprintf("pages on %s can't open the order feed", origin))
+				return
+			}
+			ctx.Header("Access-Control-Allow-Origin", origin) // EventSource on another origin needs it
+			ctx.Header("Vary", "Origin")
+		}
+		ctx.Next()
+	}
+}
+
+// Reads "https://a.example.com,https://b.example.com", origins are compared as browsers send them
+func parseOrigins(list string) map[string]bool {
+	origins := map[string]bool{}
+	for _, origin := range splitConfigList(list) {
+		origins[strings.TrimRight(origin, "/")] = true
+	}
+	return origins
+}
+
+// Subscribes to the feed and reads the events the client missed, sends a problem if it can't
+func (server *Server) openOrderFeed(ctx *gin.Context) (*orderFeedStream, bool) {
+	var reqQuery orderFeedRequest
+
+	// If params are invalid
+	if err := ctx.ShouldBindQuery(&reqQuery); err != nil {
+		sendInvalid(ctx, err)
+		return nil, false
+	}
+	afterID := reqQuery.LastEventID
+	if header := ctx.GetHeader("Last-Event-ID"); header != "" {
+		id, err := strconv.ParseInt(header, 10, 64)
+		if err != nil || id < 0 {
+			sendInvalid(ctx, fmt.Errorf("Last-Event-ID must be the id of an event"))
+			return nil, false
+		}
+		afterID = id
+	}
+
+	stream := &orderFeedStream{sub: server.orderFeed.Subscribe()}
+	if afterID == 0 {
+		return stream, true // Only new events
+	}
+
+	backlog, complete, err := server.orderFeed.Backlog(ctx, afterID)
+	if err != nil {
+		stream.sub.Close()
+		sendError(ctx, err)
+		return nil, false
+	}
+	stream.backlog, stream.reset = backlog, !complete
+	return stream, true
+}
+
+// Sends the stream until the client goes away, the context is done or the client fell too far behind
+func (stream *orderFeedStream) run(ctx context.Context, send func(feed.Event) error, keepAlive func() error) error {
+	defer stream.sub.Close()
+
+	if stream.reset {
+		if err := send(feed.Event{Event: orderFeedReset}); err != nil {return err}
+	}
+	sent := make(map[int64]bool, len(stream.backlog)) // An event can be in the backlog and come in live too
+	for _, event := range stream.backlog {
+		if err := send(event); err != nil {return err}
+		sent[event.ID] = true
+	}
+	stream.backlog = nil
+
+	ticker := time.NewTicker(orderFeedKeepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := keepAlive(); err != nil {return err}
+		case event, ok := <-stream.sub.Events():
+			if !ok {
+				return nil // Fell behind, the client reconnects with the last id it got
+			}
+			if sent[event.ID] {
+				continue
+			}
+			if err := send(event); err != nil {return err}
+		}
+	}
+}
+
+// Add streamOrderEvents function to the server instance
+// Server-Sent Events: order.created, order.updated and order.deleted with the order as data
+func (server *Server) streamOrderEvents(ctx *gin.Context){
+	stream, ok := server.openOrderFeed(ctx)
+	if !ok {
+		return
+	}
+	defer stream.sub.Close()
+
+	ctx.Header("Content-Type", "text/event-stream")
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Header("X-Accel-Buffering", "no") // Proxies like nginx would hold events back otherwise
+	ctx.Status(http.StatusOK)
+	fmt.Fprintf(ctx.Writer, "retry: %d\n\n", orderFeedRetry.Milliseconds())
+	ctx.Writer.Flush()
+
+	send := func(event feed.Event) error {
+		if err := writeServerSentEvent(ctx.Writer, event); err != nil {return err}
+		ctx.Writer.Flush()
+		return nil
+	}
+	keepAlive := func() error {
+		if _, err := io.WriteString(ctx.Writer, ": ping\n\n"); err != nil {return err}
+		ctx.Writer.Flush()
+		return nil
+	}
+	if err := stream.run(ctx.Request.Context(), send, keepAlive); err != nil {
+		ctx.Error(err) // Client went away
+	}
+}
+
+// Writes the event in the text/event-stream format, the data is one line of JSON
+func writeServerSentEvent(w io.Writer, event feed.Event) error {
+	if event.ID != 0 {
+		if _, err := fmt.Fprintf(w, "id: %d\n", event.ID); err != nil {return err}
+	}
+	data := []byte(event.Data)
+	if len(data) == 0 {
+		data = []byte("{}")
+	}
+	_, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Event, data)
+	return err
+}
+
+// Add streamOrderEventsWebSocket function to the server instance
+// Same events as streamOrderEvents, each one a JSON text message: {"id", "event", "order_id", "data"}
+func (server *Server) streamOrderEventsWebSocket(ctx *gin.Context){
+	stream, ok := server.openOrderFeed(ctx)
+	if !ok {
+		return
+	}
+	defer stream.sub.Close() // Also when the handshake fails
+
+	websocket.Server{
+		// orderFeedOriginMiddleware already checked the origin, and clients without one don't have to send it
+		Handshake: func(config *websocket.Config, request *http.Request) error { return nil },
+		Handler: func(conn *websocket.Conn) {
+			streamCtx, cancel := context.WithCancel(ctx.Request.Context())
+			defer cancel()
+			go func() {
+				// Clients don't send anything, reading only notices when they close the connection
+				io.Copy(io.Discard, conn)
+				cancel()
+			}()
+
+			send := func(event feed.Event) error {
+				return websocket.JSON.Send(conn, event)
+			}
+			keepAlive := func() error {
+				return websocket.JSON.Send(conn, feed.Event{Event: orderFeedPing})
+			}
+			if err := stream.run(streamCtx, send, keepAlive); err != nil {
+				ctx.Error(err)
+			}
+		},
+	}.ServeHTTP(ctx.Writer, ctx.Request)
+}
+
+/**** ORDER FEED TICKET ****/
+type orderFeedTicketResponse struct {
+	Ticket    string    `json:"ticket"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Add createOrderFeedTicket function to the server instance
+// Browsers can't send the Authorization header with EventSource or WebSocket, so they open the feed with ?ticket=
+// Tickets only open the feed and expire after ORDER_FEED_TICKET_DURATION, they end up in URLs and logs
+func (server *Server) createOrderFeedTicket(ctx *gin.Context){
+	authPayload := ctx.MustGet(authorizationPayloadKey).(*token.Payload)
+
+	ticket, payload, err := server.tokenMaker.CreateToken(authPayload.Username, authPayload.Role, token.FeedTicket, server.config.OrderFeedTicketDuration)
+	if err != nil {
+		sendError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, orderFeedTicketResponse{Ticket: ticket, ExpiresAt: payload.ExpiredAt})
+}
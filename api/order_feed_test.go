@@ -0,0 +1,298 @@
+// Unit tests for the live order feed, events come from a fake store instead of the DB
+
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	sqlc "github.com/samanthatb1/beadBashStorage/db/sqlc"
+	"github.com/samanthatb1/beadBashStorage/feed"
+	"github.com/samanthatb1/beadBashStorage/token"
+	"github.com/samanthatb1/beadBashStorage/util"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/websocket"
+)
+
+/* Helper Functions */
+
+const testStudioOrigin = "https://studio.example.com" // Page allowed to open the feed
+
+// Committed events in id order
+type fakeOrderEventStore struct {
+	mu     sync.Mutex
+	events []sqlc.OrderEvent
+}
+
+func (store *fakeOrderEventStore) commit(ids ...int64) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	for _, id := range ids {
+		store.events = append(store.events, sqlc.OrderEvent{ID: id, Event: sqlc.EventOrderUpdated, OrderID: 7, Payload: `{"order_id":7}`})
+	}
+}
+
+func (store *fakeOrderEventStore) ListOrderEventsAfter(ctx context.Context, arg sqlc.ListOrderEventsAfterParams) ([]sqlc.OrderEvent, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	events := []sqlc.OrderEvent{}
+	for _, event := range store.events {
+		if event.ID > arg.ID && len(events) < int(arg.Limit) {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (store *fakeOrderEventStore) GetOrderEventBounds(ctx context.Context) (sqlc.GetOrderEventBoundsRow, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if len(store.events) == 0 {
+		return sqlc.GetOrderEventBoundsRow{}, nil
+	}
+	return sqlc.GetOrderEventBoundsRow{OldestID: store.events[0].ID, LatestID: store.events[len(store.events)-1].ID}, nil
+}
+
+func (store *fakeOrderEventStore) PruneOrderEvents(ctx context.Context, retention time.Duration) (int64, error) {
+	return 0, nil
+}
+
+// Test server whose feed reads from the fake store, the hub is fetched by hand instead of run
+func newOrderFeedTestServer(t *testing.T, store *fakeOrderEventStore) (*Server, *httptest.Server) {
+	server := newTestServer(t)
+	server.orderFeed = feed.NewHub(store, feed.Options{GapTimeout: time.Minute})
+	server.orderFeedOrigins[testStudioOrigin] = true
+	require.NoError(t, server.orderFeed.Fetch(context.Background())) // Catches up to the committed events like Run does
+	httpServer := httptest.NewServer(server.router)
+	t.Cleanup(httpServer.Close)
+	return server, httpServer
+}
+
+// Reads the next event of the stream, skipping comments and the retry field
+func readServerSentEvent(t *testing.T, reader *bufio.Reader) string {
+	var event strings.Builder
+	for {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		if line == "\n" {
+			if event.Len() > 0 {
+				return event.String()
+			}
+			continue
+		}
+		if strings.HasPrefix(line, ":") || strings.HasPrefix(line, "retry:") {
+			continue
+		}
+		event.WriteString(line)
+	}
+}
+
+/* Test Functions */
+
+// Test Scenario: events are written in the text/event-stream format
+func TestWriteServerSentEvent(t *testing.T){
+	testCases := []struct {
+		name  string
+		event feed.Event
+		text  string
+	}{
+		{"Order", feed.Event{ID: 12, Event: sqlc.EventOrderCreated, OrderID: 3, Data: []byte(`{"order_id":3}`)}, "id: 12\nevent: order.created\ndata: {\"order_id\":3}\n\n"},
+		{"Reset", feed.Event{Event: orderFeedReset}, "event: reset\ndata: {}\n\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buffer bytes.Buffer
+			require.NoError(t, writeServerSentEvent(&buffer, tc.event))
+			require.Equal(t, tc.text, buffer.String())
+		})
+	}
+}
+
+// Test Scenario: ids to resume after must be positive numbers
+func TestOrderFeedBadLastEventID(t *testing.T){
+	server := newTestServer(t)
+	tokenMaker, err := newTestTokenMaker()
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name   string
+		url    string
+		header string
+	}{
+		{"BadQuery", "/v2/events/orders?last_event_id=0", ""},
+		{"BadHeader", "/v2/events/orders", "yesterday"},
+		{"NegativeHeader", "/v2/events/orders/ws", "-4"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodGet, tc.url, nil)
+			if tc.header != "" {
+				request.Header.Set("Last-Event-ID", tc.header)
+			}
+			addAuthorization(t, request, tokenMaker, testCustomer, util.AdminRole)
+			server.router.ServeHTTP(recorder, request)
+			require.Equal(t, http.StatusBadRequest, recorder.Code)
+		})
+	}
+}
+
+// Test Scenario: a resuming SSE client gets the events it missed, then new ones as they're fetched
+func TestStreamOrderEvents(t *testing.T){
+	store := &fakeOrderEventStore{}
+	store.commit(1, 2)
+	server, httpServer := newOrderFeedTestServer(t, store)
+	tokenMaker, err := newTestTokenMaker()
+	require.NoError(t, err)
+
+	request, err := http.NewRequest(http.MethodGet, httpServer.URL+"/v2/events/orders", nil)
+	require.NoError(t, err)
+	request.Header.Set("Last-Event-ID", "1")
+	request.Header.Set("Origin", testStudioOrigin)
+	addAuthorization(t, request, tokenMaker, testCustomer, util.ReadOnlyRole)
+	response, err := http.DefaultClient.Do(request)
+	require.NoError(t, err)
+	defer response.Body.Close()
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	require.Equal(t, "text/event-stream", response.Header.Get("Content-Type"))
+	require.Equal(t, testStudioOrigin, response.Header.Get("Access-Control-Allow-Origin"))
+
+	reader := bufio.NewReader(response.Body)
+	require.Equal(t, "id: 2\nevent: order.updated\ndata: {\"order_id\":7}\n", readServerSentEvent(t, reader))
+
+	store.commit(3)
+	require.NoError(t, server.orderFeed.Fetch(context.Background()))
+	require.Equal(t, "id: 3\nevent: order.updated\ndata: {\"order_id\":7}\n", readServerSentEvent(t, reader))
+}
+
+// Test Scenario: clients that missed pruned events are told to reset
+func TestStreamOrderEventsReset(t *testing.T){
+	store := &fakeOrderEventStore{}
+	store.commit(5, 6)
+	_, httpServer := newOrderFeedTestServer(t, store)
+	tokenMaker, err := newTestTokenMaker()
+	require.NoError(t, err)
+
+	request, err := http.NewRequest(http.MethodGet, httpServer.URL+"/v2/events/orders?last_event_id=2", nil)
+	require.NoError(t, err)
+	addAuthorization(t, request, tokenMaker, testCustomer, util.AdminRole)
+	response, err := http.DefaultClient.Do(request)
+	require.NoError(t, err)
+	defer response.Body.Close()
+
+	reader := bufio.NewReader(response.Body)
+	require.Equal(t, "event: reset\ndata: {}\n", readServerSentEvent(t, reader))
+}
+
+// Test Scenario: the WebSocket variant sends the same events as JSON messages
+func TestStreamOrderEventsWebSocket(t *testing.T){
+	store := &fakeOrderEventStore{}
+	store.commit(1, 2)
+	server, httpServer := newOrderFeedTestServer(t, store)
+	tokenMaker, err := newTestTokenMaker()
+	require.NoError(t, err)
+
+	config, err := websocket.NewConfig(strings.Replace(httpServer.URL, "http", "ws", 1)+"/v2/events/orders/ws?last_event_id=1", testStudioOrigin)
+	require.NoError(t, err)
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	addAuthorization(t, request, tokenMaker, testCustomer, util.FulfillmentRole)
+	config.Header = request.Header
+	conn, err := websocket.DialConfig(config)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	var event feed.Event
+	require.NoError(t, websocket.JSON.Receive(conn, &event))
+	require.Equal(t, int64(2), event.ID)
+	require.Equal(t, sqlc.EventOrderUpdated, event.Event)
+	require.Equal(t, int64(7), event.OrderID)
+	require.JSONEq(t, `{"order_id":7}`, string(event.Data))
+
+	store.commit(3)
+	require.NoError(t, server.orderFeed.Fetch(context.Background()))
+	require.NoError(t, websocket.JSON.Receive(conn, &event))
+	require.Equal(t, int64(3), event.ID)
+}
+
+// Test Scenario: browser pages on origins that aren't allowed can't open either feed
+func TestOrderFeedOrigin(t *testing.T){
+	_, httpServer := newOrderFeedTestServer(t, &fakeOrderEventStore{})
+	tokenMaker, err := newTestTokenMaker()
+	require.NoError(t, err)
+
+	for _, url := range []string{"/v2/events/orders", "/v2/events/orders/ws"} {
+		t.Run(url, func(t *testing.T) {
+			request, err := http.NewRequest(http.MethodGet, httpServer.URL+url, nil)
+			require.NoError(t, err)
+			request.Header.Set("Origin", "https://evil.example.com")
+			addAuthorization(t, request, tokenMaker, testCustomer, util.AdminRole)
+			response, err := http.DefaultClient.Do(request)
+			require.NoError(t, err)
+			defer response.Body.Close()
+			require.Equal(t, http.StatusForbidden, response.StatusCode)
+			require.Empty(t, response.Header.Get("Access-Control-Allow-Origin"))
+		})
+	}
+}
+
+// Test Scenario: a browser opens the feed with a ticket instead of the Authorization header, the ticket can't be used anywhere else
+func TestOrderFeedTicket(t *testing.T){
+	store := &fakeOrderEventStore{}
+	store.commit(1, 2)
+	server, httpServer := newOrderFeedTestServer(t, store)
+	server.config.OrderFeedTicketDuration = time.Minute
+	tokenMaker, err := newTestTokenMaker()
+	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPost, "/v2/events/orders/tickets", nil)
+	addAuthorization(t, request, tokenMaker, testCustomer, util.ReadOnlyRole)
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusOK, recorder.Code, recorder.Body.String())
+	var body orderFeedTicketResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+	require.NotEmpty(t, body.Ticket)
+	require.WithinDuration(t, time.Now().Add(time.Minute), body.ExpiresAt, time.Second)
+
+	// EventSource can only send the URL
+	response, err := http.Get(httpServer.URL + "/v2/events/orders?last_event_id=1&ticket=" + body.Ticket)
+	require.NoError(t, err)
+	defer response.Body.Close()
+	require.Equal(t, http.StatusOK, response.StatusCode)
+	require.Equal(t, "id: 2\nevent: order.updated\ndata: {\"order_id\":7}\n", readServerSentEvent(t, bufio.NewReader(response.Body)))
+
+	// Tickets aren't access tokens, and access tokens don't go in URLs
+	accessToken, _, err := tokenMaker.CreateToken(testCustomer, util.ReadOnlyRole, token.AccessToken, time.Minute)
+	require.NoError(t, err)
+	testCases := []struct {
+		name   string
+		url    string
+		header string
+	}{
+		{"TicketAsAccessToken", "/v2/orders", "Bearer " + body.Ticket},
+		{"AccessTokenAsTicket", "/v2/events/orders?ticket=" + accessToken, ""},
+		{"BadTicket", "/v2/events/orders?ticket=forged", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodGet, tc.url, nil)
+			if tc.header != "" {
+				request.Header.Set(authorizationHeaderKey, tc.header)
+			}
+			server.router.ServeHTTP(recorder, request)
+			require.Equal(t, http.StatusUnauthorized, recorder.Code)
+		})
+	}
+}
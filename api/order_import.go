@@ -0,0 +1,66 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samanthatb1/beadBashStorage/importer"
+)
+
+/**** IMPORT ORDERS ****/
+const importFileField = "file"
+
+type importOrdersRequest struct {
+	Source string `form:"source" binding:"required,oneof=etsy shopify"`
+	DryRun bool   `form:"dry_run"` // Only report what would be imported
+}
+
+// Add importOrders function to the server instance
+// Same as "main import-orders", for a CSV uploaded in the "file" field
+func (server *Server) importOrders(ctx *gin.Context){
+	var reqBody importOrdersRequest
+
+	// If params are invalid
+	if err := ctx.ShouldBindQuery(&reqBody); err != nil {
+		sendInvalid(ctx, err)
+		return
+	}
+
+	// Uploads without a length are cut off while they're read, a limit of 0 is turned off
+	if maxSize := server.config.ImportMaxUploadSize; maxSize > 0 {
+		if ctx.Request.ContentLength > maxSize {
+			sendProblem(ctx, http.StatusRequestEntityTooLarge, codeFileTooLarge, fmt.Sprintf("Exports can be at most %d bytes, split the file", maxSize))
+			return
+		}
+		ctx.Request.Body = http.MaxBytesReader(ctx.Writer, ctx.Request.Body, maxSize)
+	}
+
+	fileHeader, err := ctx.FormFile(importFileField)
+	if err != nil {
+		sendInvalid(ctx, err)
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		sendError(ctx, err)
+		return
+	}
+	defer file.Close()
+
+	parsed, err := importer.Parse(reqBody.Source, file)
+	if err != nil { // Not an export of the source, nothing was imported
+		sendProblem(ctx, http.StatusUnprocessableEntity, codeInvalidFile, err.Error())
+		return
+	}
+
+	report, err := importer.Import(ctx, server.store, parsed, importer.Options{DryRun: reqBody.DryRun, BatchSize: server.config.ImportBatchSize})
+	if err != nil {
+		status, code, detail := describeError(ctx, err)
+		detail = fmt.Sprintf("%d batches were imported before it failed, importing the file again skips them: %s", report.Batches, detail)
+		sendProblem(ctx, status, code, detail)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,82 @@
+// Unit tests for the checks on uploaded exports, before any order reaches the DB
+
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/samanthatb1/beadBashStorage/util"
+	"github.com/stretchr/testify/require"
+)
+
+/* Helper Functions */
+
+// Uploads the content as the file field, no file is sent if content is nil
+func postImport(t *testing.T, server *Server, query string, content []byte) *httptest.ResponseRecorder {
+	tokenMaker, err := newTestTokenMaker()
+	require.NoError(t, err)
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	if content != nil {
+		part, err := writer.CreateFormFile(importFileField, "sales.csv")
+		require.NoError(t, err)
+		_, err = part.Write(content)
+		require.NoError(t, err)
+	}
+	require.NoError(t, writer.Close())
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPost, "/v2/orders/import"+query, body)
+	request.Header.Set("Content-Type", writer.FormDataContentType())
+	addAuthorization(t, request, tokenMaker, testCustomer, util.AdminRole)
+	server.router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+/* Test Functions */
+
+// Test Scenario: uploads that can't be imported are rejected with their own code
+func TestImportOrdersUpload(t *testing.T){
+	server := newTestServer(t)
+	etsy := []byte("Sale Date,Item Name,Buyer,Quantity,Item Total,Currency,Order ID\n")
+
+	testCases := []struct {
+		name    string
+		query   string
+		content []byte
+		status  int
+		code    string
+	}{
+		{"MissingSource", "", etsy, http.StatusBadRequest, codeInvalidRequest},
+		{"UnknownSource", "?source=amazon", etsy, http.StatusBadRequest, codeInvalidRequest},
+		{"MissingFile", "?source=etsy", nil, http.StatusBadRequest, codeInvalidRequest},
+		{"WrongFormat", "?source=shopify", etsy, http.StatusUnprocessableEntity, codeInvalidFile},
+		{"EmptyFile", "?source=etsy&dry_run=true", []byte{}, http.StatusUnprocessableEntity, codeInvalidFile},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := postImport(t, server, tc.query, tc.content)
+			require.Equal(t, tc.status, recorder.Code, recorder.Body.String())
+
+			var body problem
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+			require.Equal(t, tc.code, body.Code)
+		})
+	}
+}
+
+// Test Scenario: files over IMPORT_MAX_UPLOAD_SIZE are rejected before they're read
+func TestImportOrdersTooLarge(t *testing.T){
+	server := newTestServer(t)
+	server.config.ImportMaxUploadSize = 100
+
+	recorder := postImport(t, server, "?source=etsy", bytes.Repeat([]byte("a"), 200))
+	require.Equal(t, http.StatusRequestEntityTooLarge, recorder.Code)
+}
@@ -0,0 +1,133 @@
+// Unit tests for changing orders with JSON Merge Patch, the parts that don't need the DB
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samanthatb1/beadBashStorage/util"
+	"github.com/stretchr/testify/require"
+)
+
+/* Helper Functions */
+
+// Reads the body as a merge patch of order 7
+func readTestMergePatch(t *testing.T, body string) error {
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest(http.MethodPatch, "/v2/orders/7", strings.NewReader(body))
+	ctx.Request.Header.Set("Content-Type", mergePatchContentType)
+	params, err := readOrderMergePatch(ctx, 7)
+	if err == nil {
+		require.Equal(t, int64(7), params.OrderID)
+	}
+	return err
+}
+
+/* Test Functions */
+
+// Test Scenario: members that are left out are kept, null clears the shipping location
+func TestReadOrderMergePatch(t *testing.T){
+	ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx.Request = httptest.NewRequest(http.MethodPatch, "/v2/orders/7", strings.NewReader(`{"purchase_amount": 12.5, "currency": "EUR", "shipping_location": null, "full_name": "Jane Doe"}`))
+	params, err := readOrderMergePatch(ctx, 7)
+	require.NoError(t, err)
+	require.Equal(t, 12.5, *params.PurchaseAmount)
+	require.Equal(t, "EUR", *params.Currency)
+	require.Equal(t, "", *params.ShippingLocation)
+	require.Equal(t, "Jane Doe", *params.FullName)
+	require.Nil(t, params.PurchasedItem)
+	require.Nil(t, params.DateOrdered)
+
+	// An empty string clears it too
+	ctx.Request = httptest.NewRequest(http.MethodPatch, "/v2/orders/7", strings.NewReader(`{"shipping_location": ""}`))
+	params, err = readOrderMergePatch(ctx, 7)
+	require.NoError(t, err)
+	require.Equal(t, "", *params.ShippingLocation)
+	require.Nil(t, params.PurchaseAmount)
+}
+
+// Test Scenario: patches that would leave the order invalid are rejected
+func TestReadOrderMergePatchInvalid(t *testing.T){
+	testCases := []struct {
+		name    string
+		body    string
+		message string
+	}{
+		{"NotAnObject", `[]`, "body must be a JSON object"},
+		{"NullBody", `null`, "body must be a JSON object"},
+		{"RemoveRequired", `{"purchased_item": null}`, "purchased_item can't be removed"},
+		{"RemoveAmount", `{"purchase_amount": null}`, "purchase_amount can't be removed"},
+		{"ReadOnly", `{"username": "someone_else"}`, "username can't be changed"},
+		{"ZeroAmount", `{"purchase_amount": 0}`, "PurchaseAmount"},
+		{"NegativeAmount", `{"purchase_amount": -3}`, "PurchaseAmount"},
+		{"EmptyDate", `{"date_ordered": ""}`, "DateOrdered"},
+		{"EmptyCurrency", `{"currency": ""}`, "Currency"},
+		{"UnknownCurrency", `{"currency": "GBP"}`, "Currency"},
+		{"WrongType", `{"full_name": 12}`, "full_name"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := readTestMergePatch(t, tc.body)
+			require.ErrorContains(t, err, tc.message)
+		})
+	}
+}
+
+// Test Scenario: the document's merge patch schema is checked for merge patch bodies only
+func TestMergePatchValidation(t *testing.T){
+	doc, err := newOpenAPIDocument(routeDocs, v1RouteDocs)
+	require.NoError(t, err)
+	operation := doc.Paths["/v2/orders/{order_id}"]["patch"]
+	require.Contains(t, operation.RequestBody.Content, gin.MIMEJSON)
+	require.True(t, operation.RequestBody.Content[mergePatchContentType].Schema.Properties["shipping_location"].Nullable)
+
+	router := gin.New()
+	router.Group("/").Use(requestValidationMiddleware(doc, testMaxBodySize)).PATCH("/v2/orders/:order_id", func(ctx *gin.Context) { ctx.Status(http.StatusOK) })
+
+	testCases := []struct {
+		name        string
+		contentType string
+		body        string
+		code        int
+	}{
+		{"MergePatchNull", mergePatchContentType, `{"shipping_location": null, "currency": "CAD"}`, http.StatusOK},
+		{"MergePatchZero", mergePatchContentType, `{"purchase_amount": 0}`, http.StatusBadRequest},
+		{"MergePatchEnum", mergePatchContentType, `{"currency": "GBP"}`, http.StatusBadRequest},
+		{"JSONNull", gin.MIMEJSON, `{"shipping_location": null}`, http.StatusBadRequest},
+		{"JSONZero", gin.MIMEJSON, `{"purchase_amount": 0}`, http.StatusOK}, // Kept, like before
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodPatch, "/v2/orders/7", strings.NewReader(tc.body))
+			request.Header.Set("Content-Type", tc.contentType)
+			router.ServeHTTP(recorder, request)
+			require.Equal(t, tc.code, recorder.Code, recorder.Body.String())
+		})
+	}
+}
+
+// Test Scenario: an If-Match that isn't one of our ETags fails before the order is written
+func TestPatchOrderUnknownETag(t *testing.T){
+	server := newTestServer(t)
+	tokenMaker, err := newTestTokenMaker()
+	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPatch, "/orders", strings.NewReader(`{"order_id": 7, "purchased_item": "Anklet"}`))
+	request.Header.Set("If-Match", `W/"3"`)
+	addAuthorization(t, request, tokenMaker, testCustomer, util.AdminRole)
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusPreconditionFailed, recorder.Code)
+
+	var body problem
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+	require.Equal(t, codeVersionMismatch, body.Code)
+}
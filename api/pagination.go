@@ -0,0 +1,97 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	db "github.com/samanthatb1/beadBashStorage/db/sqlc"
+	"github.com/samanthatb1/beadBashStorage/util"
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// Query params shared by every list endpoint, each endpoint adds its own sort keys and filters
+type pageRequest struct {
+	Cursor    string `form:"cursor"` // next_cursor of the previous page, empty for the first page
+	PageSize  int32  `form:"page_size" binding:"omitempty,min=1"`
+	Order     string `form:"order" binding:"omitempty,oneof=asc desc"`
+}
+
+// Body of every list endpoint
+type pageResponse struct {
+	Data       interface{} `json:"data"`
+	NextCursor string      `json:"next_cursor"` // Empty on the last page
+	TotalCount int64       `json:"total_count"` // Rows matching the filters on every page
+}
+
+// What's inside the opaque cursor, the sort is kept so a cursor can't be reused with another sort
+type pageCursor struct {
+	Sort string `json:"s"`
+	Desc bool   `json:"d"`
+	db.Cursor
+}
+
+func encodeCursor(sort string, desc bool, cursor *db.Cursor) string {
+	if cursor == nil {
+		return ""
+	}
+	data, _ := json.Marshal(pageCursor{Sort: sort, Desc: desc, Cursor: *cursor})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(encoded string) (pageCursor, error) {
+	var cursor pageCursor
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return cursor, errInvalidCursor
+	}
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return cursor, errInvalidCursor
+	}
+	return cursor, nil
+}
+
+// Turns the request into DB page params, checking the page size against the server's config
+func (server *Server) pageParams(req pageRequest, sort string) (db.PageParams, error) {
+	return newPageParams(server.config, req, sort)
+}
+
+// Turns the request into DB page params, checking the page size against the config
+func newPageParams(config util.Config, req pageRequest, sort string) (db.PageParams, error) {
+	params := db.PageParams{
+		Sort: sort,
+		Desc: req.Order == "desc",
+		Limit: req.PageSize,
+	}
+	if params.Sort == "" {
+		params.Sort = "id"
+	}
+	if params.Limit == 0 {
+		params.Limit = config.DefaultPageSize
+	}
+	if params.Limit > config.MaxPageSize {
+		return params, fmt.Errorf("page_size can't be more than %d", config.MaxPageSize)
+	}
+
+	if req.Cursor != "" {
+		cursor, err := decodeCursor(req.Cursor)
+		if err != nil {
+			return params, err
+		}
+		if cursor.Sort != params.Sort || cursor.Desc != params.Desc {
+			return params, errors.New("cursor was made for another sort, start again without it")
+		}
+		params.After = &cursor.Cursor
+	}
+	return params, nil
+}
+
+func newPageResponse(data interface{}, params db.PageParams, next *db.Cursor, total int64) pageResponse {
+	return pageResponse{
+		Data: data,
+		NextCursor: encodeCursor(params.Sort, params.Desc, next),
+		TotalCount: total,
+	}
+}
@@ -0,0 +1,46 @@
+// Unit tests for cursor pagination params
+
+package api
+
+import (
+	"testing"
+
+	db "github.com/samanthatb1/beadBashStorage/db/sqlc"
+	"github.com/samanthatb1/beadBashStorage/util"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Scenario: page params come from the request, the config and the cursor
+func TestPageParams(t *testing.T){
+	server := &Server{config: util.Config{DefaultPageSize: 20, MaxPageSize: 50}}
+
+	// Defaults
+	params, err := server.pageParams(pageRequest{}, "")
+	require.NoError(t, err)
+	require.Equal(t, db.PageParams{Sort: "id", Limit: 20}, params)
+
+	// Too big
+	_, err = server.pageParams(pageRequest{PageSize: 51}, "")
+	require.Error(t, err)
+
+	// Cursor round trips
+	cursor := encodeCursor("amount", true, &db.Cursor{Value: "12.5", ID: 7})
+	params, err = server.pageParams(pageRequest{Cursor: cursor, Order: "desc", PageSize: 5}, "amount")
+	require.NoError(t, err)
+	require.True(t, params.Desc)
+	require.Equal(t, int32(5), params.Limit)
+	require.Equal(t, &db.Cursor{Value: "12.5", ID: 7}, params.After)
+
+	// Cursor from another sort
+	_, err = server.pageParams(pageRequest{Cursor: cursor, Order: "asc"}, "amount")
+	require.Error(t, err)
+	_, err = server.pageParams(pageRequest{Cursor: cursor, Order: "desc"}, "date")
+	require.Error(t, err)
+
+	// Garbage
+	_, err = server.pageParams(pageRequest{Cursor: "not a cursor"}, "")
+	require.ErrorIs(t, err, errInvalidCursor)
+
+	// Last page has no cursor
+	require.Empty(t, encodeCursor("id", false, nil))
+}
@@ -0,0 +1,188 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	db "github.com/samanthatb1/beadBashStorage/db/sqlc"
+	"github.com/samanthatb1/beadBashStorage/token"
+	"github.com/samanthatb1/beadBashStorage/util"
+)
+
+// Who may call a route
+type routePolicy struct {
+	roles      []string // Roles that may always call the route
+	ownerParam string   // If set, customers may call the route when this uri param is their own username
+	scope      string   // Scope an API key needs to call the route, API keys can't call it if empty
+}
+
+var (
+	adminOnly  = []string{util.AdminRole}
+	staffWrite = []string{util.AdminRole, util.FulfillmentRole}
+	staffRead  = []string{util.AdminRole, util.FulfillmentRole, util.ReadOnlyRole}
+)
+
+// Policy for every authenticated route, keyed by "METHOD /route/:param"
+// Routes that are missing from this table are forbidden for everyone
+var routePolicies = map[string]routePolicy{
+	/* User */
+	"GET /users/:identifier":            {roles: staffRead, ownerParam: "identifier", scope: util.UsersReadScope},
+	"GET /users/all":                    {roles: staffRead, scope: util.UsersReadScope},
+	"DELETE /users/:username":           {roles: adminOnly, scope: util.UsersWriteScope},
+	"PATCH /users/:username/role":       {roles: adminOnly},
+	"GET /users/:identifier/export":     {roles: adminOnly, ownerParam: "identifier"},
+	"POST /users/:username/erase":       {roles: adminOnly},
+	"POST /users/:username/tags":        {roles: staffWrite, scope: util.UsersWriteScope},
+	"DELETE /users/:username/tags/:tag": {roles: staffWrite, scope: util.UsersWriteScope},
+
+	/* Order */
+	"GET /orders/:username":              {roles: staffRead, ownerParam: "username", scope: util.OrdersReadScope},
+	"GET /orders/all":                    {roles: staffRead, scope: util.OrdersReadScope},
+	"POST /orders":                       {roles: staffWrite, scope: util.OrdersWriteScope},
+	"POST /orders/batch":                 {roles: staffWrite, scope: util.OrdersWriteScope},
+	"DELETE /orders/:order_id":           {roles: adminOnly, scope: util.OrdersWriteScope},
+	"PATCH /orders":                      {roles: staffWrite, scope: util.OrdersWriteScope},
+	"POST /orders/:order_id/tags":        {roles: staffWrite, scope: util.OrdersWriteScope},
+	"DELETE /orders/:order_id/tags/:tag": {roles: staffWrite, scope: util.OrdersWriteScope},
+
+	/* Search */
+	"GET /search": {roles: staffRead},
+
+	/* API Key */
+	"POST /api_keys":       {roles: adminOnly},
+	"GET /api_keys":        {roles: adminOnly},
+	"DELETE /api_keys/:id": {roles: adminOnly},
+
+	/**** v2 ****/
+	// resourceParamMiddleware sets "username" to the owner of the :user_id or :order_id in the path
+
+	/* User */
+	"GET /v2/users":                       {roles: staffRead, scope: util.UsersReadScope},
+	"GET /v2/users/:user_id":              {roles: staffRead, ownerParam: "username", scope: util.UsersReadScope},
+	"DELETE /v2/users/:user_id":           {roles: adminOnly, scope: util.UsersWriteScope},
+	"PATCH /v2/users/:user_id/role":       {roles: adminOnly},
+	"GET /v2/users/:user_id/export":       {roles: adminOnly, ownerParam: "username"},
+	"POST /v2/users/:user_id/erase":       {roles: adminOnly},
+	"POST /v2/users/:user_id/tags":        {roles: staffWrite, scope: util.UsersWriteScope},
+	"DELETE /v2/users/:user_id/tags/:tag": {roles: staffWrite, scope: util.UsersWriteScope},
+	"GET /v2/users/:user_id/orders":       {roles: staffRead, ownerParam: "username", scope: util.OrdersReadScope},
+	"GET /v2/exports/users":               {roles: staffRead, scope: util.UsersReadScope},
+
+	/* Order */
+	"GET /v2/orders":                        {roles: staffRead, scope: util.OrdersReadScope},
+	"POST /v2/orders":                       {roles: staffWrite, scope: util.OrdersWriteScope},
+	"POST /v2/orders/batch":                 {roles: staffWrite, scope: util.OrdersWriteScope},
+	"POST /v2/orders/import":                {roles: adminOnly, scope: util.OrdersWriteScope},
+	"GET /v2/orders/:order_id":              {roles: staffRead, ownerParam: "username", scope: util.OrdersReadScope},
+	"PATCH /v2/orders/:order_id":            {roles: staffWrite, scope: util.OrdersWriteScope},
+	"DELETE /v2/orders/:order_id":           {roles: adminOnly, scope: util.OrdersWriteScope},
+	"POST /v2/orders/:order_id/tags":        {roles: staffWrite, scope: util.OrdersWriteScope},
+	"DELETE /v2/orders/:order_id/tags/:tag": {roles: staffWrite, scope: util.OrdersWriteScope},
+	"GET /v2/exports/orders":                {roles: staffRead, scope: util.OrdersReadScope},
+
+	/* Search */
+	"GET /v2/search": {roles: staffRead},
+
+	/* Live Feed */
+	"GET /v2/events/orders":          {roles: staffRead, scope: util.OrdersReadScope},
+	"GET /v2/events/orders/ws":       {roles: staffRead, scope: util.OrdersReadScope},
+	"POST /v2/events/orders/tickets": {roles: staffRead}, // API keys can send headers
+
+	/* API Key */
+	"POST /v2/api_keys":       {roles: adminOnly},
+	"GET /v2/api_keys":        {roles: adminOnly},
+	"DELETE /v2/api_keys/:id": {roles: adminOnly},
+
+	/* Webhook */
+	"POST /v2/webhooks":                                    {roles: adminOnly},
+	"GET /v2/webhooks":                                     {roles: adminOnly},
+	"DELETE /v2/webhooks/:id":                              {roles: adminOnly},
+	"GET /v2/webhooks/:id/deliveries":                      {roles: adminOnly},
+	"POST /v2/webhooks/:id/deliveries/:delivery_id/replay": {roles: adminOnly},
+
+	/**** GraphQL ****/
+	// Mutations also need the roles of the REST route they match, see authorizeMutation
+	"POST /graphql": {roles: staffRead},
+}
+
+// Checks if the logged in user is allowed by the route's policy
+func (policy routePolicy) allows(ctx *gin.Context, payload *token.Payload) bool {
+	if policy.allowsRole(payload.Role) {
+		return true
+	}
+
+	// Customers can only reach their own resources
+	// An identifier that's a number is read as a user id, so it's never the customer's username
+	owner := ctx.Param(policy.ownerParam)
+	if policy.ownerParam == "identifier" && util.CheckUsername(owner) != nil {
+		return false
+	}
+	return policy.ownerParam != "" &&
+		payload.Role == util.CustomerRole &&
+		owner == payload.Username
+}
+
+// Checks the owner of the resource a handler read, for customers the policy let in by its ownerParam
+// Staff and API keys were let in by their role or scope, whoever owns the resource
+func ownsResource(ctx *gin.Context, username string) bool {
+	payload, isUser := ctx.Get(authorizationPayloadKey)
+	if !isUser {
+		return true
+	}
+	return payload.(*token.Payload).Role != util.CustomerRole || payload.(*token.Payload).Username == username
+}
+
+// Checks if the role may always call the route, whoever owns the resource
+func (policy routePolicy) allowsRole(role string) bool {
+	for _, allowed := range policy.roles {
+		if role == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// Checks if the API key has the scope the route's policy asks for
+func (policy routePolicy) allowsApiKey(apiKey db.ApiKey) bool {
+	if policy.scope == "" {
+		return false
+	}
+	for _, scope := range apiKey.Scopes {
+		if scope == policy.scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Why a user's role can't call the route
+func roleNotAllowed(ctx *gin.Context, role string) error {
+	return fmt.Errorf("role %s is not allowed to %s %s", role, ctx.Request.Method, ctx.FullPath())
+}
+
+// Rejects requests that aren't allowed by the route's policy, must run after authMiddleware
+func authorizeMiddleware() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		policy, ok := routePolicies[ctx.Request.Method+" "+ctx.FullPath()]
+
+		var err error
+		if payload, isUser := ctx.Get(authorizationPayloadKey); isUser {
+			if !ok || !policy.allows(ctx, payload.(*token.Payload)) {
+				err = roleNotAllowed(ctx, payload.(*token.Payload).Role)
+			}
+		} else {
+			apiKey := ctx.MustGet(authorizationApiKeyKey).(db.ApiKey)
+			if !ok || !policy.allowsApiKey(apiKey) {
+				err = fmt.Errorf("api key %s is missing the scope to %s %s", apiKey.Name, ctx.Request.Method, ctx.FullPath())
+			}
+		}
+
+		if err != nil {
+			sendProblem(ctx, http.StatusForbidden, codeForbidden, err.Error())
+			return
+		}
+
+		ctx.Next()
+	}
+}
@@ -0,0 +1,333 @@
+// Unit tests for the role based route policies
+
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	db "github.com/samanthatb1/beadBashStorage/db/sqlc"
+	"github.com/samanthatb1/beadBashStorage/token"
+	"github.com/samanthatb1/beadBashStorage/util"
+	"github.com/stretchr/testify/require"
+)
+
+// 32 character key used by the tests
+const testSymmetricKey = "12345678901234567890123456789012"
+
+// Username of the customer making the requests in the tests
+const testCustomer = "bead_lover"
+
+// Routes that don't require an access token
+var publicRoutes = map[string]bool{
+	"POST /users":               true,
+	"POST /users/login":         true,
+	"POST /tokens/renew_access": true,
+
+	"POST /v2/users":            true,
+	"POST /v2/sessions":         true,
+	"POST /v2/sessions/refresh": true,
+
+	"GET /openapi.json": true,
+	"GET /docs":         true,
+}
+
+/* Helper Functions */
+
+func newTestServer(t *testing.T) *Server {
+	gin.SetMode(gin.TestMode)
+	server, err := NewServer(util.Config{
+		TokenSymmetricKey: testSymmetricKey,
+		AccessTokenDuration: time.Minute,
+	}, nil)
+	require.NoError(t, err)
+	return server
+}
+
+func newTestTokenMaker() (token.Maker, error) {
+	return token.NewPasetoMaker(testSymmetricKey)
+}
+
+// Lookups for the v2 ids, user 1 and order 1 belong to the test customer and the rest to someone else
+func newTestResourceLookup() resourceLookup {
+	owner := func(id int64) string {
+		if id == 1 {
+			return testCustomer
+		}
+		return "someone_else"
+	}
+	return resourceLookup{
+		getUser: func(ctx context.Context, id int64) (db.User, error) {
+			return db.User{ID: id, Username: owner(id)}, nil
+		},
+		getOrder: func(ctx context.Context, orderID int64) (db.Order, error) {
+			return db.Order{OrderID: orderID, Username: owner(orderID)}, nil
+		},
+	}
+}
+
+// Router with the same middleware as the server but with handlers that never touch the DB
+func newPolicyTestRouter(tokenMaker token.Maker) *gin.Engine {
+	router := gin.New()
+	authRoutes := router.Group("/").Use(authMiddleware(tokenMaker, nil), resourceParamMiddleware(newTestResourceLookup()), authorizeMiddleware())
+	for route := range routePolicies {
+		fields := strings.SplitN(route, " ", 2)
+		authRoutes.Handle(fields[0], fields[1], func(ctx *gin.Context) { ctx.Status(http.StatusOK) })
+	}
+	return router
+}
+
+func addAuthorization(t *testing.T, request *http.Request, tokenMaker token.Maker, username string, role string) {
+	accessToken, _, err := tokenMaker.CreateToken(username, role, token.AccessToken, time.Minute)
+	require.NoError(t, err)
+	request.Header.Set(authorizationHeaderKey, fmt.Sprintf("%s %s", authorizationTypeBearer, accessToken))
+}
+
+func containsRole(roles []string, role string) bool {
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+/* Test Functions */
+
+// Test Scenario: every authenticated route has a policy and every policy has a route
+func TestRoutePoliciesCoverAllRoutes(t *testing.T){
+	server := newTestServer(t)
+
+	registered := map[string]bool{}
+	for _, route := range server.router.Routes() {
+		key := route.Method + " " + route.Path
+		registered[key] = true
+		if !publicRoutes[key] {
+			require.Contains(t, routePolicies, key, "route has no policy")
+		}
+	}
+	for key := range routePolicies {
+		require.True(t, registered[key], "policy %s has no route", key)
+	}
+}
+
+// Test Scenario: requests without a token never reach the policy check
+func TestMissingToken(t *testing.T){
+	server := newTestServer(t)
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, "/users/all", nil)
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
+
+// Test Scenario: each route only lets in the roles in its policy
+func TestRoutePolicies(t *testing.T){
+	tokenMaker, err := newTestTokenMaker()
+	require.NoError(t, err)
+	router := newPolicyTestRouter(tokenMaker)
+
+	allRoles := []string{util.CustomerRole, util.AdminRole, util.FulfillmentRole, util.ReadOnlyRole}
+
+	testCases := []struct {
+		method       string
+		url          string
+		allowed      []string // Roles that get through
+		ownURL       string   // Same route on the customer's own resource, empty if customers are never allowed
+	}{
+		/* User */
+		{http.MethodGet, "/users/someone_else", []string{util.AdminRole, util.FulfillmentRole, util.ReadOnlyRole}, "/users/" + testCustomer},
+		{http.MethodGet, "/users/all", []string{util.AdminRole, util.FulfillmentRole, util.ReadOnlyRole}, ""},
+		{http.MethodDelete, "/users/someone_else", []string{util.AdminRole}, ""},
+		{http.MethodPatch, "/users/someone_else/role", []string{util.AdminRole}, ""},
+		{http.MethodGet, "/users/someone_else/export", []string{util.AdminRole}, "/users/" + testCustomer + "/export"},
+		{http.MethodPost, "/users/someone_else/erase", []string{util.AdminRole}, ""},
+		{http.MethodPost, "/users/someone_else/tags", []string{util.AdminRole, util.FulfillmentRole}, ""},
+		{http.MethodDelete, "/users/someone_else/tags/vip", []string{util.AdminRole, util.FulfillmentRole}, ""},
+
+		/* Order */
+		{http.MethodGet, "/orders/someone_else", []string{util.AdminRole, util.FulfillmentRole, util.ReadOnlyRole}, "/orders/" + testCustomer},
+		{http.MethodGet, "/orders/all", []string{util.AdminRole, util.FulfillmentRole, util.ReadOnlyRole}, ""},
+		{http.MethodPost, "/orders", []string{util.AdminRole, util.FulfillmentRole}, ""},
+		{http.MethodPost, "/orders/batch", []string{util.AdminRole, util.FulfillmentRole}, ""},
+		{http.MethodDelete, "/orders/12", []string{util.AdminRole}, ""},
+		{http.MethodPatch, "/orders", []string{util.AdminRole, util.FulfillmentRole}, ""},
+		{http.MethodPost, "/orders/12/tags", []string{util.AdminRole, util.FulfillmentRole}, ""},
+		{http.MethodDelete, "/orders/12/tags/gift", []string{util.AdminRole, util.FulfillmentRole}, ""},
+
+		/* Search */
+		{http.MethodGet, "/search", []string{util.AdminRole, util.FulfillmentRole, util.ReadOnlyRole}, ""},
+
+		/* API Key */
+		{http.MethodPost, "/api_keys", []string{util.AdminRole}, ""},
+		{http.MethodGet, "/api_keys", []string{util.AdminRole}, ""},
+		{http.MethodDelete, "/api_keys/3", []string{util.AdminRole}, ""},
+
+		/* v2 User */
+		{http.MethodGet, "/v2/users", []string{util.AdminRole, util.FulfillmentRole, util.ReadOnlyRole}, ""},
+		{http.MethodGet, "/v2/users/2", []string{util.AdminRole, util.FulfillmentRole, util.ReadOnlyRole}, "/v2/users/1"},
+		{http.MethodDelete, "/v2/users/2", []string{util.AdminRole}, ""},
+		{http.MethodPatch, "/v2/users/2/role", []string{util.AdminRole}, ""},
+		{http.MethodGet, "/v2/users/2/export", []string{util.AdminRole}, "/v2/users/1/export"},
+		{http.MethodPost, "/v2/users/2/erase", []string{util.AdminRole}, ""},
+		{http.MethodPost, "/v2/users/2/tags", []string{util.AdminRole, util.FulfillmentRole}, ""},
+		{http.MethodDelete, "/v2/users/2/tags/vip", []string{util.AdminRole, util.FulfillmentRole}, ""},
+		{http.MethodGet, "/v2/users/2/orders", []string{util.AdminRole, util.FulfillmentRole, util.ReadOnlyRole}, "/v2/users/1/orders"},
+		{http.MethodGet, "/v2/exports/users", []string{util.AdminRole, util.FulfillmentRole, util.ReadOnlyRole}, ""},
+
+		/* v2 Order */
+		{http.MethodGet, "/v2/orders", []string{util.AdminRole, util.FulfillmentRole, util.ReadOnlyRole}, ""},
+		{http.MethodPost, "/v2/orders", []string{util.AdminRole, util.FulfillmentRole}, ""},
+		{http.MethodPost, "/v2/orders/batch", []string{util.AdminRole, util.FulfillmentRole}, ""},
+		{http.MethodPost, "/v2/orders/import", []string{util.AdminRole}, ""},
+		{http.MethodGet, "/v2/orders/12", []string{util.AdminRole, util.FulfillmentRole, util.ReadOnlyRole}, "/v2/orders/1"},
+		{http.MethodPatch, "/v2/orders/12", []string{util.AdminRole, util.FulfillmentRole}, ""},
+		{http.MethodDelete, "/v2/orders/12", []string{util.AdminRole}, ""},
+		{http.MethodPost, "/v2/orders/12/tags", []string{util.AdminRole, util.FulfillmentRole}, ""},
+		{http.MethodDelete, "/v2/orders/12/tags/gift", []string{util.AdminRole, util.FulfillmentRole}, ""},
+		{http.MethodGet, "/v2/exports/orders", []string{util.AdminRole, util.FulfillmentRole, util.ReadOnlyRole}, ""},
+
+		/* v2 Search */
+		{http.MethodGet, "/v2/search", []string{util.AdminRole, util.FulfillmentRole, util.ReadOnlyRole}, ""},
+
+		/* v2 Live Feed */
+		{http.MethodGet, "/v2/events/orders", []string{util.AdminRole, util.FulfillmentRole, util.ReadOnlyRole}, ""},
+		{http.MethodGet, "/v2/events/orders/ws", []string{util.AdminRole, util.FulfillmentRole, util.ReadOnlyRole}, ""},
+		{http.MethodPost, "/v2/events/orders/tickets", []string{util.AdminRole, util.FulfillmentRole, util.ReadOnlyRole}, ""},
+
+		/* v2 API Key */
+		{http.MethodPost, "/v2/api_keys", []string{util.AdminRole}, ""},
+		{http.MethodGet, "/v2/api_keys", []string{util.AdminRole}, ""},
+		{http.MethodDelete, "/v2/api_keys/3", []string{util.AdminRole}, ""},
+
+		/* v2 Webhook */
+		{http.MethodPost, "/v2/webhooks", []string{util.AdminRole}, ""},
+		{http.MethodGet, "/v2/webhooks", []string{util.AdminRole}, ""},
+		{http.MethodDelete, "/v2/webhooks/3", []string{util.AdminRole}, ""},
+		{http.MethodGet, "/v2/webhooks/3/deliveries", []string{util.AdminRole}, ""},
+		{http.MethodPost, "/v2/webhooks/3/deliveries/5/replay", []string{util.AdminRole}, ""},
+
+		/* GraphQL */
+		{http.MethodPost, "/graphql", []string{util.AdminRole, util.FulfillmentRole, util.ReadOnlyRole}, ""},
+	}
+	require.Len(t, testCases, len(routePolicies), "every route needs a test case")
+
+	for _, tc := range testCases {
+		for _, role := range allRoles {
+			t.Run(fmt.Sprintf("%s %s as %s", tc.method, tc.url, role), func(t *testing.T) {
+				recorder := httptest.NewRecorder()
+				request := httptest.NewRequest(tc.method, tc.url, nil)
+				addAuthorization(t, request, tokenMaker, testCustomer, role)
+				router.ServeHTTP(recorder, request)
+
+				if containsRole(tc.allowed, role) {
+					require.Equal(t, http.StatusOK, recorder.Code)
+				} else {
+					require.Equal(t, http.StatusForbidden, recorder.Code)
+				}
+			})
+		}
+
+		// Customers may reach their own resources
+		if tc.ownURL != "" {
+			t.Run(fmt.Sprintf("%s %s as owner", tc.method, tc.ownURL), func(t *testing.T) {
+				recorder := httptest.NewRecorder()
+				request := httptest.NewRequest(tc.method, tc.ownURL, nil)
+				addAuthorization(t, request, tokenMaker, testCustomer, util.CustomerRole)
+				router.ServeHTTP(recorder, request)
+				require.Equal(t, http.StatusOK, recorder.Code)
+			})
+		}
+	}
+}
+
+// Test Scenario: API keys only get through routes matching one of their scopes
+func TestApiKeyScopes(t *testing.T){
+	readOnlyKey := db.ApiKey{Name: "bookkeeping", Scopes: []string{util.OrdersReadScope, util.UsersReadScope}}
+	orderWriterKey := db.ApiKey{Name: "storefront", Scopes: []string{util.OrdersWriteScope}}
+
+	require.True(t, routePolicies["GET /orders/all"].allowsApiKey(readOnlyKey))
+	require.False(t, routePolicies["GET /orders/all"].allowsApiKey(orderWriterKey))
+	require.True(t, routePolicies["POST /orders"].allowsApiKey(orderWriterKey))
+	require.False(t, routePolicies["POST /orders"].allowsApiKey(readOnlyKey))
+	require.False(t, routePolicies["DELETE /users/:username"].allowsApiKey(orderWriterKey))
+
+	// Routes without a scope are for logged in users only
+	allScopes := db.ApiKey{Scopes: []string{util.UsersReadScope, util.UsersWriteScope, util.OrdersReadScope, util.OrdersWriteScope}}
+	for route, policy := range routePolicies {
+		if policy.scope == "" {
+			require.False(t, policy.allowsApiKey(allScopes), route)
+		}
+	}
+	require.False(t, routePolicies["PATCH /users/:username/role"].allowsApiKey(allScopes))
+	require.False(t, routePolicies["POST /api_keys"].allowsApiKey(allScopes))
+}
+
+// Test Scenario: a customer can't use a username that's a number to reach the user with that id
+func TestNumericUsername(t *testing.T){
+	server := newTestServer(t)
+	tokenMaker, err := newTestTokenMaker()
+	require.NoError(t, err)
+
+	// Usernames that are numbers can't be created
+	testCases := []struct {
+		name string
+		url  string
+		body string
+	}{
+		{"SignUp", "/users", `{"full_name": "Jane Doe", "username": "1", "password": "secret"}`},
+		{"SignUpV2", "/v2/users", `{"full_name": "Jane Doe", "username": "1", "password": "secret"}`},
+		{"Order", "/orders", `{"username": "1", "full_name": "Jane Doe", "purchase_amount": 24.5, "purchased_item": "bracelet",
+			"shipping_location": "Halifax", "currency": "CAD", "date_ordered": "2022-08-01"}`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodPost, tc.url, strings.NewReader(tc.body))
+			addAuthorization(t, request, tokenMaker, testCustomer, util.AdminRole)
+			server.router.ServeHTTP(recorder, request)
+			require.Equal(t, http.StatusBadRequest, recorder.Code, recorder.Body.String())
+			require.Contains(t, recorder.Body.String(), util.ErrNumericUsername.Error())
+		})
+	}
+
+	// A customer named "1" from before the rule still only reaches their own data
+	router := newPolicyTestRouter(tokenMaker)
+	for _, url := range []string{"/users/1", "/users/1/export"} {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodGet, url, nil)
+		addAuthorization(t, request, tokenMaker, "1", util.CustomerRole)
+		router.ServeHTTP(recorder, request)
+		require.Equal(t, http.StatusForbidden, recorder.Code, url)
+	}
+}
+
+// Test Scenario: customers only own the resources with their username, staff and API keys aren't limited by owner
+func TestOwnsResource(t *testing.T){
+	testCases := []struct {
+		name    string
+		payload *token.Payload // nil for an API key
+		owns    bool
+	}{
+		{"Owner", &token.Payload{Username: testCustomer, Role: util.CustomerRole}, true},
+		{"OtherCustomer", &token.Payload{Username: "1", Role: util.CustomerRole}, false},
+		{"Staff", &token.Payload{Username: "staff", Role: util.ReadOnlyRole}, true},
+		{"ApiKey", nil, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+			if tc.payload != nil {
+				ctx.Set(authorizationPayloadKey, tc.payload)
+			}
+			require.Equal(t, tc.owns, ownsResource(ctx, testCustomer))
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samanthatb1/beadBashStorage/db/dberr"
+)
+
+// Every error response is an RFC 7807 problem, sent as application/problem+json
+type problem struct {
+	Type     string `json:"type"`     // problemTypePrefix + code
+	Title    string `json:"title"`    // Text of the status
+	Status   int    `json:"status"`
+	Detail   string `json:"detail"`   // For people, may change
+	Instance string `json:"instance"` // Path of the request
+	Code     string `json:"code"`     // For programs, stable
+	Items    []itemProblem `json:"items,omitempty"` // Problems of single items of a batch request
+}
+
+// Problem with one item of a batch request
+type itemProblem struct {
+	Index  int    `json:"index"`  // Position of the item in the request
+	Status int    `json:"status"` // Status the item would get on its own
+	Code   string `json:"code"`
+	Detail string `json:"detail"`
+}
+
+const (
+	problemContentType = "application/problem+json"
+	problemTypePrefix  = "urn:beadbash:problem:"
+)
+
+// Codes of the problems the API sends itself, domain errors bring their own (see db/dberr)
+// Clients switch on these, so they never change once released
+const (
+	codeInvalidRequest   = "invalid_request"    // Params or body don't match the route's docs
+	codeUnauthorized     = "unauthorized"       // Missing or invalid credentials
+	codeBadCredentials   = "bad_credentials"    // Wrong username or password
+	codeInvalidSession   = "invalid_session"    // Refresh token can't be used anymore
+	codeForbidden        = "forbidden"          // Role or scope isn't allowed
+	codeUserNotFound     = "user_not_found"
+	codeOrderNotFound    = "order_not_found"
+	codeTagNotFound      = "tag_not_found"
+	codeSessionNotFound  = "session_not_found"
+	codeApiKeyNotFound   = "api_key_not_found"
+	codeWebhookNotFound  = "webhook_not_found"
+	codeDeliveryNotFound = "webhook_delivery_not_found"
+	codeVersionMismatch  = "version_mismatch"   // If-Match didn't match, or the row changed while it was written
+	codeIdempotencyReuse = "idempotency_key_reused"
+	codeIdempotencyBusy  = "idempotency_key_in_progress"
+	codeRateLimited      = "rate_limited"
+	codeFileTooLarge     = "file_too_large"
+	codeBodyTooLarge     = "body_too_large"
+	codeInvalidFile      = "invalid_file"       // Upload isn't in the format the route reads
+	codeInternal         = "internal_error"     // Details are only logged
+)
+
+// Status each kind of domain error is sent with
+var kindStatus = map[dberr.Kind]int{
+	dberr.NotFound:   http.StatusNotFound,
+	dberr.Conflict:   http.StatusConflict,
+	dberr.Validation: http.StatusUnprocessableEntity,
+}
+
+// Sends a problem and stops the handler chain
+func sendProblem(ctx *gin.Context, status int, code string, detail string) {
+	sendItemProblems(ctx, status, code, detail, nil)
+}
+
+// Sends a problem with the items of a batch request that caused it
+func sendItemProblems(ctx *gin.Context, status int, code string, detail string, items []itemProblem) {
+	ctx.Header("Content-Type", problemContentType)
+	ctx.AbortWithStatusJSON(status, problem{
+		Type: problemTypePrefix + code,
+		Title: http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Instance: ctx.Request.URL.Path,
+		Code: code,
+		Items: items,
+	})
+}
+
+// Sends the error of a binding or a param check
+func sendInvalid(ctx *gin.Context, err error) {
+	sendProblem(ctx, http.StatusBadRequest, codeInvalidRequest, err.Error())
+}
+
+// Sends a store error, domain errors keep their code and everything else is a 500
+// Internal details are logged through the gin context instead of being sent
+func sendError(ctx *gin.Context, err error) {
+	status, code, detail := describeError(ctx, err)
+	sendProblem(ctx, status, code, detail)
+}
+
+// Status, code and detail a store error is sent with, internal errors are logged
+func describeError(ctx *gin.Context, err error) (int, string, string) {
+	err = dberr.Translate(err)
+	domainErr := dberr.As(err)
+	switch {
+	case err == sql.ErrNoRows: // Handlers should say what was missing, this is the fallback
+		return http.StatusNotFound, "not_found", "Doesn't exist"
+	case domainErr == nil || domainErr.Kind == dberr.Internal:
+		ctx.Error(err)
+		return http.StatusInternalServerError, codeInternal, "Something went wrong on our side, try again later"
+	case domainErr.Kind == dberr.Invariant: // A bug or bad data, not the client's fault
+		ctx.Error(err)
+		return http.StatusInternalServerError, domainErr.Code, "Something went wrong on our side, try again later"
+	}
+	return kindStatus[domainErr.Kind], domainErr.Code, domainErr.Message
+}
@@ -0,0 +1,87 @@
+// Unit tests for the problem details sent on errors
+
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"github.com/samanthatb1/beadBashStorage/db/dberr"
+	db "github.com/samanthatb1/beadBashStorage/db/sqlc"
+	"github.com/stretchr/testify/require"
+)
+
+/* Helper Functions */
+
+// Runs sendError with err on a bare router and decodes the problem
+func sendErrorResponse(t *testing.T, err error) (*httptest.ResponseRecorder, problem) {
+	router := gin.New()
+	router.GET("/things/1", func(ctx *gin.Context) { sendError(ctx, err) })
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/things/1", nil))
+
+	var body problem
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+	return recorder, body
+}
+
+/* Test Functions */
+
+// Test Scenario: store errors are sent with the status of their kind and their stable code
+func TestSendError(t *testing.T){
+	testCases := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+	}{
+		{"TakenUsername", &pq.Error{Code: "23505", Constraint: "users_username_key"}, http.StatusConflict, "username_taken"},
+		{"MissingReference", &pq.Error{Code: "23503", Constraint: "orders_username_fkey"}, http.StatusNotFound, "user_not_found"},
+		{"TooLong", &pq.Error{Code: "22001"}, http.StatusUnprocessableEntity, "value_too_long"},
+		{"VersionMismatch", db.ErrVersionMismatch, http.StatusConflict, codeVersionMismatch},
+		{"TypedNotFound", dberr.NotFoundOr(sql.ErrNoRows, codeTagNotFound, "Tag doesn't exist"), http.StatusNotFound, codeTagNotFound},
+		{"BareNoRows", sql.ErrNoRows, http.StatusNotFound, "not_found"},
+		{"Invariant", dberr.NewInvariant("order_without_user", "Order has no user"), http.StatusInternalServerError, "order_without_user"},
+		{"Unknown", errors.New("connection refused"), http.StatusInternalServerError, codeInternal},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder, body := sendErrorResponse(t, tc.err)
+			require.Equal(t, tc.status, recorder.Code)
+			require.Equal(t, problemContentType, recorder.Header().Get("Content-Type"))
+			require.Equal(t, tc.code, body.Code)
+			require.Equal(t, problemTypePrefix+tc.code, body.Type)
+			require.Equal(t, tc.status, body.Status)
+			require.Equal(t, http.StatusText(tc.status), body.Title)
+			require.Equal(t, "/things/1", body.Instance)
+		})
+	}
+}
+
+// Test Scenario: internal details are never sent to the client
+func TestSendErrorHidesInternals(t *testing.T){
+	_, body := sendErrorResponse(t, errors.New("dial tcp 10.0.0.5:5432: connection refused"))
+	require.NotContains(t, body.Detail, "10.0.0.5")
+}
+
+// Test Scenario: requests that fail validation get an invalid_request problem
+func TestInvalidRequestProblem(t *testing.T){
+	server := newTestServer(t)
+
+	recorder := httptest.NewRecorder()
+	server.router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/users/login", nil))
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	require.Equal(t, problemContentType, recorder.Header().Get("Content-Type"))
+
+	var body problem
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+	require.Equal(t, codeInvalidRequest, body.Code)
+}
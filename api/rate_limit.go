@@ -0,0 +1,63 @@
+package api
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samanthatb1/beadBashStorage/ratelimit"
+)
+
+// Rate limit applied to a group of routes
+type rateLimitGroup struct {
+	name        string          // Keeps the buckets of different groups apart
+	limit       ratelimit.Limit // Per user, or per IP before authentication
+	apiKeyLimit ratelimit.Limit // Per API key, the zero value uses limit
+}
+
+// Limit for the identity the request is counted by
+func (group rateLimitGroup) limitFor(ctx *gin.Context) ratelimit.Limit {
+	if _, isApiKey := ctx.Get(authorizationApiKeyKey); isApiKey && group.apiKeyLimit != (ratelimit.Limit{}) {
+		return group.apiKeyLimit
+	}
+	return group.limit
+}
+
+// Rounds durations up to whole seconds for the headers
+func headerSeconds(d time.Duration) string {
+	return fmt.Sprint(int64(math.Ceil(d.Seconds())))
+}
+
+// Rejects requests over the group's limit with 429 Too Many Requests
+// Requests are counted per user or API key after authMiddleware, and per IP before it
+func rateLimitMiddleware(limiter ratelimit.Limiter, group rateLimitGroup) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		limit := group.limitFor(ctx)
+		if limit.Disabled() {
+			ctx.Next()
+			return
+		}
+
+		result, err := limiter.Allow(ctx, group.name+":"+clientIdentity(ctx), limit)
+		if err != nil {
+			sendError(ctx, err)
+			return
+		}
+
+		// Standard RateLimit headers (IETF draft) so clients can slow down before they're limited
+		ctx.Header("RateLimit-Policy", fmt.Sprintf("%d;w=%s", limit.Requests, headerSeconds(limit.Period)))
+		ctx.Header("RateLimit-Limit", fmt.Sprint(result.Limit))
+		ctx.Header("RateLimit-Remaining", fmt.Sprint(result.Remaining))
+		ctx.Header("RateLimit-Reset", headerSeconds(result.ResetAfter))
+
+		if !result.Allowed {
+			ctx.Header("Retry-After", headerSeconds(result.RetryAfter))
+			sendProblem(ctx, http.StatusTooManyRequests, codeRateLimited, "Too many requests, try again later")
+			return
+		}
+
+		ctx.Next()
+	}
+}
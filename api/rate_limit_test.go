@@ -0,0 +1,136 @@
+// Unit tests for the rate limit middleware
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	db "github.com/samanthatb1/beadBashStorage/db/sqlc"
+	"github.com/samanthatb1/beadBashStorage/ratelimit"
+	"github.com/samanthatb1/beadBashStorage/util"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Scenario: requests over the limit get 429 with Retry-After, every response gets RateLimit headers
+func TestRateLimitMiddleware(t *testing.T){
+	gin.SetMode(gin.TestMode)
+	tokenMaker, err := newTestTokenMaker()
+	require.NoError(t, err)
+
+	router := gin.New()
+	limiter := ratelimit.NewMemoryLimiter()
+	group := rateLimitGroup{name: "test", limit: ratelimit.Limit{Requests: 2, Period: time.Minute}}
+	router.GET("/limited", authMiddleware(tokenMaker, nil), rateLimitMiddleware(limiter, group), func(ctx *gin.Context) { ctx.Status(http.StatusOK) })
+
+	send := func(username string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodGet, "/limited", nil)
+		addAuthorization(t, request, tokenMaker, username, util.CustomerRole)
+		router.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	recorder := send("runaway_script")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "2", recorder.Header().Get("RateLimit-Limit"))
+	require.Equal(t, "1", recorder.Header().Get("RateLimit-Remaining"))
+	require.Equal(t, "2;w=60", recorder.Header().Get("RateLimit-Policy"))
+
+	recorder = send("runaway_script")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "0", recorder.Header().Get("RateLimit-Remaining"))
+
+	recorder = send("runaway_script")
+	require.Equal(t, http.StatusTooManyRequests, recorder.Code)
+	require.Equal(t, "30", recorder.Header().Get("Retry-After"))
+	require.Equal(t, "60", recorder.Header().Get("RateLimit-Reset"))
+
+	// Every user has their own limit even from the same IP
+	recorder = send("someone_else")
+	require.Equal(t, http.StatusOK, recorder.Code)
+}
+
+// Test Scenario: API keys get their own limit when one is set, users keep the group's
+func TestRateLimitApiKey(t *testing.T){
+	userLimit := ratelimit.Limit{Requests: 2, Period: time.Minute}
+	apiKeyLimit := ratelimit.Limit{Requests: 10, Period: time.Minute}
+
+	testCases := []struct {
+		name   string
+		group  rateLimitGroup
+		apiKey bool
+		limit  ratelimit.Limit
+	}{
+		{"User", rateLimitGroup{name: "test", limit: userLimit, apiKeyLimit: apiKeyLimit}, false, userLimit},
+		{"ApiKey", rateLimitGroup{name: "test", limit: userLimit, apiKeyLimit: apiKeyLimit}, true, apiKeyLimit},
+		{"ApiKeyWithoutOwnLimit", rateLimitGroup{name: "test", limit: userLimit}, true, userLimit},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+			if tc.apiKey {
+				ctx.Set(authorizationApiKeyKey, db.ApiKey{ID: 1})
+			}
+			require.Equal(t, tc.limit, tc.group.limitFor(ctx))
+		})
+	}
+}
+
+// Test Scenario: requests with a wrong token count against the per-IP limit, so tokens and keys can't be guessed without limit
+func TestRateLimitBeforeAuth(t *testing.T){
+	gin.SetMode(gin.TestMode)
+	server, err := NewServer(util.Config{TokenSymmetricKey: testSymmetricKey, RateLimitIP: "2/1m"}, nil)
+	require.NoError(t, err)
+
+	for _, path := range []string{"/users/all", "/v2/users", "/v2/events/orders"} {
+		t.Run(path, func(t *testing.T) {
+			var recorder *httptest.ResponseRecorder
+			for i := 0; i < 3; i++ {
+				recorder = httptest.NewRecorder()
+				request := httptest.NewRequest(http.MethodGet, path, nil)
+				request.RemoteAddr = fmt.Sprintf("198.51.100.%d:1234", len(path)) // Every path has its own IP
+				request.Header.Set(authorizationHeaderKey, authorizationTypeBearer+" not-a-token")
+				server.router.ServeHTTP(recorder, request)
+			}
+			require.Equal(t, http.StatusTooManyRequests, recorder.Code)
+		})
+	}
+}
+
+// Test Scenario: X-Forwarded-For only picks the client IP when it comes from a trusted proxy, so clients can't dodge the per-IP limit
+func TestTrustedProxies(t *testing.T){
+	gin.SetMode(gin.TestMode)
+
+	testCases := []struct {
+		name    string
+		proxies string
+		ip      string
+	}{
+		{"NoProxies", "", "192.0.2.1"}, // httptest requests come from 192.0.2.1
+		{"OtherProxy", "10.0.0.0/8", "192.0.2.1"},
+		{"TrustedProxy", "10.0.0.0/8, 192.0.2.0/24", "203.0.113.9"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server, err := NewServer(util.Config{TokenSymmetricKey: testSymmetricKey, TrustedProxies: tc.proxies}, nil)
+			require.NoError(t, err)
+			server.router.GET("/ip", func(ctx *gin.Context) { ctx.String(http.StatusOK, clientIdentity(ctx)) })
+
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(http.MethodGet, "/ip", nil)
+			request.Header.Set("X-Forwarded-For", "203.0.113.9")
+			server.router.ServeHTTP(recorder, request)
+			require.Equal(t, "ip:"+tc.ip, recorder.Body.String())
+		})
+	}
+
+	_, err := NewServer(util.Config{TokenSymmetricKey: testSymmetricKey, TrustedProxies: "not-an-ip"}, nil)
+	require.Error(t, err)
+}
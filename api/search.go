@@ -0,0 +1,59 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	sqlc "github.com/samanthatb1/beadBashStorage/db/sqlc"
+)
+
+/**** SEARCH ****/
+type searchRequest struct {
+	Query    string `form:"q" binding:"required,max=200"`
+	Type     string `form:"type" binding:"omitempty,oneof=all users orders"` // What to search, everything if empty
+	Limit    int32  `form:"limit" binding:"omitempty,min=1"` // Per type
+}
+
+type searchResponse struct {
+	Users  []sqlc.UserHit  `json:"users"`
+	Orders []sqlc.OrderHit `json:"orders"`
+}
+
+// Add search function to the server instance
+func (server *Server) search(ctx *gin.Context){
+	var reqBody searchRequest
+
+	// If params are invalid
+	if err := ctx.ShouldBindQuery(&reqBody); err != nil {
+		sendInvalid(ctx, err)
+		return
+	}
+	if reqBody.Limit == 0 {
+		reqBody.Limit = server.config.DefaultPageSize
+	}
+	if reqBody.Limit > server.config.MaxPageSize {
+		sendInvalid(ctx, fmt.Errorf("limit can't be more than %d", server.config.MaxPageSize))
+		return
+	}
+
+	result := searchResponse{Users: []sqlc.UserHit{}, Orders: []sqlc.OrderHit{}}
+	var err error
+
+	if reqBody.Type != "orders" {
+		result.Users, err = server.store.SearchUsers(ctx, reqBody.Query, reqBody.Limit)
+		if err != nil {
+			sendError(ctx, err)
+			return
+		}
+	}
+	if reqBody.Type != "users" {
+		result.Orders, err = server.store.SearchOrders(ctx, reqBody.Query, reqBody.Limit)
+		if err != nil {
+			sendError(ctx, err)
+			return
+		}
+	}
+
+	ctx.JSON(http.StatusOK, result)
+}
@@ -1,47 +1,267 @@
 package api
 
 import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
 	"github.com/gin-gonic/gin"
 	db "github.com/samanthatb1/beadBashStorage/db/sqlc"
+	"github.com/samanthatb1/beadBashStorage/feed"
+	"github.com/samanthatb1/beadBashStorage/ratelimit"
+	"github.com/samanthatb1/beadBashStorage/token"
+	"github.com/samanthatb1/beadBashStorage/util"
 	_ "github.com/lib/pq" // provides the DB driver
 )
 
 type Server struct {
+	config util.Config // Token durations and keys
 	store *db.Store // Defined in store.go: allows us to access inherent and additional DB operations
+	tokenMaker token.Maker // Creates and verifies access and refresh tokens
+	limiter ratelimit.Limiter // Counts requests per client, in memory unless replaced by a shared backend
+	openAPI *openAPIDocument // Served at /openapi.json and used to validate requests
+	graphQL *graphQLAPI // Served at /graphql
+	orderFeed *feed.Hub // Live order events for SSE and WebSocket clients, runs once the server starts
+	orderFeedOrigins map[string]bool // Origins of the browser pages that may open the order feed
 	router *gin.Engine // Router from gin
 }
 
 // New server instance
-func NewServer(store *db.Store) *Server {
+func NewServer(config util.Config, store *db.Store) (*Server, error) {
+	tokenMaker, err := token.NewPasetoMaker(config.TokenSymmetricKey)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create token maker: %w", err)
+	}
+
+	// Rate limits for each group of routes
+	publicLimit, err := ratelimit.ParseLimit(config.RateLimitPublic)
+	if err != nil { return nil, err }
+	ipLimit, err := ratelimit.ParseLimit(config.RateLimitIP)
+	if err != nil { return nil, err }
+	defaultLimit, err := ratelimit.ParseLimit(config.RateLimitDefault)
+	if err != nil { return nil, err }
+	defaultApiKeyLimit, err := ratelimit.ParseLimit(config.RateLimitDefaultApiKey)
+	if err != nil { return nil, err }
+	ordersWriteLimit, err := ratelimit.ParseLimit(config.RateLimitOrdersWrite)
+	if err != nil { return nil, err }
+	ordersWriteApiKeyLimit, err := ratelimit.ParseLimit(config.RateLimitOrdersWriteApiKey)
+	if err != nil { return nil, err }
+
+	// Built from the request structs, fails if the docs don't match the routes' params
+	openAPI, err := newOpenAPIDocument(routeDocs, v1RouteDocs)
+	if err != nil {
+		return nil, fmt.Errorf("cannot build OpenAPI document: %w", err)
+	}
+
+	graphQL, err := newGraphQLAPI(config, store)
+	if err != nil {
+		return nil, fmt.Errorf("cannot build GraphQL schema: %w", err)
+	}
+
 	// Instance
-	server := &Server{store: store} // Assign store
+	server := &Server{
+		config: config,
+		store: store, // Assign store
+		tokenMaker: tokenMaker,
+		limiter: ratelimit.NewMemoryLimiter(),
+		openAPI: openAPI,
+		graphQL: graphQL,
+		orderFeed: feed.NewHub(store, feed.Options{
+			PollInterval: config.OrderFeedPollInterval,
+			GapTimeout: time.Minute, // Longer than order transactions take
+			Retention: config.OrderEventsRetention,
+		}),
+		orderFeedOrigins: parseOrigins(config.OrderFeedAllowedOrigins),
+	}
 	router := gin.Default()
 
-	// Routes
+	// The public limit counts per ClientIP, which trusts every X-Forwarded-For unless told who may send it
+	if err := router.SetTrustedProxies(splitConfigList(config.TrustedProxies)); err != nil {
+		return nil, fmt.Errorf("cannot set trusted proxies: %w", err)
+	}
+
+	// Rate limits, shared by v1 and v2
+	limitPublic := rateLimitMiddleware(server.limiter, rateLimitGroup{name: "public", limit: publicLimit})
+	limitIP := rateLimitMiddleware(server.limiter, rateLimitGroup{name: "ip", limit: ipLimit}) // Runs before authMiddleware, so failed logins count too
+	limitDefault := rateLimitMiddleware(server.limiter, rateLimitGroup{name: "default", limit: defaultLimit, apiKeyLimit: defaultApiKeyLimit})
+	limitOrdersWrite := rateLimitMiddleware(server.limiter, rateLimitGroup{name: "orders_write", limit: ordersWriteLimit, apiKeyLimit: ordersWriteApiKeyLimit}) // On top of the default limit
+	idempotentOrders := idempotencyMiddleware(server.store, config.IdempotencyKeyTTL)
+	validate := requestValidationMiddleware(openAPI, config.MaxRequestBodySize) // Runs last, so rejected requests still count against the limits
+
+	/**** Docs ****/
+	docsRoutes := router.Group("/").Use(limitPublic)
+	docsRoutes.GET("/openapi.json", server.openAPISpec) // OpenAPI 3 document for every route
+	docsRoutes.GET("/docs", server.openAPIDocs) // Browsable docs for the document
+
+	/**** v1 Routes (deprecated, use v2) ****/
+	deprecated := deprecationMiddleware(config.APIV1Sunset)
+
+	/* Public */
+	publicRoutes := router.Group("/").Use(deprecated, limitPublic, validate)
+	publicRoutes.POST("/users", server.createUser) // Params: full_name, username, password
+	publicRoutes.POST("/users/login", server.loginUser) // Params: username, password
+	publicRoutes.POST("/tokens/renew_access", server.renewAccessToken) // Params: refresh_token
+
+	// Every route below requires "Authorization: Bearer <access token>" or "Authorization: ApiKey <key>"
+	// and a role or scope allowed by routePolicies
+	authRoutes := router.Group("/").Use(
+		deprecated,
+		limitIP,
+		authMiddleware(server.tokenMaker, server.store),
+		authorizeMiddleware(),
+		limitDefault,
+		validate,
+	)
 
 	/* User */
-	router.GET("/users/:identifier", server.getUserByUsername) // Params: username
-	router.GET("/users/all", server.listUsers) // Params: page_id, page_size
-	router.POST("/users", server.createUser) // Params: full_name, username
-	router.DELETE("/users/:username", server.deleteUserByUsername) // Params: id
+	authRoutes.GET("/users/:identifier", server.getUserByUsername) // Params: username
+	authRoutes.GET("/users/all", server.listUsers) // Params: cursor, page_size, sort, order, tag
+	authRoutes.DELETE("/users/:username", server.deleteUserByUsername) // Params: id
+	authRoutes.PATCH("/users/:username/role", server.updateUserRole) // Params: username, role
+	authRoutes.GET("/users/:identifier/export", server.exportUserData) // Params: username or id
+	authRoutes.POST("/users/:username/erase", server.eraseUser) // Params: username
+	authRoutes.POST("/users/:username/tags", server.addUserTag) // Params: username, tag
+	authRoutes.DELETE("/users/:username/tags/:tag", server.removeUserTag) // Params: username, tag
 	
 	/* Order */
-	router.GET("/orders/:username", server.listOrdersOfUser) // Params: username
-	router.GET("/orders/all", server.listAllOrders) // Params: page_id, page_size
-	router.POST("/orders", server.createOrder) // Params: username, name, all purchase info
-	router.DELETE("/orders/:order_id", server.deleteOrderById) // Params: order_id
-	router.PATCH("/orders", server.updateOrderById) // Params: order_id
+	authRoutes.GET("/orders/:username", server.listOrdersOfUser) // Params: username, cursor, page_size, sort, order, filters
+	authRoutes.GET("/orders/all", server.listAllOrders) // Params: cursor, page_size, sort, order, filters
+	authRoutes.POST("/orders", limitOrdersWrite, idempotentOrders, server.createOrder) // Params: username, name, all purchase info
+	authRoutes.POST("/orders/batch", limitOrdersWrite, idempotentOrders, server.createOrders) // Params: mode, orders
+	authRoutes.DELETE("/orders/:order_id", limitOrdersWrite, server.deleteOrderById) // Params: order_id
+	authRoutes.PATCH("/orders", limitOrdersWrite, server.updateOrderById) // Params: order_id
+	authRoutes.POST("/orders/:order_id/tags", server.addOrderTag) // Params: order_id, tag
+	authRoutes.DELETE("/orders/:order_id/tags/:tag", server.removeOrderTag) // Params: order_id, tag
+
+	/* Search */
+	authRoutes.GET("/search", server.search) // Params: q, type, limit
+
+	/* API Key */
+	authRoutes.POST("/api_keys", server.createApiKey) // Params: name, scopes, expires_at
+	authRoutes.GET("/api_keys", server.listApiKeys)
+	authRoutes.DELETE("/api_keys/:id", server.revokeApiKey) // Params: id
+
+	/**** v2 Routes ****/
+	// Resources are nested and always keyed by id, params are the same as v1 unless noted
+
+	/* Public */
+	v2PublicRoutes := router.Group("/v2").Use(limitPublic, validate)
+	v2PublicRoutes.POST("/users", server.createUser)
+	v2PublicRoutes.POST("/sessions", server.loginUser) // Log in
+	v2PublicRoutes.POST("/sessions/refresh", server.renewAccessToken) // New access token from a refresh token
+
+	v2AuthRoutes := router.Group("/v2").Use(
+		limitIP,
+		authMiddleware(server.tokenMaker, server.store),
+		resourceParamMiddleware(resourceLookup{getUser: server.store.GetUserById, getOrder: server.store.GetOrderById}),
+		authorizeMiddleware(),
+		limitDefault,
+		validate,
+	)
+
+	/* User */
+	v2AuthRoutes.GET("/users", server.listUsers)
+	v2AuthRoutes.GET("/users/:user_id", server.getUserByUsername)
+	v2AuthRoutes.DELETE("/users/:user_id", server.deleteUserByUsername)
+	v2AuthRoutes.PATCH("/users/:user_id/role", server.updateUserRole)
+	v2AuthRoutes.GET("/users/:user_id/export", server.exportUserData)
+	v2AuthRoutes.POST("/users/:user_id/erase", server.eraseUser)
+	v2AuthRoutes.POST("/users/:user_id/tags", server.addUserTag)
+	v2AuthRoutes.DELETE("/users/:user_id/tags/:tag", server.removeUserTag)
+	v2AuthRoutes.GET("/users/:user_id/orders", server.listOrdersOfUser)
+	v2AuthRoutes.GET("/exports/users", server.exportUsers) // Params: format, columns, tag
+
+	/* Order */
+	v2AuthRoutes.GET("/orders", server.listAllOrders)
+	v2AuthRoutes.POST("/orders", limitOrdersWrite, idempotentOrders, server.createOrder)
+	v2AuthRoutes.POST("/orders/batch", limitOrdersWrite, idempotentOrders, server.createOrders)
+	v2AuthRoutes.POST("/orders/import", limitOrdersWrite, server.importOrders) // Params: source, dry_run, file (Etsy or Shopify CSV)
+	v2AuthRoutes.GET("/orders/:order_id", server.getOrderById)
+	v2AuthRoutes.PATCH("/orders/:order_id", limitOrdersWrite, server.updateOrderByUri) // Params: any order field as a JSON Merge Patch, or purchase_amount, purchased_item, shipping_location
+	v2AuthRoutes.DELETE("/orders/:order_id", limitOrdersWrite, server.deleteOrderById)
+	v2AuthRoutes.POST("/orders/:order_id/tags", server.addOrderTag)
+	v2AuthRoutes.DELETE("/orders/:order_id/tags/:tag", server.removeOrderTag)
+	v2AuthRoutes.GET("/exports/orders", server.exportOrders) // Params: format, columns, username, filters
+
+	/* Search */
+	v2AuthRoutes.GET("/search", server.search)
+
+	/* Live Feed */
+	v2AuthRoutes.POST("/events/orders/tickets", server.createOrderFeedTicket) // For browsers, see v2FeedRoutes
+
+	// Browsers can't send the Authorization header with EventSource or WebSocket, they send ?ticket= instead
+	v2FeedRoutes := router.Group("/v2/events").Use(
+		orderFeedOriginMiddleware(server.orderFeedOrigins),
+		limitIP,
+		ticketAuthMiddleware(server.tokenMaker, server.store),
+		authorizeMiddleware(),
+		limitDefault,
+		validate,
+	)
+	v2FeedRoutes.GET("/orders", server.streamOrderEvents) // Params: last_event_id, or the Last-Event-ID header, ticket
+	v2FeedRoutes.GET("/orders/ws", server.streamOrderEventsWebSocket) // Params: last_event_id, ticket
+
+	/* API Key */
+	v2AuthRoutes.POST("/api_keys", server.createApiKey)
+	v2AuthRoutes.GET("/api_keys", server.listApiKeys)
+	v2AuthRoutes.DELETE("/api_keys/:id", server.revokeApiKey)
+
+	/* Webhook */
+	v2AuthRoutes.POST("/webhooks", server.createWebhook) // Params: url, events, secret
+	v2AuthRoutes.GET("/webhooks", server.listWebhooks)
+	v2AuthRoutes.DELETE("/webhooks/:id", server.deleteWebhook)
+	v2AuthRoutes.GET("/webhooks/:id/deliveries", server.listWebhookDeliveries) // Params: status, before, page_size
+	v2AuthRoutes.POST("/webhooks/:id/deliveries/:delivery_id/replay", server.replayWebhookDelivery)
+
+	/**** GraphQL ****/
+	// Users with their orders (and more) in one request, see graphql_schema.go
+	graphQLRoutes := router.Group("/").Use(
+		authMiddleware(server.tokenMaker, server.store),
+		authorizeMiddleware(),
+		limitDefault,
+		validate,
+	)
+	graphQLRoutes.POST("/graphql", server.graphQLQuery) // Params: query, operationName, variables
 
 	server.router = router // Assign router
-	return server
+	return server, nil
 }
 
-// Runs the Http server on a specified address port
+// Runs the Http server on a specified address port, over TLS if a certificate is configured
 func (server *Server) Start(address string) error {
-	return server.router.Run(address)
-}
+	// Postgres wakes the order feed up when events are committed, by any instance
+	wake, stopListening, err := feed.ListenPostgres(server.config.DBSource, db.OrderEventsChannel)
+	if err != nil {
+		return fmt.Errorf("cannot listen for order events: %w", err)
+	}
+	defer stopListening()
+	feedCtx, stopFeed := context.WithCancel(context.Background())
+	defer stopFeed()
+	go server.orderFeed.Run(feedCtx, wake)
 
-// Converts error message to a map
-func errResponseToJSON(err error) gin.H {
-	return gin.H{"error" : err.Error()}
-}
\ No newline at end of file
+	tlsConfig, stopReloading, err := util.ServerTLSConfig(server.config)
+	if err != nil { return err }
+	defer stopReloading()
+	if tlsConfig == nil {
+		return server.router.Run(address)
+	}
+
+	httpServer := &http.Server{
+		Addr: address,
+		Handler: server.router,
+		TLSConfig: tlsConfig,
+	}
+	return httpServer.ListenAndServeTLS("", "") // Certificates come from the TLS config
+}
+// Reads a comma separated config value, blank entries are dropped
+func splitConfigList(list string) []string {
+	values := []string{}
+	for _, value := range strings.Split(list, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
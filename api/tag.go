@@ -0,0 +1,162 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	sqlc "github.com/samanthatb1/beadBashStorage/db/sqlc"
+)
+
+// Tags are stored lowercase so "VIP" and "vip" are the same tag
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+type tagRequest struct {
+	Tag    string `json:"tag" binding:"required,max=32"`
+}
+
+// Binds the body and normalizes the tag before checking it, so a tag of only spaces is rejected
+func bindTagRequest(ctx *gin.Context, reqBody *tagRequest) error {
+	if err := json.NewDecoder(ctx.Request.Body).Decode(reqBody); err != nil {return err}
+	reqBody.Tag = normalizeTag(reqBody.Tag)
+	return binding.Validator.ValidateStruct(reqBody)
+}
+
+/**** ADD TAG TO USER ****/
+type userTagUriRequest struct {
+	Username    string `uri:"username" binding:"required"`
+}
+
+// Add addUserTag function to the server instance
+func (server *Server) addUserTag(ctx *gin.Context){
+	var uriParams userTagUriRequest
+	var reqBody tagRequest
+
+	// If params are invalid
+	if err := ctx.ShouldBindUri(&uriParams); err != nil {
+		sendInvalid(ctx, err)
+		return
+	}
+	if err := bindTagRequest(ctx, &reqBody); err != nil {
+		sendInvalid(ctx, err)
+		return
+	}
+
+	// Make sure user exists
+	user, err := server.store.GetUserByUsername(ctx, uriParams.Username)
+	if err != nil {
+		if err == sql.ErrNoRows { // If that username doesnt exist
+			sendProblem(ctx, http.StatusNotFound, codeUserNotFound, "User doesn't exist")
+			return
+		}
+		sendError(ctx, err)
+		return
+	}
+
+	result, err := server.store.AddUserTagTx(ctx, sqlc.UserTagTxParams{UserID: user.ID, TagName: reqBody.Tag})
+	if err != nil {
+		sendError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, result)
+}
+
+/**** REMOVE TAG FROM USER ****/
+type removeUserTagRequest struct {
+	Username    string `uri:"username" binding:"required"`
+	Tag         string `uri:"tag" binding:"required"`
+}
+
+// Add removeUserTag function to the server instance
+func (server *Server) removeUserTag(ctx *gin.Context){
+	var reqBody removeUserTagRequest
+
+	// If params are invalid
+	if err := ctx.ShouldBindUri(&reqBody); err != nil {
+		sendInvalid(ctx, err)
+		return
+	}
+
+	// Make sure user exists
+	user, err := server.store.GetUserByUsername(ctx, reqBody.Username)
+	if err != nil {
+		if err == sql.ErrNoRows { // If that username doesnt exist
+			sendProblem(ctx, http.StatusNotFound, codeUserNotFound, "User doesn't exist")
+			return
+		}
+		sendError(ctx, err)
+		return
+	}
+
+	result, err := server.store.RemoveUserTagTx(ctx, sqlc.UserTagTxParams{UserID: user.ID, TagName: normalizeTag(reqBody.Tag)})
+	if err != nil { // Says whether the user or the tag is missing
+		sendError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, result)
+}
+
+/**** ADD TAG TO ORDER ****/
+type orderTagUriRequest struct {
+	OrderId   int64  `uri:"order_id" binding:"required"`
+}
+
+// Add addOrderTag function to the server instance
+func (server *Server) addOrderTag(ctx *gin.Context){
+	var uriParams orderTagUriRequest
+	var reqBody tagRequest
+
+	// If params are invalid
+	if err := ctx.ShouldBindUri(&uriParams); err != nil {
+		sendInvalid(ctx, err)
+		return
+	}
+	if err := bindTagRequest(ctx, &reqBody); err != nil {
+		sendInvalid(ctx, err)
+		return
+	}
+
+	result, err := server.store.AddOrderTagTx(ctx, sqlc.OrderTagTxParams{OrderID: uriParams.OrderId, TagName: reqBody.Tag})
+	if err != nil {
+		if err == sql.ErrNoRows { // If that id doesnt exist
+			sendProblem(ctx, http.StatusNotFound, codeOrderNotFound, "Order doesn't exist")
+			return
+		}
+		sendError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, result)
+}
+
+/**** REMOVE TAG FROM ORDER ****/
+type removeOrderTagRequest struct {
+	OrderId   int64  `uri:"order_id" binding:"required"`
+	Tag       string `uri:"tag" binding:"required"`
+}
+
+// Add removeOrderTag function to the server instance
+func (server *Server) removeOrderTag(ctx *gin.Context){
+	var reqBody removeOrderTagRequest
+
+	// If params are invalid
+	if err := ctx.ShouldBindUri(&reqBody); err != nil {
+		sendInvalid(ctx, err)
+		return
+	}
+
+	result, err := server.store.RemoveOrderTagTx(ctx, sqlc.OrderTagTxParams{OrderID: reqBody.OrderId, TagName: normalizeTag(reqBody.Tag)})
+	if err != nil { // Says whether the order or the tag is missing
+		sendError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,47 @@
+// Unit tests for reading tags from request bodies
+
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+/* Test Functions */
+
+// Test Scenario: tags are normalized before they're checked
+func TestBindTagRequest(t *testing.T){
+	testCases := []struct {
+		name string
+		body string
+		tag  string // Empty when the body is rejected
+	}{
+		{"Valid", `{"tag": "vip"}`, "vip"},
+		{"Normalized", `{"tag": "  VIP  "}`, "vip"},
+		{"Missing", `{}`, ""},
+		{"OnlySpaces", `{"tag": "   "}`, ""},
+		{"TooLong", `{"tag": "` + strings.Repeat("a", 33) + `"}`, ""},
+		{"LongOnlyWithSpaces", `{"tag": "  ` + strings.Repeat("a", 32) + `  "}`, strings.Repeat("a", 32)},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+			ctx.Request = httptest.NewRequest(http.MethodPost, "/orders/1/tags", strings.NewReader(tc.body))
+
+			var reqBody tagRequest
+			err := bindTagRequest(ctx, &reqBody)
+			if tc.tag == "" {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.tag, reqBody.Tag)
+		})
+	}
+}
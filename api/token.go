@@ -0,0 +1,85 @@
+package api
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samanthatb1/beadBashStorage/token"
+)
+
+/**** RENEW ACCESS TOKEN ****/
+type renewAccessTokenRequest struct {
+	RefreshToken    string `json:"refresh_token" binding:"required"`
+}
+
+type renewAccessTokenResponse struct {
+	AccessToken          string    `json:"access_token"`
+	AccessTokenExpiresAt time.Time `json:"access_token_expires_at"`
+}
+
+// Add renewAccessToken function to the server instance
+func (server *Server) renewAccessToken(ctx *gin.Context){
+	var reqBody renewAccessTokenRequest
+
+	// If params are invalid
+	if err := ctx.ShouldBindJSON(&reqBody); err != nil {
+		sendInvalid(ctx, err)
+		return
+	}
+
+	refreshPayload, err := server.tokenMaker.VerifyToken(reqBody.RefreshToken)
+	if err == nil {
+		err = refreshPayload.CheckType(token.RefreshToken) // Access tokens don't have a session
+	}
+	if err != nil {
+		sendProblem(ctx, http.StatusUnauthorized, codeUnauthorized, err.Error())
+		return
+	}
+
+	// The refresh token must belong to a live session
+	session, err := server.store.GetSession(ctx, refreshPayload.ID)
+	if err != nil {
+		if err == sql.ErrNoRows { // If that session doesnt exist
+			sendProblem(ctx, http.StatusNotFound, codeSessionNotFound, "Session doesn't exist")
+			return
+		}
+		sendError(ctx, err)
+		return
+	}
+
+	user, err := server.store.GetUserById(ctx, session.UserID)
+	if err != nil {
+		sendError(ctx, err)
+		return
+	}
+
+	if session.IsBlocked {
+		sendProblem(ctx, http.StatusUnauthorized, codeInvalidSession, "blocked session")
+		return
+	}
+	if user.Username != refreshPayload.Username {
+		sendProblem(ctx, http.StatusUnauthorized, codeInvalidSession, "incorrect session user")
+		return
+	}
+	if session.RefreshToken != reqBody.RefreshToken {
+		sendProblem(ctx, http.StatusUnauthorized, codeInvalidSession, "mismatched session token")
+		return
+	}
+	if time.Now().After(session.ExpiresAt) {
+		sendProblem(ctx, http.StatusUnauthorized, codeInvalidSession, "expired session")
+		return
+	}
+
+	accessToken, accessPayload, err := server.tokenMaker.CreateToken(user.Username, user.Role, token.AccessToken, server.config.AccessTokenDuration)
+	if err != nil {
+		sendError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, renewAccessTokenResponse{
+		AccessToken: accessToken,
+		AccessTokenExpiresAt: accessPayload.ExpiredAt,
+	})
+}
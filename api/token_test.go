@@ -0,0 +1,51 @@
+// Unit tests for access and refresh tokens, the parts that don't need the DB
+
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/samanthatb1/beadBashStorage/token"
+	"github.com/samanthatb1/beadBashStorage/util"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Scenario: a refresh token can't be sent as an access token
+func TestRefreshTokenAsAccessToken(t *testing.T){
+	server := newTestServer(t)
+	tokenMaker, err := newTestTokenMaker()
+	require.NoError(t, err)
+
+	refreshToken, _, err := tokenMaker.CreateToken(testCustomer, util.AdminRole, token.RefreshToken, time.Hour)
+	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, "/users/all", nil)
+	request.Header.Set(authorizationHeaderKey, fmt.Sprintf("%s %s", authorizationTypeBearer, refreshToken))
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
+
+// Test Scenario: an access token can't be exchanged for a new one
+func TestRenewWithAccessToken(t *testing.T){
+	server := newTestServer(t)
+	tokenMaker, err := newTestTokenMaker()
+	require.NoError(t, err)
+
+	accessToken, _, err := tokenMaker.CreateToken(testCustomer, util.CustomerRole, token.AccessToken, time.Minute)
+	require.NoError(t, err)
+	body, err := json.Marshal(renewAccessTokenRequest{RefreshToken: accessToken})
+	require.NoError(t, err)
+
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPost, "/v2/sessions/refresh", bytes.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	server.router.ServeHTTP(recorder, request)
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+}
@@ -4,9 +4,14 @@ import (
 	"database/sql"
 	"net/http"
 	"strconv"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	sqlc "github.com/samanthatb1/beadBashStorage/db/sqlc"
+	"github.com/samanthatb1/beadBashStorage/token"
+	"github.com/samanthatb1/beadBashStorage/util"
 )
 
 /**** CREATE USER ****/
@@ -14,6 +19,7 @@ import (
 type createUserRequest struct {
 	FullName    string `json:"full_name" binding:"required"`
 	Username    string `json:"username" binding:"required"`
+	Password    string `json:"password" binding:"required,min=6"`
 }
 
 // Add createUser function to the server instance
@@ -22,22 +28,32 @@ func (server *Server) createUser(ctx *gin.Context){
 
 	// If params are invalid
 	if err := ctx.ShouldBindJSON(&reqBody); err != nil { 
-		ctx.JSON(http.StatusBadRequest, errResponseToJSON(err))
+		sendInvalid(ctx, err)
+		return
+	}
+	if err := util.CheckUsername(reqBody.Username); err != nil {
+		sendInvalid(ctx, err)
+		return
+	}
+
+	// Data is valid, never store the plain password
+	hashedPassword, err := util.HashPassword(reqBody.Password)
+	if err != nil {
+		sendError(ctx, err)
 		return
 	}
 
-	// Data is valid
-	args := sqlc.CreateUserParams{
+	args := sqlc.CreateUserTxParams{
 		FullName: reqBody.FullName,
 		Username: reqBody.Username,
-		TotalOrders: 0, // New user defaults to 0 orders
+		HashedPassword: hashedPassword,
 	}
 
 	// Access the store we constructed through the server instance
-	user, err := server.store.CreateUser(ctx, args)
+	user, err := server.store.CreateUserTx(ctx, args)
 	// Check if the DB insertion was successful 
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, errResponseToJSON(err))
+		sendError(ctx, err)
 		return
 	}
 
@@ -45,6 +61,109 @@ func (server *Server) createUser(ctx *gin.Context){
 	ctx.JSON(http.StatusOK, user)
 }
 
+/**** LOGIN USER ****/
+
+type loginUserRequest struct {
+	Username    string `json:"username" binding:"required"`
+	Password    string `json:"password" binding:"required,min=6"`
+}
+
+type loginUserResponse struct {
+	SessionID             uuid.UUID `json:"session_id"`
+	AccessToken           string    `json:"access_token"`
+	AccessTokenExpiresAt  time.Time `json:"access_token_expires_at"`
+	RefreshToken          string    `json:"refresh_token"`
+	RefreshTokenExpiresAt time.Time `json:"refresh_token_expires_at"`
+	User                  sqlc.User `json:"user"`
+}
+
+// Add loginUser function to the server instance
+func (server *Server) loginUser(ctx *gin.Context){
+	var reqBody loginUserRequest
+
+	// If params are invalid
+	if err := ctx.ShouldBindJSON(&reqBody); err != nil {
+		sendInvalid(ctx, err)
+		return
+	}
+
+	// Unknown users, users without a password and wrong passwords get the same answer
+	// and take as long, so the login route can't be used to find out who has an account
+	hashedPassword, hasPassword := dummyPasswordHash(), false
+	user, err := server.store.GetUserByUsername(ctx, reqBody.Username)
+	if err != nil && err != sql.ErrNoRows {
+		sendError(ctx, err)
+		return
+	}
+	if err == nil {
+		// Users created through an order have no password and can't log in
+		credential, err := server.store.GetCredential(ctx, user.ID)
+		if err != nil && err != sql.ErrNoRows {
+			sendError(ctx, err)
+			return
+		}
+		if err == nil {
+			hashedPassword, hasPassword = credential.HashedPassword, true
+		}
+	}
+
+	err = util.CheckPassword(reqBody.Password, hashedPassword)
+	if err != nil || !hasPassword {
+		sendProblem(ctx, http.StatusUnauthorized, codeBadCredentials, "Incorrect username or password")
+		return
+	}
+
+	accessToken, accessPayload, err := server.tokenMaker.CreateToken(user.Username, user.Role, token.AccessToken, server.config.AccessTokenDuration)
+	if err != nil {
+		sendError(ctx, err)
+		return
+	}
+
+	refreshToken, refreshPayload, err := server.tokenMaker.CreateToken(user.Username, user.Role, token.RefreshToken, server.config.RefreshTokenDuration)
+	if err != nil {
+		sendError(ctx, err)
+		return
+	}
+
+	// Keep track of the refresh token so it can be blocked later
+	session, err := server.store.CreateSession(ctx, sqlc.CreateSessionParams{
+		ID: refreshPayload.ID,
+		UserID: user.ID,
+		RefreshToken: refreshToken,
+		UserAgent: ctx.Request.UserAgent(),
+		ClientIp: ctx.ClientIP(),
+		IsBlocked: false,
+		ExpiresAt: refreshPayload.ExpiredAt,
+	})
+	if err != nil {
+		sendError(ctx, err)
+		return
+	}
+
+	// Success, send tokens to client
+	ctx.JSON(http.StatusOK, loginUserResponse{
+		SessionID: session.ID,
+		AccessToken: accessToken,
+		AccessTokenExpiresAt: accessPayload.ExpiredAt,
+		RefreshToken: refreshToken,
+		RefreshTokenExpiresAt: refreshPayload.ExpiredAt,
+		User: user,
+	})
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     string
+)
+
+// Hash checked when the user doesn't exist or has no password, so those logins take as long as a wrong password
+func dummyPasswordHash() string {
+	dummyHashOnce.Do(func() {
+		dummyHash, _ = util.HashPassword(uuid.NewString())
+	})
+	return dummyHash
+}
+
 /**** GET USER BY USERNAME OR ID ****/
 type getUserUsernameRequest struct {
 	Identifier    string   `uri:"identifier" binding:"required"`
@@ -53,10 +172,19 @@ type getUserUsernameRequest struct {
 // Add getUserByUsername function to the server instance
 func (server *Server) getUserByUsername(ctx *gin.Context){
 	var reqBody getUserUsernameRequest
+	var reqQuery fieldsRequest
 
 	// If params are invalid
 	if err := ctx.ShouldBindUri(&reqBody); err != nil { 
-		ctx.JSON(http.StatusBadRequest, errResponseToJSON(err))
+		sendInvalid(ctx, err)
+		return
+	}
+	if err := ctx.ShouldBindQuery(&reqQuery); err != nil {
+		sendInvalid(ctx, err)
+		return
+	}
+	set, ok := bindFieldSet(ctx, reqQuery, userFields, userRelations)
+	if !ok {
 		return
 	}
 
@@ -70,10 +198,10 @@ func (server *Server) getUserByUsername(ctx *gin.Context){
 		// Check if the DB fetch was successful 
 		if err != nil {
 			if err == sql.ErrNoRows { // If that id doesnt exist
-				ctx.JSON(http.StatusNotFound, gin.H{"error" : "User with that id doesn't exist"})
+				sendProblem(ctx, http.StatusNotFound, codeUserNotFound, "User with that id doesn't exist")
 				return
 			}
-			ctx.JSON(http.StatusInternalServerError, errResponseToJSON(err))
+			sendError(ctx, err)
 			return
 		}
 	} else { // If its a username
@@ -82,23 +210,37 @@ func (server *Server) getUserByUsername(ctx *gin.Context){
 		// Check if the DB fetch was successful 
 		if err != nil {
 			if err == sql.ErrNoRows { // If that id doesnt exist
-				ctx.JSON(http.StatusNotFound, gin.H{"error" : "User with that username doesn't exist"})
+				sendProblem(ctx, http.StatusNotFound, codeUserNotFound, "User with that username doesn't exist")
 				return
 			}
-			ctx.JSON(http.StatusInternalServerError, errResponseToJSON(err))
+			sendError(ctx, err)
 			return
 		}
 	}
+	if !ownsResource(ctx, user.Username) {
+		sendProblem(ctx, http.StatusForbidden, codeForbidden, "Customers can only read their own profile")
+		return
+	}
 
-	// Success, send user to client
-	ctx.JSON(http.StatusOK, user)
+	// Embed the orders and leave out the fields the client didn't pick
+	rendered, err := server.renderUsers(ctx, set, []sqlc.User{user})
+	if err != nil {
+		sendError(ctx, err)
+		return
+	}
+
+	// Success, send user to client, or 304 if it hasn't changed since the client read it
+	etag, lastModified := set.validators(user.Version, user.UpdatedAt)
+	sendConditional(ctx, etag, lastModified, rendered[0])
 }
 
 /**** LIST USERS ****/
 
 type listUsersRequest struct {
-	PageId    int32 `form:"page_id" binding:"required"`
-	PageSize    int32 `form:"page_size" binding:"required,min=5,max=10"`
+	pageRequest
+	fieldsRequest
+	Sort    string `form:"sort" binding:"omitempty,oneof=id date name"` // name sorts by username
+	Tag    string `form:"tag"` // Optional: only users with this tag
 }
 
 // Add listUsers function to the server instance
@@ -107,25 +249,36 @@ func (server *Server) listUsers(ctx *gin.Context){
 
 	// If params are invalid
 	if err := ctx.ShouldBindQuery(&reqBody); err != nil { 
-		ctx.JSON(http.StatusBadRequest, errResponseToJSON(err))
+		sendInvalid(ctx, err)
 		return
 	}
-
-	args := sqlc.ListUsersParams{
-		Limit: reqBody.PageSize,
-		Offset: (reqBody.PageId - 1) * reqBody.PageSize,
+	params, err := server.pageParams(reqBody.pageRequest, reqBody.Sort)
+	if err != nil {
+		sendInvalid(ctx, err)
+		return
+	}
+	set, ok := bindFieldSet(ctx, reqBody.fieldsRequest, userFields, userRelations)
+	if !ok {
+		return
 	}
 
 	// Access the store we constructed through the server instance
-	users, err := server.store.ListUsers(ctx, args)
+	page, err := server.store.ListUsersPage(ctx, sqlc.UserFilter{Tag: normalizeTag(reqBody.Tag)}, params)
 	// Check if the DB fetch was successful 
 	if err != nil {
-		ctx.JSON(http.StatusInternalServerError, errResponseToJSON(err))
+		sendError(ctx, err)
+		return
+	}
+	// The orders of the whole page are read with one query
+	users, err := server.renderUsers(ctx, set, page.Users)
+	if err != nil {
+		sendError(ctx, err)
 		return
 	}
 
-	// Success, send user back to client
-	ctx.JSON(http.StatusOK, users)
+	// Success, send users back to client, or 304 if the page hasn't changed
+	// No Last-Modified, a row leaving the page or a new total wouldn't move it
+	sendConditional(ctx, "", time.Time{}, newPageResponse(users, params, page.Next, page.Total))
 }
 
 /**** DELETE USER BY USERNAME ****/
@@ -139,7 +292,7 @@ func (server *Server) deleteUserByUsername(ctx *gin.Context){
 
 	// If params are invalid
 	if err := ctx.ShouldBindUri(&reqBody); err != nil { 
-		ctx.JSON(http.StatusBadRequest, errResponseToJSON(err))
+		sendInvalid(ctx, err)
 		return
 	}
 
@@ -148,20 +301,76 @@ func (server *Server) deleteUserByUsername(ctx *gin.Context){
 	// Check if the DB fetch was successful 
 	if err != nil {
 		if err == sql.ErrNoRows { // If that id doesnt exist
-			ctx.JSON(http.StatusNotFound, gin.H{"error" : "User doesn't exist"})
+			sendProblem(ctx, http.StatusNotFound, codeUserNotFound, "User doesn't exist")
 			return
 		}
-		ctx.JSON(http.StatusInternalServerError, errResponseToJSON(err))
+		sendError(ctx, err)
 		return
 	}
 
-	result, err := server.store.DeleteUserTx(ctx, sqlc.DeleteUserTxParams{ID : user.ID})
+	// Only delete the version the client has seen, if it sent If-Match
+	deleteParams := sqlc.DeleteUserTxParams{ID : user.ID}
+	if versions, ok := ifMatchVersions(ctx); ok {
+		deleteParams.Versions = versions
+		if len(versions) == 0 { // None of our ETags, can't match
+			sendProblem(ctx, http.StatusPreconditionFailed, codeVersionMismatch, "User was changed by someone else, fetch it again")
+			return
+		}
+	}
+
+	result, err := server.store.DeleteUserTx(ctx, deleteParams)
+	if err == sqlc.ErrVersionMismatch {
+		sendProblem(ctx, http.StatusPreconditionFailed, codeVersionMismatch, "User was changed by someone else, fetch it again")
+		return
+	}
 	// Check if the DB Delete was successful 
 	if err != nil || result.Status != "Deleted" {
-		ctx.JSON(http.StatusInternalServerError, errResponseToJSON(err))
+		sendError(ctx, err)
 		return
 	}
 
 	// Success, send user to client
 	ctx.JSON(http.StatusOK, gin.H{"Deleted" : user.Username})
+}
+
+/**** UPDATE USER ROLE ****/
+type updateUserRoleUriRequest struct {
+	Username    string `uri:"username" binding:"required"`
+}
+
+type updateUserRoleRequest struct {
+	Role    string `json:"role" binding:"required,oneof=customer admin fulfillment read_only"`
+}
+
+// Add updateUserRole function to the server instance
+func (server *Server) updateUserRole(ctx *gin.Context){
+	var uriParams updateUserRoleUriRequest
+	var reqBody updateUserRoleRequest
+
+	// If params are invalid
+	if err := ctx.ShouldBindUri(&uriParams); err != nil {
+		sendInvalid(ctx, err)
+		return
+	}
+	if err := ctx.ShouldBindJSON(&reqBody); err != nil {
+		sendInvalid(ctx, err)
+		return
+	}
+
+	// New role takes effect the next time the user logs in or renews their access token
+	user, err := server.store.UpdateUserRole(ctx, sqlc.UpdateUserRoleParams{
+		Username: uriParams.Username,
+		Role: reqBody.Role,
+	})
+	if err != nil {
+		if err == sql.ErrNoRows { // If that username doesnt exist
+			sendProblem(ctx, http.StatusNotFound, codeUserNotFound, "User doesn't exist")
+			return
+		}
+		sendError(ctx, err)
+		return
+	}
+
+	// Success, send user to client
+	ctx.JSON(http.StatusOK, user)
 }
\ No newline at end of file
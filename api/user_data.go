@@ -0,0 +1,142 @@
+package api
+
+import (
+	"archive/zip"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	sqlc "github.com/samanthatb1/beadBashStorage/db/sqlc"
+)
+
+/**** EXPORT USER DATA ****/
+type exportUserDataRequest struct {
+	Identifier    string   `uri:"identifier" binding:"required"`
+}
+
+// Add exportUserData function to the server instance
+// Sends everything stored about a customer as a ZIP of JSON files
+func (server *Server) exportUserData(ctx *gin.Context){
+	var reqBody exportUserDataRequest
+
+	// If params are invalid
+	if err := ctx.ShouldBindUri(&reqBody); err != nil {
+		sendInvalid(ctx, err)
+		return
+	}
+
+	// Client can send an id or a username
+	var user sqlc.User
+	id, err := strconv.ParseInt(reqBody.Identifier, 10, 64)
+	if err == nil {
+		user, err = server.store.GetUserById(ctx, id)
+	} else {
+		user, err = server.store.GetUserByUsername(ctx, reqBody.Identifier)
+	}
+	if err != nil {
+		if err == sql.ErrNoRows { // If that user doesnt exist
+			sendProblem(ctx, http.StatusNotFound, codeUserNotFound, "User doesn't exist")
+			return
+		}
+		sendError(ctx, err)
+		return
+	}
+	if !ownsResource(ctx, user.Username) {
+		sendProblem(ctx, http.StatusForbidden, codeForbidden, "Customers can only export their own data")
+		return
+	}
+
+	export, err := server.store.ExportUserDataTx(ctx, user.ID)
+	if err != nil {
+		sendError(ctx, err)
+		return
+	}
+
+	ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-data.zip"`, user.Username))
+	ctx.Header("Content-Type", "application/zip")
+	ctx.Header("Cache-Control", "no-store")
+	ctx.Status(http.StatusOK)
+	if err := writeUserDataZip(ctx.Writer, export); err != nil {
+		ctx.Error(err) // Headers are already sent
+	}
+}
+
+// Writes each part of the export as its own JSON file
+func writeUserDataZip(w io.Writer, export sqlc.UserDataExport) error {
+	files := []struct {
+		name    string
+		content interface{}
+	}{
+		{"user.json", export.User},
+		{"orders.json", export.Orders},
+		{"tags.json", export.Tags},
+		{"sessions.json", export.Sessions},
+		{"credential.json", export.Credential},
+	}
+
+	archive := zip.NewWriter(w)
+	for _, file := range files {
+		data, err := json.MarshalIndent(file.content, "", "  ")
+		if err != nil {return err}
+
+		fileWriter, err := archive.Create(file.name)
+		if err != nil {return err}
+		if _, err = fileWriter.Write(data); err != nil {return err}
+	}
+
+	return archive.Close()
+}
+
+/**** ERASE USER ****/
+type eraseUserRequest struct {
+	Username    string `uri:"username" binding:"required"`
+}
+
+// Add eraseUser function to the server instance
+// Removes the customer's PII but keeps their orders for accounting, unlike deleteUserByUsername
+func (server *Server) eraseUser(ctx *gin.Context){
+	var reqBody eraseUserRequest
+
+	// If params are invalid
+	if err := ctx.ShouldBindUri(&reqBody); err != nil {
+		sendInvalid(ctx, err)
+		return
+	}
+
+	// Make sure user exists
+	user, err := server.store.GetUserByUsername(ctx, reqBody.Username)
+	if err != nil {
+		if err == sql.ErrNoRows { // If that username doesnt exist
+			sendProblem(ctx, http.StatusNotFound, codeUserNotFound, "User doesn't exist")
+			return
+		}
+		sendError(ctx, err)
+		return
+	}
+
+	args := sqlc.EraseUserTxParams{ID: user.ID}
+	if versions, ok := ifMatchVersions(ctx); ok {
+		args.Versions = versions
+		if len(versions) == 0 { // None of our ETags, can't match
+			sendProblem(ctx, http.StatusPreconditionFailed, codeVersionMismatch, "User was changed by someone else, fetch it again")
+			return
+		}
+	}
+
+	result, err := server.store.EraseUserTx(ctx, args)
+	if err != nil {
+		if err == sqlc.ErrVersionMismatch {
+			sendProblem(ctx, http.StatusPreconditionFailed, codeVersionMismatch, "User was changed by someone else, fetch it again")
+			return
+		}
+		sendError(ctx, err)
+		return
+	}
+
+	ctx.Header("ETag", versionETag(result.User.Version))
+	ctx.JSON(http.StatusOK, result)
+}
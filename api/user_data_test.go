@@ -0,0 +1,49 @@
+// Unit tests for the customer data export
+
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+
+	sqlc "github.com/samanthatb1/beadBashStorage/db/sqlc"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Scenario: every part of the export ends up in its own JSON file
+func TestWriteUserDataZip(t *testing.T){
+	export := sqlc.UserDataExport{
+		User: sqlc.User{ID: 4, Username: "jane", FullName: "Jane Doe"},
+		Tags: []sqlc.Tag{{ID: 1, Name: "vip"}},
+	}
+
+	var buffer bytes.Buffer
+	require.NoError(t, writeUserDataZip(&buffer, export))
+
+	archive, err := zip.NewReader(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+	require.NoError(t, err)
+
+	files := map[string][]byte{}
+	for _, file := range archive.File {
+		reader, err := file.Open()
+		require.NoError(t, err)
+		files[file.Name], err = io.ReadAll(reader)
+		require.NoError(t, err)
+		reader.Close()
+	}
+	require.Len(t, files, 5)
+	require.Contains(t, files, "orders.json")
+	require.Contains(t, files, "sessions.json")
+	require.Contains(t, files, "credential.json")
+
+	var user sqlc.User
+	require.NoError(t, json.Unmarshal(files["user.json"], &user))
+	require.Equal(t, export.User.FullName, user.FullName)
+
+	var tags []sqlc.Tag
+	require.NoError(t, json.Unmarshal(files["tags.json"], &tags))
+	require.Equal(t, "vip", tags[0].Name)
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samanthatb1/beadBashStorage/db/dberr"
+	db "github.com/samanthatb1/beadBashStorage/db/sqlc"
+	"github.com/samanthatb1/beadBashStorage/token"
+	"github.com/samanthatb1/beadBashStorage/util"
+)
+
+// Path params of the v2 user routes, documented for the OpenAPI spec
+// The handlers bind the username resourceParamMiddleware looks up instead
+type userIdUri struct {
+	UserId    int64  `uri:"user_id" binding:"required,min=1"`
+}
+
+type userTagUri struct {
+	userIdUri
+	Tag       string `uri:"tag" binding:"required"`
+}
+
+// Looks up the rows behind v2 path ids, the store's methods in production and stubs in tests
+type resourceLookup struct {
+	getUser  func(ctx context.Context, id int64) (db.User, error)
+	getOrder func(ctx context.Context, orderID int64) (db.Order, error)
+}
+
+// v2 paths are keyed by id, v1 handlers and owner policies work with usernames
+// Resolves :user_id and :order_id to their owner's username and adds it as the "username" param
+// :user_id is also added as "identifier", handlers taking an identifier look numbers up by id
+// Must run before authorizeMiddleware so customers can reach their own resources
+func resourceParamMiddleware(lookup resourceLookup) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var params gin.Params
+
+		if param := ctx.Param("user_id"); param != "" {
+			id, err := strconv.ParseInt(param, 10, 64)
+			if err != nil {
+				sendProblem(ctx, http.StatusBadRequest, codeInvalidRequest, "user id must be a number")
+				return
+			}
+			user, err := lookup.getUser(ctx, id)
+			if err != nil {
+				sendLookupError(ctx, err, codeUserNotFound, "User doesn't exist")
+				return
+			}
+			params = gin.Params{{Key: "username", Value: user.Username}, {Key: "identifier", Value: param}}
+		} else if param := ctx.Param("order_id"); param != "" {
+			id, err := strconv.ParseInt(param, 10, 64)
+			if err != nil {
+				sendProblem(ctx, http.StatusBadRequest, codeInvalidRequest, "order id must be a number")
+				return
+			}
+			order, err := lookup.getOrder(ctx, id)
+			if err != nil {
+				sendLookupError(ctx, err, codeOrderNotFound, "Order doesn't exist")
+				return
+			}
+			params = gin.Params{{Key: "username", Value: order.Username}}
+		} else {
+			ctx.Next()
+			return
+		}
+
+		ctx.Params = append(ctx.Params, params...)
+		ctx.Next()
+	}
+}
+
+// Sends the error of a failed id lookup
+// Customers get the same 403 for a missing row as for someone else's, so they can't probe which ids exist
+func sendLookupError(ctx *gin.Context, err error, code string, message string) {
+	payload, isUser := ctx.Get(authorizationPayloadKey)
+	if isUser && payload.(*token.Payload).Role == util.CustomerRole && dberr.Translate(err) == sql.ErrNoRows {
+		sendProblem(ctx, http.StatusForbidden, codeForbidden, roleNotAllowed(ctx, util.CustomerRole).Error())
+		return
+	}
+	sendError(ctx, dberr.NotFoundOr(err, code, message))
+}
+
+// Marks v1 responses as deprecated and points clients at v2
+// sunset is an HTTP date (e.g. "Sat, 01 Mar 2025 00:00:00 GMT"), the Sunset header is left out if it's empty
+func deprecationMiddleware(sunset string) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Header("Deprecation", "true")
+		ctx.Header("Link", `</v2>; rel="successor-version"`)
+		if sunset != "" {
+			ctx.Header("Sunset", sunset)
+		}
+		ctx.Next()
+	}
+}
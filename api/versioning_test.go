@@ -0,0 +1,107 @@
+// Unit tests for the v1 deprecation headers and the v2 id lookups
+
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	db "github.com/samanthatb1/beadBashStorage/db/sqlc"
+	"github.com/samanthatb1/beadBashStorage/token"
+	"github.com/samanthatb1/beadBashStorage/util"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Scenario: v1 responses are marked deprecated, v2 responses aren't
+func TestDeprecationHeaders(t *testing.T){
+	server := newTestServer(t)
+
+	recorder := httptest.NewRecorder()
+	server.router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/users/all", nil))
+	require.Equal(t, "true", recorder.Header().Get("Deprecation"))
+	require.Equal(t, `</v2>; rel="successor-version"`, recorder.Header().Get("Link"))
+	require.Empty(t, recorder.Header().Get("Sunset"))
+
+	recorder = httptest.NewRecorder()
+	server.router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/v2/users", nil))
+	require.Equal(t, http.StatusUnauthorized, recorder.Code)
+	require.Empty(t, recorder.Header().Get("Deprecation"))
+
+	// Sunset date is sent once one is picked
+	router := gin.New()
+	router.GET("/", deprecationMiddleware("Sat, 01 Mar 2025 00:00:00 GMT"), func(ctx *gin.Context) { ctx.Status(http.StatusOK) })
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(t, "Sat, 01 Mar 2025 00:00:00 GMT", recorder.Header().Get("Sunset"))
+}
+
+// Test Scenario: v2 ids are resolved to the owner's username, unknown and malformed ids are rejected
+func TestResourceParamMiddleware(t *testing.T){
+	lookup := resourceLookup{
+		getUser: func(ctx context.Context, id int64) (db.User, error) {
+			if id != 7 {
+				return db.User{}, sql.ErrNoRows
+			}
+			return db.User{ID: id, Username: "bead_lover"}, nil
+		},
+		getOrder: func(ctx context.Context, orderID int64) (db.Order, error) {
+			if orderID != 3 {
+				return db.Order{}, sql.ErrNoRows
+			}
+			return db.Order{OrderID: orderID, Username: "order_owner"}, nil
+		},
+	}
+
+	router := gin.New()
+	router.Use(resourceParamMiddleware(lookup))
+	echo := func(ctx *gin.Context) { ctx.String(http.StatusOK, ctx.Param("username")) }
+	router.GET("/v2/users/:user_id", echo)
+	router.GET("/v2/orders/:order_id", echo)
+	router.GET("/v2/orders", echo)
+
+	testCases := []struct {
+		url      string
+		code     int
+		username string
+	}{
+		{"/v2/users/7", http.StatusOK, "bead_lover"},
+		{"/v2/users/8", http.StatusNotFound, ""},
+		{"/v2/users/bead_lover", http.StatusBadRequest, ""},
+		{"/v2/orders/3", http.StatusOK, "order_owner"},
+		{"/v2/orders/4", http.StatusNotFound, ""},
+		{"/v2/orders", http.StatusOK, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.url, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, tc.url, nil))
+			require.Equal(t, tc.code, recorder.Code)
+			if tc.code == http.StatusOK {
+				require.Equal(t, tc.username, recorder.Body.String())
+			}
+		})
+	}
+
+	// Customers can't tell missing ids from other people's, authorizeMiddleware sends them the same 403
+	customerRouter := gin.New()
+	customerRouter.Use(func(ctx *gin.Context) {
+		ctx.Set(authorizationPayloadKey, &token.Payload{Username: testCustomer, Role: util.CustomerRole})
+	}, resourceParamMiddleware(lookup))
+	customerRouter.GET("/v2/users/:user_id", echo)
+	customerRouter.GET("/v2/orders/:order_id", echo)
+
+	for _, url := range []string{"/v2/users/8", "/v2/orders/4"} {
+		recorder := httptest.NewRecorder()
+		customerRouter.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, url, nil))
+		require.Equal(t, http.StatusForbidden, recorder.Code, url)
+		var body problem
+		require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+		require.Equal(t, codeForbidden, body.Code)
+	}
+}
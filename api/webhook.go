@@ -0,0 +1,285 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	sqlc "github.com/samanthatb1/beadBashStorage/db/sqlc"
+	"github.com/samanthatb1/beadBashStorage/webhook"
+)
+
+// Webhook as shown to clients, the secret is only sent back when it's created
+type webhookResponse struct {
+	ID        int64     `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func newWebhookResponse(hook sqlc.Webhook) webhookResponse {
+	return webhookResponse{
+		ID: hook.ID,
+		URL: hook.Url,
+		Events: hook.Events,
+		CreatedAt: hook.CreatedAt,
+	}
+}
+
+// Delivery as shown in the log
+type webhookDeliveryResponse struct {
+	ID             int64           `json:"id"`
+	WebhookID      int64           `json:"webhook_id"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"` // Body sent to the webhook
+	Status         string          `json:"status"` // pending, succeeded or failed
+	Attempts       int32           `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at"` // Only while pending
+	LastStatusCode int32           `json:"last_status_code"` // 0 if the receiver didn't answer
+	LastError      string          `json:"last_error"`
+	DeliveredAt    *time.Time      `json:"delivered_at"`
+	ReplayOf       *int64          `json:"replay_of"` // Delivery this one was replayed from
+	CreatedAt      time.Time       `json:"created_at"`
+}
+
+func newWebhookDeliveryResponse(delivery sqlc.WebhookDelivery) webhookDeliveryResponse {
+	response := webhookDeliveryResponse{
+		ID: delivery.ID,
+		WebhookID: delivery.WebhookID,
+		Event: delivery.Event,
+		Payload: json.RawMessage(delivery.Payload),
+		Status: delivery.Status,
+		Attempts: delivery.Attempts,
+		LastStatusCode: delivery.LastStatusCode,
+		LastError: delivery.LastError,
+		CreatedAt: delivery.CreatedAt,
+	}
+	if delivery.Status == sqlc.DeliveryPending {
+		response.NextAttemptAt = &delivery.NextAttemptAt
+	}
+	if delivery.DeliveredAt.Valid {
+		response.DeliveredAt = &delivery.DeliveredAt.Time
+	}
+	if delivery.ReplayOf.Valid {
+		response.ReplayOf = &delivery.ReplayOf.Int64
+	}
+	return response
+}
+
+type webhookIdUri struct {
+	ID    int64 `uri:"id" binding:"required,min=1"`
+}
+
+/**** CREATE WEBHOOK ****/
+type createWebhookRequest struct {
+	URL     string   `json:"url" binding:"required"` // https on a public host
+	Events  []string `json:"events" binding:"required,min=1,dive,oneof=order.created order.updated order.deleted user.deleted"`
+	Secret  string   `json:"secret" binding:"omitempty,min=16"` // Optional: one is generated if empty
+}
+
+type createWebhookResponse struct {
+	Secret   string          `json:"secret"` // Only ever returned here, deliveries are signed with it
+	Webhook  webhookResponse `json:"webhook"`
+}
+
+// Add createWebhook function to the server instance
+func (server *Server) createWebhook(ctx *gin.Context){
+	var reqBody createWebhookRequest
+
+	// If params are invalid
+	if err := ctx.ShouldBindJSON(&reqBody); err != nil {
+		sendInvalid(ctx, err)
+		return
+	}
+	if err := webhook.CheckURL(reqBody.URL, server.config.WebhookAllowPrivateNetworks); err != nil {
+		sendInvalid(ctx, err)
+		return
+	}
+
+	secret := reqBody.Secret
+	if secret == "" {
+		var err error
+		if secret, err = webhook.GenerateSecret(); err != nil {
+			sendError(ctx, err)
+			return
+		}
+	}
+
+	hook, err := server.store.CreateWebhook(ctx, sqlc.CreateWebhookParams{
+		Url: reqBody.URL,
+		Events: uniqueStrings(reqBody.Events),
+		Secret: secret,
+	})
+	if err != nil {
+		sendError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, createWebhookResponse{Secret: secret, Webhook: newWebhookResponse(hook)})
+}
+
+// Drops repeated values, keeping the first of each
+func uniqueStrings(values []string) []string {
+	seen := map[string]bool{}
+	unique := make([]string, 0, len(values))
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
+
+/**** LIST WEBHOOKS ****/
+
+// Add listWebhooks function to the server instance
+func (server *Server) listWebhooks(ctx *gin.Context){
+	hooks, err := server.store.ListWebhooks(ctx)
+	if err != nil {
+		sendError(ctx, err)
+		return
+	}
+
+	response := make([]webhookResponse, 0, len(hooks))
+	for _, hook := range hooks {
+		response = append(response, newWebhookResponse(hook))
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+/**** DELETE WEBHOOK ****/
+
+// Add deleteWebhook function to the server instance
+func (server *Server) deleteWebhook(ctx *gin.Context){
+	var reqUri webhookIdUri
+
+	// If params are invalid
+	if err := ctx.ShouldBindUri(&reqUri); err != nil {
+		sendInvalid(ctx, err)
+		return
+	}
+
+	// Its deliveries go with it, pending ones are never sent
+	hook, err := server.store.DeleteWebhook(ctx, reqUri.ID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			sendProblem(ctx, http.StatusNotFound, codeWebhookNotFound, "Webhook doesn't exist")
+			return
+		}
+		sendError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusOK, newWebhookResponse(hook))
+}
+
+/**** LIST WEBHOOK DELIVERIES ****/
+type listWebhookDeliveriesRequest struct {
+	Status    string `form:"status" binding:"omitempty,oneof=pending succeeded failed"`
+	Before    int64  `form:"before" binding:"omitempty,min=1"` // next_before of the previous page, empty for the newest deliveries
+	PageSize  int32  `form:"page_size" binding:"omitempty,min=1"`
+}
+
+type webhookDeliveriesResponse struct {
+	Data        []webhookDeliveryResponse `json:"data"` // Newest first
+	NextBefore  int64                     `json:"next_before"` // 0 on the last page
+}
+
+// Add listWebhookDeliveries function to the server instance
+func (server *Server) listWebhookDeliveries(ctx *gin.Context){
+	var reqUri webhookIdUri
+	var reqQuery listWebhookDeliveriesRequest
+
+	// If params are invalid
+	if err := ctx.ShouldBindUri(&reqUri); err != nil {
+		sendInvalid(ctx, err)
+		return
+	}
+	if err := ctx.ShouldBindQuery(&reqQuery); err != nil {
+		sendInvalid(ctx, err)
+		return
+	}
+	pageSize := reqQuery.PageSize
+	if pageSize == 0 {
+		pageSize = server.config.DefaultPageSize
+	}
+	if pageSize > server.config.MaxPageSize {
+		sendInvalid(ctx, fmt.Errorf("page_size must be at most %d", server.config.MaxPageSize))
+		return
+	}
+
+	if !server.webhookExists(ctx, reqUri.ID) {
+		return
+	}
+
+	params := sqlc.ListWebhookDeliveriesParams{WebhookID: reqUri.ID, MaxRows: pageSize + 1} // One more tells if there's a next page
+	if reqQuery.Status != "" {
+		params.Status = sql.NullString{String: reqQuery.Status, Valid: true}
+	}
+	if reqQuery.Before != 0 {
+		params.BeforeID = sql.NullInt64{Int64: reqQuery.Before, Valid: true}
+	}
+	deliveries, err := server.store.ListWebhookDeliveries(ctx, params)
+	if err != nil {
+		sendError(ctx, err)
+		return
+	}
+
+	response := webhookDeliveriesResponse{Data: make([]webhookDeliveryResponse, 0, len(deliveries))}
+	if len(deliveries) > int(pageSize) {
+		deliveries = deliveries[:pageSize]
+		response.NextBefore = deliveries[len(deliveries)-1].ID
+	}
+	for _, delivery := range deliveries {
+		response.Data = append(response.Data, newWebhookDeliveryResponse(delivery))
+	}
+	ctx.JSON(http.StatusOK, response)
+}
+
+// Sends a not found problem if the webhook doesn't exist
+func (server *Server) webhookExists(ctx *gin.Context, id int64) bool {
+	_, err := server.store.GetWebhook(ctx, id)
+	if err == sql.ErrNoRows {
+		sendProblem(ctx, http.StatusNotFound, codeWebhookNotFound, "Webhook doesn't exist")
+		return false
+	}
+	if err != nil {
+		sendError(ctx, err)
+		return false
+	}
+	return true
+}
+
+/**** REPLAY WEBHOOK DELIVERY ****/
+type replayWebhookDeliveryRequest struct {
+	ID          int64 `uri:"id" binding:"required,min=1"`
+	DeliveryID  int64 `uri:"delivery_id" binding:"required,min=1"`
+}
+
+// Add replayWebhookDelivery function to the server instance
+// The payload is queued again as a new delivery, the dispatcher sends it like any other
+func (server *Server) replayWebhookDelivery(ctx *gin.Context){
+	var reqUri replayWebhookDeliveryRequest
+
+	// If params are invalid
+	if err := ctx.ShouldBindUri(&reqUri); err != nil {
+		sendInvalid(ctx, err)
+		return
+	}
+
+	delivery, err := server.store.ReplayWebhookDeliveryTx(ctx, sqlc.GetWebhookDeliveryParams{ID: reqUri.DeliveryID, WebhookID: reqUri.ID})
+	if err != nil {
+		if err == sql.ErrNoRows { // If the webhook doesn't exist or the delivery isn't one of its own
+			sendProblem(ctx, http.StatusNotFound, codeDeliveryNotFound, "Webhook delivery doesn't exist")
+			return
+		}
+		sendError(ctx, err)
+		return
+	}
+
+	ctx.JSON(http.StatusAccepted, newWebhookDeliveryResponse(delivery))
+}
@@ -0,0 +1,97 @@
+// Unit tests for managing webhooks, the parts that don't need the DB
+
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	sqlc "github.com/samanthatb1/beadBashStorage/db/sqlc"
+	"github.com/samanthatb1/beadBashStorage/util"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Scenario: webhooks that can't be delivered to and bad log params are rejected before the DB is used
+func TestWebhookParams(t *testing.T){
+	server := newTestServer(t)
+	tokenMaker, err := newTestTokenMaker()
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name   string
+		method string
+		url    string
+		body   string
+	}{
+		{"NoEvents", http.MethodPost, "/v2/webhooks", `{"url": "https://example.com/hooks", "events": []}`},
+		{"UnknownEvent", http.MethodPost, "/v2/webhooks", `{"url": "https://example.com/hooks", "events": ["order.shipped"]}`},
+		{"RelativeURL", http.MethodPost, "/v2/webhooks", `{"url": "/hooks", "events": ["order.created"]}`},
+		{"NotHTTP", http.MethodPost, "/v2/webhooks", `{"url": "ftp://example.com/hooks", "events": ["order.created"]}`},
+		{"PlainHTTP", http.MethodPost, "/v2/webhooks", `{"url": "http://example.com/hooks", "events": ["order.created"]}`},
+		{"PrivateAddress", http.MethodPost, "/v2/webhooks", `{"url": "https://169.254.169.254/latest/meta-data", "events": ["order.created"]}`},
+		{"ShortSecret", http.MethodPost, "/v2/webhooks", `{"url": "https://example.com/hooks", "events": ["order.created"], "secret": "short"}`},
+		{"BadWebhookId", http.MethodDelete, "/v2/webhooks/zero", ""},
+		{"UnknownStatus", http.MethodGet, "/v2/webhooks/3/deliveries?status=lost", ""},
+		{"PageTooLarge", http.MethodGet, "/v2/webhooks/3/deliveries?page_size=100000", ""},
+		{"BadDeliveryId", http.MethodPost, "/v2/webhooks/3/deliveries/0/replay", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			request := httptest.NewRequest(tc.method, tc.url, strings.NewReader(tc.body))
+			request.Header.Set("Content-Type", "application/json")
+			addAuthorization(t, request, tokenMaker, testCustomer, util.AdminRole)
+			server.router.ServeHTTP(recorder, request)
+			require.Equal(t, http.StatusBadRequest, recorder.Code, recorder.Body.String())
+
+			var body problem
+			require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &body))
+			require.Equal(t, codeInvalidRequest, body.Code)
+		})
+	}
+}
+
+// Test Scenario: the log shows the payload as JSON, and when the next attempt is only while it's pending
+func TestWebhookDeliveryResponse(t *testing.T){
+	now := time.Now()
+	delivery := sqlc.WebhookDelivery{
+		ID: 5,
+		WebhookID: 3,
+		Event: sqlc.EventOrderDeleted,
+		Payload: `{"event":"order.deleted","data":{"order_id":9}}`,
+		Status: sqlc.DeliverySucceeded,
+		Attempts: 2,
+		NextAttemptAt: now,
+		LastStatusCode: http.StatusOK,
+		DeliveredAt: sql.NullTime{Time: now, Valid: true},
+		ReplayOf: sql.NullInt64{Int64: 4, Valid: true},
+	}
+
+	response := newWebhookDeliveryResponse(delivery)
+	require.Nil(t, response.NextAttemptAt)
+	require.Equal(t, now, *response.DeliveredAt)
+	require.Equal(t, int64(4), *response.ReplayOf)
+
+	data, err := json.Marshal(response)
+	require.NoError(t, err)
+	require.Contains(t, string(data), `"payload":{"event":"order.deleted","data":{"order_id":9}}`)
+
+	delivery.Status = sqlc.DeliveryPending
+	delivery.DeliveredAt, delivery.ReplayOf = sql.NullTime{}, sql.NullInt64{}
+	response = newWebhookDeliveryResponse(delivery)
+	require.Equal(t, now, *response.NextAttemptAt)
+	require.Nil(t, response.DeliveredAt)
+	require.Nil(t, response.ReplayOf)
+}
+
+// Test Scenario: a webhook subscribed to an event twice gets it once
+func TestUniqueStrings(t *testing.T){
+	require.Equal(t, []string{"order.created", "user.deleted"}, uniqueStrings([]string{"order.created", "user.deleted", "order.created"}))
+	require.Equal(t, []string{}, uniqueStrings(nil))
+}
@@ -0,0 +1,124 @@
+// In-process cache of values read from the DB, each API instance has its own
+
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+type entry struct {
+	value   interface{}
+	expires time.Time
+}
+
+// Cache keeps values for a TTL, a nil *Cache caches nothing
+// Readers take a Generation before reading the DB and pass it to Set, so a value read before a write
+// that was invalidated while the read was running isn't stored
+type Cache struct {
+	ttl        time.Duration
+	maxEntries int
+
+	mu         sync.Mutex
+	entries    map[string]entry
+	generation uint64
+	now        func() time.Time // Replaced in tests
+}
+
+// Creates a cache keeping values for ttl and at most maxEntries of them, nil if ttl isn't positive
+func New(ttl time.Duration, maxEntries int) *Cache {
+	if ttl <= 0 {
+		return nil
+	}
+	return &Cache{
+		ttl: ttl,
+		maxEntries: maxEntries,
+		entries: map[string]entry{},
+		now: time.Now,
+	}
+}
+
+// The value of the key, if it's there and not expired
+func (cache *Cache) Get(key string) (interface{}, bool) {
+	if cache == nil {
+		return nil, false
+	}
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	e, ok := cache.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if !cache.now().Before(e.expires) {
+		delete(cache.entries, key)
+		return nil, false
+	}
+	return e.value, true
+}
+
+// Take it before reading what's passed to Set
+func (cache *Cache) Generation() uint64 {
+	if cache == nil {
+		return 0
+	}
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	return cache.generation
+}
+
+// Stores the value under the keys, unless something was invalidated since the generation was taken
+func (cache *Cache) Set(generation uint64, value interface{}, keys ...string) {
+	if cache == nil {
+		return
+	}
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if generation != cache.generation {
+		return
+	}
+
+	now := cache.now()
+	if len(cache.entries)+len(keys) > cache.maxEntries {
+		cache.sweep(now)
+	}
+	if len(cache.entries)+len(keys) > cache.maxEntries {
+		cache.entries = map[string]entry{} // Still full of live entries, start over
+	}
+	for _, key := range keys {
+		cache.entries[key] = entry{value: value, expires: now.Add(cache.ttl)}
+	}
+}
+
+// Removes the keys, reads that were running keep their values out of the cache
+func (cache *Cache) Delete(keys ...string) {
+	if cache == nil {
+		return
+	}
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	cache.generation++
+	for _, key := range keys {
+		delete(cache.entries, key)
+	}
+}
+
+// Removes every key, for writes that touch more rows than they know about
+func (cache *Cache) Clear() {
+	if cache == nil {
+		return
+	}
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	cache.generation++
+	cache.entries = map[string]entry{}
+}
+
+// Drops expired entries, caller must hold the lock
+func (cache *Cache) sweep(now time.Time) {
+	for key, e := range cache.entries {
+		if !now.Before(e.expires) {
+			delete(cache.entries, key)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+// Unit tests for the in-process TTL cache
+
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Cache with a clock the tests can move forward
+func newTestCache(maxEntries int) (*Cache, *time.Time) {
+	now := time.Now()
+	cache := New(time.Minute, maxEntries)
+	cache.now = func() time.Time { return now }
+	return cache, &now
+}
+
+// Test Scenario: values are kept until they expire
+func TestCacheTTL(t *testing.T){
+	cache, now := newTestCache(10)
+	cache.Set(cache.Generation(), "jane", "user:id:1", "user:username:jane")
+
+	for _, key := range []string{"user:id:1", "user:username:jane"} {
+		value, ok := cache.Get(key)
+		require.True(t, ok)
+		require.Equal(t, "jane", value)
+	}
+
+	*now = now.Add(time.Minute)
+	_, ok := cache.Get("user:id:1")
+	require.False(t, ok)
+}
+
+// Test Scenario: deleted keys are gone, and reads that started before the delete aren't stored
+func TestCacheInvalidation(t *testing.T){
+	cache, _ := newTestCache(10)
+	cache.Set(cache.Generation(), 1, "order:1")
+	cache.Set(cache.Generation(), 2, "order:2")
+
+	generation := cache.Generation() // A read starts
+	cache.Delete("order:1")          // A write commits meanwhile
+	cache.Set(generation, 1, "order:1")
+	_, ok := cache.Get("order:1")
+	require.False(t, ok)
+	_, ok = cache.Get("order:2")
+	require.True(t, ok)
+
+	cache.Clear()
+	_, ok = cache.Get("order:2")
+	require.False(t, ok)
+}
+
+// Test Scenario: a full cache drops expired entries first, then everything
+func TestCacheMaxEntries(t *testing.T){
+	cache, now := newTestCache(2)
+	cache.Set(cache.Generation(), 1, "order:1")
+	*now = now.Add(time.Minute)
+	cache.Set(cache.Generation(), 2, "order:2")
+	cache.Set(cache.Generation(), 3, "order:3")
+	require.Len(t, cache.entries, 2) // order:1 expired
+
+	cache.Set(cache.Generation(), 4, "order:4")
+	require.Len(t, cache.entries, 1)
+	_, ok := cache.Get("order:4")
+	require.True(t, ok)
+}
+
+// Test Scenario: a nil cache, when caching is off, stores nothing
+func TestCacheOff(t *testing.T){
+	cache := New(0, 10)
+	require.Nil(t, cache)
+	cache.Set(cache.Generation(), 1, "order:1")
+	_, ok := cache.Get("order:1")
+	require.False(t, ok)
+	cache.Delete("order:1")
+	cache.Clear()
+}
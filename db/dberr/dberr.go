@@ -0,0 +1,169 @@
+// Domain errors the store returns, so callers can tell a missing row from a broken DB
+// Postgres errors are translated by their SQLSTATE code and constraint name
+
+package dberr
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// What went wrong, callers pick a status from it (HTTP, gRPC ...)
+type Kind int
+
+const (
+	Internal   Kind = iota // Anything that isn't one of the kinds below, e.g. the DB is down
+	NotFound               // The row doesn't exist
+	Conflict               // Clashes with another row or a concurrent change, e.g. a taken username
+	Validation             // The values can't be stored, e.g. a name that's too long
+	Invariant              // The data broke a rule the code relies on, e.g. an order without its user
+)
+
+func (kind Kind) String() string {
+	switch kind {
+	case NotFound:
+		return "not found"
+	case Conflict:
+		return "conflict"
+	case Validation:
+		return "validation"
+	case Invariant:
+		return "invariant"
+	}
+	return "internal"
+}
+
+// A domain error, Code is stable and Message can be shown to clients
+type Error struct {
+	Kind    Kind
+	Code    string // e.g. "username_taken", part of the API so don't rename
+	Message string
+	Err     error // What caused it, nil if the store found the problem itself
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Err)
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+/********* Constructors *********/
+
+func NewNotFound(code string, message string) *Error {
+	return &Error{Kind: NotFound, Code: code, Message: message}
+}
+
+func NewConflict(code string, message string) *Error {
+	return &Error{Kind: Conflict, Code: code, Message: message}
+}
+
+func NewValidation(code string, message string) *Error {
+	return &Error{Kind: Validation, Code: code, Message: message}
+}
+
+func NewInvariant(code string, message string) *Error {
+	return &Error{Kind: Invariant, Code: code, Message: message}
+}
+
+/********* Inspecting *********/
+
+// The domain error in err's chain, nil if there is none
+func As(err error) *Error {
+	var domainErr *Error
+	if errors.As(err, &domainErr) {
+		return domainErr
+	}
+	return nil
+}
+
+// Kind of the domain error in err's chain, Internal if there is none
+func KindOf(err error) Kind {
+	if domainErr := As(err); domainErr != nil {
+		return domainErr.Kind
+	}
+	return Internal
+}
+
+/********* Postgres *********/
+
+// SQLSTATE codes the translation understands
+// https://www.postgresql.org/docs/current/errcodes-appendix.html
+const (
+	uniqueViolation       = "23505"
+	foreignKeyViolation   = "23503"
+	notNullViolation      = "23502"
+	checkViolation        = "23514"
+	exclusionViolation    = "23P01"
+	stringTooLong         = "22001"
+	numericOutOfRange     = "22003"
+	invalidTextValue      = "22P02"
+	invalidDatetimeFormat = "22007"
+	serializationFailure  = "40001"
+	deadlockDetected      = "40P01"
+)
+
+// Errors for constraints clients can run into, keyed by the name Postgres gives the constraint
+// Constraints missing here get a generic code for their kind
+var constraintErrors = map[string]*Error{
+	"users_username_key":      NewConflict("username_taken", "Username is already taken"),
+	"orders_username_fkey":    NewNotFound("user_not_found", "User doesn't exist"),
+	"orders_account_id_fkey":  NewNotFound("user_not_found", "User doesn't exist"),
+	"orders_external_id_key":  NewConflict("already_imported", "An order with this external id was already imported"),
+}
+
+// Turns Postgres errors into domain errors, other errors come back as they are
+// sql.ErrNoRows is left alone too, only the caller knows which row was missing
+func Translate(err error) error {
+	var pqErr *pq.Error
+	if err == nil || As(err) != nil || !errors.As(err, &pqErr) {
+		return err
+	}
+
+	// A foreign key also fails when deleting a row others still refer to, the table only covers missing references
+	stillReferenced := pqErr.Code == foreignKeyViolation && strings.Contains(pqErr.Detail, "is still referenced")
+	if known, ok := constraintErrors[pqErr.Constraint]; ok && !stillReferenced {
+		return &Error{Kind: known.Kind, Code: known.Code, Message: known.Message, Err: err}
+	}
+
+	switch pqErr.Code {
+	case uniqueViolation:
+		return &Error{Kind: Conflict, Code: "already_exists", Message: "A row with these values already exists", Err: err}
+	case exclusionViolation:
+		return &Error{Kind: Conflict, Code: "conflict", Message: "Clashes with another row", Err: err}
+	case foreignKeyViolation:
+		if stillReferenced {
+			return &Error{Kind: Conflict, Code: "still_referenced", Message: "Other rows still refer to it", Err: err}
+		}
+		return &Error{Kind: NotFound, Code: "reference_not_found", Message: "A row it refers to doesn't exist", Err: err}
+	case notNullViolation:
+		return &Error{Kind: Validation, Code: "missing_value", Message: fmt.Sprintf("%s can't be empty", pqErr.Column), Err: err}
+	case checkViolation:
+		return &Error{Kind: Validation, Code: "check_failed", Message: "A value is out of the allowed range", Err: err}
+	case stringTooLong:
+		return &Error{Kind: Validation, Code: "value_too_long", Message: "A value is too long", Err: err}
+	case numericOutOfRange:
+		return &Error{Kind: Validation, Code: "value_out_of_range", Message: "A number is too large", Err: err}
+	case invalidTextValue, invalidDatetimeFormat:
+		return &Error{Kind: Validation, Code: "invalid_value", Message: "A value has the wrong format", Err: err}
+	case serializationFailure, deadlockDetected:
+		return &Error{Kind: Conflict, Code: "concurrent_update", Message: "Changed at the same time by another request, try again", Err: err}
+	}
+	return err
+}
+
+// Treats a missing row as a NotFound domain error, other errors are translated like Translate
+func NotFoundOr(err error, code string, message string) error {
+	if err == sql.ErrNoRows {
+		return &Error{Kind: NotFound, Code: code, Message: message, Err: err}
+	}
+	return Translate(err)
+}
@@ -0,0 +1,75 @@
+// Unit tests for translating Postgres errors into domain errors
+
+package dberr
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Scenario: SQLSTATE codes and known constraints become domain errors with stable codes
+func TestTranslate(t *testing.T){
+	testCases := []struct {
+		name string
+		err  *pq.Error
+		kind Kind
+		code string
+	}{
+		{"TakenUsername", &pq.Error{Code: "23505", Constraint: "users_username_key"}, Conflict, "username_taken"},
+		{"ImportedTwice", &pq.Error{Code: "23505", Constraint: "orders_external_id_key"}, Conflict, "already_imported"},
+		{"OtherUnique", &pq.Error{Code: "23505", Constraint: "tags_name_key"}, Conflict, "already_exists"},
+		{"MissingUser", &pq.Error{Code: "23503", Constraint: "orders_username_fkey"}, NotFound, "user_not_found"},
+		{"StillReferenced", &pq.Error{Code: "23503", Constraint: "orders_username_fkey", Detail: `Key (username)=(bob) is still referenced from table "orders".`}, Conflict, "still_referenced"},
+		{"OtherReference", &pq.Error{Code: "23503", Constraint: "order_tags_tag_id_fkey"}, NotFound, "reference_not_found"},
+		{"NotNull", &pq.Error{Code: "23502", Column: "full_name"}, Validation, "missing_value"},
+		{"Check", &pq.Error{Code: "23514"}, Validation, "check_failed"},
+		{"TooLong", &pq.Error{Code: "22001"}, Validation, "value_too_long"},
+		{"OutOfRange", &pq.Error{Code: "22003"}, Validation, "value_out_of_range"},
+		{"BadText", &pq.Error{Code: "22P02"}, Validation, "invalid_value"},
+		{"Serialization", &pq.Error{Code: "40001"}, Conflict, "concurrent_update"},
+		{"Deadlock", &pq.Error{Code: "40P01"}, Conflict, "concurrent_update"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := Translate(fmt.Errorf("tx err: %w", tc.err))
+			domainErr := As(err)
+			require.NotNil(t, domainErr)
+			require.Equal(t, tc.kind, domainErr.Kind)
+			require.Equal(t, tc.code, domainErr.Code)
+			require.NotEmpty(t, domainErr.Message)
+
+			// The Postgres error stays in the chain for logging
+			var pqErr *pq.Error
+			require.True(t, errors.As(err, &pqErr))
+		})
+	}
+}
+
+// Test Scenario: errors that aren't from Postgres come back as they are
+func TestTranslateLeavesOthers(t *testing.T){
+	require.Nil(t, Translate(nil))
+	require.Equal(t, sql.ErrNoRows, Translate(sql.ErrNoRows))
+	require.Equal(t, Internal, KindOf(Translate(errors.New("connection refused"))))
+	require.Equal(t, Internal, KindOf(Translate(&pq.Error{Code: "53300"}))) // too_many_connections
+
+	// Domain errors aren't translated twice
+	conflict := NewConflict("version_mismatch", "Changed")
+	require.Equal(t, error(conflict), Translate(conflict))
+}
+
+// Test Scenario: missing rows become NotFound with the caller's code
+func TestNotFoundOr(t *testing.T){
+	err := NotFoundOr(sql.ErrNoRows, "tag_not_found", "Tag doesn't exist")
+	require.Equal(t, NotFound, KindOf(err))
+	require.Equal(t, "tag_not_found", As(err).Code)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	require.Nil(t, NotFoundOr(nil, "tag_not_found", "Tag doesn't exist"))
+	require.Equal(t, "username_taken", As(NotFoundOr(&pq.Error{Code: "23505", Constraint: "users_username_key"}, "x", "x")).Code)
+}
@@ -0,0 +1,33 @@
+CREATE TABLE "tags" (
+  "id" bigserial PRIMARY KEY,
+  "name" varchar UNIQUE NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE TABLE "user_tags" (
+  "user_id" bigint NOT NULL,
+  "tag_id" bigint NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT (now()),
+  PRIMARY KEY ("user_id", "tag_id")
+);
+
+CREATE TABLE "order_tags" (
+  "order_id" bigint NOT NULL,
+  "tag_id" bigint NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT (now()),
+  PRIMARY KEY ("order_id", "tag_id")
+);
+
+CREATE INDEX ON "user_tags" ("tag_id");
+
+CREATE INDEX ON "order_tags" ("tag_id");
+
+COMMENT ON COLUMN "tags"."name" IS 'stored lowercase, e.g. wholesale, vip, gift, rush';
+
+ALTER TABLE "user_tags" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE CASCADE;
+
+ALTER TABLE "user_tags" ADD FOREIGN KEY ("tag_id") REFERENCES "tags" ("id") ON DELETE CASCADE;
+
+ALTER TABLE "order_tags" ADD FOREIGN KEY ("order_id") REFERENCES "orders" ("order_id") ON DELETE CASCADE;
+
+ALTER TABLE "order_tags" ADD FOREIGN KEY ("tag_id") REFERENCES "tags" ("id") ON DELETE CASCADE;
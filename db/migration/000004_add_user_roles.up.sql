@@ -0,0 +1,3 @@
+ALTER TABLE "users" ADD COLUMN "role" varchar NOT NULL DEFAULT 'customer';
+
+COMMENT ON COLUMN "users"."role" IS 'customer, admin, fulfillment or read_only';
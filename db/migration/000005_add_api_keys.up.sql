@@ -0,0 +1,17 @@
+CREATE TABLE "api_keys" (
+  "id" bigserial PRIMARY KEY,
+  "name" varchar NOT NULL,
+  "key_prefix" varchar NOT NULL,
+  "hashed_key" varchar UNIQUE NOT NULL,
+  "scopes" varchar[] NOT NULL,
+  "expires_at" timestamptz NOT NULL,
+  "last_used_at" timestamptz,
+  "revoked_at" timestamptz,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+COMMENT ON COLUMN "api_keys"."key_prefix" IS 'first characters of the key, shown to tell keys apart';
+
+COMMENT ON COLUMN "api_keys"."hashed_key" IS 'sha256 of the key, the key itself is never stored';
+
+COMMENT ON COLUMN "api_keys"."scopes" IS 'e.g. orders:read, orders:write';
@@ -0,0 +1,18 @@
+CREATE TABLE "idempotency_keys" (
+  "owner" varchar NOT NULL,
+  "key" varchar NOT NULL,
+  "request_hash" varchar NOT NULL,
+  "response_status" int NOT NULL DEFAULT 0,
+  "response_body" jsonb NOT NULL DEFAULT 'null',
+  "expires_at" timestamptz NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT (now()),
+  PRIMARY KEY ("owner", "key")
+);
+
+CREATE INDEX ON "idempotency_keys" ("expires_at");
+
+COMMENT ON COLUMN "idempotency_keys"."owner" IS 'user or API key that sent the request, keys are only unique per owner';
+
+COMMENT ON COLUMN "idempotency_keys"."request_hash" IS 'sha256 of the request, a key reused with another request is rejected';
+
+COMMENT ON COLUMN "idempotency_keys"."response_status" IS '0 while the first request is still being processed';
@@ -0,0 +1,7 @@
+ALTER TABLE "users" ADD COLUMN "version" bigint NOT NULL DEFAULT 1;
+
+ALTER TABLE "orders" ADD COLUMN "version" bigint NOT NULL DEFAULT 1;
+
+COMMENT ON COLUMN "users"."version" IS 'increases on every update, used for ETag and If-Match';
+
+COMMENT ON COLUMN "orders"."version" IS 'increases on every update, used for ETag and If-Match';
@@ -0,0 +1,11 @@
+DROP INDEX IF EXISTS "users_full_name_bidx_idx";
+
+DROP INDEX IF EXISTS "orders_shipping_location_bidx_idx";
+
+CREATE INDEX ON "orders" ("shipping_location");
+
+ALTER TABLE "orders" DROP COLUMN IF EXISTS "shipping_location_bidx";
+
+ALTER TABLE "orders" DROP COLUMN IF EXISTS "full_name_bidx";
+
+ALTER TABLE "users" DROP COLUMN IF EXISTS "full_name_bidx";
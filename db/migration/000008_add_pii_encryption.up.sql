@@ -0,0 +1,31 @@
+ALTER TABLE "users" ADD COLUMN "full_name_bidx" varchar NOT NULL DEFAULT '';
+
+ALTER TABLE "orders" ADD COLUMN "full_name_bidx" varchar NOT NULL DEFAULT '';
+
+ALTER TABLE "orders" ADD COLUMN "shipping_location_bidx" varchar NOT NULL DEFAULT '';
+
+-- Existing rows are still plain text, their index is the normalised value until rotate-keys encrypts them
+UPDATE "users" SET "full_name_bidx" = lower(regexp_replace(trim("full_name"), '\s+', ' ', 'g'));
+
+UPDATE "orders" SET
+  "full_name_bidx" = lower(regexp_replace(trim("full_name"), '\s+', ' ', 'g')),
+  "shipping_location_bidx" = lower(regexp_replace(trim("shipping_location"), '\s+', ' ', 'g'));
+
+-- Encrypted values can't be looked up directly, lookups go through the blind index
+DROP INDEX IF EXISTS "orders_shipping_location_idx";
+
+CREATE INDEX ON "orders" ("shipping_location_bidx");
+
+CREATE INDEX ON "users" ("full_name_bidx");
+
+COMMENT ON COLUMN "users"."full_name" IS 'encrypted when PII keys are configured';
+
+COMMENT ON COLUMN "orders"."full_name" IS 'encrypted when PII keys are configured';
+
+COMMENT ON COLUMN "orders"."shipping_location" IS 'encrypted when PII keys are configured';
+
+COMMENT ON COLUMN "users"."full_name_bidx" IS 'HMAC of the normalised full name, used for exact-match lookups';
+
+COMMENT ON COLUMN "orders"."full_name_bidx" IS 'HMAC of the normalised full name, used for exact-match lookups';
+
+COMMENT ON COLUMN "orders"."shipping_location_bidx" IS 'HMAC of the normalised shipping location, used for exact-match lookups';
@@ -0,0 +1,5 @@
+ALTER TABLE "orders" DROP CONSTRAINT IF EXISTS "orders_username_fkey";
+
+ALTER TABLE "orders" ADD FOREIGN KEY ("username") REFERENCES "users" ("username");
+
+ALTER TABLE "users" DROP COLUMN IF EXISTS "erased_at";
@@ -0,0 +1,8 @@
+ALTER TABLE "users" ADD COLUMN "erased_at" timestamptz;
+
+COMMENT ON COLUMN "users"."erased_at" IS 'set when the customer''s PII was erased, their orders are kept for accounting';
+
+-- Erasing a customer renames them, their orders have to follow
+ALTER TABLE "orders" DROP CONSTRAINT IF EXISTS "orders_username_fkey";
+
+ALTER TABLE "orders" ADD FOREIGN KEY ("username") REFERENCES "users" ("username") ON UPDATE CASCADE;
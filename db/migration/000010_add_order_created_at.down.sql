@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS "users_created_at_id_idx";
+
+DROP INDEX IF EXISTS "orders_purchase_amount_order_id_idx";
+
+ALTER TABLE "orders" DROP COLUMN IF EXISTS "created_at";
@@ -0,0 +1,8 @@
+-- date_ordered is free text, orders are sorted by when they were recorded
+ALTER TABLE "orders" ADD COLUMN "created_at" timestamptz NOT NULL DEFAULT (now());
+
+CREATE INDEX ON "orders" ("created_at", "order_id");
+
+CREATE INDEX ON "orders" ("purchase_amount", "order_id");
+
+CREATE INDEX ON "users" ("created_at", "id");
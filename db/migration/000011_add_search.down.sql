@@ -0,0 +1,11 @@
+DROP INDEX IF EXISTS "orders_purchased_item_idx";
+
+DROP INDEX IF EXISTS "users_username_idx1";
+
+ALTER TABLE "orders" DROP COLUMN IF EXISTS "pii_tokens";
+
+ALTER TABLE "users" DROP COLUMN IF EXISTS "pii_tokens";
+
+ALTER TABLE "orders" DROP COLUMN IF EXISTS "search_vector";
+
+ALTER TABLE "users" DROP COLUMN IF EXISTS "search_vector";
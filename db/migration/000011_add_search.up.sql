@@ -0,0 +1,41 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- Only columns that are never encrypted go in the tsvectors, names and shipping locations are matched through pii_tokens
+ALTER TABLE "users" ADD COLUMN "search_vector" tsvector
+  GENERATED ALWAYS AS (to_tsvector('simple', "username")) STORED;
+
+ALTER TABLE "orders" ADD COLUMN "search_vector" tsvector
+  GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', "purchased_item"), 'A') ||
+    setweight(to_tsvector('simple', "username"), 'B')
+  ) STORED;
+
+ALTER TABLE "users" ADD COLUMN "pii_tokens" varchar[] NOT NULL DEFAULT '{}';
+
+ALTER TABLE "orders" ADD COLUMN "pii_tokens" varchar[] NOT NULL DEFAULT '{}';
+
+-- Plain text rows get their words as tokens, rotate-keys replaces them with HMACs once PII keys are set
+UPDATE "users" SET "pii_tokens" = ARRAY(
+  SELECT DISTINCT w FROM regexp_split_to_table(lower("full_name"), '[^[:alnum:]]+') AS w WHERE w <> ''
+) WHERE "full_name" NOT LIKE 'enc:%';
+
+UPDATE "orders" SET "pii_tokens" = ARRAY(
+  SELECT DISTINCT w FROM regexp_split_to_table(lower("full_name" || ' ' || "shipping_location"), '[^[:alnum:]]+') AS w WHERE w <> ''
+) WHERE "full_name" NOT LIKE 'enc:%' AND "shipping_location" NOT LIKE 'enc:%';
+
+CREATE INDEX ON "users" USING GIN ("search_vector");
+
+CREATE INDEX ON "orders" USING GIN ("search_vector");
+
+CREATE INDEX ON "users" USING GIN ("pii_tokens");
+
+CREATE INDEX ON "orders" USING GIN ("pii_tokens");
+
+-- Typo tolerant matching
+CREATE INDEX ON "users" USING GIN ("username" gin_trgm_ops);
+
+CREATE INDEX ON "orders" USING GIN ("purchased_item" gin_trgm_ops);
+
+COMMENT ON COLUMN "users"."pii_tokens" IS 'HMAC of every word of the full name, used by search';
+
+COMMENT ON COLUMN "orders"."pii_tokens" IS 'HMAC of every word of the full name and shipping location, used by search';
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS "orders_external_id_key";
+
+ALTER TABLE "orders" DROP COLUMN IF EXISTS "external_id";
+
+ALTER TABLE "orders" DROP COLUMN IF EXISTS "external_source";
@@ -0,0 +1,10 @@
+ALTER TABLE "orders" ADD COLUMN "external_source" varchar NOT NULL DEFAULT '';
+
+ALTER TABLE "orders" ADD COLUMN "external_id" varchar NOT NULL DEFAULT '';
+
+-- Imported orders are skipped when the same export is imported again
+CREATE UNIQUE INDEX "orders_external_id_key" ON "orders" ("external_source", "external_id") WHERE "external_id" <> '';
+
+COMMENT ON COLUMN "orders"."external_source" IS 'etsy or shopify for imported orders, empty for orders made here';
+
+COMMENT ON COLUMN "orders"."external_id" IS 'id of the order in the source, e.g. the Etsy order id';
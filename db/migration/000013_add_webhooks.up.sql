@@ -0,0 +1,37 @@
+CREATE TABLE "webhooks" (
+  "id" bigserial PRIMARY KEY,
+  "url" varchar NOT NULL,
+  "events" varchar[] NOT NULL,
+  "secret" varchar NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE TABLE "webhook_deliveries" (
+  "id" bigserial PRIMARY KEY,
+  "webhook_id" bigint NOT NULL REFERENCES "webhooks" ("id") ON DELETE CASCADE,
+  "event" varchar NOT NULL,
+  "payload" varchar NOT NULL,
+  "status" varchar NOT NULL DEFAULT 'pending',
+  "attempts" integer NOT NULL DEFAULT 0,
+  "next_attempt_at" timestamptz NOT NULL DEFAULT (now()),
+  "last_status_code" integer NOT NULL DEFAULT 0,
+  "last_error" varchar NOT NULL DEFAULT '',
+  "delivered_at" timestamptz,
+  "replay_of" bigint,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+-- The dispatcher only looks for pending deliveries that are due
+CREATE INDEX "webhook_deliveries_due_idx" ON "webhook_deliveries" ("next_attempt_at") WHERE "status" = 'pending';
+
+CREATE INDEX ON "webhook_deliveries" ("webhook_id", "id");
+
+COMMENT ON COLUMN "webhooks"."events" IS 'e.g. order.created, user.deleted';
+
+COMMENT ON COLUMN "webhooks"."secret" IS 'signs every delivery, encrypted like PII';
+
+COMMENT ON COLUMN "webhook_deliveries"."payload" IS 'JSON body sent to the webhook, encrypted like PII';
+
+COMMENT ON COLUMN "webhook_deliveries"."status" IS 'pending, succeeded or failed (no attempts left)';
+
+COMMENT ON COLUMN "webhook_deliveries"."replay_of" IS 'delivery this one was replayed from';
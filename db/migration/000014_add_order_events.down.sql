@@ -0,0 +1,5 @@
+DROP TRIGGER IF EXISTS "order_events_notify" ON "order_events";
+
+DROP FUNCTION IF EXISTS notify_order_events;
+
+DROP TABLE IF EXISTS order_events;
@@ -0,0 +1,25 @@
+CREATE TABLE "order_events" (
+  "id" bigserial PRIMARY KEY,
+  "event" varchar NOT NULL,
+  "order_id" bigint NOT NULL,
+  "payload" varchar NOT NULL,
+  "created_at" timestamptz NOT NULL DEFAULT (now())
+);
+
+CREATE INDEX ON "order_events" ("created_at");
+
+-- Wakes up every API instance listening on order_events, they read the new rows themselves
+-- Per statement and without a payload, so a batch of orders sends one notification
+CREATE FUNCTION notify_order_events() RETURNS trigger AS $$
+BEGIN
+  PERFORM pg_notify('order_events', '');
+  RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER "order_events_notify" AFTER INSERT ON "order_events"
+FOR EACH STATEMENT EXECUTE FUNCTION notify_order_events();
+
+COMMENT ON COLUMN "order_events"."event" IS 'order.created, order.updated or order.deleted';
+
+COMMENT ON COLUMN "order_events"."payload" IS 'the order as JSON, encrypted like PII';
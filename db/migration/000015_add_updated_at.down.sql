@@ -0,0 +1,6 @@
+DROP TRIGGER IF EXISTS "orders_updated_at" ON "orders";
+DROP TRIGGER IF EXISTS "users_updated_at" ON "users";
+DROP FUNCTION IF EXISTS touch_updated_at();
+
+ALTER TABLE "orders" DROP COLUMN IF EXISTS "updated_at";
+ALTER TABLE "users" DROP COLUMN IF EXISTS "updated_at";
@@ -0,0 +1,27 @@
+ALTER TABLE "users" ADD COLUMN "updated_at" timestamptz NOT NULL DEFAULT (now());
+ALTER TABLE "orders" ADD COLUMN "updated_at" timestamptz NOT NULL DEFAULT (now());
+
+-- Rows don't know when they last changed, their creation is the best guess
+UPDATE "users" SET "updated_at" = "created_at";
+UPDATE "orders" SET "updated_at" = "created_at";
+
+-- Moves with the version, so Last-Modified and the ETag change together
+-- Updates that keep the version, like re-encrypting with a new key, keep it too
+CREATE FUNCTION touch_updated_at() RETURNS trigger AS $$
+BEGIN
+  IF NEW.version <> OLD.version THEN
+    NEW.updated_at = now();
+  END IF;
+  RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER "users_updated_at" BEFORE UPDATE ON "users"
+FOR EACH ROW EXECUTE FUNCTION touch_updated_at();
+
+CREATE TRIGGER "orders_updated_at" BEFORE UPDATE ON "orders"
+FOR EACH ROW EXECUTE FUNCTION touch_updated_at();
+
+COMMENT ON COLUMN "users"."updated_at" IS 'when the version last went up, sent as Last-Modified';
+
+COMMENT ON COLUMN "orders"."updated_at" IS 'when the version last went up, sent as Last-Modified';
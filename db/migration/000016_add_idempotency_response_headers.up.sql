@@ -0,0 +1,3 @@
+ALTER TABLE "idempotency_keys" ADD COLUMN "response_headers" jsonb NOT NULL DEFAULT '{}';
+
+COMMENT ON COLUMN "idempotency_keys"."response_headers" IS 'headers sent back with a replayed response, like Content-Type and ETag';
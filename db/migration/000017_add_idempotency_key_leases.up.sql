@@ -0,0 +1,4 @@
+-- Keys claimed before leases existed are free to take over right away
+ALTER TABLE "idempotency_keys" ADD COLUMN "locked_until" timestamptz NOT NULL DEFAULT (now());
+
+COMMENT ON COLUMN "idempotency_keys"."locked_until" IS 'while response_status is 0, a retry of the same request takes the key over after this';
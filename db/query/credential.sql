@@ -0,0 +1,15 @@
+-- name: CreateCredential :one
+INSERT INTO credentials (
+  user_id,
+  hashed_password
+) VALUES (
+  $1, $2
+) RETURNING *;
+
+-- name: GetCredential :one
+SELECT * FROM credentials
+WHERE user_id = $1 LIMIT 1;
+
+-- name: DeleteCredential :exec
+DELETE FROM credentials
+WHERE user_id = $1;
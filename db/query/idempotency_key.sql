@@ -0,0 +1,54 @@
+-- name: CreateIdempotencyKey :one
+INSERT INTO idempotency_keys (
+  owner,
+  key,
+  request_hash,
+  expires_at,
+  locked_until
+) VALUES (
+  $1, $2, $3, $4, $5
+) ON CONFLICT (owner, key) DO NOTHING
+RETURNING *;
+
+-- name: TakeOverIdempotencyKey :one
+UPDATE idempotency_keys
+SET locked_until = sqlc.arg(locked_until)
+WHERE owner = sqlc.arg(owner) AND key = sqlc.arg(key)
+AND request_hash = sqlc.arg(request_hash)
+AND response_status = 0 AND locked_until < now()
+RETURNING *;
+
+-- name: GetIdempotencyKey :one
+SELECT * FROM idempotency_keys
+WHERE owner = $1 AND key = $2 LIMIT 1;
+
+-- name: CompleteIdempotencyKey :exec
+UPDATE idempotency_keys
+SET response_status = $3,
+response_body = $4,
+response_headers = $5
+WHERE owner = $1 AND key = $2;
+
+-- name: DeleteIdempotencyKey :exec
+DELETE FROM idempotency_keys
+WHERE owner = $1 AND key = $2;
+
+-- name: ListIdempotencyKeysAfter :many
+SELECT * FROM idempotency_keys
+WHERE (owner, key) > (sqlc.arg(owner)::varchar, sqlc.arg(key)::varchar)
+ORDER BY owner, key
+LIMIT sqlc.arg(max_rows);
+
+-- name: UpdateIdempotencyKeyBody :exec
+UPDATE idempotency_keys
+SET response_body = $3
+WHERE owner = $1 AND key = $2;
+
+-- name: RenameIdempotencyKeyOwner :exec
+UPDATE idempotency_keys
+SET owner = sqlc.arg(new_owner)
+WHERE owner = sqlc.arg(old_owner);
+
+-- name: DeleteExpiredIdempotencyKeys :execrows
+DELETE FROM idempotency_keys
+WHERE expires_at < $1;
@@ -3,13 +3,16 @@ INSERT INTO orders (
   account_id,
   username,
   full_name,
+  full_name_bidx,
   purchase_amount,
   purchased_item,
   shipping_location,
+  shipping_location_bidx,
+  pii_tokens,
   currency,
   date_ordered
 ) VALUES (
-  $1, $2, $3, $4, $5, $6, $7, $8
+  $1, $2, $3, $4, $5, $6, $7, $8, coalesce(sqlc.narg(pii_tokens)::varchar[], '{}'), $9, $10
 ) RETURNING *;
 
 -- name: GetOrderById :one
@@ -26,18 +29,99 @@ ORDER BY order_id
 LIMIT $1
 OFFSET $2;
 
--- name: UpdateOrder :one
+-- name: GetOrderForUpdate :one
+SELECT * FROM orders
+WHERE order_id = $1 LIMIT 1
+FOR UPDATE;
+
+-- name: PatchOrder :one
+-- NULL params keep the column, the version is only checked when versions are given
 UPDATE orders
-SET purchase_amount = $2,
-purchased_item = $3,
-shipping_location = $4
-WHERE order_id = $1
+SET purchase_amount = coalesce(sqlc.narg(purchase_amount), purchase_amount),
+purchased_item = coalesce(sqlc.narg(purchased_item), purchased_item),
+currency = coalesce(sqlc.narg(currency), currency),
+date_ordered = coalesce(sqlc.narg(date_ordered), date_ordered),
+full_name = coalesce(sqlc.narg(full_name), full_name),
+full_name_bidx = coalesce(sqlc.narg(full_name_bidx), full_name_bidx),
+shipping_location = coalesce(sqlc.narg(shipping_location), shipping_location),
+shipping_location_bidx = coalesce(sqlc.narg(shipping_location_bidx), shipping_location_bidx),
+pii_tokens = coalesce(sqlc.narg(pii_tokens)::varchar[], pii_tokens),
+version = version + 1
+WHERE order_id = sqlc.arg(order_id) AND (sqlc.narg(versions)::bigint[] IS NULL OR version = ANY(sqlc.narg(versions)::bigint[]))
 RETURNING *;
 
 -- name: DeleteOrder :exec
 DELETE FROM orders
 WHERE order_id = $1;
 
--- name: DeleteAllOrderFromUser :exec
+-- name: DeleteAllOrderFromUser :many
 DELETE FROM orders
-WHERE username = $1;
\ No newline at end of file
+WHERE username = $1
+RETURNING *;
+
+-- name: ListOrdersByShippingLocation :many
+SELECT * FROM orders
+WHERE shipping_location_bidx = $1
+ORDER BY order_id
+LIMIT $2
+OFFSET $3;
+
+-- name: ListOrdersAfterId :many
+SELECT * FROM orders
+WHERE order_id > $1
+ORDER BY order_id
+LIMIT $2;
+
+-- name: UpdateOrderPII :exec
+UPDATE orders
+SET full_name = $2,
+full_name_bidx = $3,
+shipping_location = $4,
+shipping_location_bidx = $5,
+pii_tokens = coalesce(sqlc.narg(pii_tokens)::varchar[], '{}')
+WHERE order_id = $1;
+
+-- name: EraseOrdersOfUser :execrows
+UPDATE orders
+SET full_name = $2,
+full_name_bidx = $3,
+shipping_location = $4,
+shipping_location_bidx = $5,
+pii_tokens = '{}',
+version = version + 1
+WHERE account_id = $1;
+
+-- name: ListFirstOrdersByUsernames :many
+SELECT * FROM orders
+WHERE order_id IN (
+  SELECT numbered.order_id FROM (
+    SELECT o.order_id, row_number() OVER (PARTITION BY o.username ORDER BY o.order_id) AS user_row
+    FROM orders o
+    WHERE o.username = ANY(sqlc.arg(usernames)::varchar[])
+  ) AS numbered
+  WHERE numbered.user_row <= sqlc.arg(max_per_user)::int
+)
+ORDER BY order_id;
+
+-- name: ImportOrder :one
+INSERT INTO orders (
+  account_id,
+  username,
+  full_name,
+  full_name_bidx,
+  purchase_amount,
+  purchased_item,
+  shipping_location,
+  shipping_location_bidx,
+  pii_tokens,
+  currency,
+  date_ordered,
+  external_source,
+  external_id
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7, $8, coalesce(sqlc.narg(pii_tokens)::varchar[], '{}'), $9, $10, $11, $12
+) RETURNING *;
+
+-- name: ListImportedOrderIds :many
+SELECT external_id FROM orders
+WHERE external_source = $1 AND external_id = ANY(sqlc.arg(external_ids)::varchar[]);
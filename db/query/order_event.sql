@@ -0,0 +1,27 @@
+-- name: CreateOrderEvent :exec
+INSERT INTO order_events (
+  event,
+  order_id,
+  payload
+) VALUES (
+  $1, $2, $3
+);
+
+-- name: ListOrderEventsAfter :many
+SELECT * FROM order_events
+WHERE id > $1
+ORDER BY id
+LIMIT $2;
+
+-- name: UpdateOrderEventPayload :exec
+UPDATE order_events
+SET payload = $2
+WHERE id = $1;
+
+-- name: GetOrderEventBounds :one
+SELECT coalesce(min(id), 0)::bigint AS oldest_id, coalesce(max(id), 0)::bigint AS latest_id
+FROM order_events;
+
+-- name: DeleteOrderEventsBefore :execrows
+DELETE FROM order_events
+WHERE created_at < $1;
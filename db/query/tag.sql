@@ -0,0 +1,77 @@
+-- name: UpsertTag :one
+INSERT INTO tags (
+  name
+) VALUES (
+  $1
+) ON CONFLICT (name) DO UPDATE
+SET name = EXCLUDED.name
+RETURNING *;
+
+-- name: GetTagByName :one
+SELECT * FROM tags
+WHERE name = $1 LIMIT 1;
+
+-- name: AddUserTag :exec
+INSERT INTO user_tags (
+  user_id,
+  tag_id
+) VALUES (
+  $1, $2
+) ON CONFLICT DO NOTHING;
+
+-- name: RemoveUserTag :exec
+DELETE FROM user_tags
+WHERE user_id = $1 AND tag_id = $2;
+
+-- name: ListTagsOfUser :many
+SELECT tags.* FROM tags
+JOIN user_tags ON user_tags.tag_id = tags.id
+WHERE user_tags.user_id = $1
+ORDER BY tags.name;
+
+-- name: AddOrderTag :exec
+INSERT INTO order_tags (
+  order_id,
+  tag_id
+) VALUES (
+  $1, $2
+) ON CONFLICT DO NOTHING;
+
+-- name: RemoveOrderTag :exec
+DELETE FROM order_tags
+WHERE order_id = $1 AND tag_id = $2;
+
+-- name: ListTagsOfOrder :many
+SELECT tags.* FROM tags
+JOIN order_tags ON order_tags.tag_id = tags.id
+WHERE order_tags.order_id = $1
+ORDER BY tags.name;
+
+-- name: ListUsersByTag :many
+SELECT users.* FROM users
+JOIN user_tags ON user_tags.user_id = users.id
+JOIN tags ON tags.id = user_tags.tag_id
+WHERE tags.name = $1
+ORDER BY users.id
+LIMIT $2
+OFFSET $3;
+
+-- name: ListAllOrdersByTag :many
+SELECT orders.* FROM orders
+JOIN order_tags ON order_tags.order_id = orders.order_id
+JOIN tags ON tags.id = order_tags.tag_id
+WHERE tags.name = $1
+ORDER BY orders.order_id
+LIMIT $2
+OFFSET $3;
+
+-- name: ListOrdersByUsernameAndTag :many
+SELECT orders.* FROM orders
+JOIN order_tags ON order_tags.order_id = orders.order_id
+JOIN tags ON tags.id = order_tags.tag_id
+WHERE orders.username = $1 AND tags.name = $2
+ORDER BY orders.order_id;
+
+-- name: RemoveAllUserTags :exec
+DELETE FROM user_tags
+WHERE user_id = $1;
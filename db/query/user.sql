@@ -1,10 +1,12 @@
 -- name: CreateUser :one
 INSERT INTO users (
   full_name,
+  full_name_bidx,
+  pii_tokens,
   username,
   total_orders
 ) VALUES (
-  $1, $2, $3
+  $1, $2, coalesce(sqlc.narg(pii_tokens)::varchar[], '{}'), $3, $4
 ) RETURNING *;
 
 -- name: GetUserById :one
@@ -21,12 +23,67 @@ ORDER BY id
 LIMIT $1
 OFFSET $2;
 
+-- name: GetUserForUpdate :one
+SELECT * FROM users
+WHERE id = $1 LIMIT 1
+FOR UPDATE;
+
 -- name: UpdateUser :one
 UPDATE users
-SET total_orders = $2
+SET total_orders = $2,
+version = version + 1
+WHERE id = $1
+RETURNING *;
+
+-- name: AddUserOrders :one
+UPDATE users
+SET total_orders = total_orders + sqlc.arg(count)::bigint,
+version = version + 1
 WHERE id = $1
-RETURNING *;;
+RETURNING *;
 
 -- name: DeleteUser :exec
 DELETE FROM users
-WHERE username = $1;
\ No newline at end of file
+WHERE username = $1;
+
+-- name: UpdateUserRole :one
+UPDATE users
+SET role = $2,
+version = version + 1
+WHERE username = $1
+RETURNING *;
+
+-- name: ListUsersByFullName :many
+SELECT * FROM users
+WHERE full_name_bidx = $1
+ORDER BY id
+LIMIT $2
+OFFSET $3;
+
+-- name: ListUsersAfterId :many
+SELECT * FROM users
+WHERE id > $1
+ORDER BY id
+LIMIT $2;
+
+-- name: UpdateUserPII :exec
+UPDATE users
+SET full_name = $2,
+full_name_bidx = $3,
+pii_tokens = coalesce(sqlc.narg(pii_tokens)::varchar[], '{}')
+WHERE id = $1;
+
+-- name: EraseUser :one
+UPDATE users
+SET username = $2,
+full_name = $3,
+full_name_bidx = $4,
+pii_tokens = '{}',
+erased_at = now(),
+version = version + 1
+WHERE id = $1
+RETURNING *;
+
+-- name: ListUsersByUsernames :many
+SELECT * FROM users
+WHERE username = ANY(sqlc.arg(usernames)::varchar[]);
@@ -0,0 +1,89 @@
+-- name: CreateWebhook :one
+INSERT INTO webhooks (
+  url,
+  events,
+  secret
+) VALUES (
+  $1, $2, $3
+) RETURNING *;
+
+-- name: GetWebhook :one
+SELECT * FROM webhooks
+WHERE id = $1 LIMIT 1;
+
+-- name: ListWebhooks :many
+SELECT * FROM webhooks
+ORDER BY id;
+
+-- name: ListWebhooksForEvent :many
+SELECT * FROM webhooks
+WHERE sqlc.arg(event)::varchar = ANY(events)
+ORDER BY id;
+
+-- name: UpdateWebhookSecret :exec
+UPDATE webhooks
+SET secret = $2
+WHERE id = $1;
+
+-- name: DeleteWebhook :one
+DELETE FROM webhooks
+WHERE id = $1
+RETURNING *;
+
+-- name: CreateWebhookDelivery :one
+INSERT INTO webhook_deliveries (
+  webhook_id,
+  event,
+  payload,
+  replay_of
+) VALUES (
+  $1, $2, $3, $4
+) RETURNING *;
+
+-- name: GetWebhookDelivery :one
+SELECT * FROM webhook_deliveries
+WHERE id = $1 AND webhook_id = $2 LIMIT 1;
+
+-- name: ListWebhookDeliveries :many
+SELECT * FROM webhook_deliveries
+WHERE webhook_id = sqlc.arg(webhook_id)
+AND (sqlc.narg(status)::varchar IS NULL OR status = sqlc.narg(status))
+AND (sqlc.narg(before_id)::bigint IS NULL OR id < sqlc.narg(before_id))
+ORDER BY id DESC
+LIMIT sqlc.arg(max_rows);
+
+-- Due deliveries are pushed back until lease_until so no other dispatcher sends them in the meantime,
+-- if the dispatcher dies before recording the attempt they're sent again after the lease
+-- name: ClaimWebhookDeliveries :many
+UPDATE webhook_deliveries
+SET next_attempt_at = sqlc.arg(lease_until)
+WHERE id IN (
+  SELECT id FROM webhook_deliveries
+  WHERE status = 'pending' AND next_attempt_at <= now()
+  ORDER BY next_attempt_at
+  LIMIT sqlc.arg(max_rows)
+  FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: RecordWebhookAttempt :one
+UPDATE webhook_deliveries
+SET attempts = attempts + 1,
+status = sqlc.arg(status),
+next_attempt_at = sqlc.arg(next_attempt_at),
+last_status_code = sqlc.arg(last_status_code),
+last_error = sqlc.arg(last_error),
+delivered_at = sqlc.narg(delivered_at)
+WHERE id = sqlc.arg(id)
+RETURNING *;
+
+-- name: ListWebhookDeliveriesAfterId :many
+SELECT * FROM webhook_deliveries
+WHERE id > $1
+ORDER BY id
+LIMIT $2;
+
+-- name: UpdateWebhookDeliveryPayload :exec
+UPDATE webhook_deliveries
+SET payload = $2
+WHERE id = $1;
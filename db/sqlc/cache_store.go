@@ -0,0 +1,97 @@
+// Hot lookups (users by id or username, orders by id) are kept in an in-process cache, decrypted
+// The Store write paths forget the rows they change once their transaction commits
+// Other API instances keep what they cached until it expires, so they can be up to the TTL behind
+
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/samanthatb1/beadBashStorage/cache"
+)
+
+// Caches lookups in c, nil turns caching off
+func (store *Store) SetCache(c *cache.Cache) {
+	store.cache = c
+}
+
+func userIdKey(id int64) string {
+	return fmt.Sprintf("user:id:%d", id)
+}
+
+func usernameKey(username string) string {
+	return "user:username:" + username
+}
+
+func orderKey(orderID int64) string {
+	return fmt.Sprintf("order:%d", orderID)
+}
+
+/********* Lookups *********/
+
+func (store *Store) GetUserById(ctx context.Context, id int64) (User, error) {
+	if cached, ok := store.cache.Get(userIdKey(id)); ok {
+		return cached.(User), nil
+	}
+	generation := store.cache.Generation()
+	user, err := store.Queries.GetUserById(ctx, id)
+	if err != nil {return user, err}
+	return store.cacheUser(generation, user)
+}
+
+func (store *Store) GetUserByUsername(ctx context.Context, username string) (User, error) {
+	if cached, ok := store.cache.Get(usernameKey(username)); ok {
+		return cached.(User), nil
+	}
+	generation := store.cache.Generation()
+	user, err := store.Queries.GetUserByUsername(ctx, username)
+	if err != nil {return user, err}
+	return store.cacheUser(generation, user)
+}
+
+// Decrypts the user and caches it under its id and its username
+func (store *Store) cacheUser(generation uint64, user User) (User, error) {
+	user, err := store.decryptUser(user)
+	if err != nil {return user, err}
+	store.cache.Set(generation, user, userIdKey(user.ID), usernameKey(user.Username))
+	return user, nil
+}
+
+func (store *Store) GetOrderById(ctx context.Context, orderID int64) (Order, error) {
+	if cached, ok := store.cache.Get(orderKey(orderID)); ok {
+		return cached.(Order), nil
+	}
+	generation := store.cache.Generation()
+	order, err := store.Queries.GetOrderById(ctx, orderID)
+	if err != nil {return order, err}
+	order, err = store.decryptOrder(order)
+	if err != nil {return order, err}
+	store.cache.Set(generation, order, orderKey(order.OrderID))
+	return order, nil
+}
+
+/********* Invalidation *********/
+
+// Forgets the users under their id and username, the usernames they had before a change must be passed too
+func (store *Store) forgetUsers(users ...User) {
+	if len(users) == 0 {
+		return
+	}
+	keys := make([]string, 0, 2*len(users))
+	for _, user := range users {
+		keys = append(keys, userIdKey(user.ID), usernameKey(user.Username))
+	}
+	store.cache.Delete(keys...)
+}
+
+func (store *Store) forgetOrders(orders ...Order) {
+	if len(orders) == 0 {
+		return
+	}
+	keys := make([]string, len(orders))
+	for i, order := range orders {
+		keys[i] = orderKey(order.OrderID)
+	}
+	store.cache.Delete(keys...)
+}
@@ -0,0 +1,61 @@
+// Code generated by sqlc. DO NOT EDIT.
+// source: credential.sql
+
+package db
+
+import (
+	"context"
+)
+
+const createCredential = `-- name: CreateCredential :one
+INSERT INTO credentials (
+  user_id,
+  hashed_password
+) VALUES (
+  $1, $2
+) RETURNING user_id, hashed_password, password_changed_at, created_at
+`
+
+type CreateCredentialParams struct {
+	UserID         int64  `json:"user_id"`
+	HashedPassword string `json:"hashed_password"`
+}
+
+func (q *Queries) CreateCredential(ctx context.Context, arg CreateCredentialParams) (Credential, error) {
+	row := q.db.QueryRowContext(ctx, createCredential, arg.UserID, arg.HashedPassword)
+	var i Credential
+	err := row.Scan(
+		&i.UserID,
+		&i.HashedPassword,
+		&i.PasswordChangedAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const deleteCredential = `-- name: DeleteCredential :exec
+DELETE FROM credentials
+WHERE user_id = $1
+`
+
+func (q *Queries) DeleteCredential(ctx context.Context, userID int64) error {
+	_, err := q.db.ExecContext(ctx, deleteCredential, userID)
+	return err
+}
+
+const getCredential = `-- name: GetCredential :one
+SELECT user_id, hashed_password, password_changed_at, created_at FROM credentials
+WHERE user_id = $1 LIMIT 1
+`
+
+func (q *Queries) GetCredential(ctx context.Context, userID int64) (Credential, error) {
+	row := q.db.QueryRowContext(ctx, getCredential, userID)
+	var i Credential
+	err := row.Scan(
+		&i.UserID,
+		&i.HashedPassword,
+		&i.PasswordChangedAt,
+		&i.CreatedAt,
+	)
+	return i, err
+}
@@ -0,0 +1,161 @@
+// Erasing a customer also has to reach the copies of their PII that other tables keep as JSON
+// The copies are redacted rather than deleted, so retries are still recognized and the logs keep their shape
+
+package db
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strconv"
+)
+
+// Rows read per query while looking for copies of the customer
+const erasureBatchSize = 500
+
+// Fields holding PII in the JSON of users and orders
+var erasedFields = []string{"full_name", "shipping_location"}
+
+// Who is being erased
+type erasure struct {
+	userID         int64
+	username       string // Before the erasure
+	erasedUsername string
+}
+
+// How the api package tells a logged in user apart in idempotency keys and rate limits
+func UserIdentity(username string) string {
+	return "user:" + username
+}
+
+/********* Redaction *********/
+
+// Redacts the customer in a JSON document, changed is false if nothing in it was theirs
+func (e erasure) redactJSON(doc []byte) (redacted []byte, changed bool, err error) {
+	decoder := json.NewDecoder(bytes.NewReader(doc))
+	decoder.UseNumber() // Keeps ids and amounts as they were
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {return nil, false, err}
+	if !e.redact(value) {return doc, false, nil}
+	redacted, err = json.Marshal(value)
+	return redacted, true, err
+}
+
+// Objects with the customer's username or account id are theirs: their user, their orders, and the same nested in anything else
+func (e erasure) redact(value interface{}) bool {
+	changed := false
+	switch value := value.(type) {
+	case map[string]interface{}:
+		if e.owns(value) {
+			for _, field := range erasedFields {
+				if _, ok := value[field]; ok {
+					value[field] = ErasedValue
+				}
+			}
+			if _, ok := value["username"]; ok {
+				value["username"] = e.erasedUsername
+			}
+			changed = true
+		}
+		for _, nested := range value {
+			changed = e.redact(nested) || changed
+		}
+	case []interface{}:
+		for _, item := range value {
+			changed = e.redact(item) || changed
+		}
+	}
+	return changed
+}
+
+func (e erasure) owns(object map[string]interface{}) bool {
+	if username, ok := object["username"].(string); ok && username == e.username {
+		return true
+	}
+	accountID, ok := object["account_id"].(json.Number)
+	return ok && accountID.String() == strconv.FormatInt(e.userID, 10)
+}
+
+/********* Copies *********/
+
+// Redacts the customer in stored idempotent responses, whoever sent the request, and renames the keys they sent themselves
+func (store *Store) eraseIdempotencyKeys(ctx context.Context, q *Queries, e erasure) error {
+	err := q.RenameIdempotencyKeyOwner(ctx, RenameIdempotencyKeyOwnerParams{
+		OldOwner: UserIdentity(e.username),
+		NewOwner: UserIdentity(e.erasedUsername),
+	})
+	if err != nil {return err}
+
+	after := ListIdempotencyKeysAfterParams{MaxRows: erasureBatchSize}
+	for {
+		records, err := q.ListIdempotencyKeysAfter(ctx, after)
+		if err != nil {return err}
+
+		for _, record := range records {
+			if record.ResponseStatus == 0 {continue} // Still running, nothing stored yet
+			body, err := store.decryptResponseBody(record.ResponseBody)
+			if err != nil {return err}
+			redacted, changed, err := e.redactJSON(body)
+			if err != nil {return err}
+			if !changed {continue}
+
+			if redacted, err = store.encryptResponseBody(redacted); err != nil {return err}
+			err = q.UpdateIdempotencyKeyBody(ctx, UpdateIdempotencyKeyBodyParams{Owner: record.Owner, Key: record.Key, ResponseBody: redacted})
+			if err != nil {return err}
+		}
+
+		if len(records) < erasureBatchSize {return nil}
+		last := records[len(records)-1]
+		after.Owner, after.Key = last.Owner, last.Key
+	}
+}
+
+// Redacts the customer in webhook payloads, so replaying a delivery can't send their PII again
+func (store *Store) eraseWebhookDeliveries(ctx context.Context, q *Queries, e erasure) error {
+	var lastID int64
+	for {
+		deliveries, err := q.ListWebhookDeliveriesAfterId(ctx, ListWebhookDeliveriesAfterIdParams{ID: lastID, Limit: erasureBatchSize})
+		if err != nil {return err}
+
+		for _, delivery := range deliveries {
+			lastID = delivery.ID
+			payload, changed, err := store.redactPayload(e, delivery.Payload)
+			if err != nil {return err}
+			if !changed {continue}
+			err = q.UpdateWebhookDeliveryPayload(ctx, UpdateWebhookDeliveryPayloadParams{ID: delivery.ID, Payload: payload})
+			if err != nil {return err}
+		}
+
+		if len(deliveries) < erasureBatchSize {return nil}
+	}
+}
+
+// Redacts the customer's orders in the live feed, clients resuming from an old event get them erased
+func (store *Store) eraseOrderEvents(ctx context.Context, q *Queries, e erasure) error {
+	var lastID int64
+	for {
+		events, err := q.ListOrderEventsAfter(ctx, ListOrderEventsAfterParams{ID: lastID, Limit: erasureBatchSize})
+		if err != nil {return err}
+
+		for _, event := range events {
+			lastID = event.ID
+			payload, changed, err := store.redactPayload(e, event.Payload)
+			if err != nil {return err}
+			if !changed {continue}
+			err = q.UpdateOrderEventPayload(ctx, UpdateOrderEventPayloadParams{ID: event.ID, Payload: payload})
+			if err != nil {return err}
+		}
+
+		if len(events) < erasureBatchSize {return nil}
+	}
+}
+
+// Redacts an encrypted JSON payload, changed is false if nothing in it was the customer's
+func (store *Store) redactPayload(e erasure, payload string) (redacted string, changed bool, err error) {
+	plain, err := store.cipher.Decrypt(payload)
+	if err != nil {return "", false, err}
+	doc, changed, err := e.redactJSON([]byte(plain))
+	if err != nil || !changed {return payload, false, err}
+	redacted, err = store.cipher.Encrypt(string(doc))
+	return redacted, true, err
+}
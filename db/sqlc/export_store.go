@@ -0,0 +1,73 @@
+// Streams every user or order matching a filter, for exports
+// Rows come from a server side cursor in batches, so large tables never sit in memory
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Rows fetched from the cursor at a time
+const streamBatchSize = 500
+
+// Runs the query through a cursor and calls fn with each batch of rows
+// The transaction is read only and REPEATABLE READ, so the export is a snapshot even if rows change while it's sent
+// Returns the first error of fn, fn may be slow (e.g. writing to the client), the transaction stays open until it's done
+func (store *Store) streamQuery(ctx context.Context, query string, args []interface{}, fn func(rows *sql.Rows) error) error {
+	tx, err := store.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {return err}
+	defer tx.Rollback() // Read only, nothing to commit
+
+	if _, err := tx.ExecContext(ctx, "DECLARE export_cursor NO SCROLL CURSOR FOR "+query, args...); err != nil {
+		return err
+	}
+	fetch := fmt.Sprintf("FETCH FORWARD %d FROM export_cursor", streamBatchSize)
+	for {
+		rows, err := tx.QueryContext(ctx, fetch)
+		if err != nil {return err}
+
+		fetched := 0
+		for rows.Next() {
+			fetched++
+			if err := fn(rows); err != nil {
+				rows.Close()
+				return err
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {return err}
+
+		// A short batch is the last one
+		if fetched < streamBatchSize {
+			return nil
+		}
+	}
+}
+
+// Calls fn with every user matching the filter in id order, decrypted
+func (store *Store) StreamUsers(ctx context.Context, filter UserFilter, fn func(User) error) error {
+	query := &listQuery{}
+	filter.apply(query)
+
+	return store.streamQuery(ctx, "SELECT "+userColumns+" FROM users"+query.whereClause()+" ORDER BY id", query.args, func(rows *sql.Rows) error {
+		user, err := scanUser(rows)
+		if err != nil {return err}
+		if user, err = store.decryptUser(user); err != nil {return err}
+		return fn(user)
+	})
+}
+
+// Calls fn with every order matching the filter in id order, decrypted
+func (store *Store) StreamOrders(ctx context.Context, filter OrderFilter, fn func(Order) error) error {
+	query := &listQuery{}
+	store.applyOrderFilter(filter, query)
+
+	return store.streamQuery(ctx, "SELECT "+orderColumns+" FROM orders"+query.whereClause()+" ORDER BY order_id", query.args, func(rows *sql.Rows) error {
+		order, err := scanOrder(rows)
+		if err != nil {return err}
+		if order, err = store.decryptOrder(order); err != nil {return err}
+		return fn(order)
+	})
+}
@@ -0,0 +1,127 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/samanthatb1/beadBashStorage/db/dberr"
+)
+
+/********* Import *********/
+
+// An order from another shop's export, ExternalID is its id there
+type ImportedOrder struct {
+	NewOrderTxParams
+	ExternalID string `json:"external_id"`
+}
+
+type ImportOrdersTxParams struct {
+	Source string // e.g. etsy, saved as the orders' external_source
+	Orders []ImportedOrder
+	DryRun bool // Only report what would be imported, nothing is written
+}
+
+type ImportOrdersTxResult struct {
+	Imported   int      `json:"imported"`   // Orders created, or that would be on a dry run
+	Duplicates []string `json:"duplicates"` // External ids that were imported before, skipped
+	NewUsers   []string `json:"new_users"`  // Usernames created for the orders
+}
+
+// Imports one batch of orders in one transaction, orders whose external id is already stored are skipped
+// Missing users are created the way NewOrderTx does and every user's total_orders goes up once per batch
+func (store *Store) ImportOrdersTx(ctx context.Context, args ImportOrdersTxParams) (ImportOrdersTxResult, error){
+	result := ImportOrdersTxResult{Duplicates: []string{}, NewUsers: []string{}}
+	var editedUsers []User // Their total_orders went up
+
+	ids := make([]string, len(args.Orders))
+	for i, order := range args.Orders {
+		ids[i] = order.ExternalID
+	}
+
+	err := store.execTx(ctx, func(q *Queries) error{
+		imported, err := q.ListImportedOrderIds(ctx, ListImportedOrderIdsParams{ExternalSource: args.Source, ExternalIds: ids})
+		if err != nil { return err }
+		seen := map[string]bool{}
+		for _, id := range imported {
+			seen[id] = true
+		}
+
+		// Orders that aren't stored yet, an id showing up twice is only imported once
+		fresh := []ImportedOrder{}
+		for _, order := range args.Orders {
+			if seen[order.ExternalID] {
+				result.Duplicates = append(result.Duplicates, order.ExternalID)
+				continue
+			}
+			seen[order.ExternalID] = true
+			fresh = append(fresh, order)
+		}
+		result.Imported = len(fresh)
+		if len(fresh) == 0 { return nil }
+
+		// Users the import would create
+		params := make([]NewOrderTxParams, len(fresh))
+		usernames := []string{}
+		for i, order := range fresh {
+			params[i] = order.NewOrderTxParams
+			usernames = append(usernames, order.Username)
+		}
+		existing, err := q.ListUsersByUsernames(ctx, usernames)
+		if err != nil { return err }
+		exists := map[string]bool{}
+		for _, user := range existing {
+			exists[user.Username] = true
+		}
+		for _, order := range fresh {
+			if !exists[order.Username] {
+				exists[order.Username] = true
+				result.NewUsers = append(result.NewUsers, order.Username)
+			}
+		}
+		sort.Strings(result.NewUsers)
+		if args.DryRun { return nil }
+
+		users, edited, err := store.addBatchUsers(ctx, q, params)
+		editedUsers = edited
+		if err != nil {
+			if orderErr, ok := err.(*BatchOrderError); ok {
+				return fmt.Errorf("order %s: %w", fresh[orderErr.Index].ExternalID, orderErr.Err)
+			}
+			return err
+		}
+		for _, order := range fresh {
+			if err := store.importOrderOf(ctx, q, users[order.Username], args.Source, order); err != nil {
+				return fmt.Errorf("order %s: %w", order.ExternalID, dberr.Translate(err))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return ImportOrdersTxResult{}, err
+	}
+	store.forgetUsers(editedUsers...)
+	return result, nil
+}
+
+// Creates the imported order for an existing user, like createOrderOf
+func (store *Store) importOrderOf(ctx context.Context, q *Queries, user User, source string, order ImportedOrder) error {
+	params, err := store.encryptOrderParams(orderParamsOf(user, order.NewOrderTxParams))
+	if err != nil { return err }
+	_, err = q.ImportOrder(ctx, ImportOrderParams{
+		AccountID: params.AccountID,
+		Username: params.Username,
+		FullName: params.FullName,
+		FullNameBidx: params.FullNameBidx,
+		PurchaseAmount: params.PurchaseAmount,
+		PurchasedItem: params.PurchasedItem,
+		ShippingLocation: params.ShippingLocation,
+		ShippingLocationBidx: params.ShippingLocationBidx,
+		Currency: params.Currency,
+		DateOrdered: params.DateOrdered,
+		ExternalSource: source,
+		ExternalID: order.ExternalID,
+		PiiTokens: params.PiiTokens,
+	})
+	return err
+}
@@ -0,0 +1,323 @@
+// Keyset paginated lists with filters and sorting
+// Written by hand because sqlc can't build the WHERE and ORDER BY clauses from the request
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Position of the last row of a page, the next page starts after it
+type Cursor struct {
+	Value string `json:"v"`  // Sort column of the last row, as text
+	ID    int64  `json:"id"` // Breaks ties between rows with the same sort value
+}
+
+type PageParams struct {
+	Sort  string  // One of the sort keys of the list, "id" if empty
+	Desc  bool
+	After *Cursor // nil for the first page
+	Limit int32
+}
+
+// A sortable column and the type its cursor value is cast back to
+type sortColumn struct {
+	column  string
+	sqlType string
+}
+
+var userSorts = map[string]sortColumn{
+	"id":   {"id", "bigint"},
+	"date": {"created_at", "timestamptz"},
+	"name": {"username", "varchar"}, // Full names are encrypted, so names sort by username
+}
+
+var orderSorts = map[string]sortColumn{
+	"id":     {"order_id", "bigint"},
+	"date":   {"created_at", "timestamptz"},
+	"amount": {"purchase_amount", "float8"},
+	"name":   {"username", "varchar"},
+}
+
+// Checks if the key can be used to sort users
+func IsUserSort(sort string) bool {
+	_, ok := userSorts[sort]
+	return ok
+}
+
+// Checks if the key can be used to sort orders
+func IsOrderSort(sort string) bool {
+	_, ok := orderSorts[sort]
+	return ok
+}
+
+// Builds the WHERE clause and its numbered arguments
+type listQuery struct {
+	where []string
+	args  []interface{}
+}
+
+// Adds an argument and returns its placeholder
+func (query *listQuery) arg(value interface{}) string {
+	query.args = append(query.args, value)
+	return fmt.Sprintf("$%d", len(query.args))
+}
+
+func (query *listQuery) filter(condition string) {
+	query.where = append(query.where, condition)
+}
+
+func (query *listQuery) whereClause() string {
+	if len(query.where) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(query.where, " AND ")
+}
+
+// Adds the keyset condition, ORDER BY and LIMIT for the page
+// One extra row is fetched to know if there's a next page
+func (query *listQuery) page(sorts map[string]sortColumn, idColumn string, params PageParams) (string, error) {
+	if params.Sort == "" {
+		params.Sort = "id"
+	}
+	sort, ok := sorts[params.Sort]
+	if !ok {
+		return "", fmt.Errorf("cannot sort by %q", params.Sort)
+	}
+
+	direction, comparison := "ASC", ">"
+	if params.Desc {
+		direction, comparison = "DESC", "<"
+	}
+
+	if params.After != nil {
+		if sort.column == idColumn {
+			query.filter(fmt.Sprintf("%s %s %s", idColumn, comparison, query.arg(params.After.ID)))
+		} else {
+			query.filter(fmt.Sprintf("(%s, %s) %s (%s::%s, %s)",
+				sort.column, idColumn, comparison, query.arg(params.After.Value), sort.sqlType, query.arg(params.After.ID)))
+		}
+	}
+
+	orderBy := fmt.Sprintf(" ORDER BY %s %s", sort.column, direction)
+	if sort.column != idColumn {
+		orderBy += fmt.Sprintf(", %s %s", idColumn, direction)
+	}
+	return query.whereClause() + orderBy + " LIMIT " + query.arg(params.Limit+1), nil
+}
+
+/********* Users *********/
+
+type UserFilter struct {
+	Tag string // Only users with this tag
+}
+
+type UserPage struct {
+	Users []User
+	Next  *Cursor // nil on the last page
+	Total int64   // Users matching the filter on every page
+}
+
+const userColumns = "id, username, full_name, total_orders, created_at, role, version, full_name_bidx, erased_at, updated_at"
+
+func (filter UserFilter) apply(query *listQuery) {
+	if filter.Tag != "" {
+		query.filter("EXISTS (SELECT 1 FROM user_tags JOIN tags ON tags.id = user_tags.tag_id WHERE user_tags.user_id = users.id AND tags.name = " + query.arg(filter.Tag) + ")")
+	}
+}
+
+// Lists a page of users, decrypted
+func (store *Store) ListUsersPage(ctx context.Context, filter UserFilter, params PageParams) (UserPage, error) {
+	var result UserPage
+
+	// Total ignores the cursor
+	countQuery := &listQuery{}
+	filter.apply(countQuery)
+	err := store.db.QueryRowContext(ctx, "SELECT count(*) FROM users"+countQuery.whereClause(), countQuery.args...).Scan(&result.Total)
+	if err != nil {return result, err}
+
+	query := &listQuery{}
+	filter.apply(query)
+	clauses, err := query.page(userSorts, "id", params)
+	if err != nil {return result, err}
+
+	rows, err := store.db.QueryContext(ctx, "SELECT "+userColumns+" FROM users"+clauses, query.args...)
+	if err != nil {return result, err}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		i, err := scanUser(rows)
+		if err != nil {return result, err}
+		users = append(users, i)
+	}
+	if err := rows.Err(); err != nil {return result, err}
+
+	// Extra row means there's another page
+	if len(users) > int(params.Limit) {
+		users = users[:params.Limit]
+		last := users[len(users)-1]
+		result.Next = &Cursor{Value: userSortValue(last, params.Sort), ID: last.ID}
+	}
+
+	result.Users, err = store.decryptUsers(users)
+	return result, err
+}
+
+// Reads a row selected with userColumns, still encrypted
+func scanUser(rows *sql.Rows) (User, error) {
+	var i User
+	err := rows.Scan(
+		&i.ID,
+		&i.Username,
+		&i.FullName,
+		&i.TotalOrders,
+		&i.CreatedAt,
+		&i.Role,
+		&i.Version,
+		&i.FullNameBidx,
+		&i.ErasedAt,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+func userSortValue(user User, sort string) string {
+	switch sort {
+	case "date":
+		return user.CreatedAt.Format(time.RFC3339Nano)
+	case "name":
+		return user.Username
+	default:
+		return strconv.FormatInt(user.ID, 10)
+	}
+}
+
+/********* Orders *********/
+
+type OrderFilter struct {
+	Username         string  // Only orders of this user
+	Tag              string  // Only orders with this tag
+	Currency         string
+	MinAmount        float64 // Ignored if 0
+	MaxAmount        float64 // Ignored if 0
+	ShippingLocation string  // Exact match, case and extra spaces are ignored
+	Item             string  // Purchased item contains this, case is ignored
+}
+
+type OrderPage struct {
+	Orders []Order
+	Next   *Cursor // nil on the last page
+	Total  int64   // Orders matching the filter on every page
+}
+
+const orderColumns = "order_id, account_id, username, full_name, purchase_amount, purchased_item, shipping_location, currency, date_ordered, version, full_name_bidx, shipping_location_bidx, created_at, external_source, external_id, updated_at"
+
+func (store *Store) applyOrderFilter(filter OrderFilter, query *listQuery) {
+	if filter.Username != "" {
+		query.filter("username = " + query.arg(filter.Username))
+	}
+	if filter.Tag != "" {
+		query.filter("EXISTS (SELECT 1 FROM order_tags JOIN tags ON tags.id = order_tags.tag_id WHERE order_tags.order_id = orders.order_id AND tags.name = " + query.arg(filter.Tag) + ")")
+	}
+	if filter.Currency != "" {
+		query.filter("currency = " + query.arg(filter.Currency))
+	}
+	if filter.MinAmount != 0 {
+		query.filter("purchase_amount >= " + query.arg(filter.MinAmount))
+	}
+	if filter.MaxAmount != 0 {
+		query.filter("purchase_amount <= " + query.arg(filter.MaxAmount))
+	}
+	if filter.ShippingLocation != "" { // Shipping locations are encrypted, match on the blind index
+		query.filter("shipping_location_bidx = " + query.arg(store.cipher.BlindIndex(filter.ShippingLocation)))
+	}
+	if filter.Item != "" {
+		query.filter("purchased_item ILIKE '%' || " + query.arg(escapeLike(filter.Item)) + "::text || '%'")
+	}
+}
+
+// Lists a page of orders, decrypted
+func (store *Store) ListOrdersPage(ctx context.Context, filter OrderFilter, params PageParams) (OrderPage, error) {
+	var result OrderPage
+
+	// Total ignores the cursor
+	countQuery := &listQuery{}
+	store.applyOrderFilter(filter, countQuery)
+	err := store.db.QueryRowContext(ctx, "SELECT count(*) FROM orders"+countQuery.whereClause(), countQuery.args...).Scan(&result.Total)
+	if err != nil {return result, err}
+
+	query := &listQuery{}
+	store.applyOrderFilter(filter, query)
+	clauses, err := query.page(orderSorts, "order_id", params)
+	if err != nil {return result, err}
+
+	rows, err := store.db.QueryContext(ctx, "SELECT "+orderColumns+" FROM orders"+clauses, query.args...)
+	if err != nil {return result, err}
+	defer rows.Close()
+
+	orders := []Order{}
+	for rows.Next() {
+		i, err := scanOrder(rows)
+		if err != nil {return result, err}
+		orders = append(orders, i)
+	}
+	if err := rows.Err(); err != nil {return result, err}
+
+	// Extra row means there's another page
+	if len(orders) > int(params.Limit) {
+		orders = orders[:params.Limit]
+		last := orders[len(orders)-1]
+		result.Next = &Cursor{Value: orderSortValue(last, params.Sort), ID: last.OrderID}
+	}
+
+	result.Orders, err = store.decryptOrders(orders)
+	return result, err
+}
+
+// Reads a row selected with orderColumns, still encrypted
+func scanOrder(rows *sql.Rows) (Order, error) {
+	var i Order
+	err := rows.Scan(
+		&i.OrderID,
+		&i.AccountID,
+		&i.Username,
+		&i.FullName,
+		&i.PurchaseAmount,
+		&i.PurchasedItem,
+		&i.ShippingLocation,
+		&i.Currency,
+		&i.DateOrdered,
+		&i.Version,
+		&i.FullNameBidx,
+		&i.ShippingLocationBidx,
+		&i.CreatedAt,
+		&i.ExternalSource,
+		&i.ExternalID,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+func orderSortValue(order Order, sort string) string {
+	switch sort {
+	case "date":
+		return order.CreatedAt.Format(time.RFC3339Nano)
+	case "amount":
+		return strconv.FormatFloat(order.PurchaseAmount, 'g', -1, 64)
+	case "name":
+		return order.Username
+	default:
+		return strconv.FormatInt(order.OrderID, 10)
+	}
+}
+
+// Escapes LIKE wildcards so they match literally
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
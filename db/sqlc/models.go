@@ -3,26 +3,170 @@
 package db
 
 import (
+	"database/sql"
+	"encoding/json"
 	"time"
+
+	"github.com/google/uuid"
 )
 
+type ApiKey struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+	// first characters of the key, shown to tell keys apart
+	KeyPrefix string `json:"key_prefix"`
+	// sha256 of the key, the key itself is never stored
+	HashedKey string `json:"hashed_key"`
+	// e.g. orders:read, orders:write
+	Scopes     []string     `json:"scopes"`
+	ExpiresAt  time.Time    `json:"expires_at"`
+	LastUsedAt sql.NullTime `json:"last_used_at"`
+	RevokedAt  sql.NullTime `json:"revoked_at"`
+	CreatedAt  time.Time    `json:"created_at"`
+}
+
+type Credential struct {
+	UserID int64 `json:"user_id"`
+	// bcrypt hash
+	HashedPassword    string    `json:"hashed_password"`
+	PasswordChangedAt time.Time `json:"password_changed_at"`
+	CreatedAt         time.Time `json:"created_at"`
+}
+
+type IdempotencyKey struct {
+	// user or API key that sent the request, keys are only unique per owner
+	Owner string `json:"owner"`
+	Key   string `json:"key"`
+	// sha256 of the request, a key reused with another request is rejected
+	RequestHash string `json:"request_hash"`
+	// 0 while the first request is still being processed
+	ResponseStatus int32           `json:"response_status"`
+	ResponseBody   json.RawMessage `json:"response_body"`
+	ExpiresAt      time.Time       `json:"expires_at"`
+	CreatedAt      time.Time       `json:"created_at"`
+	// headers sent back with a replayed response, like Content-Type and ETag
+	ResponseHeaders json.RawMessage `json:"response_headers"`
+	// while response_status is 0, a retry of the same request takes the key over after this
+	LockedUntil time.Time `json:"locked_until"`
+}
+
 type Order struct {
 	OrderID   int64  `json:"order_id"`
 	AccountID int64  `json:"account_id"`
 	Username  string `json:"username"`
-	FullName  string `json:"full_name"`
+	// encrypted when PII keys are configured
+	FullName string `json:"full_name"`
 	// must be positive
-	PurchaseAmount   float64 `json:"purchase_amount"`
-	PurchasedItem    string  `json:"purchased_item"`
-	ShippingLocation string  `json:"shipping_location"`
-	Currency         string  `json:"currency"`
-	DateOrdered      string  `json:"date_ordered"`
+	PurchaseAmount float64 `json:"purchase_amount"`
+	PurchasedItem  string  `json:"purchased_item"`
+	// encrypted when PII keys are configured
+	ShippingLocation string `json:"shipping_location"`
+	Currency         string `json:"currency"`
+	DateOrdered      string `json:"date_ordered"`
+	// increases on every update, used for ETag and If-Match
+	Version int64 `json:"version"`
+	// HMAC of the normalised full name, used for exact-match lookups
+	FullNameBidx string `json:"-"`
+	// HMAC of the normalised shipping location, used for exact-match lookups
+	ShippingLocationBidx string    `json:"-"`
+	CreatedAt            time.Time `json:"created_at"`
+	SearchVector         string    `json:"-"`
+	// HMAC of every word of the full name and shipping location, used by search
+	PiiTokens []string `json:"-"`
+	// etsy or shopify for imported orders, empty for orders made here
+	ExternalSource string `json:"external_source"`
+	// id of the order in the source, e.g. the Etsy order id
+	ExternalID string `json:"external_id"`
+	// when the version last went up, sent as Last-Modified
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type OrderEvent struct {
+	ID int64 `json:"id"`
+	// order.created, order.updated or order.deleted
+	Event   string `json:"event"`
+	OrderID int64  `json:"order_id"`
+	// the order as JSON, encrypted like PII
+	Payload   string    `json:"payload"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type OrderTag struct {
+	OrderID   int64     `json:"order_id"`
+	TagID     int64     `json:"tag_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Session struct {
+	ID           uuid.UUID `json:"id"`
+	UserID       int64     `json:"user_id"`
+	RefreshToken string    `json:"refresh_token"`
+	UserAgent    string    `json:"user_agent"`
+	ClientIp     string    `json:"client_ip"`
+	IsBlocked    bool      `json:"is_blocked"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type Tag struct {
+	ID int64 `json:"id"`
+	// stored lowercase, e.g. wholesale, vip, gift, rush
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 type User struct {
-	ID          int64     `json:"id"`
-	Username    string    `json:"username"`
+	ID       int64  `json:"id"`
+	Username string `json:"username"`
+	// encrypted when PII keys are configured
 	FullName    string    `json:"full_name"`
 	TotalOrders int64     `json:"total_orders"`
 	CreatedAt   time.Time `json:"created_at"`
+	// customer, admin, fulfillment or read_only
+	Role string `json:"role"`
+	// increases on every update, used for ETag and If-Match
+	Version int64 `json:"version"`
+	// HMAC of the normalised full name, used for exact-match lookups
+	FullNameBidx string `json:"-"`
+	// set when the customer's PII was erased, their orders are kept for accounting
+	ErasedAt     sql.NullTime `json:"erased_at"`
+	SearchVector string       `json:"-"`
+	// HMAC of every word of the full name, used by search
+	PiiTokens []string `json:"-"`
+	// when the version last went up, sent as Last-Modified
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type UserTag struct {
+	UserID    int64     `json:"user_id"`
+	TagID     int64     `json:"tag_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Webhook struct {
+	ID  int64  `json:"id"`
+	Url string `json:"url"`
+	// e.g. order.created, user.deleted
+	Events []string `json:"events"`
+	// signs every delivery, encrypted like PII
+	Secret    string    `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type WebhookDelivery struct {
+	ID        int64  `json:"id"`
+	WebhookID int64  `json:"webhook_id"`
+	Event     string `json:"event"`
+	// JSON body sent to the webhook, encrypted like PII
+	Payload string `json:"payload"`
+	// pending, succeeded or failed (no attempts left)
+	Status         string       `json:"status"`
+	Attempts       int32        `json:"attempts"`
+	NextAttemptAt  time.Time    `json:"next_attempt_at"`
+	LastStatusCode int32        `json:"last_status_code"`
+	LastError      string       `json:"last_error"`
+	DeliveredAt    sql.NullTime `json:"delivered_at"`
+	// delivery this one was replayed from
+	ReplayOf  sql.NullInt64 `json:"replay_of"`
+	CreatedAt time.Time     `json:"created_at"`
 }
@@ -5,6 +5,9 @@ package db
 
 import (
 	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
 )
 
 const createOrder = `-- name: CreateOrder :one
@@ -12,25 +15,31 @@ INSERT INTO orders (
   account_id,
   username,
   full_name,
+  full_name_bidx,
   purchase_amount,
   purchased_item,
   shipping_location,
+  shipping_location_bidx,
+  pii_tokens,
   currency,
   date_ordered
 ) VALUES (
-  $1, $2, $3, $4, $5, $6, $7, $8
-) RETURNING order_id, account_id, username, full_name, purchase_amount, purchased_item, shipping_location, currency, date_ordered
+  $1, $2, $3, $4, $5, $6, $7, $8, coalesce($11::varchar[], '{}'), $9, $10
+) RETURNING order_id, account_id, username, full_name, purchase_amount, purchased_item, shipping_location, currency, date_ordered, version, full_name_bidx, shipping_location_bidx, created_at, search_vector, pii_tokens, external_source, external_id, updated_at
 `
 
 type CreateOrderParams struct {
-	AccountID        int64   `json:"account_id"`
-	Username         string  `json:"username"`
-	FullName         string  `json:"full_name"`
-	PurchaseAmount   float64 `json:"purchase_amount"`
-	PurchasedItem    string  `json:"purchased_item"`
-	ShippingLocation string  `json:"shipping_location"`
-	Currency         string  `json:"currency"`
-	DateOrdered      string  `json:"date_ordered"`
+	AccountID            int64    `json:"account_id"`
+	Username             string   `json:"username"`
+	FullName             string   `json:"full_name"`
+	FullNameBidx         string   `json:"-"`
+	PurchaseAmount       float64  `json:"purchase_amount"`
+	PurchasedItem        string   `json:"purchased_item"`
+	ShippingLocation     string   `json:"shipping_location"`
+	ShippingLocationBidx string   `json:"-"`
+	Currency             string   `json:"currency"`
+	DateOrdered          string   `json:"date_ordered"`
+	PiiTokens            []string `json:"pii_tokens"`
 }
 
 func (q *Queries) CreateOrder(ctx context.Context, arg CreateOrderParams) (Order, error) {
@@ -38,11 +47,14 @@ func (q *Queries) CreateOrder(ctx context.Context, arg CreateOrderParams) (Order
 		arg.AccountID,
 		arg.Username,
 		arg.FullName,
+		arg.FullNameBidx,
 		arg.PurchaseAmount,
 		arg.PurchasedItem,
 		arg.ShippingLocation,
+		arg.ShippingLocationBidx,
 		arg.Currency,
 		arg.DateOrdered,
+		pq.Array(arg.PiiTokens),
 	)
 	var i Order
 	err := row.Scan(
@@ -55,18 +67,65 @@ func (q *Queries) CreateOrder(ctx context.Context, arg CreateOrderParams) (Order
 		&i.ShippingLocation,
 		&i.Currency,
 		&i.DateOrdered,
+		&i.Version,
+		&i.FullNameBidx,
+		&i.ShippingLocationBidx,
+		&i.CreatedAt,
+		&i.SearchVector,
+		pq.Array(&i.PiiTokens),
+		&i.ExternalSource,
+		&i.ExternalID,
+		&i.UpdatedAt,
 	)
 	return i, err
 }
 
-const deleteAllOrderFromUser = `-- name: DeleteAllOrderFromUser :exec
+const deleteAllOrderFromUser = `-- name: DeleteAllOrderFromUser :many
 DELETE FROM orders
 WHERE username = $1
+RETURNING order_id, account_id, username, full_name, purchase_amount, purchased_item, shipping_location, currency, date_ordered, version, full_name_bidx, shipping_location_bidx, created_at, search_vector, pii_tokens, external_source, external_id, updated_at
 `
 
-func (q *Queries) DeleteAllOrderFromUser(ctx context.Context, username string) error {
-	_, err := q.db.ExecContext(ctx, deleteAllOrderFromUser, username)
-	return err
+func (q *Queries) DeleteAllOrderFromUser(ctx context.Context, username string) ([]Order, error) {
+	rows, err := q.db.QueryContext(ctx, deleteAllOrderFromUser, username)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Order{}
+	for rows.Next() {
+		var i Order
+		if err := rows.Scan(
+			&i.OrderID,
+			&i.AccountID,
+			&i.Username,
+			&i.FullName,
+			&i.PurchaseAmount,
+			&i.PurchasedItem,
+			&i.ShippingLocation,
+			&i.Currency,
+			&i.DateOrdered,
+			&i.Version,
+			&i.FullNameBidx,
+			&i.ShippingLocationBidx,
+			&i.CreatedAt,
+			&i.SearchVector,
+			pq.Array(&i.PiiTokens),
+			&i.ExternalSource,
+			&i.ExternalID,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
 }
 
 const deleteOrder = `-- name: DeleteOrder :exec
@@ -79,8 +138,41 @@ func (q *Queries) DeleteOrder(ctx context.Context, orderID int64) error {
 	return err
 }
 
+const eraseOrdersOfUser = `-- name: EraseOrdersOfUser :execrows
+UPDATE orders
+SET full_name = $2,
+full_name_bidx = $3,
+shipping_location = $4,
+shipping_location_bidx = $5,
+pii_tokens = '{}',
+version = version + 1
+WHERE account_id = $1
+`
+
+type EraseOrdersOfUserParams struct {
+	AccountID            int64  `json:"account_id"`
+	FullName             string `json:"full_name"`
+	FullNameBidx         string `json:"-"`
+	ShippingLocation     string `json:"shipping_location"`
+	ShippingLocationBidx string `json:"-"`
+}
+
+func (q *Queries) EraseOrdersOfUser(ctx context.Context, arg EraseOrdersOfUserParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, eraseOrdersOfUser,
+		arg.AccountID,
+		arg.FullName,
+		arg.FullNameBidx,
+		arg.ShippingLocation,
+		arg.ShippingLocationBidx,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const getOrderById = `-- name: GetOrderById :one
-SELECT order_id, account_id, username, full_name, purchase_amount, purchased_item, shipping_location, currency, date_ordered FROM orders
+SELECT order_id, account_id, username, full_name, purchase_amount, purchased_item, shipping_location, currency, date_ordered, version, full_name_bidx, shipping_location_bidx, created_at, search_vector, pii_tokens, external_source, external_id, updated_at FROM orders
 WHERE order_id = $1 LIMIT 1
 `
 
@@ -97,12 +189,129 @@ func (q *Queries) GetOrderById(ctx context.Context, orderID int64) (Order, error
 		&i.ShippingLocation,
 		&i.Currency,
 		&i.DateOrdered,
+		&i.Version,
+		&i.FullNameBidx,
+		&i.ShippingLocationBidx,
+		&i.CreatedAt,
+		&i.SearchVector,
+		pq.Array(&i.PiiTokens),
+		&i.ExternalSource,
+		&i.ExternalID,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const getOrderForUpdate = `-- name: GetOrderForUpdate :one
+SELECT order_id, account_id, username, full_name, purchase_amount, purchased_item, shipping_location, currency, date_ordered, version, full_name_bidx, shipping_location_bidx, created_at, search_vector, pii_tokens, external_source, external_id, updated_at FROM orders
+WHERE order_id = $1 LIMIT 1
+FOR UPDATE
+`
+
+func (q *Queries) GetOrderForUpdate(ctx context.Context, orderID int64) (Order, error) {
+	row := q.db.QueryRowContext(ctx, getOrderForUpdate, orderID)
+	var i Order
+	err := row.Scan(
+		&i.OrderID,
+		&i.AccountID,
+		&i.Username,
+		&i.FullName,
+		&i.PurchaseAmount,
+		&i.PurchasedItem,
+		&i.ShippingLocation,
+		&i.Currency,
+		&i.DateOrdered,
+		&i.Version,
+		&i.FullNameBidx,
+		&i.ShippingLocationBidx,
+		&i.CreatedAt,
+		&i.SearchVector,
+		pq.Array(&i.PiiTokens),
+		&i.ExternalSource,
+		&i.ExternalID,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const importOrder = `-- name: ImportOrder :one
+INSERT INTO orders (
+  account_id,
+  username,
+  full_name,
+  full_name_bidx,
+  purchase_amount,
+  purchased_item,
+  shipping_location,
+  shipping_location_bidx,
+  pii_tokens,
+  currency,
+  date_ordered,
+  external_source,
+  external_id
+) VALUES (
+  $1, $2, $3, $4, $5, $6, $7, $8, coalesce($13::varchar[], '{}'), $9, $10, $11, $12
+) RETURNING order_id, account_id, username, full_name, purchase_amount, purchased_item, shipping_location, currency, date_ordered, version, full_name_bidx, shipping_location_bidx, created_at, search_vector, pii_tokens, external_source, external_id, updated_at
+`
+
+type ImportOrderParams struct {
+	AccountID            int64    `json:"account_id"`
+	Username             string   `json:"username"`
+	FullName             string   `json:"full_name"`
+	FullNameBidx         string   `json:"-"`
+	PurchaseAmount       float64  `json:"purchase_amount"`
+	PurchasedItem        string   `json:"purchased_item"`
+	ShippingLocation     string   `json:"shipping_location"`
+	ShippingLocationBidx string   `json:"-"`
+	Currency             string   `json:"currency"`
+	DateOrdered          string   `json:"date_ordered"`
+	ExternalSource       string   `json:"external_source"`
+	ExternalID           string   `json:"external_id"`
+	PiiTokens            []string `json:"pii_tokens"`
+}
+
+func (q *Queries) ImportOrder(ctx context.Context, arg ImportOrderParams) (Order, error) {
+	row := q.db.QueryRowContext(ctx, importOrder,
+		arg.AccountID,
+		arg.Username,
+		arg.FullName,
+		arg.FullNameBidx,
+		arg.PurchaseAmount,
+		arg.PurchasedItem,
+		arg.ShippingLocation,
+		arg.ShippingLocationBidx,
+		arg.Currency,
+		arg.DateOrdered,
+		arg.ExternalSource,
+		arg.ExternalID,
+		pq.Array(arg.PiiTokens),
+	)
+	var i Order
+	err := row.Scan(
+		&i.OrderID,
+		&i.AccountID,
+		&i.Username,
+		&i.FullName,
+		&i.PurchaseAmount,
+		&i.PurchasedItem,
+		&i.ShippingLocation,
+		&i.Currency,
+		&i.DateOrdered,
+		&i.Version,
+		&i.FullNameBidx,
+		&i.ShippingLocationBidx,
+		&i.CreatedAt,
+		&i.SearchVector,
+		pq.Array(&i.PiiTokens),
+		&i.ExternalSource,
+		&i.ExternalID,
+		&i.UpdatedAt,
 	)
 	return i, err
 }
 
 const listAllOrders = `-- name: ListAllOrders :many
-SELECT order_id, account_id, username, full_name, purchase_amount, purchased_item, shipping_location, currency, date_ordered FROM orders
+SELECT order_id, account_id, username, full_name, purchase_amount, purchased_item, shipping_location, currency, date_ordered, version, full_name_bidx, shipping_location_bidx, created_at, search_vector, pii_tokens, external_source, external_id, updated_at FROM orders
 ORDER BY order_id
 LIMIT $1
 OFFSET $2
@@ -132,6 +341,218 @@ func (q *Queries) ListAllOrders(ctx context.Context, arg ListAllOrdersParams) ([
 			&i.ShippingLocation,
 			&i.Currency,
 			&i.DateOrdered,
+			&i.Version,
+			&i.FullNameBidx,
+			&i.ShippingLocationBidx,
+			&i.CreatedAt,
+			&i.SearchVector,
+			pq.Array(&i.PiiTokens),
+			&i.ExternalSource,
+			&i.ExternalID,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listFirstOrdersByUsernames = `-- name: ListFirstOrdersByUsernames :many
+SELECT order_id, account_id, username, full_name, purchase_amount, purchased_item, shipping_location, currency, date_ordered, version, full_name_bidx, shipping_location_bidx, created_at, search_vector, pii_tokens, external_source, external_id, updated_at FROM orders
+WHERE order_id IN (
+  SELECT numbered.order_id FROM (
+    SELECT o.order_id, row_number() OVER (PARTITION BY o.username ORDER BY o.order_id) AS user_row
+    FROM orders o
+    WHERE o.username = ANY($1::varchar[])
+  ) AS numbered
+  WHERE numbered.user_row <= $2::int
+)
+ORDER BY order_id
+`
+
+type ListFirstOrdersByUsernamesParams struct {
+	Usernames  []string `json:"usernames"`
+	MaxPerUser int32    `json:"max_per_user"`
+}
+
+func (q *Queries) ListFirstOrdersByUsernames(ctx context.Context, arg ListFirstOrdersByUsernamesParams) ([]Order, error) {
+	rows, err := q.db.QueryContext(ctx, listFirstOrdersByUsernames, pq.Array(arg.Usernames), arg.MaxPerUser)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Order{}
+	for rows.Next() {
+		var i Order
+		if err := rows.Scan(
+			&i.OrderID,
+			&i.AccountID,
+			&i.Username,
+			&i.FullName,
+			&i.PurchaseAmount,
+			&i.PurchasedItem,
+			&i.ShippingLocation,
+			&i.Currency,
+			&i.DateOrdered,
+			&i.Version,
+			&i.FullNameBidx,
+			&i.ShippingLocationBidx,
+			&i.CreatedAt,
+			&i.SearchVector,
+			pq.Array(&i.PiiTokens),
+			&i.ExternalSource,
+			&i.ExternalID,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listImportedOrderIds = `-- name: ListImportedOrderIds :many
+SELECT external_id FROM orders
+WHERE external_source = $1 AND external_id = ANY($2::varchar[])
+`
+
+type ListImportedOrderIdsParams struct {
+	ExternalSource string   `json:"external_source"`
+	ExternalIds    []string `json:"external_ids"`
+}
+
+func (q *Queries) ListImportedOrderIds(ctx context.Context, arg ListImportedOrderIdsParams) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, listImportedOrderIds, arg.ExternalSource, pq.Array(arg.ExternalIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []string{}
+	for rows.Next() {
+		var external_id string
+		if err := rows.Scan(&external_id); err != nil {
+			return nil, err
+		}
+		items = append(items, external_id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listOrdersAfterId = `-- name: ListOrdersAfterId :many
+SELECT order_id, account_id, username, full_name, purchase_amount, purchased_item, shipping_location, currency, date_ordered, version, full_name_bidx, shipping_location_bidx, created_at, search_vector, pii_tokens, external_source, external_id, updated_at FROM orders
+WHERE order_id > $1
+ORDER BY order_id
+LIMIT $2
+`
+
+type ListOrdersAfterIdParams struct {
+	OrderID int64 `json:"order_id"`
+	Limit   int32 `json:"limit"`
+}
+
+func (q *Queries) ListOrdersAfterId(ctx context.Context, arg ListOrdersAfterIdParams) ([]Order, error) {
+	rows, err := q.db.QueryContext(ctx, listOrdersAfterId, arg.OrderID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Order{}
+	for rows.Next() {
+		var i Order
+		if err := rows.Scan(
+			&i.OrderID,
+			&i.AccountID,
+			&i.Username,
+			&i.FullName,
+			&i.PurchaseAmount,
+			&i.PurchasedItem,
+			&i.ShippingLocation,
+			&i.Currency,
+			&i.DateOrdered,
+			&i.Version,
+			&i.FullNameBidx,
+			&i.ShippingLocationBidx,
+			&i.CreatedAt,
+			&i.SearchVector,
+			pq.Array(&i.PiiTokens),
+			&i.ExternalSource,
+			&i.ExternalID,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listOrdersByShippingLocation = `-- name: ListOrdersByShippingLocation :many
+SELECT order_id, account_id, username, full_name, purchase_amount, purchased_item, shipping_location, currency, date_ordered, version, full_name_bidx, shipping_location_bidx, created_at, search_vector, pii_tokens, external_source, external_id, updated_at FROM orders
+WHERE shipping_location_bidx = $1
+ORDER BY order_id
+LIMIT $2
+OFFSET $3
+`
+
+type ListOrdersByShippingLocationParams struct {
+	ShippingLocationBidx string `json:"-"`
+	Limit                int32  `json:"limit"`
+	Offset               int32  `json:"offset"`
+}
+
+func (q *Queries) ListOrdersByShippingLocation(ctx context.Context, arg ListOrdersByShippingLocationParams) ([]Order, error) {
+	rows, err := q.db.QueryContext(ctx, listOrdersByShippingLocation, arg.ShippingLocationBidx, arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Order{}
+	for rows.Next() {
+		var i Order
+		if err := rows.Scan(
+			&i.OrderID,
+			&i.AccountID,
+			&i.Username,
+			&i.FullName,
+			&i.PurchaseAmount,
+			&i.PurchasedItem,
+			&i.ShippingLocation,
+			&i.Currency,
+			&i.DateOrdered,
+			&i.Version,
+			&i.FullNameBidx,
+			&i.ShippingLocationBidx,
+			&i.CreatedAt,
+			&i.SearchVector,
+			pq.Array(&i.PiiTokens),
+			&i.ExternalSource,
+			&i.ExternalID,
+			&i.UpdatedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -147,7 +568,7 @@ func (q *Queries) ListAllOrders(ctx context.Context, arg ListAllOrdersParams) ([
 }
 
 const listOrdersByUsername = `-- name: ListOrdersByUsername :many
-SELECT order_id, account_id, username, full_name, purchase_amount, purchased_item, shipping_location, currency, date_ordered FROM orders
+SELECT order_id, account_id, username, full_name, purchase_amount, purchased_item, shipping_location, currency, date_ordered, version, full_name_bidx, shipping_location_bidx, created_at, search_vector, pii_tokens, external_source, external_id, updated_at FROM orders
 WHERE username = $1
 `
 
@@ -170,6 +591,15 @@ func (q *Queries) ListOrdersByUsername(ctx context.Context, username string) ([]
 			&i.ShippingLocation,
 			&i.Currency,
 			&i.DateOrdered,
+			&i.Version,
+			&i.FullNameBidx,
+			&i.ShippingLocationBidx,
+			&i.CreatedAt,
+			&i.SearchVector,
+			pq.Array(&i.PiiTokens),
+			&i.ExternalSource,
+			&i.ExternalID,
+			&i.UpdatedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -184,28 +614,50 @@ func (q *Queries) ListOrdersByUsername(ctx context.Context, username string) ([]
 	return items, nil
 }
 
-const updateOrder = `-- name: UpdateOrder :one
+const patchOrder = `-- name: PatchOrder :one
 UPDATE orders
-SET purchase_amount = $2,
-purchased_item = $3,
-shipping_location = $4
-WHERE order_id = $1
-RETURNING order_id, account_id, username, full_name, purchase_amount, purchased_item, shipping_location, currency, date_ordered
+SET purchase_amount = coalesce($1, purchase_amount),
+purchased_item = coalesce($2, purchased_item),
+currency = coalesce($3, currency),
+date_ordered = coalesce($4, date_ordered),
+full_name = coalesce($5, full_name),
+full_name_bidx = coalesce($6, full_name_bidx),
+shipping_location = coalesce($7, shipping_location),
+shipping_location_bidx = coalesce($8, shipping_location_bidx),
+pii_tokens = coalesce($9::varchar[], pii_tokens),
+version = version + 1
+WHERE order_id = $10 AND ($11::bigint[] IS NULL OR version = ANY($11::bigint[]))
+RETURNING order_id, account_id, username, full_name, purchase_amount, purchased_item, shipping_location, currency, date_ordered, version, full_name_bidx, shipping_location_bidx, created_at, search_vector, pii_tokens, external_source, external_id, updated_at
 `
 
-type UpdateOrderParams struct {
-	OrderID          int64   `json:"order_id"`
-	PurchaseAmount   float64 `json:"purchase_amount"`
-	PurchasedItem    string  `json:"purchased_item"`
-	ShippingLocation string  `json:"shipping_location"`
+type PatchOrderParams struct {
+	PurchaseAmount       sql.NullFloat64 `json:"purchase_amount"`
+	PurchasedItem        sql.NullString  `json:"purchased_item"`
+	Currency             sql.NullString  `json:"currency"`
+	DateOrdered          sql.NullString  `json:"date_ordered"`
+	FullName             sql.NullString  `json:"full_name"`
+	FullNameBidx         sql.NullString  `json:"-"`
+	ShippingLocation     sql.NullString  `json:"shipping_location"`
+	ShippingLocationBidx sql.NullString  `json:"-"`
+	PiiTokens            []string        `json:"pii_tokens"`
+	OrderID              int64           `json:"order_id"`
+	Versions             []int64         `json:"versions"`
 }
 
-func (q *Queries) UpdateOrder(ctx context.Context, arg UpdateOrderParams) (Order, error) {
-	row := q.db.QueryRowContext(ctx, updateOrder,
-		arg.OrderID,
+// NULL params keep the column, the version is only checked when versions are given
+func (q *Queries) PatchOrder(ctx context.Context, arg PatchOrderParams) (Order, error) {
+	row := q.db.QueryRowContext(ctx, patchOrder,
 		arg.PurchaseAmount,
 		arg.PurchasedItem,
+		arg.Currency,
+		arg.DateOrdered,
+		arg.FullName,
+		arg.FullNameBidx,
 		arg.ShippingLocation,
+		arg.ShippingLocationBidx,
+		pq.Array(arg.PiiTokens),
+		arg.OrderID,
+		pq.Array(arg.Versions),
 	)
 	var i Order
 	err := row.Scan(
@@ -218,6 +670,46 @@ func (q *Queries) UpdateOrder(ctx context.Context, arg UpdateOrderParams) (Order
 		&i.ShippingLocation,
 		&i.Currency,
 		&i.DateOrdered,
+		&i.Version,
+		&i.FullNameBidx,
+		&i.ShippingLocationBidx,
+		&i.CreatedAt,
+		&i.SearchVector,
+		pq.Array(&i.PiiTokens),
+		&i.ExternalSource,
+		&i.ExternalID,
+		&i.UpdatedAt,
 	)
 	return i, err
 }
+
+const updateOrderPII = `-- name: UpdateOrderPII :exec
+UPDATE orders
+SET full_name = $2,
+full_name_bidx = $3,
+shipping_location = $4,
+shipping_location_bidx = $5,
+pii_tokens = coalesce($6::varchar[], '{}')
+WHERE order_id = $1
+`
+
+type UpdateOrderPIIParams struct {
+	OrderID              int64    `json:"order_id"`
+	FullName             string   `json:"full_name"`
+	FullNameBidx         string   `json:"-"`
+	ShippingLocation     string   `json:"shipping_location"`
+	ShippingLocationBidx string   `json:"-"`
+	PiiTokens            []string `json:"pii_tokens"`
+}
+
+func (q *Queries) UpdateOrderPII(ctx context.Context, arg UpdateOrderPIIParams) error {
+	_, err := q.db.ExecContext(ctx, updateOrderPII,
+		arg.OrderID,
+		arg.FullName,
+		arg.FullNameBidx,
+		arg.ShippingLocation,
+		arg.ShippingLocationBidx,
+		pq.Array(arg.PiiTokens),
+	)
+	return err
+}
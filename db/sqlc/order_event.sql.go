@@ -0,0 +1,117 @@
+// Code generated by sqlc. DO NOT EDIT.
+// source: order_event.sql
+
+package db
+
+import (
+	"context"
+	"time"
+)
+
+const createOrderEvent = `-- name: CreateOrderEvent :exec
+INSERT INTO order_events (
+  event,
+  order_id,
+  payload
+) VALUES (
+  $1, $2, $3
+)
+`
+
+type CreateOrderEventParams struct {
+	Event   string `json:"event"`
+	OrderID int64  `json:"order_id"`
+	Payload string `json:"payload"`
+}
+
+func (q *Queries) CreateOrderEvent(ctx context.Context, arg CreateOrderEventParams) error {
+	_, err := q.db.ExecContext(ctx, createOrderEvent, arg.Event, arg.OrderID, arg.Payload)
+	return err
+}
+
+const deleteOrderEventsBefore = `-- name: DeleteOrderEventsBefore :execrows
+DELETE FROM order_events
+WHERE created_at < $1
+`
+
+func (q *Queries) DeleteOrderEventsBefore(ctx context.Context, createdAt time.Time) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteOrderEventsBefore, createdAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getOrderEventBounds = `-- name: GetOrderEventBounds :one
+SELECT coalesce(min(id), 0)::bigint AS oldest_id, coalesce(max(id), 0)::bigint AS latest_id
+FROM order_events
+`
+
+type GetOrderEventBoundsRow struct {
+	OldestID int64 `json:"oldest_id"`
+	LatestID int64 `json:"latest_id"`
+}
+
+func (q *Queries) GetOrderEventBounds(ctx context.Context) (GetOrderEventBoundsRow, error) {
+	row := q.db.QueryRowContext(ctx, getOrderEventBounds)
+	var i GetOrderEventBoundsRow
+	err := row.Scan(&i.OldestID, &i.LatestID)
+	return i, err
+}
+
+const listOrderEventsAfter = `-- name: ListOrderEventsAfter :many
+SELECT id, event, order_id, payload, created_at FROM order_events
+WHERE id > $1
+ORDER BY id
+LIMIT $2
+`
+
+type ListOrderEventsAfterParams struct {
+	ID    int64 `json:"id"`
+	Limit int32 `json:"limit"`
+}
+
+func (q *Queries) ListOrderEventsAfter(ctx context.Context, arg ListOrderEventsAfterParams) ([]OrderEvent, error) {
+	rows, err := q.db.QueryContext(ctx, listOrderEventsAfter, arg.ID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []OrderEvent{}
+	for rows.Next() {
+		var i OrderEvent
+		if err := rows.Scan(
+			&i.ID,
+			&i.Event,
+			&i.OrderID,
+			&i.Payload,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const updateOrderEventPayload = `-- name: UpdateOrderEventPayload :exec
+UPDATE order_events
+SET payload = $2
+WHERE id = $1
+`
+
+type UpdateOrderEventPayloadParams struct {
+	ID      int64  `json:"id"`
+	Payload string `json:"payload"`
+}
+
+func (q *Queries) UpdateOrderEventPayload(ctx context.Context, arg UpdateOrderEventPayloadParams) error {
+	_, err := q.db.ExecContext(ctx, updateOrderEventPayload, arg.ID, arg.Payload)
+	return err
+}
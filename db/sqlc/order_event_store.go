@@ -0,0 +1,56 @@
+// Live order feed: order changes are appended to order_events in the transaction that made them,
+// a trigger NOTIFYs every API instance listening on order_events once it commits (see the feed package)
+// Payloads are encrypted like PII, ListOrderEventsAfter shadows the generated query to decrypt them
+
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// Channel the order_events trigger notifies
+const OrderEventsChannel = "order_events"
+
+/********* Events *********/
+
+// Publishes the change of the orders to the live feed and to the webhooks subscribed to the event
+func (store *Store) publishOrderEvent(ctx context.Context, q *Queries, event string, orders ...Order) error {
+	data := make([]interface{}, len(orders))
+	for i, order := range orders {
+		data[i] = order
+	}
+	if err := store.queueWebhookEvent(ctx, q, event, data...); err != nil {return err}
+	return store.recordOrderEvents(ctx, q, event, orders...)
+}
+
+// Appends the orders to the live feed
+func (store *Store) recordOrderEvents(ctx context.Context, q *Queries, event string, orders ...Order) error {
+	for _, order := range orders {
+		body, err := json.Marshal(order)
+		if err != nil {return err}
+		payload, err := store.cipher.Encrypt(string(body))
+		if err != nil {return err}
+
+		err = q.CreateOrderEvent(ctx, CreateOrderEventParams{Event: event, OrderID: order.OrderID, Payload: payload})
+		if err != nil {return err}
+	}
+	return nil
+}
+
+/********* Feed *********/
+
+func (store *Store) ListOrderEventsAfter(ctx context.Context, arg ListOrderEventsAfterParams) ([]OrderEvent, error) {
+	events, err := store.Queries.ListOrderEventsAfter(ctx, arg)
+	if err != nil {return nil, err}
+	for i := range events {
+		if events[i].Payload, err = store.cipher.Decrypt(events[i].Payload); err != nil {return nil, err}
+	}
+	return events, nil
+}
+
+// Deletes events older than the retention, clients that were away longer can't resume past them
+func (store *Store) PruneOrderEvents(ctx context.Context, retention time.Duration) (int64, error) {
+	return store.DeleteOrderEventsBefore(ctx, time.Now().Add(-retention))
+}
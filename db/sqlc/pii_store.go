@@ -0,0 +1,411 @@
+// Encrypts and decrypts customer PII (full names, shipping locations) on its way in and out of the DB
+// The Store methods here shadow the generated Queries methods so callers only ever see plain text
+
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/samanthatb1/beadBashStorage/db/dberr"
+	"github.com/samanthatb1/beadBashStorage/pii"
+)
+
+var ErrNoPIIKeys = errors.New("no PII keys are configured")
+
+// Values that look encrypted would be decrypted on every read, and fail without the right key
+var ErrEncryptedValue = dberr.NewValidation("invalid_value", "Names and shipping locations can't start with \"enc:v1:\"")
+
+/********* Helpers *********/
+
+// Encrypts a PII value from a client, rejects it if it already looks encrypted
+func (store *Store) encryptPII(value string) (string, error) {
+	if pii.IsEncrypted(value) {return "", ErrEncryptedValue}
+	return store.cipher.Encrypt(value)
+}
+
+// Encrypts the user's PII and fills in its blind index
+func (store *Store) encryptUserParams(arg CreateUserParams) (CreateUserParams, error) {
+	var err error
+	arg.FullNameBidx = store.cipher.BlindIndex(arg.FullName)
+	arg.PiiTokens = store.cipher.WordTokens(arg.FullName)
+	arg.FullName, err = store.encryptPII(arg.FullName)
+	return arg, err
+}
+
+// Encrypts the order's PII and fills in its blind indexes
+func (store *Store) encryptOrderParams(arg CreateOrderParams) (CreateOrderParams, error) {
+	var err error
+	arg.FullNameBidx = store.cipher.BlindIndex(arg.FullName)
+	arg.ShippingLocationBidx = store.cipher.BlindIndex(arg.ShippingLocation)
+	arg.PiiTokens = store.cipher.WordTokens(arg.FullName, arg.ShippingLocation)
+	if arg.FullName, err = store.encryptPII(arg.FullName); err != nil {return arg, err}
+	arg.ShippingLocation, err = store.encryptPII(arg.ShippingLocation)
+	return arg, err
+}
+
+func (store *Store) decryptUser(user User) (User, error) {
+	var err error
+	user.FullName, err = store.cipher.Decrypt(user.FullName)
+	return user, err
+}
+
+func (store *Store) decryptUsers(users []User) ([]User, error) {
+	for i := range users {
+		var err error
+		if users[i], err = store.decryptUser(users[i]); err != nil {return nil, err}
+	}
+	return users, nil
+}
+
+func (store *Store) decryptOrder(order Order) (Order, error) {
+	var err error
+	if order.FullName, err = store.cipher.Decrypt(order.FullName); err != nil {return order, err}
+	order.ShippingLocation, err = store.cipher.Decrypt(order.ShippingLocation)
+	return order, err
+}
+
+func (store *Store) decryptOrders(orders []Order) ([]Order, error) {
+	for i := range orders {
+		var err error
+		if orders[i], err = store.decryptOrder(orders[i]); err != nil {return nil, err}
+	}
+	return orders, nil
+}
+
+/********* Users *********/
+
+func (store *Store) CreateUser(ctx context.Context, arg CreateUserParams) (User, error) {
+	arg, err := store.encryptUserParams(arg)
+	if err != nil {return User{}, err}
+	user, err := store.Queries.CreateUser(ctx, arg)
+	if err != nil {return user, err}
+	return store.decryptUser(user)
+}
+
+func (store *Store) ListUsers(ctx context.Context, arg ListUsersParams) ([]User, error) {
+	users, err := store.Queries.ListUsers(ctx, arg)
+	if err != nil {return nil, err}
+	return store.decryptUsers(users)
+}
+
+func (store *Store) ListUsersByTag(ctx context.Context, arg ListUsersByTagParams) ([]User, error) {
+	users, err := store.Queries.ListUsersByTag(ctx, arg)
+	if err != nil {return nil, err}
+	return store.decryptUsers(users)
+}
+
+func (store *Store) ListUsersByUsernames(ctx context.Context, usernames []string) ([]User, error) {
+	users, err := store.Queries.ListUsersByUsernames(ctx, usernames)
+	if err != nil {return nil, err}
+	return store.decryptUsers(users)
+}
+
+func (store *Store) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, error) {
+	user, err := store.Queries.UpdateUser(ctx, arg)
+	if err != nil {return user, err}
+	store.forgetUsers(user)
+	return store.decryptUser(user)
+}
+
+func (store *Store) UpdateUserRole(ctx context.Context, arg UpdateUserRoleParams) (User, error) {
+	user, err := store.Queries.UpdateUserRole(ctx, arg)
+	if err != nil {return user, err}
+	store.forgetUsers(user)
+	return store.decryptUser(user)
+}
+
+// Exact-match lookup on the full name through its blind index (case and extra spaces are ignored)
+func (store *Store) FindUsersByFullName(ctx context.Context, fullName string, limit int32, offset int32) ([]User, error) {
+	users, err := store.Queries.ListUsersByFullName(ctx, ListUsersByFullNameParams{
+		FullNameBidx: store.cipher.BlindIndex(fullName),
+		Limit: limit,
+		Offset: offset,
+	})
+	if err != nil {return nil, err}
+	return store.decryptUsers(users)
+}
+
+/********* Orders *********/
+
+func (store *Store) CreateOrder(ctx context.Context, arg CreateOrderParams) (Order, error) {
+	arg, err := store.encryptOrderParams(arg)
+	if err != nil {return Order{}, err}
+	order, err := store.Queries.CreateOrder(ctx, arg)
+	if err != nil {return order, err}
+	return store.decryptOrder(order)
+}
+
+func (store *Store) ListOrdersByUsername(ctx context.Context, username string) ([]Order, error) {
+	orders, err := store.Queries.ListOrdersByUsername(ctx, username)
+	if err != nil {return nil, err}
+	return store.decryptOrders(orders)
+}
+
+// At most maxPerUser orders of each user, oldest first, so the batch can't grow with how much they ordered
+func (store *Store) ListFirstOrdersByUsernames(ctx context.Context, usernames []string, maxPerUser int32) ([]Order, error) {
+	orders, err := store.Queries.ListFirstOrdersByUsernames(ctx, ListFirstOrdersByUsernamesParams{Usernames: usernames, MaxPerUser: maxPerUser})
+	if err != nil {return nil, err}
+	return store.decryptOrders(orders)
+}
+
+func (store *Store) ListAllOrders(ctx context.Context, arg ListAllOrdersParams) ([]Order, error) {
+	orders, err := store.Queries.ListAllOrders(ctx, arg)
+	if err != nil {return nil, err}
+	return store.decryptOrders(orders)
+}
+
+func (store *Store) ListAllOrdersByTag(ctx context.Context, arg ListAllOrdersByTagParams) ([]Order, error) {
+	orders, err := store.Queries.ListAllOrdersByTag(ctx, arg)
+	if err != nil {return nil, err}
+	return store.decryptOrders(orders)
+}
+
+func (store *Store) ListOrdersByUsernameAndTag(ctx context.Context, arg ListOrdersByUsernameAndTagParams) ([]Order, error) {
+	orders, err := store.Queries.ListOrdersByUsernameAndTag(ctx, arg)
+	if err != nil {return nil, err}
+	return store.decryptOrders(orders)
+}
+
+// Exact-match lookup on the shipping location through its blind index (case and extra spaces are ignored)
+func (store *Store) FindOrdersByShippingLocation(ctx context.Context, location string, limit int32, offset int32) ([]Order, error) {
+	orders, err := store.Queries.ListOrdersByShippingLocation(ctx, ListOrdersByShippingLocationParams{
+		ShippingLocationBidx: store.cipher.BlindIndex(location),
+		Limit: limit,
+		Offset: offset,
+	})
+	if err != nil {return nil, err}
+	return store.decryptOrders(orders)
+}
+
+/********* Idempotency Keys *********/
+
+// Stored responses contain the order's PII, so the whole body is encrypted and kept as a JSON string
+
+func (store *Store) CompleteIdempotencyKey(ctx context.Context, arg CompleteIdempotencyKeyParams) error {
+	var err error
+	if arg.ResponseBody, err = store.encryptResponseBody(arg.ResponseBody); err != nil {return err}
+	return store.Queries.CompleteIdempotencyKey(ctx, arg)
+}
+
+func (store *Store) GetIdempotencyKey(ctx context.Context, arg GetIdempotencyKeyParams) (IdempotencyKey, error) {
+	record, err := store.Queries.GetIdempotencyKey(ctx, arg)
+	if err != nil {return record, err}
+	record.ResponseBody, err = store.decryptResponseBody(record.ResponseBody)
+	return record, err
+}
+
+func (store *Store) encryptResponseBody(body json.RawMessage) (json.RawMessage, error) {
+	if store.cipher == nil {return body, nil}
+	encrypted, err := store.cipher.Encrypt(string(body))
+	if err != nil {return nil, err}
+	return json.Marshal(encrypted)
+}
+
+func (store *Store) decryptResponseBody(body json.RawMessage) (json.RawMessage, error) {
+	var encrypted string
+	if json.Unmarshal(body, &encrypted) != nil || !pii.IsEncrypted(encrypted) {
+		return body, nil // Not encrypted
+	}
+	plain, err := store.cipher.Decrypt(encrypted)
+	if err != nil {return nil, err}
+	return json.RawMessage(plain), nil
+}
+
+/********* Key Rotation *********/
+
+type RotateKeysResult struct {
+	UsersRotated       int64  `json:"users_rotated"`
+	OrdersRotated      int64  `json:"orders_rotated"`
+	WebhooksRotated    int64  `json:"webhooks_rotated"`
+	DeliveriesRotated  int64  `json:"deliveries_rotated"`
+	OrderEventsRotated int64  `json:"order_events_rotated"`
+	ResponsesRotated   int64  `json:"responses_rotated"` // Stored Idempotency-Key responses
+}
+
+// Rewrites every user, order, webhook, feed event and stored response whose PII is still plain text or wrapped by an old master key,
+// and recomputes blind indexes and search tokens that don't match the current index key
+// Rows are handled in batches, each batch in its own transaction, so it can be stopped and run again
+func (store *Store) RotateKeys(ctx context.Context, batchSize int32) (RotateKeysResult, error) {
+	var result RotateKeysResult
+	if store.cipher == nil {return result, ErrNoPIIKeys}
+
+	// Users
+	var lastID int64
+	for {
+		var done bool
+		err := store.execTx(ctx, func(q *Queries) error {
+			users, err := q.ListUsersAfterId(ctx, ListUsersAfterIdParams{ID: lastID, Limit: batchSize})
+			if err != nil {return err}
+			done = len(users) < int(batchSize)
+
+			for _, user := range users {
+				lastID = user.ID
+				fullName, err := store.cipher.Decrypt(user.FullName)
+				if err != nil {return fmt.Errorf("user %d: %w", user.ID, err)}
+				bidx := store.cipher.BlindIndex(fullName)
+				tokens := store.cipher.WordTokens(fullName)
+				if !store.cipher.NeedsRotation(user.FullName) && bidx == user.FullNameBidx && sameTokens(tokens, user.PiiTokens) {continue}
+
+				rotated, err := store.cipher.Rotate(user.FullName)
+				if err != nil {return fmt.Errorf("user %d: %w", user.ID, err)}
+				err = q.UpdateUserPII(ctx, UpdateUserPIIParams{ID: user.ID, FullName: rotated, FullNameBidx: bidx, PiiTokens: tokens})
+				if err != nil {return err}
+				result.UsersRotated++
+			}
+			return nil
+		})
+		if err != nil {return result, err}
+		if done {break}
+	}
+
+	// Orders
+	lastID = 0
+	for {
+		var done bool
+		err := store.execTx(ctx, func(q *Queries) error {
+			orders, err := q.ListOrdersAfterId(ctx, ListOrdersAfterIdParams{OrderID: lastID, Limit: batchSize})
+			if err != nil {return err}
+			done = len(orders) < int(batchSize)
+
+			for _, order := range orders {
+				lastID = order.OrderID
+				plain, err := store.decryptOrder(order)
+				if err != nil {return fmt.Errorf("order %d: %w", order.OrderID, err)}
+				fullNameBidx := store.cipher.BlindIndex(plain.FullName)
+				locationBidx := store.cipher.BlindIndex(plain.ShippingLocation)
+				tokens := store.cipher.WordTokens(plain.FullName, plain.ShippingLocation)
+				if !store.cipher.NeedsRotation(order.FullName) && !store.cipher.NeedsRotation(order.ShippingLocation) &&
+					fullNameBidx == order.FullNameBidx && locationBidx == order.ShippingLocationBidx && sameTokens(tokens, order.PiiTokens) {continue}
+
+				fullName, err := store.cipher.Rotate(order.FullName)
+				if err != nil {return fmt.Errorf("order %d: %w", order.OrderID, err)}
+				location, err := store.cipher.Rotate(order.ShippingLocation)
+				if err != nil {return fmt.Errorf("order %d: %w", order.OrderID, err)}
+				err = q.UpdateOrderPII(ctx, UpdateOrderPIIParams{
+					OrderID: order.OrderID,
+					FullName: fullName,
+					FullNameBidx: fullNameBidx,
+					ShippingLocation: location,
+					ShippingLocationBidx: locationBidx,
+					PiiTokens: tokens,
+				})
+				if err != nil {return err}
+				result.OrdersRotated++
+			}
+			return nil
+		})
+		if err != nil {return result, err}
+		if done {break}
+	}
+
+	// Webhook secrets, there are only a few
+	webhooks, err := store.Queries.ListWebhooks(ctx)
+	if err != nil {return result, err}
+	for _, webhook := range webhooks {
+		if !store.cipher.NeedsRotation(webhook.Secret) {continue}
+		secret, err := store.cipher.Rotate(webhook.Secret)
+		if err != nil {return result, fmt.Errorf("webhook %d: %w", webhook.ID, err)}
+		if err = store.UpdateWebhookSecret(ctx, UpdateWebhookSecretParams{ID: webhook.ID, Secret: secret}); err != nil {return result, err}
+		result.WebhooksRotated++
+	}
+
+	// Webhook delivery payloads
+	lastID = 0
+	for {
+		var done bool
+		err := store.execTx(ctx, func(q *Queries) error {
+			deliveries, err := q.ListWebhookDeliveriesAfterId(ctx, ListWebhookDeliveriesAfterIdParams{ID: lastID, Limit: batchSize})
+			if err != nil {return err}
+			done = len(deliveries) < int(batchSize)
+
+			for _, delivery := range deliveries {
+				lastID = delivery.ID
+				if !store.cipher.NeedsRotation(delivery.Payload) {continue}
+				payload, err := store.cipher.Rotate(delivery.Payload)
+				if err != nil {return fmt.Errorf("webhook delivery %d: %w", delivery.ID, err)}
+				err = q.UpdateWebhookDeliveryPayload(ctx, UpdateWebhookDeliveryPayloadParams{ID: delivery.ID, Payload: payload})
+				if err != nil {return err}
+				result.DeliveriesRotated++
+			}
+			return nil
+		})
+		if err != nil {return result, err}
+		if done {break}
+	}
+
+	// Live feed events, the feed can't be read once one of them is wrapped by a removed key
+	lastID = 0
+	for {
+		var done bool
+		err := store.execTx(ctx, func(q *Queries) error {
+			events, err := q.ListOrderEventsAfter(ctx, ListOrderEventsAfterParams{ID: lastID, Limit: batchSize})
+			if err != nil {return err}
+			done = len(events) < int(batchSize)
+
+			for _, event := range events {
+				lastID = event.ID
+				if !store.cipher.NeedsRotation(event.Payload) {continue}
+				payload, err := store.cipher.Rotate(event.Payload)
+				if err != nil {return fmt.Errorf("order event %d: %w", event.ID, err)}
+				err = q.UpdateOrderEventPayload(ctx, UpdateOrderEventPayloadParams{ID: event.ID, Payload: payload})
+				if err != nil {return err}
+				result.OrderEventsRotated++
+			}
+			return nil
+		})
+		if err != nil {return result, err}
+		if done {break}
+	}
+
+	// Stored Idempotency-Key responses, plain ones are JSON documents and encrypted ones JSON strings
+	after := ListIdempotencyKeysAfterParams{MaxRows: batchSize}
+	for {
+		var done bool
+		err := store.execTx(ctx, func(q *Queries) error {
+			records, err := q.ListIdempotencyKeysAfter(ctx, after)
+			if err != nil {return err}
+			done = len(records) < int(batchSize)
+
+			for _, record := range records {
+				after.Owner, after.Key = record.Owner, record.Key
+				if record.ResponseStatus == 0 {continue} // Still running, nothing stored yet
+
+				var body json.RawMessage
+				var encrypted string
+				if json.Unmarshal(record.ResponseBody, &encrypted) == nil && pii.IsEncrypted(encrypted) {
+					if !store.cipher.NeedsRotation(encrypted) {continue}
+					rotated, err := store.cipher.Rotate(encrypted)
+					if err != nil {return fmt.Errorf("idempotency key %s: %w", record.Key, err)}
+					if body, err = json.Marshal(rotated); err != nil {return err}
+				} else if body, err = store.encryptResponseBody(record.ResponseBody); err != nil {
+					return err
+				}
+
+				err = q.UpdateIdempotencyKeyBody(ctx, UpdateIdempotencyKeyBodyParams{Owner: record.Owner, Key: record.Key, ResponseBody: body})
+				if err != nil {return err}
+				result.ResponsesRotated++
+			}
+			return nil
+		})
+		if err != nil {return result, err}
+		if done {break}
+	}
+
+	return result, nil
+}
+
+// Compares search tokens ignoring their order, the migration backfilled them sorted by the DB's collation
+func sameTokens(tokens []string, stored []string) bool {
+	if len(tokens) != len(stored) {return false}
+	set := make(map[string]bool, len(stored))
+	for _, token := range stored {
+		set[token] = true
+	}
+	for _, token := range tokens {
+		if !set[token] {return false}
+	}
+	return true
+}
@@ -0,0 +1,217 @@
+// Full-text search over users and orders
+// Usernames and purchased items are matched with tsvectors and trigrams, encrypted names and
+// shipping locations can only be matched word for word through their search tokens
+
+package db
+
+import (
+	"context"
+	"strings"
+	"unicode"
+
+	"github.com/lib/pq"
+	"github.com/samanthatb1/beadBashStorage/pii"
+)
+
+// Wraps matched words in highlights
+const (
+	highlightStart = "<mark>"
+	highlightStop  = "</mark>"
+)
+
+// Highlights are HTML, so the stored text in them is escaped before the marks are added
+// The DB escapes purchased items the same way before ts_headline marks them
+var highlightEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+const escapedPurchasedItem = `replace(replace(replace(orders.purchased_item, '&', '&amp;'), '<', '&lt;'), '>', '&gt;')`
+
+type UserHit struct {
+	User       User              `json:"user"`
+	Rank       float64           `json:"rank"`
+	Highlights map[string]string `json:"highlights"` // Matched fields with their matches marked
+}
+
+type OrderHit struct {
+	Order      Order             `json:"order"`
+	Rank       float64           `json:"rank"`
+	Highlights map[string]string `json:"highlights"` // Matched fields with their matches marked
+}
+
+// Words of the search and what they're matched with
+type searchTerms struct {
+	words   []string
+	tsquery string   // Any of the words, as a prefix
+	tokens  []string // Search tokens of the words, to match encrypted columns
+}
+
+func (store *Store) searchTerms(query string) searchTerms {
+	words := pii.Words(query)
+	prefixes := make([]string, len(words))
+	for i, word := range words {
+		prefixes[i] = word + ":*" // Words are only letters and digits, safe inside a tsquery
+	}
+	return searchTerms{
+		words: words,
+		tsquery: strings.Join(prefixes, " | "),
+		tokens: store.cipher.WordTokens(query),
+	}
+}
+
+const searchUsers = `
+WITH q AS (SELECT to_tsquery('simple', $1) AS query)
+SELECT ` + userColumns + `,
+  ts_rank(users.search_vector, q.query)
+    + (SELECT coalesce(sum(word_similarity(w, users.username)), 0) FROM unnest($2::text[]) AS w)
+    + 0.5 * (SELECT count(*) FROM unnest(users.pii_tokens) AS t WHERE t = ANY($3::varchar[])) AS rank
+FROM users, q
+WHERE users.search_vector @@ q.query
+  OR users.pii_tokens && $3::varchar[]
+  OR EXISTS (SELECT 1 FROM unnest($2::text[]) AS w WHERE w <% users.username)
+ORDER BY rank DESC, users.id DESC
+LIMIT $4
+`
+
+// Finds users by username (typos are tolerated) and by whole words of their full name, best match first
+func (store *Store) SearchUsers(ctx context.Context, query string, limit int32) ([]UserHit, error) {
+	terms := store.searchTerms(query)
+	if len(terms.words) == 0 {return []UserHit{}, nil}
+
+	rows, err := store.db.QueryContext(ctx, searchUsers, terms.tsquery, pq.Array(terms.words), pq.Array(terms.tokens), limit)
+	if err != nil {return nil, err}
+	defer rows.Close()
+
+	hits := []UserHit{}
+	for rows.Next() {
+		var hit UserHit
+		i := &hit.User
+		if err := rows.Scan(
+			&i.ID,
+			&i.Username,
+			&i.FullName,
+			&i.TotalOrders,
+			&i.CreatedAt,
+			&i.Role,
+			&i.Version,
+			&i.FullNameBidx,
+			&i.ErasedAt,
+			&i.UpdatedAt,
+			&hit.Rank,
+		); err != nil {
+			return nil, err
+		}
+		if hit.User, err = store.decryptUser(hit.User); err != nil {return nil, err}
+
+		hit.Highlights = map[string]string{}
+		highlightField(hit.Highlights, "username", hit.User.Username, terms.words)
+		highlightField(hit.Highlights, "full_name", hit.User.FullName, terms.words)
+		hits = append(hits, hit)
+	}
+	return hits, rows.Err()
+}
+
+const searchOrders = `
+WITH q AS (SELECT to_tsquery('english', $1) || to_tsquery('simple', $1) AS query)
+SELECT ` + orderColumns + `,
+  ts_rank(orders.search_vector, q.query)
+    + (SELECT coalesce(sum(word_similarity(w, orders.purchased_item)), 0) FROM unnest($2::text[]) AS w)
+    + (SELECT coalesce(sum(word_similarity(w, orders.username)), 0) FROM unnest($2::text[]) AS w)
+    + 0.5 * (SELECT count(*) FROM unnest(orders.pii_tokens) AS t WHERE t = ANY($3::varchar[])) AS rank,
+  ts_headline('english', ` + escapedPurchasedItem + `, q.query, 'StartSel=` + highlightStart + `, StopSel=` + highlightStop + `, HighlightAll=true') AS item_highlight
+FROM orders, q
+WHERE orders.search_vector @@ q.query
+  OR orders.pii_tokens && $3::varchar[]
+  OR EXISTS (SELECT 1 FROM unnest($2::text[]) AS w WHERE w <% orders.purchased_item OR w <% orders.username)
+ORDER BY rank DESC, orders.order_id DESC
+LIMIT $4
+`
+
+// Finds orders by purchased item and username (typos are tolerated) and by whole words
+// of the full name and shipping location, best match first
+func (store *Store) SearchOrders(ctx context.Context, query string, limit int32) ([]OrderHit, error) {
+	terms := store.searchTerms(query)
+	if len(terms.words) == 0 {return []OrderHit{}, nil}
+
+	rows, err := store.db.QueryContext(ctx, searchOrders, terms.tsquery, pq.Array(terms.words), pq.Array(terms.tokens), limit)
+	if err != nil {return nil, err}
+	defer rows.Close()
+
+	hits := []OrderHit{}
+	for rows.Next() {
+		var hit OrderHit
+		var itemHighlight string
+		i := &hit.Order
+		if err := rows.Scan(
+			&i.OrderID,
+			&i.AccountID,
+			&i.Username,
+			&i.FullName,
+			&i.PurchaseAmount,
+			&i.PurchasedItem,
+			&i.ShippingLocation,
+			&i.Currency,
+			&i.DateOrdered,
+			&i.Version,
+			&i.FullNameBidx,
+			&i.ShippingLocationBidx,
+			&i.CreatedAt,
+			&i.ExternalSource,
+			&i.ExternalID,
+			&i.UpdatedAt,
+			&hit.Rank,
+			&itemHighlight,
+		); err != nil {
+			return nil, err
+		}
+		if hit.Order, err = store.decryptOrder(hit.Order); err != nil {return nil, err}
+
+		hit.Highlights = map[string]string{}
+		if strings.Contains(itemHighlight, highlightStart) { // Stems are highlighted by the DB
+			hit.Highlights["purchased_item"] = itemHighlight
+		}
+		highlightField(hit.Highlights, "username", hit.Order.Username, terms.words)
+		highlightField(hit.Highlights, "full_name", hit.Order.FullName, terms.words)
+		highlightField(hit.Highlights, "shipping_location", hit.Order.ShippingLocation, terms.words)
+		hits = append(hits, hit)
+	}
+	return hits, rows.Err()
+}
+
+// Adds the field to the highlights if any of its words is one of the search words
+func highlightField(highlights map[string]string, field string, value string, words []string) {
+	if marked, ok := highlightWords(value, words); ok {
+		highlights[field] = marked
+	}
+}
+
+// Marks the words of the text that are search words, case is ignored, and escapes the rest
+func highlightWords(text string, words []string) (string, bool) {
+	wanted := make(map[string]bool, len(words))
+	for _, word := range words {
+		wanted[word] = true
+	}
+
+	var marked strings.Builder
+	found := false
+	var word []rune
+	flush := func() {
+		if len(word) == 0 {return}
+		if wanted[strings.ToLower(string(word))] {
+			found = true
+			marked.WriteString(highlightStart + string(word) + highlightStop)
+		} else {
+			marked.WriteString(string(word))
+		}
+		word = word[:0]
+	}
+
+	for _, r := range text {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) { // Separator, same as pii.Words
+			flush()
+			marked.WriteString(highlightEscaper.Replace(string(r)))
+		} else {
+			word = append(word, r)
+		}
+	}
+	flush()
+	return marked.String(), found
+}
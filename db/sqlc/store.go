@@ -5,20 +5,48 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"sort"
+	"time"
+
+	"github.com/samanthatb1/beadBashStorage/cache"
+	"github.com/samanthatb1/beadBashStorage/db/dberr"
+	"github.com/samanthatb1/beadBashStorage/pii"
 )
 
+// Returned when a row was changed since the client last read it (If-Match didn't match)
+var ErrVersionMismatch = dberr.NewConflict("version_mismatch", "The row was changed since it was read, fetch it again")
+
+// Whether a row at this version may be changed, any version may if none are expected
+func versionMatches(version int64, expected []int64) bool {
+	if len(expected) == 0 {
+		return true
+	}
+	for _, v := range expected {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// Replaces the customer's name and shipping locations when they ask to be forgotten
+const ErasedValue = "[erased]"
+
 // Queries only supports individual DB operation functions
 // Golang Composition: Extending Store to include Queries function plus it's own functions
 type Store struct {
 	*Queries
 	db *sql.DB // required to create a new DB transaction
+	cipher *pii.Cipher // encrypts PII columns, nil stores them in plain text
+	cache *cache.Cache // hot lookups, nil reads them from the DB every time (see cache_store.go)
 }
 
-func NewStore(db *sql.DB) *Store {
+func NewStore(db *sql.DB, cipher *pii.Cipher) *Store {
 	// Build the store object
 	return &Store{
 		db : db, // sql db
 		Queries: New(db), // Queries from ./db.go
+		cipher: cipher,
 	}
 }
 
@@ -35,17 +63,55 @@ func (store *Store) execTx(ctx context.Context, fn func(*Queries) error) error {
 	if err != nil {
 		// Rollback so that any DB actions are not commited
 		if rbErr := tx.Rollback(); rbErr != nil{
-			return fmt.Errorf("tx err: %v, rollbackk err: %v", err, rbErr)
+			return fmt.Errorf("tx err: %w, rollback err: %v", dberr.Translate(err), rbErr)
 		}
-		return err
+		return dberr.Translate(err) // Postgres errors become domain errors, e.g. a taken username
 	}
 
 	// If all operations within the transaction are succesful, commit the changes
-	return tx.Commit()
+	return dberr.Translate(tx.Commit())
 } 
 
 /********* TRANSACTIONS *********/
 
+/********* New User *********/
+
+type CreateUserTxParams struct {
+	FullName       string  `json:"full_name"`
+	Username       string  `json:"username"`
+	HashedPassword string  `json:"-"`
+}
+
+// Add new user -> Must store the user's credentials alongside the user
+func (store *Store) CreateUserTx(ctx context.Context, args CreateUserTxParams) (User, error){
+	var result User
+
+	// Begin Transaction
+	err := store.execTx(ctx, func(q *Queries) error{
+		// Create the user
+		userParams, err := store.encryptUserParams(CreateUserParams{
+			FullName: args.FullName,
+			Username: args.Username,
+			TotalOrders: 0, // New user defaults to 0 orders
+		})
+		if err != nil {return err}
+		user, err := q.CreateUser(ctx, userParams)
+		if err != nil {return err}
+
+		// Store the user's password hash
+		_, err = q.CreateCredential(ctx, CreateCredentialParams{
+			UserID: user.ID,
+			HashedPassword: args.HashedPassword,
+		})
+		if err != nil {return err}
+
+		result, err = store.decryptUser(user)
+		return err
+	})
+
+	return result, err
+}
+
 /********* New Order *********/
 
 type NewOrderTxParams struct {
@@ -58,109 +124,311 @@ type NewOrderTxParams struct {
 	DateOrdered      string  `json:"date_ordered"`
 }
 
-type newOrderResult struct {
+type NewOrderTxResult struct {
 	EditedUser User `json:"edited_user"`
 	OrderMade Order `json:"order_made"`
 }
 
 // Add new order -> Must handle if the user for that order exists or not
-func (store *Store) NewOrderTx(ctx context.Context, args NewOrderTxParams) (newOrderResult, error){
-	var result newOrderResult
+func (store *Store) NewOrderTx(ctx context.Context, args NewOrderTxParams) (NewOrderTxResult, error){
+	var result NewOrderTxResult
 
 	// Create a new DB transaction
 	err := store.execTx(ctx, func(q *Queries) error{
+		// Create the user or count the order on the existing one
+		user, err := store.addUserOrders(ctx, q, args.Username, args.FullName, 1)
+		if err != nil { return err }
+		result.EditedUser = user
+
+		// Create the new order
+		result.OrderMade, err = store.createOrderOf(ctx, q, user, args)
+		if err != nil { return err }
 
+		return store.publishOrderEvent(ctx, q, EventOrderCreated, result.OrderMade)
+	})
+	if err == nil {
+		store.forgetUsers(result.EditedUser)
+	}
+	// Return the new order and the updated user
+	return result, err
+}
+
+// Adds count orders to the user's total, creating the user if they don't exist yet
+// The total is increased in the UPDATE itself, so concurrent orders can't overwrite each other's count
+func (store *Store) addUserOrders(ctx context.Context, q *Queries, username string, fullName string, count int64) (User, error){
 	// Check to see if a user with the inputted username already exists
-	user, err := q.GetUserByUsername(ctx, args.Username)
-
-		// If User doesnt exist
-    if err == sql.ErrNoRows { 
-			newUser, err := q.CreateUser(ctx, CreateUserParams{
-				FullName: args.FullName,
-				Username: args.Username,
-				TotalOrders: 1,
-			})
-			if err != nil { return err }
-			// Set the user to the result
-			result.EditedUser = newUser
-
-		// If theres an Error
-    } else if err != nil{ 
-				return err
-
-		// User already exists
-    } else { 
-				// Increase users order number by 1
-				updatedUser, err := q.UpdateUser(ctx, UpdateUserParams{
-					ID: user.ID, 
-					TotalOrders: (user.TotalOrders + 1),
-				})
-				if err != nil {return err}
+	user, err := q.GetUserByUsername(ctx, username)
+
+	// If User doesnt exist
+	if err == sql.ErrNoRows {
+		userParams, err := store.encryptUserParams(CreateUserParams{
+			FullName: fullName,
+			Username: username,
+			TotalOrders: count,
+		})
+		if err != nil { return User{}, err }
+		user, err = q.CreateUser(ctx, userParams)
+		if err != nil { return User{}, err }
+		return store.decryptUser(user)
+	}
+	if err != nil { return User{}, err }
 
-				// Set the user to the result
-				result.EditedUser = updatedUser
-		}
+	// User already exists
+	user, err = q.AddUserOrders(ctx, AddUserOrdersParams{ID: user.ID, Count: count})
+	if err != nil { return User{}, err }
+	return store.decryptUser(user)
+}
+
+// Creates the order for an existing user, the order keeps the user's name
+func (store *Store) createOrderOf(ctx context.Context, q *Queries, user User, args NewOrderTxParams) (Order, error){
+	orderParams, err := store.encryptOrderParams(orderParamsOf(user, args))
+	if err != nil { return Order{}, err }
+	order, err := q.CreateOrder(ctx, orderParams)
+	if err != nil { return Order{}, err }
+	return store.decryptOrder(order)
+}
 
-	 // Create the new order
-	 order, err := q.CreateOrder(ctx, CreateOrderParams{
-		AccountID: result.EditedUser.ID,
-		Username: result.EditedUser.Username,
-		FullName: result.EditedUser.FullName,
+func orderParamsOf(user User, args NewOrderTxParams) CreateOrderParams {
+	return CreateOrderParams{
+		AccountID: user.ID,
+		Username: user.Username,
+		FullName: user.FullName,
 		PurchaseAmount: args.PurchaseAmount,
 		PurchasedItem: args.PurchasedItem,
 		ShippingLocation: args.ShippingLocation,
 		Currency: args.Currency,
 		DateOrdered: args.DateOrdered,
-	 })
-	 if err != nil{ return err }
+	}
+}
+
+/********* Batch of Orders *********/
 
-	 result.OrderMade = order
-	 return nil // No Error
+type BatchOrderTxResult struct {
+	Orders []Order `json:"orders"` // Same order as the params
+	EditedUsers []User `json:"edited_users"` // Every user the batch touched, with their final total_orders
+}
+
+// Returned by BatchOrderTx when one of the orders failed, Err is the domain error of that order
+type BatchOrderError struct {
+	Index int // Position of the order in the batch
+	Err error
+}
+
+func (e *BatchOrderError) Error() string {
+	return fmt.Sprintf("order %d: %v", e.Index, e.Err)
+}
+
+func (e *BatchOrderError) Unwrap() error {
+	return e.Err
+}
+
+// Adds every order or none of them
+// Each user's total_orders goes up once by the number of their orders
+func (store *Store) BatchOrderTx(ctx context.Context, orders []NewOrderTxParams) (BatchOrderTxResult, error){
+	var result BatchOrderTxResult
+
+	err := store.execTx(ctx, func(q *Queries) error{
+		users, editedUsers, err := store.addBatchUsers(ctx, q, orders)
+		if err != nil { return err }
+		result.EditedUsers = editedUsers
+
+		result.Orders = make([]Order, 0, len(orders))
+		for i, args := range orders {
+			order, err := store.createOrderOf(ctx, q, users[args.Username], args)
+			if err != nil {
+				return &BatchOrderError{Index: i, Err: dberr.Translate(err)}
+			}
+			result.Orders = append(result.Orders, order)
+		}
+
+		return store.publishOrderEvent(ctx, q, EventOrderCreated, result.Orders...)
 	})
-	// Return the new order and the updated user
+	if err != nil {
+		return BatchOrderTxResult{}, err
+	}
+	store.forgetUsers(result.EditedUsers...)
+	return result, nil
+}
+
+// Adds the orders to their users' totals, creating missing users with the name of their first order
+// Users are updated in username order so two batches for the same customers wait for each other instead of deadlocking
+// Returns the users by username and in username order, a failing user is a BatchOrderError with the index of their first order
+func (store *Store) addBatchUsers(ctx context.Context, q *Queries, orders []NewOrderTxParams) (map[string]User, []User, error){
+	firstIndex := map[string]int{}
+	counts := map[string]int64{}
+	for i, order := range orders {
+		if _, ok := firstIndex[order.Username]; !ok {
+			firstIndex[order.Username] = i
+		}
+		counts[order.Username]++
+	}
+	usernames := make([]string, 0, len(counts))
+	for username := range counts {
+		usernames = append(usernames, username)
+	}
+	sort.Strings(usernames)
+
+	users := map[string]User{}
+	edited := make([]User, 0, len(usernames))
+	for _, username := range usernames {
+		index := firstIndex[username]
+		user, err := store.addUserOrders(ctx, q, username, orders[index].FullName, counts[username])
+		if err != nil {
+			return nil, nil, &BatchOrderError{Index: index, Err: dberr.Translate(err)}
+		}
+		users[username] = user
+		edited = append(edited, user)
+	}
+	return users, edited, nil
+}
+
+/********* Patch Order *********/
+
+// Fields of an order to change, nil fields are kept
+type PatchOrderTxParams struct {
+	OrderID          int64    `json:"order_id"`
+	Versions         []int64  `json:"versions"` // Optional: only patch if the order is still at one of these versions
+	PurchaseAmount   *float64 `json:"purchase_amount"`
+	PurchasedItem    *string  `json:"purchased_item"`
+	Currency         *string  `json:"currency"`
+	DateOrdered      *string  `json:"date_ordered"`
+	FullName         *string  `json:"full_name"`
+	ShippingLocation *string  `json:"shipping_location"` // Empty clears it
+}
+
+func (args PatchOrderTxParams) isEmpty() bool {
+	return args.PurchaseAmount == nil && args.PurchasedItem == nil && args.Currency == nil &&
+		args.DateOrdered == nil && args.FullName == nil && args.ShippingLocation == nil
+}
+
+// Changes the given fields in one UPDATE, returns sql.ErrNoRows if the order doesn't exist
+// Search tokens cover the full name and the shipping location together, so if only one of them changes
+// the order is locked and read first to get the other one
+func (store *Store) PatchOrderTx(ctx context.Context, args PatchOrderTxParams) (Order, error){
+	var result Order
+
+	err := store.execTx(ctx, func(q *Queries) error{
+		// Nothing to change, the order is sent back as it is
+		if args.isEmpty() {
+			order, err := q.GetOrderById(ctx, args.OrderID)
+			if err != nil {return err}
+			if !versionMatches(order.Version, args.Versions) {return ErrVersionMismatch}
+			result, err = store.decryptOrder(order)
+			return err
+		}
+
+		params := PatchOrderParams{OrderID: args.OrderID, Versions: args.Versions}
+		if args.PurchaseAmount != nil {
+			params.PurchaseAmount = sql.NullFloat64{Float64: *args.PurchaseAmount, Valid: true}
+		}
+		params.PurchasedItem = nullString(args.PurchasedItem)
+		params.Currency = nullString(args.Currency)
+		params.DateOrdered = nullString(args.DateOrdered)
+
+		if args.FullName != nil || args.ShippingLocation != nil {
+			fullName, location := args.FullName, args.ShippingLocation
+			if fullName == nil || location == nil {
+				current, err := q.GetOrderForUpdate(ctx, args.OrderID)
+				if err != nil {return err}
+				if current, err = store.decryptOrder(current); err != nil {return err}
+				if fullName == nil {
+					fullName = &current.FullName
+				}
+				if location == nil {
+					location = &current.ShippingLocation
+				}
+			}
+			params.PiiTokens = store.cipher.WordTokens(*fullName, *location)
+
+			var err error
+			if args.FullName != nil {
+				params.FullNameBidx = sql.NullString{String: store.cipher.BlindIndex(*args.FullName), Valid: true}
+				if params.FullName.String, err = store.encryptPII(*args.FullName); err != nil {return err}
+				params.FullName.Valid = true
+			}
+			if args.ShippingLocation != nil {
+				params.ShippingLocationBidx = sql.NullString{String: store.cipher.BlindIndex(*args.ShippingLocation), Valid: true}
+				if params.ShippingLocation.String, err = store.encryptPII(*args.ShippingLocation); err != nil {return err}
+				params.ShippingLocation.Valid = true
+			}
+		}
+
+		order, err := q.PatchOrder(ctx, params)
+		if err == sql.ErrNoRows {
+			// Either the order is gone or it's at another version
+			if _, err := q.GetOrderById(ctx, args.OrderID); err != nil {return err}
+			return ErrVersionMismatch
+		}
+		if err != nil {return err}
+
+		result, err = store.decryptOrder(order)
+		if err != nil {return err}
+		return store.publishOrderEvent(ctx, q, EventOrderUpdated, result)
+	})
+	if err == nil {
+		store.forgetOrders(result)
+	}
+
 	return result, err
 }
 
+func nullString(value *string) sql.NullString {
+	if value == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: *value, Valid: true}
+}
+
 /********* Delete Order *********/
 
 type DeleteOrderTxParams struct {
 	OrderID        int64   `json:"order_id"`
+	Versions       []int64 `json:"versions"` // Optional: only delete if the order is still at one of these versions
 }
 
-type deleteOrderResult struct {
+type DeleteOrderTxResult struct {
 	Status string `json:"deletion_status"`
 	DeletedItem string `json:"deleted_item"`
 }
 
 // Order is deleted -> Must update the associated user information
-func (store *Store) DeleteOrderTx(ctx context.Context, args DeleteOrderTxParams) (deleteOrderResult, error){
-	var result deleteOrderResult
+func (store *Store) DeleteOrderTx(ctx context.Context, args DeleteOrderTxParams) (DeleteOrderTxResult, error){
+	var result DeleteOrderTxResult
+	var deletedOrder Order
+	var owner User // Their total_orders goes down
 
 	// Begin Transaction
 	err := store.execTx(ctx, func(q *Queries) error{
-		// Make sure the order exists before deleting it
-		order, err := q.GetOrderById(ctx, args.OrderID)
-		if err == sql.ErrNoRows { return err }
+		// Make sure the order exists before deleting it, lock it so it can't change in the meantime
+		order, err := q.GetOrderForUpdate(ctx, args.OrderID)
+		if err != nil { return err }
+		if !versionMatches(order.Version, args.Versions) { return ErrVersionMismatch }
 
 		// Delete the order
 		err = q.DeleteOrder(ctx, order.OrderID)
 		if err != nil {return err}
 
-		// Get the corresponding user
-		user, err := q.GetUserById(ctx, order.AccountID)
+		// Decrease the total orders of the corresponding user in place, so orders made meanwhile aren't lost
+		user, err := q.AddUserOrders(ctx, AddUserOrdersParams{ID: order.AccountID, Count: -1})
+		if err == sql.ErrNoRows { // Every order has one
+			return dberr.NewInvariant("order_without_user", fmt.Sprintf("order %d belongs to user %d, who doesn't exist", order.OrderID, order.AccountID))
+		}
 		if err != nil {return err}
+		deletedOrder, owner = order, user
 
-		// Decrease user's total order amount
-		_, err = q.UpdateUser(ctx, UpdateUserParams{
-			ID : user.ID, 
-			TotalOrders: (user.TotalOrders - 1),
-		})
+		// Subscribers get the order as it was
+		deleted, err := store.decryptOrder(order)
 		if err != nil {return err}
+		if err = store.publishOrderEvent(ctx, q, EventOrderDeleted, deleted); err != nil {return err}
 
 		result.DeletedItem = order.PurchasedItem
 		result.Status = "Deleted"
 		return nil // No Error
 	})
+	if err == nil {
+		store.forgetOrders(deletedOrder)
+		store.forgetUsers(owner)
+	}
 
 	return result, err
 }
@@ -169,36 +437,338 @@ func (store *Store) DeleteOrderTx(ctx context.Context, args DeleteOrderTxParams)
 
 type DeleteUserTxParams struct {
 	ID        int64   `json:"id"`
+	Versions  []int64 `json:"versions"` // Optional: only delete if the user is still at one of these versions
 }
 
-type deleteUserResult struct {
+type DeleteUserTxResult struct {
 	Status string `json:"deletion_status"`
 }
 
 // User is deleted -> Must update the associated user information
-func (store *Store) DeleteUserTx(ctx context.Context, args DeleteUserTxParams) (deleteUserResult, error){
-	var result deleteUserResult
+func (store *Store) DeleteUserTx(ctx context.Context, args DeleteUserTxParams) (DeleteUserTxResult, error){
+	var result DeleteUserTxResult
+	var deletedUser User
+	var deletedOrders []Order
 
 	// Begin Transaction
 	err := store.execTx(ctx, func(q *Queries) error{
-		// Make sure the user exists before deleting it
-		user, err := q.GetUserById(ctx, args.ID)
-		if err == sql.ErrNoRows { 
+		// Make sure the user exists before deleting it, lock it so it can't change in the meantime
+		user, err := q.GetUserForUpdate(ctx, args.ID)
+		if err != nil {
 			return err
 		}
+		if !versionMatches(user.Version, args.Versions) { return ErrVersionMismatch }
 
 		// Delete all orders that correspond to that user
-		err = q.DeleteAllOrderFromUser(ctx, user.Username)
+		orders, err := q.DeleteAllOrderFromUser(ctx, user.Username)
 		if err != nil {return err}
+		deletedUser, deletedOrders = user, orders
 
 		// Delete User
 		err = q.DeleteUser(ctx, user.Username)
 		if err != nil {return err}
 
+		// Subscribers get the user as they were
+		deleted, err := store.decryptUser(user)
+		if err != nil {return err}
+		if err = store.queueWebhookEvent(ctx, q, EventUserDeleted, deleted); err != nil {return err}
+
+		// The live feed only has orders, so it gets each of the user's orders
+		feedOrders, err := store.decryptOrders(orders)
+		if err != nil {return err}
+		if err = store.recordOrderEvents(ctx, q, EventOrderDeleted, feedOrders...); err != nil {return err}
+
 		// Send Result
 		result.Status = "Deleted"
 		return nil // No Error
 	})
+	if err == nil {
+		store.forgetUsers(deletedUser)
+		store.forgetOrders(deletedOrders...)
+	}
 
 	return result, err
-}
\ No newline at end of file
+}
+
+/********* Tag User *********/
+
+type UserTagTxParams struct {
+	UserID        int64   `json:"user_id"`
+	TagName       string  `json:"tag_name"`
+}
+
+type userTagResult struct {
+	User User `json:"user"`
+	Tags []Tag `json:"tags"`
+}
+
+// Tag is added to a user -> Must create the tag if it doesn't exist yet
+func (store *Store) AddUserTagTx(ctx context.Context, args UserTagTxParams) (userTagResult, error){
+	var result userTagResult
+
+	// Begin Transaction
+	err := store.execTx(ctx, func(q *Queries) error{
+		// Make sure the user exists before tagging it
+		user, err := q.GetUserById(ctx, args.UserID)
+		if err != nil {return err}
+
+		// Get the tag, creating it the first time it's used
+		tag, err := q.UpsertTag(ctx, args.TagName)
+		if err != nil {return err}
+
+		// Link the tag to the user (no-op if already linked)
+		err = q.AddUserTag(ctx, AddUserTagParams{UserID: user.ID, TagID: tag.ID})
+		if err != nil {return err}
+
+		// Send Result
+		result.User, err = store.decryptUser(user)
+		if err != nil {return err}
+		result.Tags, err = q.ListTagsOfUser(ctx, user.ID)
+		return err
+	})
+
+	return result, err
+}
+
+// Tag is removed from a user -> The tag itself is kept for other users and orders
+func (store *Store) RemoveUserTagTx(ctx context.Context, args UserTagTxParams) (userTagResult, error){
+	var result userTagResult
+
+	// Begin Transaction
+	err := store.execTx(ctx, func(q *Queries) error{
+		// Make sure the user and the tag exist
+		user, err := q.GetUserById(ctx, args.UserID)
+		if err != nil {return dberr.NotFoundOr(err, "user_not_found", "User doesn't exist")}
+		tag, err := q.GetTagByName(ctx, args.TagName)
+		if err != nil {return dberr.NotFoundOr(err, "tag_not_found", "Tag doesn't exist")}
+
+		// Unlink the tag from the user
+		err = q.RemoveUserTag(ctx, RemoveUserTagParams{UserID: user.ID, TagID: tag.ID})
+		if err != nil {return err}
+
+		// Send Result
+		result.User, err = store.decryptUser(user)
+		if err != nil {return err}
+		result.Tags, err = q.ListTagsOfUser(ctx, user.ID)
+		return err
+	})
+
+	return result, err
+}
+
+/********* Tag Order *********/
+
+type OrderTagTxParams struct {
+	OrderID       int64   `json:"order_id"`
+	TagName       string  `json:"tag_name"`
+}
+
+type orderTagResult struct {
+	Order Order `json:"order"`
+	Tags []Tag `json:"tags"`
+}
+
+// Tag is added to an order -> Must create the tag if it doesn't exist yet
+func (store *Store) AddOrderTagTx(ctx context.Context, args OrderTagTxParams) (orderTagResult, error){
+	var result orderTagResult
+
+	// Begin Transaction
+	err := store.execTx(ctx, func(q *Queries) error{
+		// Make sure the order exists before tagging it
+		order, err := q.GetOrderById(ctx, args.OrderID)
+		if err != nil {return err}
+
+		// Get the tag, creating it the first time it's used
+		tag, err := q.UpsertTag(ctx, args.TagName)
+		if err != nil {return err}
+
+		// Link the tag to the order (no-op if already linked)
+		err = q.AddOrderTag(ctx, AddOrderTagParams{OrderID: order.OrderID, TagID: tag.ID})
+		if err != nil {return err}
+
+		// Send Result
+		result.Order, err = store.decryptOrder(order)
+		if err != nil {return err}
+		result.Tags, err = q.ListTagsOfOrder(ctx, order.OrderID)
+		return err
+	})
+
+	return result, err
+}
+
+// Tag is removed from an order -> The tag itself is kept for other users and orders
+func (store *Store) RemoveOrderTagTx(ctx context.Context, args OrderTagTxParams) (orderTagResult, error){
+	var result orderTagResult
+
+	// Begin Transaction
+	err := store.execTx(ctx, func(q *Queries) error{
+		// Make sure the order and the tag exist
+		order, err := q.GetOrderById(ctx, args.OrderID)
+		if err != nil {return dberr.NotFoundOr(err, "order_not_found", "Order doesn't exist")}
+		tag, err := q.GetTagByName(ctx, args.TagName)
+		if err != nil {return dberr.NotFoundOr(err, "tag_not_found", "Tag doesn't exist")}
+
+		// Unlink the tag from the order
+		err = q.RemoveOrderTag(ctx, RemoveOrderTagParams{OrderID: order.OrderID, TagID: tag.ID})
+		if err != nil {return err}
+
+		// Send Result
+		result.Order, err = store.decryptOrder(order)
+		if err != nil {return err}
+		result.Tags, err = q.ListTagsOfOrder(ctx, order.OrderID)
+		return err
+	})
+
+	return result, err
+}
+
+/********* Export User Data *********/
+
+type orderExport struct {
+	Order
+	Tags []Tag `json:"tags"`
+}
+
+// Sessions without the refresh token
+type sessionExport struct {
+	ID        string    `json:"id"`
+	UserAgent string    `json:"user_agent"`
+	ClientIP  string    `json:"client_ip"`
+	IsBlocked bool      `json:"is_blocked"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Credentials without the password hash
+type credentialExport struct {
+	PasswordChangedAt time.Time `json:"password_changed_at"`
+	CreatedAt         time.Time `json:"created_at"`
+}
+
+type UserDataExport struct {
+	User        User               `json:"user"`
+	Orders      []orderExport      `json:"orders"`
+	Tags        []Tag              `json:"tags"`
+	Sessions    []sessionExport    `json:"sessions"`
+	Credential  *credentialExport  `json:"credential"` // nil if the user never set a password
+}
+
+// Customer asks for their data -> Collect everything stored about them in one consistent read
+func (store *Store) ExportUserDataTx(ctx context.Context, userID int64) (UserDataExport, error){
+	var result UserDataExport
+
+	// Begin Transaction
+	err := store.execTx(ctx, func(q *Queries) error{
+		user, err := q.GetUserById(ctx, userID)
+		if err != nil {return err}
+		if result.User, err = store.decryptUser(user); err != nil {return err}
+
+		// Orders with their tags
+		orders, err := q.ListOrdersByUsername(ctx, user.Username)
+		if err != nil {return err}
+		if orders, err = store.decryptOrders(orders); err != nil {return err}
+		result.Orders = make([]orderExport, len(orders))
+		for i, order := range orders {
+			tags, err := q.ListTagsOfOrder(ctx, order.OrderID)
+			if err != nil {return err}
+			result.Orders[i] = orderExport{Order: order, Tags: tags}
+		}
+
+		if result.Tags, err = q.ListTagsOfUser(ctx, user.ID); err != nil {return err}
+
+		sessions, err := q.ListSessionsOfUser(ctx, user.ID)
+		if err != nil {return err}
+		result.Sessions = make([]sessionExport, len(sessions))
+		for i, session := range sessions {
+			result.Sessions[i] = sessionExport{
+				ID: session.ID.String(),
+				UserAgent: session.UserAgent,
+				ClientIP: session.ClientIp,
+				IsBlocked: session.IsBlocked,
+				ExpiresAt: session.ExpiresAt,
+				CreatedAt: session.CreatedAt,
+			}
+		}
+
+		credential, err := q.GetCredential(ctx, user.ID)
+		if err == nil {
+			result.Credential = &credentialExport{PasswordChangedAt: credential.PasswordChangedAt, CreatedAt: credential.CreatedAt}
+		} else if err != sql.ErrNoRows {
+			return err
+		}
+
+		return nil // No Error
+	})
+
+	return result, err
+}
+
+/********* Erase User *********/
+
+type EraseUserTxParams struct {
+	ID        int64   `json:"id"`
+	Versions  []int64 `json:"versions"` // Optional: only erase if the user is still at one of these versions
+}
+
+type eraseUserResult struct {
+	Status string `json:"erasure_status"`
+	User User `json:"user"`
+	OrdersErased int64 `json:"orders_erased"`
+}
+
+// Customer asks to be forgotten -> Remove their PII but keep their orders' amounts and dates for accounting
+func (store *Store) EraseUserTx(ctx context.Context, args EraseUserTxParams) (eraseUserResult, error){
+	var result eraseUserResult
+
+	// Begin Transaction
+	err := store.execTx(ctx, func(q *Queries) error{
+		// Lock the user so nothing is added while it's erased
+		user, err := q.GetUserForUpdate(ctx, args.ID)
+		if err != nil {return err}
+		if !versionMatches(user.Version, args.Versions) { return ErrVersionMismatch }
+
+		erased, err := store.cipher.Encrypt(ErasedValue)
+		if err != nil {return err}
+		erasedBidx := store.cipher.BlindIndex(ErasedValue)
+		e := erasure{userID: user.ID, username: user.Username, erasedUsername: fmt.Sprintf("erased-%d", user.ID)}
+
+		// Orders keep their amounts, items and dates, follow the new username through the foreign key
+		result.OrdersErased, err = q.EraseOrdersOfUser(ctx, EraseOrdersOfUserParams{
+			AccountID: user.ID,
+			FullName: erased,
+			FullNameBidx: erasedBidx,
+			ShippingLocation: erased,
+			ShippingLocationBidx: erasedBidx,
+		})
+		if err != nil {return err}
+
+		// The username identifies the customer too
+		erasedUser, err := q.EraseUser(ctx, EraseUserParams{
+			ID: user.ID,
+			Username: e.erasedUsername,
+			FullName: erased,
+			FullNameBidx: erasedBidx,
+		})
+		if err != nil {return err}
+
+		// Nothing left to log in with
+		if err = q.DeleteCredential(ctx, user.ID); err != nil {return err}
+		if err = q.DeleteSessionsOfUser(ctx, user.ID); err != nil {return err}
+		if err = q.RemoveAllUserTags(ctx, user.ID); err != nil {return err}
+
+		// Copies of their PII kept as JSON
+		if err = store.eraseIdempotencyKeys(ctx, q, e); err != nil {return err}
+		if err = store.eraseWebhookDeliveries(ctx, q, e); err != nil {return err}
+		if err = store.eraseOrderEvents(ctx, q, e); err != nil {return err}
+
+		// Send Result
+		result.Status = "Erased"
+		result.User, err = store.decryptUser(erasedUser)
+		return err
+	})
+	if err == nil {
+		store.cache.Clear() // The user's orders changed too, and erasing is rare
+	}
+
+	return result, err
+}
@@ -0,0 +1,93 @@
+// Unit tests for API keys
+
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	sqlc "github.com/samanthatb1/beadBashStorage/db/sqlc"
+	"github.com/samanthatb1/beadBashStorage/util"
+	"github.com/stretchr/testify/require"
+)
+
+/* Helper Functions */
+
+func createRandomApiKey(t *testing.T) sqlc.ApiKey {
+	key, prefix, err := util.GenerateAPIKey()
+	require.NoError(t, err)
+
+	apiKeyParams := sqlc.CreateApiKeyParams{
+		Name: util.RandomLongString(),
+		KeyPrefix: prefix,
+		HashedKey: util.HashAPIKey(key),
+		Scopes: []string{util.OrdersReadScope, util.OrdersWriteScope},
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+
+	apiKey, err := testQueries.CreateApiKey(context.Background(), apiKeyParams)
+	require.NoError(t, err)
+	require.NotZero(t, apiKey.ID)
+	require.Equal(t, apiKeyParams.Name, apiKey.Name)
+	require.Equal(t, apiKeyParams.KeyPrefix, apiKey.KeyPrefix)
+	require.Equal(t, apiKeyParams.HashedKey, apiKey.HashedKey)
+	require.Equal(t, apiKeyParams.Scopes, apiKey.Scopes)
+	require.WithinDuration(t, apiKeyParams.ExpiresAt, apiKey.ExpiresAt, time.Second)
+	require.False(t, apiKey.LastUsedAt.Valid)
+	require.False(t, apiKey.RevokedAt.Valid)
+
+	return apiKey
+}
+
+/* Test Functions */
+
+// Test Scenario: create a key and look it up by its hash
+func TestGetApiKeyByHash(t *testing.T){
+	apiKey := createRandomApiKey(t)
+
+	fetchedKey, err := testQueries.GetApiKeyByHash(context.Background(), apiKey.HashedKey)
+	require.NoError(t, err)
+	require.Equal(t, apiKey.ID, fetchedKey.ID)
+	require.Equal(t, apiKey.Scopes, fetchedKey.Scopes)
+
+	_, err = testQueries.GetApiKeyByHash(context.Background(), util.HashAPIKey(util.RandomLongString()))
+	require.EqualError(t, err, sql.ErrNoRows.Error())
+}
+
+// Test Scenario: using a key records when it was last used
+func TestTouchApiKey(t *testing.T){
+	apiKey := createRandomApiKey(t)
+
+	err := testQueries.TouchApiKey(context.Background(), apiKey.ID)
+	require.NoError(t, err)
+
+	fetchedKey, err := testQueries.GetApiKeyByHash(context.Background(), apiKey.HashedKey)
+	require.NoError(t, err)
+	require.True(t, fetchedKey.LastUsedAt.Valid)
+	require.WithinDuration(t, time.Now(), fetchedKey.LastUsedAt.Time, time.Minute)
+}
+
+// Test Scenario: keys can only be revoked once and stay listed
+func TestRevokeApiKey(t *testing.T){
+	apiKey := createRandomApiKey(t)
+
+	revokedKey, err := testQueries.RevokeApiKey(context.Background(), apiKey.ID)
+	require.NoError(t, err)
+	require.True(t, revokedKey.RevokedAt.Valid)
+
+	_, err = testQueries.RevokeApiKey(context.Background(), apiKey.ID)
+	require.EqualError(t, err, sql.ErrNoRows.Error())
+
+	apiKeys, err := testQueries.ListApiKeys(context.Background())
+	require.NoError(t, err)
+	found := false
+	for _, key := range apiKeys {
+		if key.ID == apiKey.ID {
+			found = true
+			require.True(t, key.RevokedAt.Valid)
+		}
+	}
+	require.True(t, found)
+}
@@ -0,0 +1,65 @@
+// Unit tests for the store's cached lookups
+
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/samanthatb1/beadBashStorage/cache"
+	sqlc "github.com/samanthatb1/beadBashStorage/db/sqlc"
+	"github.com/samanthatb1/beadBashStorage/util"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Scenario: cached lookups see the store's own writes, and the write bumps updated_at
+func TestCachedLookupsTx(t *testing.T){
+	store := sqlc.NewStore(testDB, nil)
+	store.SetCache(cache.New(time.Minute, 100))
+	user := createRandomUser(t)
+
+	// Both keys are cached by one lookup
+	cached, err := store.GetUserByUsername(context.Background(), user.Username)
+	require.NoError(t, err)
+	byId, err := store.GetUserById(context.Background(), user.ID)
+	require.NoError(t, err)
+	require.Equal(t, cached, byId)
+
+	// A new order bumps the user
+	result, err := store.NewOrderTx(context.Background(), sqlc.NewOrderTxParams{
+		Username: user.Username,
+		FullName: user.FullName,
+		PurchaseAmount: util.RandomCost(),
+		PurchasedItem: util.RandomLongString(),
+		ShippingLocation: util.RandomLongString(),
+		Currency: "USD",
+		DateOrdered: "2022-10-15",
+	})
+	require.NoError(t, err)
+	fresh, err := store.GetUserByUsername(context.Background(), user.Username)
+	require.NoError(t, err)
+	require.Equal(t, cached.TotalOrders + 1, fresh.TotalOrders)
+	require.Equal(t, cached.Version + 1, fresh.Version)
+	require.True(t, fresh.UpdatedAt.After(cached.UpdatedAt))
+
+	// Patching the order
+	order, err := store.GetOrderById(context.Background(), result.OrderMade.OrderID)
+	require.NoError(t, err)
+	currency := "CAD"
+	_, err = store.PatchOrderTx(context.Background(), sqlc.PatchOrderTxParams{OrderID: order.OrderID, Currency: &currency})
+	require.NoError(t, err)
+	patched, err := store.GetOrderById(context.Background(), order.OrderID)
+	require.NoError(t, err)
+	require.Equal(t, "CAD", patched.Currency)
+	require.True(t, patched.UpdatedAt.After(order.UpdatedAt))
+
+	// Deleting the user and their orders
+	_, err = store.DeleteUserTx(context.Background(), sqlc.DeleteUserTxParams{ID: user.ID})
+	require.NoError(t, err)
+	_, err = store.GetUserById(context.Background(), user.ID)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	_, err = store.GetOrderById(context.Background(), order.OrderID)
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
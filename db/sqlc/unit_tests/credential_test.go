@@ -0,0 +1,62 @@
+// Unit tests for user credentials
+
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	sqlc "github.com/samanthatb1/beadBashStorage/db/sqlc"
+	"github.com/samanthatb1/beadBashStorage/util"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Scenario: store and fetch a user's password hash
+func TestCreateCredential(t *testing.T){
+	user := createRandomUser(t)
+	hashedPassword, err := util.HashPassword(util.RandomLongString())
+	require.NoError(t, err)
+
+	credential, err := testQueries.CreateCredential(context.Background(), sqlc.CreateCredentialParams{
+		UserID: user.ID,
+		HashedPassword: hashedPassword,
+	})
+	require.NoError(t, err)
+	require.Equal(t, user.ID, credential.UserID)
+	require.Equal(t, hashedPassword, credential.HashedPassword)
+	require.True(t, credential.PasswordChangedAt.IsZero())
+	require.NotZero(t, credential.CreatedAt)
+
+	fetchedCredential, err := testQueries.GetCredential(context.Background(), user.ID)
+	require.NoError(t, err)
+	require.Equal(t, credential.HashedPassword, fetchedCredential.HashedPassword)
+}
+
+// Test Scenario: users created through an order have no credentials
+func TestMissingCredential(t *testing.T){
+	user := createRandomUser(t)
+
+	_, err := testQueries.GetCredential(context.Background(), user.ID)
+	require.EqualError(t, err, sql.ErrNoRows.Error())
+}
+
+// Test Scenario: creating a user with a password stores both rows
+func TestCreateUserTx(t *testing.T){
+	store := sqlc.NewStore(testDB, nil)
+	hashedPassword, err := util.HashPassword(util.RandomLongString())
+	require.NoError(t, err)
+
+	user, err := store.CreateUserTx(context.Background(), sqlc.CreateUserTxParams{
+		FullName: util.RandomLongString(),
+		Username: util.RandomLongString(),
+		HashedPassword: hashedPassword,
+	})
+	require.NoError(t, err)
+	require.NotZero(t, user.ID)
+	require.Zero(t, user.TotalOrders)
+
+	credential, err := testQueries.GetCredential(context.Background(), user.ID)
+	require.NoError(t, err)
+	require.Equal(t, hashedPassword, credential.HashedPassword)
+}
@@ -0,0 +1,82 @@
+// Unit tests for streaming users and orders to exports
+
+package tests
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	sqlc "github.com/samanthatb1/beadBashStorage/db/sqlc"
+	"github.com/samanthatb1/beadBashStorage/util"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Scenario: every order matching the filter is streamed in id order
+func TestStreamOrders(t *testing.T){
+	store := sqlc.NewStore(testDB, nil)
+	user := createRandomUser(t)
+	item := util.RandomLongString() // Only the orders made here match
+
+	var ids []int64
+	for _, amount := range []float64{30, 10, 20} {
+		order, err := testQueries.CreateOrder(context.Background(), sqlc.CreateOrderParams{
+			AccountID: user.ID,
+			Username: user.Username,
+			FullName: user.FullName,
+			PurchaseAmount: amount,
+			PurchasedItem: item,
+			ShippingLocation: "Halifax",
+			Currency: "CAD",
+			DateOrdered: util.RandomLongString(),
+		})
+		require.NoError(t, err)
+		ids = append(ids, order.OrderID)
+	}
+
+	var streamed []int64
+	err := store.StreamOrders(context.Background(), sqlc.OrderFilter{Item: item, MinAmount: 15}, func(order sqlc.Order) error {
+		require.Equal(t, user.FullName, order.FullName)
+		streamed = append(streamed, order.OrderID)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []int64{ids[0], ids[2]}, streamed)
+
+	// The callback's error stops the stream
+	calls := 0
+	stop := errors.New("client went away")
+	err = store.StreamOrders(context.Background(), sqlc.OrderFilter{Item: item}, func(order sqlc.Order) error {
+		calls++
+		return stop
+	})
+	require.ErrorIs(t, err, stop)
+	require.Equal(t, 1, calls)
+}
+
+// Test Scenario: users with the tag are streamed, decrypted
+func TestStreamUsers(t *testing.T){
+	store := newEncryptedStore(t)
+	tagName := util.RandomLongString()
+
+	var usernames []string
+	for i := 0; i < 2; i++ {
+		user, err := store.CreateUser(context.Background(), sqlc.CreateUserParams{
+			Username: util.RandomLongString(),
+			FullName: "Jane Doe",
+		})
+		require.NoError(t, err)
+		_, err = store.AddUserTagTx(context.Background(), sqlc.UserTagTxParams{UserID: user.ID, TagName: tagName})
+		require.NoError(t, err)
+		usernames = append(usernames, user.Username)
+	}
+
+	var streamed []string
+	err := store.StreamUsers(context.Background(), sqlc.UserFilter{Tag: tagName}, func(user sqlc.User) error {
+		require.Equal(t, "Jane Doe", user.FullName)
+		streamed = append(streamed, user.Username)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, usernames, streamed)
+}
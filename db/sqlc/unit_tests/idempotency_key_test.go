@@ -0,0 +1,141 @@
+// Unit tests for idempotency keys
+
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"testing"
+	"time"
+
+	sqlc "github.com/samanthatb1/beadBashStorage/db/sqlc"
+	"github.com/samanthatb1/beadBashStorage/util"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Scenario: a key can only be claimed once per owner, then holds the response
+func TestIdempotencyKey(t *testing.T){
+	args := sqlc.CreateIdempotencyKeyParams{
+		Owner: "user:" + util.RandomLongString(),
+		Key: util.RandomLongString(),
+		RequestHash: util.HashAPIKey(util.RandomLongString()),
+		ExpiresAt: time.Now().Add(time.Hour),
+		LockedUntil: time.Now().Add(time.Minute),
+	}
+
+	claimed, err := testQueries.CreateIdempotencyKey(context.Background(), args)
+	require.NoError(t, err)
+	require.Equal(t, args.RequestHash, claimed.RequestHash)
+	require.Zero(t, claimed.ResponseStatus) // Still in progress
+
+	// Second claim of the same key fails
+	_, err = testQueries.CreateIdempotencyKey(context.Background(), args)
+	require.EqualError(t, err, sql.ErrNoRows.Error())
+
+	// Same key from another owner is a different key
+	otherOwner := args
+	otherOwner.Owner = "apikey:1" + util.RandomLongString()
+	_, err = testQueries.CreateIdempotencyKey(context.Background(), otherOwner)
+	require.NoError(t, err)
+
+	// Save the response
+	body := json.RawMessage(`{"order_made":{"order_id":1}}`)
+	err = testQueries.CompleteIdempotencyKey(context.Background(), sqlc.CompleteIdempotencyKeyParams{
+		Owner: args.Owner,
+		Key: args.Key,
+		ResponseStatus: 200,
+		ResponseBody: body,
+		ResponseHeaders: json.RawMessage(`{"ETag": "\"1\""}`),
+	})
+	require.NoError(t, err)
+
+	saved, err := testQueries.GetIdempotencyKey(context.Background(), sqlc.GetIdempotencyKeyParams{Owner: args.Owner, Key: args.Key})
+	require.NoError(t, err)
+	require.Equal(t, int32(200), saved.ResponseStatus)
+	require.JSONEq(t, string(body), string(saved.ResponseBody))
+	require.JSONEq(t, `{"ETag": "\"1\""}`, string(saved.ResponseHeaders))
+
+	// Deleted keys can be claimed again
+	err = testQueries.DeleteIdempotencyKey(context.Background(), sqlc.DeleteIdempotencyKeyParams{Owner: args.Owner, Key: args.Key})
+	require.NoError(t, err)
+	_, err = testQueries.CreateIdempotencyKey(context.Background(), args)
+	require.NoError(t, err)
+}
+
+// Test Scenario: expired keys are purged, live ones are kept
+func TestDeleteExpiredIdempotencyKeys(t *testing.T){
+	owner := "user:" + util.RandomLongString()
+	expired := sqlc.CreateIdempotencyKeyParams{Owner: owner, Key: util.RandomLongString(), RequestHash: "hash", ExpiresAt: time.Now().Add(-time.Minute)}
+	live := sqlc.CreateIdempotencyKeyParams{Owner: owner, Key: util.RandomLongString(), RequestHash: "hash", ExpiresAt: time.Now().Add(time.Hour)}
+	for _, args := range []sqlc.CreateIdempotencyKeyParams{expired, live} {
+		_, err := testQueries.CreateIdempotencyKey(context.Background(), args)
+		require.NoError(t, err)
+	}
+
+	purged, err := testQueries.DeleteExpiredIdempotencyKeys(context.Background(), time.Now())
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, purged, int64(1))
+
+	_, err = testQueries.GetIdempotencyKey(context.Background(), sqlc.GetIdempotencyKeyParams{Owner: owner, Key: expired.Key})
+	require.EqualError(t, err, sql.ErrNoRows.Error())
+	_, err = testQueries.GetIdempotencyKey(context.Background(), sqlc.GetIdempotencyKeyParams{Owner: owner, Key: live.Key})
+	require.NoError(t, err)
+}
+
+// Test Scenario: an unfinished claim can only be taken over by the same request once its lease ran out
+func TestTakeOverIdempotencyKey(t *testing.T){
+	args := sqlc.CreateIdempotencyKeyParams{
+		Owner: "user:" + util.RandomLongString(),
+		Key: util.RandomLongString(),
+		RequestHash: util.HashAPIKey(util.RandomLongString()),
+		ExpiresAt: time.Now().Add(time.Hour),
+		LockedUntil: time.Now().Add(time.Minute),
+	}
+	_, err := testQueries.CreateIdempotencyKey(context.Background(), args)
+	require.NoError(t, err)
+
+	takeOver := sqlc.TakeOverIdempotencyKeyParams{
+		Owner: args.Owner,
+		Key: args.Key,
+		RequestHash: args.RequestHash,
+		LockedUntil: time.Now().Add(time.Minute),
+	}
+
+	// Still leased
+	_, err = testQueries.TakeOverIdempotencyKey(context.Background(), takeOver)
+	require.EqualError(t, err, sql.ErrNoRows.Error())
+
+	// Lease ran out, as if the server died mid-request
+	args.Key = util.RandomLongString()
+	args.LockedUntil = time.Now().Add(-time.Minute)
+	_, err = testQueries.CreateIdempotencyKey(context.Background(), args)
+	require.NoError(t, err)
+	takeOver.Key = args.Key
+
+	// A different request can't take it
+	other := takeOver
+	other.RequestHash = util.HashAPIKey(util.RandomLongString())
+	_, err = testQueries.TakeOverIdempotencyKey(context.Background(), other)
+	require.EqualError(t, err, sql.ErrNoRows.Error())
+
+	taken, err := testQueries.TakeOverIdempotencyKey(context.Background(), takeOver)
+	require.NoError(t, err)
+	require.WithinDuration(t, takeOver.LockedUntil, taken.LockedUntil, time.Second)
+
+	// Only one retry wins
+	_, err = testQueries.TakeOverIdempotencyKey(context.Background(), takeOver)
+	require.EqualError(t, err, sql.ErrNoRows.Error())
+
+	// Finished keys are never taken over
+	err = testQueries.CompleteIdempotencyKey(context.Background(), sqlc.CompleteIdempotencyKeyParams{
+		Owner: args.Owner,
+		Key: args.Key,
+		ResponseStatus: 201,
+		ResponseBody: json.RawMessage(`{}`),
+		ResponseHeaders: json.RawMessage(`{}`),
+	})
+	require.NoError(t, err)
+	_, err = testQueries.TakeOverIdempotencyKey(context.Background(), takeOver)
+	require.EqualError(t, err, sql.ErrNoRows.Error())
+}
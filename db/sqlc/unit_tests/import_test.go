@@ -0,0 +1,82 @@
+// Unit tests for importing orders from other shops' exports
+
+package tests
+
+import (
+	"context"
+	"testing"
+
+	sqlc "github.com/samanthatb1/beadBashStorage/db/sqlc"
+	"github.com/samanthatb1/beadBashStorage/util"
+	"github.com/stretchr/testify/require"
+)
+
+/* Helper Functions */
+
+func randomImportedOrder(username string) sqlc.ImportedOrder {
+	return sqlc.ImportedOrder{
+		ExternalID: util.RandomLongString(),
+		NewOrderTxParams: sqlc.NewOrderTxParams{
+			Username: username,
+			FullName: util.RandomLongString(),
+			PurchaseAmount: util.RandomCost(),
+			PurchasedItem: util.RandomLongString(),
+			ShippingLocation: util.RandomLongString(),
+			Currency: util.RandomCurrency(),
+			DateOrdered: "2022-10-15",
+		},
+	}
+}
+
+/* Test Functions */
+
+// Test Scenario: a dry run writes nothing, the import creates missing users and a second import skips every order
+func TestImportOrdersTx(t *testing.T){
+	store := sqlc.NewStore(testDB, nil)
+	user := createRandomUser(t)
+	newUsername := util.RandomLongString()
+	orders := []sqlc.ImportedOrder{randomImportedOrder(user.Username), randomImportedOrder(newUsername), randomImportedOrder(user.Username)}
+	args := sqlc.ImportOrdersTxParams{Source: "etsy", Orders: orders, DryRun: true}
+
+	result, err := store.ImportOrdersTx(context.Background(), args)
+	require.NoError(t, err)
+	require.Equal(t, 3, result.Imported)
+	require.Equal(t, []string{newUsername}, result.NewUsers)
+	require.Empty(t, result.Duplicates)
+	_, err = testQueries.GetUserByUsername(context.Background(), newUsername)
+	require.Error(t, err)
+
+	args.DryRun = false
+	result, err = store.ImportOrdersTx(context.Background(), args)
+	require.NoError(t, err)
+	require.Equal(t, 3, result.Imported)
+
+	existing, err := testQueries.GetUserByUsername(context.Background(), user.Username)
+	require.NoError(t, err)
+	require.Equal(t, user.TotalOrders + 2, existing.TotalOrders)
+	created, err := testQueries.GetUserByUsername(context.Background(), newUsername)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), created.TotalOrders)
+
+	imported, err := testQueries.ListOrdersByUsername(context.Background(), newUsername)
+	require.NoError(t, err)
+	require.Len(t, imported, 1)
+	require.Equal(t, "etsy", imported[0].ExternalSource)
+	require.Equal(t, orders[1].ExternalID, imported[0].ExternalID)
+
+	// Importing the same export again
+	result, err = store.ImportOrdersTx(context.Background(), args)
+	require.NoError(t, err)
+	require.Equal(t, 0, result.Imported)
+	require.Len(t, result.Duplicates, 3)
+	unchanged, err := testQueries.GetUserByUsername(context.Background(), user.Username)
+	require.NoError(t, err)
+	require.Equal(t, existing.TotalOrders, unchanged.TotalOrders)
+
+	// The same id from another shop is another order
+	args.Source = "shopify"
+	args.Orders = orders[:1]
+	result, err = store.ImportOrdersTx(context.Background(), args)
+	require.NoError(t, err)
+	require.Equal(t, 1, result.Imported)
+}
@@ -0,0 +1,91 @@
+// Unit tests for keyset paginated lists
+
+package tests
+
+import (
+	"context"
+	"testing"
+
+	sqlc "github.com/samanthatb1/beadBashStorage/db/sqlc"
+	"github.com/samanthatb1/beadBashStorage/util"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Scenario: page through filtered orders sorted by amount
+func TestListOrdersPage(t *testing.T){
+	store := sqlc.NewStore(testDB, nil)
+	user := createRandomUser(t)
+	item := util.RandomLongString() // Only the orders made here match
+
+	amounts := []float64{30, 10, 20, 40}
+	for _, amount := range amounts {
+		_, err := testQueries.CreateOrder(context.Background(), sqlc.CreateOrderParams{
+			AccountID: user.ID,
+			Username: user.Username,
+			FullName: user.FullName,
+			PurchaseAmount: amount,
+			PurchasedItem: "Blue " + item + " bracelet",
+			ShippingLocation: "Halifax",
+			ShippingLocationBidx: "halifax",
+			Currency: "CAD",
+			DateOrdered: util.RandomLongString(),
+		})
+		require.NoError(t, err)
+	}
+
+	filter := sqlc.OrderFilter{Username: user.Username, Item: item, MaxAmount: 35, ShippingLocation: " HALIFAX "}
+	params := sqlc.PageParams{Sort: "amount", Desc: true, Limit: 2}
+
+	page, err := store.ListOrdersPage(context.Background(), filter, params)
+	require.NoError(t, err)
+	require.Equal(t, int64(3), page.Total)
+	require.Len(t, page.Orders, 2)
+	require.Equal(t, 30.0, page.Orders[0].PurchaseAmount)
+	require.Equal(t, 20.0, page.Orders[1].PurchaseAmount)
+	require.NotNil(t, page.Next)
+
+	params.After = page.Next
+	page, err = store.ListOrdersPage(context.Background(), filter, params)
+	require.NoError(t, err)
+	require.Len(t, page.Orders, 1)
+	require.Equal(t, 10.0, page.Orders[0].PurchaseAmount)
+	require.Nil(t, page.Next)
+
+	// Other filters
+	page, err = store.ListOrdersPage(context.Background(), sqlc.OrderFilter{Item: item, Currency: "USD"}, sqlc.PageParams{Limit: 5})
+	require.NoError(t, err)
+	require.Empty(t, page.Orders)
+	require.Zero(t, page.Total)
+
+	_, err = store.ListOrdersPage(context.Background(), filter, sqlc.PageParams{Sort: "full_name", Limit: 5})
+	require.Error(t, err)
+}
+
+// Test Scenario: page through users by creation date
+func TestListUsersPage(t *testing.T){
+	store := sqlc.NewStore(testDB, nil)
+	tagName := util.RandomLongString()
+
+	var users []sqlc.User
+	for i := 0; i < 3; i++ {
+		user := createRandomUser(t)
+		_, err := store.AddUserTagTx(context.Background(), sqlc.UserTagTxParams{UserID: user.ID, TagName: tagName})
+		require.NoError(t, err)
+		users = append(users, user)
+	}
+
+	params := sqlc.PageParams{Sort: "date", Limit: 2}
+	page, err := store.ListUsersPage(context.Background(), sqlc.UserFilter{Tag: tagName}, params)
+	require.NoError(t, err)
+	require.Equal(t, int64(3), page.Total)
+	require.Len(t, page.Users, 2)
+	require.Equal(t, users[0].ID, page.Users[0].ID)
+	require.Equal(t, users[1].ID, page.Users[1].ID)
+
+	params.After = page.Next
+	page, err = store.ListUsersPage(context.Background(), sqlc.UserFilter{Tag: tagName}, params)
+	require.NoError(t, err)
+	require.Len(t, page.Users, 1)
+	require.Equal(t, users[2].ID, page.Users[0].ID)
+	require.Nil(t, page.Next)
+}
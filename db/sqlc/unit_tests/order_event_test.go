@@ -0,0 +1,116 @@
+// Unit tests for recording order changes for the live order feed
+
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	sqlc "github.com/samanthatb1/beadBashStorage/db/sqlc"
+	"github.com/samanthatb1/beadBashStorage/pii"
+	"github.com/stretchr/testify/require"
+)
+
+/* Helper Functions */
+
+// Events of the orders recorded after afterID, oldest first
+func orderEventsOf(t *testing.T, store *sqlc.Store, afterID int64, orderIDs ...int64) []sqlc.OrderEvent {
+	events, err := store.ListOrderEventsAfter(context.Background(), sqlc.ListOrderEventsAfterParams{ID: afterID, Limit: 1000})
+	require.NoError(t, err)
+	var matching []sqlc.OrderEvent
+	for _, event := range events {
+		for _, id := range orderIDs {
+			if event.OrderID == id {
+				matching = append(matching, event)
+			}
+		}
+	}
+	return matching
+}
+
+/* Test Functions */
+
+// Test Scenario: creating, editing and deleting orders records their events, deleting a user records its orders as deleted
+func TestOrderEvents(t *testing.T){
+	store := newEncryptedStore(t)
+	bounds, err := store.GetOrderEventBounds(context.Background())
+	require.NoError(t, err)
+
+	first, err := store.NewOrderTx(context.Background(), randomOrderParams())
+	require.NoError(t, err)
+	secondParams := randomOrderParams()
+	secondParams.Username = first.EditedUser.Username
+	second, err := store.NewOrderTx(context.Background(), secondParams)
+	require.NoError(t, err)
+
+	item := "Anklet"
+	_, err = store.PatchOrderTx(context.Background(), sqlc.PatchOrderTxParams{OrderID: first.OrderMade.OrderID, PurchasedItem: &item})
+	require.NoError(t, err)
+	_, err = store.DeleteOrderTx(context.Background(), sqlc.DeleteOrderTxParams{OrderID: first.OrderMade.OrderID})
+	require.NoError(t, err)
+	_, err = store.DeleteUserTx(context.Background(), sqlc.DeleteUserTxParams{ID: first.EditedUser.ID})
+	require.NoError(t, err)
+
+	events := orderEventsOf(t, store, bounds.LatestID, first.OrderMade.OrderID, second.OrderMade.OrderID)
+	expected := []struct {
+		event   string
+		orderID int64
+	}{
+		{sqlc.EventOrderCreated, first.OrderMade.OrderID},
+		{sqlc.EventOrderCreated, second.OrderMade.OrderID},
+		{sqlc.EventOrderUpdated, first.OrderMade.OrderID},
+		{sqlc.EventOrderDeleted, first.OrderMade.OrderID},
+		{sqlc.EventOrderDeleted, second.OrderMade.OrderID}, // With the user
+	}
+	require.Len(t, events, len(expected))
+	for i, event := range events {
+		require.Equal(t, expected[i].event, event.Event)
+		require.Equal(t, expected[i].orderID, event.OrderID)
+
+		var order sqlc.Order
+		require.NoError(t, json.Unmarshal([]byte(event.Payload), &order))
+		require.Equal(t, event.OrderID, order.OrderID)
+		require.Equal(t, first.EditedUser.Username, order.Username) // Decrypted
+	}
+
+	// The payload holds PII, so it's encrypted in the DB
+	raw, err := testQueries.ListOrderEventsAfter(context.Background(), sqlc.ListOrderEventsAfterParams{ID: events[0].ID - 1, Limit: 1})
+	require.NoError(t, err)
+	require.True(t, pii.IsEncrypted(raw[0].Payload))
+
+	bounds, err = store.GetOrderEventBounds(context.Background())
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, bounds.LatestID, events[len(events)-1].ID)
+}
+
+// Test Scenario: a failed transaction doesn't record its event
+func TestOrderEventRolledBack(t *testing.T){
+	store := sqlc.NewStore(testDB, nil)
+	order := createRandomOrder(t, createRandomUser(t))
+	bounds, err := store.GetOrderEventBounds(context.Background())
+	require.NoError(t, err)
+
+	item := "Anklet"
+	_, err = store.PatchOrderTx(context.Background(), sqlc.PatchOrderTxParams{OrderID: order.OrderID, Versions: []int64{order.Version + 1}, PurchasedItem: &item})
+	require.ErrorIs(t, err, sqlc.ErrVersionMismatch)
+	require.Empty(t, orderEventsOf(t, store, bounds.LatestID, order.OrderID))
+}
+
+// Test Scenario: events older than the retention are deleted
+func TestPruneOrderEvents(t *testing.T){
+	store := sqlc.NewStore(testDB, nil)
+	bounds, err := store.GetOrderEventBounds(context.Background())
+	require.NoError(t, err)
+	created, err := store.NewOrderTx(context.Background(), randomOrderParams())
+	require.NoError(t, err)
+
+	_, err = store.PruneOrderEvents(context.Background(), time.Hour)
+	require.NoError(t, err)
+	require.Len(t, orderEventsOf(t, store, bounds.LatestID, created.OrderMade.OrderID), 1)
+
+	_, err = store.PruneOrderEvents(context.Background(), -time.Minute) // Everything up to a minute from now
+	require.NoError(t, err)
+	require.Empty(t, orderEventsOf(t, store, bounds.LatestID, created.OrderMade.OrderID))
+}
@@ -98,6 +98,29 @@ func TestListOrdersByUsername(t *testing.T){
 	}
 }
 
+// Test Scenario: only the first orders of each user are read
+func TestListFirstOrdersByUsernames(t *testing.T){
+	user1 := createRandomUser(t)
+	user2 := createRandomUser(t)
+	var firstOrders []int64
+	for i:= 0 ; i < 5 ; i++{
+		order := createRandomOrder(t, user1)
+		if i < 3 {
+			firstOrders = append(firstOrders, order.OrderID)
+		}
+	}
+	order2 := createRandomOrder(t, user2)
+
+	orders, err := testQueries.ListFirstOrdersByUsernames(context.Background(), sqlc.ListFirstOrdersByUsernamesParams{
+		Usernames: []string{user1.Username, user2.Username},
+		MaxPerUser: 3,
+	})
+	require.NoError(t, err)
+	require.Len(t, orders, 4)
+	require.Equal(t, firstOrders, []int64{orders[0].OrderID, orders[1].OrderID, orders[2].OrderID})
+	require.Equal(t, order2.OrderID, orders[3].OrderID)
+}
+
 // Test Scenario: get all orders
 func TestListAllOrders(t *testing.T){
 	user := createRandomUser(t)
@@ -119,24 +142,53 @@ func TestListAllOrders(t *testing.T){
 	}
 }
 
-// Test Scenario: update order
-func TestUpdateOrder(t *testing.T){
+// Test Scenario: patch some fields of an order, the others are kept
+func TestPatchOrder(t *testing.T){
 	user := createRandomUser(t)
 	createdOrder := createRandomOrder(t, user)
 
-	updateOrderParams := sqlc.UpdateOrderParams{
+	patchOrderParams := sqlc.PatchOrderParams{
 		OrderID:	createdOrder.OrderID,
-		PurchasedItem: util.RandomLongString(),
-		PurchaseAmount: util.RandomCost(),
-    ShippingLocation: util.RandomLongString(),
+		PurchaseAmount: sql.NullFloat64{Float64: util.RandomCost(), Valid: true},
+		ShippingLocation: sql.NullString{String: "", Valid: true},
+		Currency: sql.NullString{String: "EUR", Valid: true},
+		Versions: []int64{createdOrder.Version},
 	}
 
-	updatedOrder, err := testQueries.UpdateOrder(context.Background(), updateOrderParams)
+	patchedOrder, err := testQueries.PatchOrder(context.Background(), patchOrderParams)
+	require.NoError(t, err)
+	require.Equal(t, patchOrderParams.PurchaseAmount.Float64, patchedOrder.PurchaseAmount)
+	require.Empty(t, patchedOrder.ShippingLocation)
+	require.Equal(t, "EUR", patchedOrder.Currency)
+	require.Equal(t, createdOrder.PurchasedItem, patchedOrder.PurchasedItem)
+	require.Equal(t, createdOrder.FullName, patchedOrder.FullName)
+	require.Equal(t, createdOrder.DateOrdered, patchedOrder.DateOrdered)
+	require.Equal(t, createdOrder.Version + 1, patchedOrder.Version)
+}
+
+// Test Scenario: patch order with an outdated version
+func TestPatchOrderStaleVersion(t *testing.T){
+	user := createRandomUser(t)
+	createdOrder := createRandomOrder(t, user)
+	require.Equal(t, int64(1), createdOrder.Version)
+
+	patchOrderParams := sqlc.PatchOrderParams{
+		OrderID:	createdOrder.OrderID,
+		PurchasedItem: sql.NullString{String: util.RandomLongString(), Valid: true},
+		Versions: []int64{createdOrder.Version},
+	}
+	_, err := testQueries.PatchOrder(context.Background(), patchOrderParams)
+	require.NoError(t, err)
+
+	// Second write with the same version lost the race
+	_, err = testQueries.PatchOrder(context.Background(), patchOrderParams)
+	require.EqualError(t, err, sql.ErrNoRows.Error())
+
+	// Without a version it goes through
+	patchOrderParams.Versions = nil
+	patchedOrder, err := testQueries.PatchOrder(context.Background(), patchOrderParams)
 	require.NoError(t, err)
-	allOrderFieldsEqual(t, createdOrder, updatedOrder, true)
-	require.Equal(t, updateOrderParams.PurchasedItem, updatedOrder.PurchasedItem)
-	require.Equal(t, updateOrderParams.PurchaseAmount, updatedOrder.PurchaseAmount)
-	require.Equal(t, updateOrderParams.ShippingLocation, updatedOrder.ShippingLocation)
+	require.Equal(t, int64(3), patchedOrder.Version)
 }
 
 // Test Scenario: delete order
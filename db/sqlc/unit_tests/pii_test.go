@@ -0,0 +1,116 @@
+// Unit tests for PII encryption in the store
+
+package tests
+
+import (
+	"context"
+	"testing"
+
+	sqlc "github.com/samanthatb1/beadBashStorage/db/sqlc"
+	"github.com/samanthatb1/beadBashStorage/pii"
+	"github.com/samanthatb1/beadBashStorage/util"
+	"github.com/stretchr/testify/require"
+)
+
+// Fixed keys so rows encrypted by earlier test runs can still be read
+const (
+	testPIIKeys = "test:MDEyMzQ1Njc4OTAxMjM0NTY3ODkwMTIzNDU2Nzg5MDE="
+	testPIIIndexKey = "YWJjZGVmZ2hpamtsbW5vcHFyc3R1dnd4eXphYmNkZWY="
+)
+
+func newEncryptedStore(t *testing.T) *sqlc.Store {
+	cipher, err := pii.NewCipher(testPIIKeys, "test", testPIIIndexKey)
+	require.NoError(t, err)
+	return sqlc.NewStore(testDB, cipher)
+}
+
+// Test Scenario: PII is encrypted in the DB and the store returns it decrypted
+func TestEncryptedOrderTx(t *testing.T){
+	store := newEncryptedStore(t)
+
+	newOrderParam := sqlc.NewOrderTxParams{
+		Username: util.RandomLongString(),
+		FullName: util.RandomLongString(),
+		PurchaseAmount: util.RandomCost(),
+		PurchasedItem: util.RandomLongString(),
+		ShippingLocation: util.RandomLongString(),
+		Currency: util.RandomCurrency(),
+		DateOrdered: util.RandomLongString(),
+	}
+
+	result, err := store.NewOrderTx(context.Background(), newOrderParam)
+	require.NoError(t, err)
+	require.Equal(t, newOrderParam.FullName, result.EditedUser.FullName)
+	require.Equal(t, newOrderParam.FullName, result.OrderMade.FullName)
+	require.Equal(t, newOrderParam.ShippingLocation, result.OrderMade.ShippingLocation)
+
+	// Rows in the DB are encrypted
+	rawUser, err := testQueries.GetUserById(context.Background(), result.EditedUser.ID)
+	require.NoError(t, err)
+	require.True(t, pii.IsEncrypted(rawUser.FullName))
+	rawOrder, err := testQueries.GetOrderById(context.Background(), result.OrderMade.OrderID)
+	require.NoError(t, err)
+	require.True(t, pii.IsEncrypted(rawOrder.FullName))
+	require.True(t, pii.IsEncrypted(rawOrder.ShippingLocation))
+
+	// Reads through the store are decrypted
+	order, err := store.GetOrderById(context.Background(), result.OrderMade.OrderID)
+	require.NoError(t, err)
+	require.Equal(t, newOrderParam.ShippingLocation, order.ShippingLocation)
+
+	// Blind index lookups
+	orders, err := store.FindOrdersByShippingLocation(context.Background(), newOrderParam.ShippingLocation, 5, 0)
+	require.NoError(t, err)
+	require.Len(t, orders, 1)
+	require.Equal(t, order.OrderID, orders[0].OrderID)
+	users, err := store.FindUsersByFullName(context.Background(), newOrderParam.FullName, 5, 0)
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+	require.Equal(t, result.EditedUser.ID, users[0].ID)
+
+	// Updating keeps the shipping location encrypted and searchable
+	newLocation := util.RandomLongString()
+	updated, err := store.PatchOrderTx(context.Background(), sqlc.PatchOrderTxParams{
+		OrderID: order.OrderID,
+		ShippingLocation: &newLocation,
+		Versions: []int64{order.Version},
+	})
+	require.NoError(t, err)
+	require.Equal(t, newLocation, updated.ShippingLocation)
+	orders, err = store.FindOrdersByShippingLocation(context.Background(), newLocation, 5, 0)
+	require.NoError(t, err)
+	require.Len(t, orders, 1)
+}
+
+// Test Scenario: plain text rows from before encryption was turned on are still readable
+func TestEncryptedStoreReadsPlainText(t *testing.T){
+	store := newEncryptedStore(t)
+	user := createRandomUser(t)
+
+	fetchedUser, err := store.GetUserById(context.Background(), user.ID)
+	require.NoError(t, err)
+	allUserFieldsEqual(t, user, fetchedUser, true)
+}
+
+// Test Scenario: names and shipping locations that look encrypted are rejected, with or without keys, so reading them can't fail later
+func TestRejectEncryptedLookingPII(t *testing.T){
+	encrypted := "enc:v1:x:y:z"
+	for _, store := range []*sqlc.Store{sqlc.NewStore(testDB, nil), newEncryptedStore(t)} {
+		_, err := store.CreateUser(context.Background(), sqlc.CreateUserParams{
+			Username: util.RandomLongString(),
+			FullName: encrypted,
+		})
+		require.ErrorIs(t, err, sqlc.ErrEncryptedValue)
+
+		_, err = store.CreateOrder(context.Background(), sqlc.CreateOrderParams{
+			Username: util.RandomLongString(),
+			FullName: util.RandomLongString(),
+			ShippingLocation: encrypted,
+		})
+		require.ErrorIs(t, err, sqlc.ErrEncryptedValue)
+
+		order := createRandomOrder(t, createRandomUser(t))
+		_, err = store.PatchOrderTx(context.Background(), sqlc.PatchOrderTxParams{OrderID: order.OrderID, FullName: &encrypted})
+		require.ErrorIs(t, err, sqlc.ErrEncryptedValue)
+	}
+}
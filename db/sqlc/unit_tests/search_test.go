@@ -0,0 +1,87 @@
+// Unit tests for full-text search
+
+package tests
+
+import (
+	"context"
+	"testing"
+
+	sqlc "github.com/samanthatb1/beadBashStorage/db/sqlc"
+	"github.com/samanthatb1/beadBashStorage/util"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Scenario: orders are found by item, typos and shipping location words, with PII encrypted
+func TestSearchOrders(t *testing.T){
+	store := newEncryptedStore(t)
+	stone := util.RandomLongString() + util.RandomLongString() // Made up word only these orders have
+	city := util.RandomLongString() + util.RandomLongString()
+
+	result, err := store.NewOrderTx(context.Background(), sqlc.NewOrderTxParams{
+		Username: util.RandomLongString(),
+		FullName: util.RandomLongString(),
+		PurchaseAmount: util.RandomCost(),
+		PurchasedItem: "Blue " + stone + " bracelet <img src=x onerror=alert(1)>",
+		ShippingLocation: "12 Water St <b>&</b>, " + city,
+		Currency: util.RandomCurrency(),
+		DateOrdered: util.RandomLongString(),
+	})
+	require.NoError(t, err)
+	match := result.OrderMade
+
+	// Same stone shipped somewhere else ranks lower
+	_, err = store.NewOrderTx(context.Background(), sqlc.NewOrderTxParams{
+		Username: util.RandomLongString(),
+		FullName: util.RandomLongString(),
+		PurchaseAmount: util.RandomCost(),
+		PurchasedItem: stone + " ring",
+		ShippingLocation: util.RandomLongString(),
+		Currency: util.RandomCurrency(),
+		DateOrdered: util.RandomLongString(),
+	})
+	require.NoError(t, err)
+
+	hits, err := store.SearchOrders(context.Background(), "the blue "+stone+" bracelet shipped to "+city, 5)
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, len(hits), 2)
+	require.Equal(t, match.OrderID, hits[0].Order.OrderID)
+	require.Equal(t, match.ShippingLocation, hits[0].Order.ShippingLocation) // Decrypted
+	require.Contains(t, hits[0].Highlights["purchased_item"], "<mark>"+stone+"</mark>")
+	require.Contains(t, hits[0].Highlights["purchased_item"], "&lt;img") // Stored markup is escaped
+	require.NotContains(t, hits[0].Highlights["purchased_item"], "<img")
+	require.Equal(t, "12 Water St &lt;b&gt;&amp;&lt;/b&gt;, <mark>"+city+"</mark>", hits[0].Highlights["shipping_location"])
+
+	// Typo in the item
+	hits, err = store.SearchOrders(context.Background(), stone[:len(stone)-1], 5)
+	require.NoError(t, err)
+	require.NotEmpty(t, hits)
+
+	// Nothing to search for
+	hits, err = store.SearchOrders(context.Background(), " ,. ", 5)
+	require.NoError(t, err)
+	require.Empty(t, hits)
+}
+
+// Test Scenario: users are found by username and by words of their encrypted full name
+func TestSearchUsers(t *testing.T){
+	store := newEncryptedStore(t)
+	lastName := util.RandomLongString() + util.RandomLongString()
+
+	user, err := store.CreateUserTx(context.Background(), sqlc.CreateUserTxParams{
+		FullName: "Jane " + lastName,
+		Username: util.RandomLongString() + util.RandomLongString(),
+		HashedPassword: util.RandomLongString(),
+	})
+	require.NoError(t, err)
+
+	hits, err := store.SearchUsers(context.Background(), lastName, 5)
+	require.NoError(t, err)
+	require.Len(t, hits, 1)
+	require.Equal(t, user.ID, hits[0].User.ID)
+	require.Equal(t, "Jane <mark>"+lastName+"</mark>", hits[0].Highlights["full_name"])
+
+	hits, err = store.SearchUsers(context.Background(), user.Username, 5)
+	require.NoError(t, err)
+	require.NotEmpty(t, hits)
+	require.Equal(t, user.ID, hits[0].User.ID)
+}
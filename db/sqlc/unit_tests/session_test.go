@@ -0,0 +1,48 @@
+// Unit tests for login sessions
+
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	sqlc "github.com/samanthatb1/beadBashStorage/db/sqlc"
+	"github.com/samanthatb1/beadBashStorage/util"
+	"github.com/stretchr/testify/require"
+)
+
+// Test Scenario: create a session and fetch it by id
+func TestCreateSession(t *testing.T){
+	user := createRandomUser(t)
+
+	sessionParams := sqlc.CreateSessionParams{
+		ID: uuid.New(),
+		UserID: user.ID,
+		RefreshToken: util.RandomLongString(),
+		UserAgent: util.RandomLongString(),
+		ClientIp: "127.0.0.1",
+		IsBlocked: false,
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+
+	session, err := testQueries.CreateSession(context.Background(), sessionParams)
+	require.NoError(t, err)
+	require.Equal(t, sessionParams.ID, session.ID)
+	require.Equal(t, sessionParams.UserID, session.UserID)
+	require.Equal(t, sessionParams.RefreshToken, session.RefreshToken)
+	require.False(t, session.IsBlocked)
+	require.WithinDuration(t, sessionParams.ExpiresAt, session.ExpiresAt, time.Second)
+
+	fetchedSession, err := testQueries.GetSession(context.Background(), session.ID)
+	require.NoError(t, err)
+	require.Equal(t, session.RefreshToken, fetchedSession.RefreshToken)
+
+	// Sessions go away with their user
+	err = testQueries.DeleteUser(context.Background(), user.Username)
+	require.NoError(t, err)
+	_, err = testQueries.GetSession(context.Background(), session.ID)
+	require.EqualError(t, err, sql.ErrNoRows.Error())
+}
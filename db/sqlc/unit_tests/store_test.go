@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	sqlc "github.com/samanthatb1/beadBashStorage/db/sqlc"
+	"github.com/samanthatb1/beadBashStorage/pii"
 	"github.com/samanthatb1/beadBashStorage/util"
 	"github.com/stretchr/testify/require"
 )
@@ -15,7 +16,7 @@ import (
 // Test Scenario: Add a new order if user already exists
 func TestNewOrderWithExistingUserTx(t *testing.T){
 	// Create a new store to use regular DB operations plus the additional operations
-	store := sqlc.NewStore(testDB)
+	store := sqlc.NewStore(testDB, nil)
 
 	// Create User
 	user := createRandomUser(t)
@@ -44,7 +45,7 @@ func TestNewOrderWithExistingUserTx(t *testing.T){
 // Test Scenario: Add a new order if user doesnt exist
 func TestNewOrderWithNonExistingUserTx(t *testing.T){
 	// Create a new store to use regular DB operations plus the additional operations
-	store := sqlc.NewStore(testDB)
+	store := sqlc.NewStore(testDB, nil)
 
 	// New order info
   newOrderParam := sqlc.NewOrderTxParams{
@@ -72,10 +73,60 @@ func TestNewOrderWithNonExistingUserTx(t *testing.T){
 	require.Equal(t, newOrderParam.FullName, result.OrderMade.FullName)
 }
 
+// Test Scenario: a batch counts each user's orders once and keeps the orders in request order
+func TestBatchOrderTx(t *testing.T){
+	store := sqlc.NewStore(testDB, nil)
+	user := createRandomUser(t)
+	newUsername := util.RandomLongString()
+
+	orderFor := func(username string) sqlc.NewOrderTxParams {
+		return sqlc.NewOrderTxParams{
+			Username: username,
+			FullName: util.RandomLongString(),
+			PurchaseAmount: util.RandomCost(),
+			PurchasedItem: util.RandomLongString(),
+			ShippingLocation: util.RandomLongString(),
+			Currency: util.RandomCurrency(),
+			DateOrdered: util.RandomLongString(),
+		}
+	}
+	orders := []sqlc.NewOrderTxParams{orderFor(user.Username), orderFor(newUsername), orderFor(user.Username), orderFor(user.Username)}
+
+	result, err := store.BatchOrderTx(context.Background(), orders)
+	require.NoError(t, err)
+	require.Len(t, result.Orders, len(orders))
+	for i, order := range result.Orders {
+		require.Equal(t, orders[i].Username, order.Username)
+		require.Equal(t, orders[i].PurchasedItem, order.PurchasedItem)
+	}
+
+	// Existing user got 3 more orders, the new one was created with 1
+	require.Len(t, result.EditedUsers, 2)
+	existing, err := testQueries.GetUserByUsername(context.Background(), user.Username)
+	require.NoError(t, err)
+	require.Equal(t, user.TotalOrders + 3, existing.TotalOrders)
+	created, err := testQueries.GetUserByUsername(context.Background(), newUsername)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), created.TotalOrders)
+	require.Equal(t, orders[1].FullName, created.FullName)
+
+	// A failing order rolls back the whole batch
+	failing := []sqlc.NewOrderTxParams{orderFor(user.Username), orderFor(user.Username)}
+	failing[1].PurchasedItem = "bead\x00necklace" // Postgres doesn't store NUL bytes in text
+	_, err = store.BatchOrderTx(context.Background(), failing)
+	var orderErr *sqlc.BatchOrderError
+	require.ErrorAs(t, err, &orderErr)
+	require.Equal(t, 1, orderErr.Index)
+
+	unchanged, err := testQueries.GetUserByUsername(context.Background(), user.Username)
+	require.NoError(t, err)
+	require.Equal(t, existing.TotalOrders, unchanged.TotalOrders)
+}
+
 // Test Scenario: Delete order if it exists
 func TestDeleteExistingOrderTx(t *testing.T){
 	// Create a new store to use regular DB operations plus the additional operations
-	store := sqlc.NewStore(testDB)
+	store := sqlc.NewStore(testDB, nil)
 
 	// Create user and add order to that user
 	user := createRandomUser(t)
@@ -108,10 +159,50 @@ func TestDeleteExistingOrderTx(t *testing.T){
 	require.Equal(t, user.TotalOrders, updatedUser.TotalOrders)
 }
 
+// Test Scenario: orders made and deleted at the same time all count in the user's total orders
+func TestConcurrentOrderTotalsTx(t *testing.T){
+	store := sqlc.NewStore(testDB, nil)
+	user := createRandomUser(t)
+	toDelete := make([]sqlc.Order, 5)
+	for i := range toDelete {
+		toDelete[i] = createRandomOrder(t, user)
+	}
+	before, err := testQueries.GetUserById(context.Background(), user.ID)
+	require.NoError(t, err)
+
+	errs := make(chan error)
+	for _, order := range toDelete {
+		go func(orderID int64) {
+			_, err := store.DeleteOrderTx(context.Background(), sqlc.DeleteOrderTxParams{OrderID: orderID})
+			errs <- err
+		}(order.OrderID)
+		go func() {
+			_, err := store.NewOrderTx(context.Background(), sqlc.NewOrderTxParams{
+				Username: user.Username,
+				FullName: user.FullName,
+				PurchaseAmount: util.RandomCost(),
+				PurchasedItem: util.RandomLongString(),
+				ShippingLocation: util.RandomLongString(),
+				Currency: util.RandomCurrency(),
+				DateOrdered: util.RandomLongString(),
+			})
+			errs <- err
+		}()
+	}
+	for i := 0; i < 2*len(toDelete); i++ {
+		require.NoError(t, <-errs)
+	}
+
+	// As many made as deleted
+	after, err := testQueries.GetUserById(context.Background(), user.ID)
+	require.NoError(t, err)
+	require.Equal(t, before.TotalOrders, after.TotalOrders)
+}
+
 // Test Scenario: Delete order if it doesnt exist
 func TestDeleteNonExistingOrderTx(t *testing.T){
 	// Create a new store to use regular DB operations plus the additional operations
-	store := sqlc.NewStore(testDB)
+	store := sqlc.NewStore(testDB, nil)
 
 	// Delete the order
 	result, err := store.DeleteOrderTx(context.Background(), sqlc.DeleteOrderTxParams{OrderID: (util.RandomID() + util.RandomID() + util.RandomID())})
@@ -119,10 +210,79 @@ func TestDeleteNonExistingOrderTx(t *testing.T){
 	require.Empty(t, result)
 }
 
+// Test Scenario: Delete order only if it's still at the version the client has seen
+func TestDeleteOrderVersionTx(t *testing.T){
+	store := sqlc.NewStore(testDB, nil)
+	user := createRandomUser(t)
+	order := createRandomOrder(t, user)
+
+	// Outdated version
+	_, err := store.DeleteOrderTx(context.Background(), sqlc.DeleteOrderTxParams{OrderID: order.OrderID, Versions: []int64{order.Version + 1}})
+	require.ErrorIs(t, err, sqlc.ErrVersionMismatch)
+
+	// Order is still there
+	_, err = testQueries.GetOrderById(context.Background(), order.OrderID)
+	require.NoError(t, err)
+
+	result, err := store.DeleteOrderTx(context.Background(), sqlc.DeleteOrderTxParams{OrderID: order.OrderID, Versions: []int64{order.Version}})
+	require.NoError(t, err)
+	require.Equal(t, "Deleted", result.Status)
+}
+
+// Test Scenario: Patch only the fields that are given, the search tokens keep the field that didn't change
+func TestPatchOrderTx(t *testing.T){
+	store := newEncryptedStore(t)
+	user := createRandomUser(t)
+	location := "12 Water St, Halifax"
+	result, err := store.NewOrderTx(context.Background(), sqlc.NewOrderTxParams{
+		Username: user.Username,
+		FullName: user.FullName,
+		PurchaseAmount: util.RandomCost(),
+		PurchasedItem: util.RandomLongString(),
+		ShippingLocation: location,
+		Currency: "USD",
+		DateOrdered: "2022-10-15",
+	})
+	require.NoError(t, err)
+	order := result.OrderMade
+
+	newName := util.RandomLongString()
+	currency := "CAD"
+	patched, err := store.PatchOrderTx(context.Background(), sqlc.PatchOrderTxParams{OrderID: order.OrderID, FullName: &newName, Currency: &currency})
+	require.NoError(t, err)
+	require.Equal(t, newName, patched.FullName)
+	require.Equal(t, location, patched.ShippingLocation)
+	require.Equal(t, "CAD", patched.Currency)
+	require.Equal(t, order.PurchasedItem, patched.PurchasedItem)
+	require.Equal(t, order.Version + 1, patched.Version)
+
+	cipher, err := pii.NewCipher(testPIIKeys, "test", testPIIIndexKey)
+	require.NoError(t, err)
+	raw, err := testQueries.GetOrderById(context.Background(), order.OrderID)
+	require.NoError(t, err)
+	require.ElementsMatch(t, cipher.WordTokens(newName, location), raw.PiiTokens)
+
+	// Empty patch changes nothing
+	unchanged, err := store.PatchOrderTx(context.Background(), sqlc.PatchOrderTxParams{OrderID: order.OrderID})
+	require.NoError(t, err)
+	require.Equal(t, patched.Version, unchanged.Version)
+
+	// Outdated version, then a missing order
+	_, err = store.PatchOrderTx(context.Background(), sqlc.PatchOrderTxParams{OrderID: order.OrderID, Versions: []int64{order.Version}, Currency: &currency})
+	require.ErrorIs(t, err, sqlc.ErrVersionMismatch)
+	_, err = store.PatchOrderTx(context.Background(), sqlc.PatchOrderTxParams{OrderID: -order.OrderID, Currency: &currency})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+
+	// Any version in the list matches
+	patched, err = store.PatchOrderTx(context.Background(), sqlc.PatchOrderTxParams{OrderID: order.OrderID, Versions: []int64{order.Version, patched.Version}, Currency: &currency})
+	require.NoError(t, err)
+	require.Equal(t, order.Version + 2, patched.Version)
+}
+
 // Test Scenario: Delete User if it exists
 func TestDeleteUserIfExistsTx(t *testing.T){
 	// Create a new store to use regular DB operations plus the additional operations
-	store := sqlc.NewStore(testDB)
+	store := sqlc.NewStore(testDB, nil)
 
 	// Create user with two orders
 	user1 := createRandomUser(t)
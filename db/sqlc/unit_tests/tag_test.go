@@ -0,0 +1,137 @@
+// Unit tests for tags on users and orders
+
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/samanthatb1/beadBashStorage/db/dberr"
+	sqlc "github.com/samanthatb1/beadBashStorage/db/sqlc"
+	"github.com/samanthatb1/beadBashStorage/util"
+	"github.com/stretchr/testify/require"
+)
+
+/* Helper Functions */
+
+func createRandomTag(t *testing.T) sqlc.Tag {
+	name := util.RandomLongString()
+
+	tag, err := testQueries.UpsertTag(context.Background(), name)
+	require.NoError(t, err)
+	require.NotEmpty(t, tag)
+	require.Equal(t, name, tag.Name)
+	require.NotZero(t, tag.ID)
+	require.NotZero(t, tag.CreatedAt)
+
+	return tag
+}
+
+/* Test Functions */
+
+// Test Scenario: upserting an existing tag returns the same tag
+func TestUpsertTag(t *testing.T){
+	tag := createRandomTag(t)
+
+	sameTag, err := testQueries.UpsertTag(context.Background(), tag.Name)
+	require.NoError(t, err)
+	require.Equal(t, tag.ID, sameTag.ID)
+
+	fetchedTag, err := testQueries.GetTagByName(context.Background(), tag.Name)
+	require.NoError(t, err)
+	require.Equal(t, tag.ID, fetchedTag.ID)
+}
+
+// Test Scenario: tag a user and filter users by that tag
+func TestUserTags(t *testing.T){
+	tag := createRandomTag(t)
+	user := createRandomUser(t)
+	createRandomUser(t) // untagged user that must not show up
+
+	// Adding the same tag twice is a no-op
+	for i := 0; i < 2; i++ {
+		err := testQueries.AddUserTag(context.Background(), sqlc.AddUserTagParams{UserID: user.ID, TagID: tag.ID})
+		require.NoError(t, err)
+	}
+
+	tags, err := testQueries.ListTagsOfUser(context.Background(), user.ID)
+	require.NoError(t, err)
+	require.Len(t, tags, 1)
+	require.Equal(t, tag.ID, tags[0].ID)
+
+	users, err := testQueries.ListUsersByTag(context.Background(), sqlc.ListUsersByTagParams{Name: tag.Name, Limit: 5, Offset: 0})
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+	allUserFieldsEqual(t, user, users[0], true)
+
+	// Remove the tag
+	err = testQueries.RemoveUserTag(context.Background(), sqlc.RemoveUserTagParams{UserID: user.ID, TagID: tag.ID})
+	require.NoError(t, err)
+	tags, err = testQueries.ListTagsOfUser(context.Background(), user.ID)
+	require.NoError(t, err)
+	require.Empty(t, tags)
+}
+
+// Test Scenario: tag an order and filter orders by that tag
+func TestOrderTags(t *testing.T){
+	tag := createRandomTag(t)
+	user := createRandomUser(t)
+	order := createRandomOrder(t, user)
+	createRandomOrder(t, user) // untagged order that must not show up
+
+	err := testQueries.AddOrderTag(context.Background(), sqlc.AddOrderTagParams{OrderID: order.OrderID, TagID: tag.ID})
+	require.NoError(t, err)
+
+	tags, err := testQueries.ListTagsOfOrder(context.Background(), order.OrderID)
+	require.NoError(t, err)
+	require.Len(t, tags, 1)
+	require.Equal(t, tag.ID, tags[0].ID)
+
+	orders, err := testQueries.ListAllOrdersByTag(context.Background(), sqlc.ListAllOrdersByTagParams{Name: tag.Name, Limit: 5, Offset: 0})
+	require.NoError(t, err)
+	require.Len(t, orders, 1)
+	allOrderFieldsEqual(t, order, orders[0], false)
+
+	orders, err = testQueries.ListOrdersByUsernameAndTag(context.Background(), sqlc.ListOrdersByUsernameAndTagParams{Username: user.Username, Name: tag.Name})
+	require.NoError(t, err)
+	require.Len(t, orders, 1)
+	allOrderFieldsEqual(t, order, orders[0], false)
+
+	// Remove the tag
+	err = testQueries.RemoveOrderTag(context.Background(), sqlc.RemoveOrderTagParams{OrderID: order.OrderID, TagID: tag.ID})
+	require.NoError(t, err)
+	tags, err = testQueries.ListTagsOfOrder(context.Background(), order.OrderID)
+	require.NoError(t, err)
+	require.Empty(t, tags)
+}
+
+// Test Scenario: tag transactions create the tag on first use and reject unknown tags on removal
+func TestTagTx(t *testing.T){
+	store := sqlc.NewStore(testDB, nil)
+	user := createRandomUser(t)
+	order := createRandomOrder(t, user)
+	tagName := util.RandomLongString()
+
+	// Tag doesn't exist yet, it is created by the transaction
+	userResult, err := store.AddUserTagTx(context.Background(), sqlc.UserTagTxParams{UserID: user.ID, TagName: tagName})
+	require.NoError(t, err)
+	require.Len(t, userResult.Tags, 1)
+	require.Equal(t, tagName, userResult.Tags[0].Name)
+
+	// Same tag can be reused on an order
+	orderResult, err := store.AddOrderTagTx(context.Background(), sqlc.OrderTagTxParams{OrderID: order.OrderID, TagName: tagName})
+	require.NoError(t, err)
+	require.Len(t, orderResult.Tags, 1)
+	require.Equal(t, userResult.Tags[0].ID, orderResult.Tags[0].ID)
+
+	userResult, err = store.RemoveUserTagTx(context.Background(), sqlc.UserTagTxParams{UserID: user.ID, TagName: tagName})
+	require.NoError(t, err)
+	require.Empty(t, userResult.Tags)
+
+	// Removing a tag that was never created
+	_, err = store.RemoveOrderTagTx(context.Background(), sqlc.OrderTagTxParams{OrderID: order.OrderID, TagName: util.RandomLongString()})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	require.Equal(t, dberr.NotFound, dberr.KindOf(err))
+	require.Equal(t, "tag_not_found", dberr.As(err).Code)
+}
@@ -0,0 +1,175 @@
+// Unit tests for customer data export and erasure
+
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	sqlc "github.com/samanthatb1/beadBashStorage/db/sqlc"
+	"github.com/samanthatb1/beadBashStorage/util"
+	"github.com/stretchr/testify/require"
+)
+
+/* Helper Functions */
+
+// Customer with a password, a session, a tag and an order
+func createCustomerWithData(t *testing.T, store *sqlc.Store) (sqlc.User, sqlc.Order) {
+	user, err := store.CreateUserTx(context.Background(), sqlc.CreateUserTxParams{
+		FullName: util.RandomLongString(),
+		Username: util.RandomLongString(),
+		HashedPassword: util.RandomLongString(),
+	})
+	require.NoError(t, err)
+
+	_, err = testQueries.CreateSession(context.Background(), sqlc.CreateSessionParams{
+		ID: uuid.New(),
+		UserID: user.ID,
+		RefreshToken: util.RandomLongString(),
+		UserAgent: util.RandomLongString(),
+		ClientIp: "127.0.0.1",
+		ExpiresAt: time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+
+	_, err = store.AddUserTagTx(context.Background(), sqlc.UserTagTxParams{UserID: user.ID, TagName: util.RandomLongString()})
+	require.NoError(t, err)
+
+	result, err := store.NewOrderTx(context.Background(), sqlc.NewOrderTxParams{
+		Username: user.Username,
+		FullName: user.FullName,
+		PurchaseAmount: util.RandomCost(),
+		PurchasedItem: util.RandomLongString(),
+		ShippingLocation: util.RandomLongString(),
+		Currency: util.RandomCurrency(),
+		DateOrdered: util.RandomLongString(),
+	})
+	require.NoError(t, err)
+
+	return result.EditedUser, result.OrderMade
+}
+
+/* Test Functions */
+
+// Test Scenario: the export has everything stored about the customer
+func TestExportUserDataTx(t *testing.T){
+	store := sqlc.NewStore(testDB, nil)
+	user, order := createCustomerWithData(t, store)
+
+	export, err := store.ExportUserDataTx(context.Background(), user.ID)
+	require.NoError(t, err)
+	allUserFieldsEqual(t, user, export.User, true)
+	require.Len(t, export.Orders, 1)
+	require.Equal(t, order.OrderID, export.Orders[0].OrderID)
+	require.Len(t, export.Tags, 1)
+	require.Len(t, export.Sessions, 1)
+	require.NotNil(t, export.Credential)
+}
+
+// Test Scenario: erasing removes PII and login data but keeps the order amounts
+func TestEraseUserTx(t *testing.T){
+	store := newEncryptedStore(t)
+	user, order := createCustomerWithData(t, store)
+
+	// Stale version is rejected
+	_, err := store.EraseUserTx(context.Background(), sqlc.EraseUserTxParams{ID: user.ID, Versions: []int64{user.Version + 1}})
+	require.ErrorIs(t, err, sqlc.ErrVersionMismatch)
+
+	result, err := store.EraseUserTx(context.Background(), sqlc.EraseUserTxParams{ID: user.ID, Versions: []int64{user.Version}})
+	require.NoError(t, err)
+	require.Equal(t, "Erased", result.Status)
+	require.Equal(t, int64(1), result.OrdersErased)
+	require.Equal(t, fmt.Sprintf("erased-%d", user.ID), result.User.Username)
+	require.Equal(t, sqlc.ErasedValue, result.User.FullName)
+	require.True(t, result.User.ErasedAt.Valid)
+
+	// Orders follow the new username and keep what accounting needs
+	erasedOrder, err := store.GetOrderById(context.Background(), order.OrderID)
+	require.NoError(t, err)
+	require.Equal(t, result.User.Username, erasedOrder.Username)
+	require.Equal(t, sqlc.ErasedValue, erasedOrder.FullName)
+	require.Equal(t, sqlc.ErasedValue, erasedOrder.ShippingLocation)
+	require.Equal(t, order.PurchaseAmount, erasedOrder.PurchaseAmount)
+	require.Equal(t, order.DateOrdered, erasedOrder.DateOrdered)
+
+	// Nothing left to log in with or look the customer up by
+	_, err = testQueries.GetCredential(context.Background(), user.ID)
+	require.EqualError(t, err, sql.ErrNoRows.Error())
+	sessions, err := testQueries.ListSessionsOfUser(context.Background(), user.ID)
+	require.NoError(t, err)
+	require.Empty(t, sessions)
+	tags, err := testQueries.ListTagsOfUser(context.Background(), user.ID)
+	require.NoError(t, err)
+	require.Empty(t, tags)
+	users, err := store.FindUsersByFullName(context.Background(), user.FullName, 5, 0)
+	require.NoError(t, err)
+	require.Empty(t, users)
+}
+
+// Test Scenario: erasing also redacts the copies of the customer kept as JSON
+func TestEraseUserCopiesTx(t *testing.T){
+	store := newEncryptedStore(t)
+	hook := createTestWebhook(t, store, "https://example.com/hooks", sqlc.EventOrderCreated)
+	bounds, err := store.GetOrderEventBounds(context.Background())
+	require.NoError(t, err)
+	user, order := createCustomerWithData(t, store)
+
+	// A response stored for staff, and one for the customer's own request
+	staffKey := sqlc.CreateIdempotencyKeyParams{Owner: "apikey:" + util.RandomLongString(), Key: util.RandomLongString(), RequestHash: "hash", ExpiresAt: time.Now().Add(time.Hour)}
+	ownKey := sqlc.CreateIdempotencyKeyParams{Owner: sqlc.UserIdentity(user.Username), Key: util.RandomLongString(), RequestHash: "hash", ExpiresAt: time.Now().Add(time.Hour)}
+	body, err := json.Marshal(sqlc.NewOrderTxResult{EditedUser: user, OrderMade: order})
+	require.NoError(t, err)
+	for _, key := range []sqlc.CreateIdempotencyKeyParams{staffKey, ownKey} {
+		_, err = store.CreateIdempotencyKey(context.Background(), key)
+		require.NoError(t, err)
+		err = store.CompleteIdempotencyKey(context.Background(), sqlc.CompleteIdempotencyKeyParams{Owner: key.Owner, Key: key.Key, ResponseStatus: 200, ResponseBody: body, ResponseHeaders: json.RawMessage(`{}`)})
+		require.NoError(t, err)
+	}
+
+	result, err := store.EraseUserTx(context.Background(), sqlc.EraseUserTxParams{ID: user.ID})
+	require.NoError(t, err)
+
+	saved, err := store.GetIdempotencyKey(context.Background(), sqlc.GetIdempotencyKeyParams{Owner: staffKey.Owner, Key: staffKey.Key})
+	require.NoError(t, err)
+	var replayed sqlc.NewOrderTxResult
+	require.NoError(t, json.Unmarshal(saved.ResponseBody, &replayed))
+	require.Equal(t, result.User.Username, replayed.EditedUser.Username)
+	require.Equal(t, sqlc.ErasedValue, replayed.EditedUser.FullName)
+	require.Equal(t, sqlc.ErasedValue, replayed.OrderMade.FullName)
+	require.Equal(t, sqlc.ErasedValue, replayed.OrderMade.ShippingLocation)
+	require.Equal(t, order.PurchaseAmount, replayed.OrderMade.PurchaseAmount)
+
+	// The customer's own keys no longer carry their username
+	_, err = store.GetIdempotencyKey(context.Background(), sqlc.GetIdempotencyKeyParams{Owner: ownKey.Owner, Key: ownKey.Key})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+	_, err = store.GetIdempotencyKey(context.Background(), sqlc.GetIdempotencyKeyParams{Owner: sqlc.UserIdentity(result.User.Username), Key: ownKey.Key})
+	require.NoError(t, err)
+
+	// Replaying the order.created delivery can't send their PII again
+	deliveries := deliveriesOf(t, store, hook)
+	require.Len(t, deliveries, 1)
+	var payload struct {
+		Data sqlc.Order
+	}
+	require.NoError(t, json.Unmarshal([]byte(deliveries[0].Payload), &payload))
+	require.Equal(t, order.OrderID, payload.Data.OrderID)
+	require.Equal(t, result.User.Username, payload.Data.Username)
+	require.Equal(t, sqlc.ErasedValue, payload.Data.FullName)
+	require.Equal(t, sqlc.ErasedValue, payload.Data.ShippingLocation)
+
+	// So does resuming the live feed from before the erasure
+	events := orderEventsOf(t, store, bounds.LatestID, order.OrderID)
+	require.NotEmpty(t, events)
+	for _, event := range events {
+		var feedOrder sqlc.Order
+		require.NoError(t, json.Unmarshal([]byte(event.Payload), &feedOrder))
+		require.Equal(t, result.User.Username, feedOrder.Username)
+		require.Equal(t, sqlc.ErasedValue, feedOrder.FullName)
+		require.Equal(t, sqlc.ErasedValue, feedOrder.ShippingLocation)
+	}
+}
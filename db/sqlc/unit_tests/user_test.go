@@ -8,6 +8,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/samanthatb1/beadBashStorage/db/dberr"
 	sqlc "github.com/samanthatb1/beadBashStorage/db/sqlc"
 	"github.com/samanthatb1/beadBashStorage/util"
 	"github.com/stretchr/testify/require"
@@ -33,6 +34,7 @@ func createRandomUser(t *testing.T) sqlc.User {
 	require.Equal(t, newUserParams.Username, user.Username)
 	require.Equal(t, newUserParams.TotalOrders, user.TotalOrders)
 
+	require.Equal(t, util.CustomerRole, user.Role) // New users default to customers
 	require.NotZero(t, user.ID)
 	require.NotZero(t, user.CreatedAt)
 
@@ -83,6 +85,20 @@ func TestUpdateUser(t *testing.T){
 	require.NoError(t, err)
 	allUserFieldsEqual(t, createdUser, updatedUser, false)
 	require.Equal(t, userParams.TotalOrders, updatedUser.TotalOrders)
+	require.Equal(t, createdUser.Version + 1, updatedUser.Version)
+}
+
+// Test Scenario: update user role
+func TestUpdateUserRole(t *testing.T){
+	createdUser := createRandomUser(t)
+
+	updatedUser, err := testQueries.UpdateUserRole(context.Background(), sqlc.UpdateUserRoleParams{
+		Username: createdUser.Username,
+		Role: util.FulfillmentRole,
+	})
+	require.NoError(t, err)
+	allUserFieldsEqual(t, createdUser, updatedUser, true)
+	require.Equal(t, util.FulfillmentRole, updatedUser.Role)
 }
 
 // Test Scenario: delete user
@@ -123,4 +139,17 @@ func TestNonExistUser(t *testing.T){
 	require.Error(t, err)
 	require.EqualError(t, err, sql.ErrNoRows.Error())
 	require.Empty(t, getUser) 
-}
\ No newline at end of file
+}
+
+// Test Scenario: a taken username is reported as a conflict with a stable code
+func TestCreateUserTakenUsername(t *testing.T){
+	user := createRandomUser(t)
+
+	_, err := testQueries.CreateUser(context.Background(), sqlc.CreateUserParams{
+		FullName: util.RandomLongString(),
+		Username: user.Username,
+	})
+	err = dberr.Translate(err)
+	require.Equal(t, dberr.Conflict, dberr.KindOf(err))
+	require.Equal(t, "username_taken", dberr.As(err).Code)
+}
@@ -0,0 +1,207 @@
+// Unit tests for queueing webhook events in the store and sending them to an httptest receiver
+
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	sqlc "github.com/samanthatb1/beadBashStorage/db/sqlc"
+	"github.com/samanthatb1/beadBashStorage/pii"
+	"github.com/samanthatb1/beadBashStorage/util"
+	"github.com/samanthatb1/beadBashStorage/webhook"
+	"github.com/stretchr/testify/require"
+)
+
+/* Helper Functions */
+
+// Subscribes a webhook for the test, it's deleted with its deliveries when the test ends
+func createTestWebhook(t *testing.T, store *sqlc.Store, url string, events ...string) sqlc.Webhook {
+	hook, err := store.CreateWebhook(context.Background(), sqlc.CreateWebhookParams{
+		Url: url,
+		Events: events,
+		Secret: "whsec_" + util.RandomLongString(),
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		testQueries.DeleteWebhook(context.Background(), hook.ID)
+	})
+	return hook
+}
+
+func deliveriesOf(t *testing.T, store *sqlc.Store, hook sqlc.Webhook) []sqlc.WebhookDelivery {
+	deliveries, err := store.ListWebhookDeliveries(context.Background(), sqlc.ListWebhookDeliveriesParams{WebhookID: hook.ID, MaxRows: 100})
+	require.NoError(t, err)
+	return deliveries
+}
+
+func randomOrderParams() sqlc.NewOrderTxParams {
+	return sqlc.NewOrderTxParams{
+		Username: util.RandomLongString(),
+		FullName: util.RandomLongString(),
+		PurchaseAmount: util.RandomCost(),
+		PurchasedItem: util.RandomLongString(),
+		ShippingLocation: util.RandomLongString(),
+		Currency: util.RandomCurrency(),
+		DateOrdered: util.RandomLongString(),
+	}
+}
+
+/* Test Functions */
+
+// Test Scenario: the secret is encrypted in the DB and read back decrypted
+func TestCreateWebhook(t *testing.T){
+	store := newEncryptedStore(t)
+	hook := createTestWebhook(t, store, "https://example.com/hooks", sqlc.EventOrderCreated)
+
+	raw, err := testQueries.GetWebhook(context.Background(), hook.ID)
+	require.NoError(t, err)
+	require.True(t, pii.IsEncrypted(raw.Secret))
+
+	stored, err := store.GetWebhook(context.Background(), hook.ID)
+	require.NoError(t, err)
+	require.Equal(t, hook.Secret, stored.Secret)
+	require.Equal(t, []string{sqlc.EventOrderCreated}, stored.Events)
+}
+
+// Test Scenario: every change queues a delivery for the webhooks subscribed to its event, and only for them
+func TestWebhookEvents(t *testing.T){
+	store := newEncryptedStore(t)
+	orderHook := createTestWebhook(t, store, "https://example.com/orders", sqlc.EventOrderCreated, sqlc.EventOrderUpdated, sqlc.EventOrderDeleted)
+	userHook := createTestWebhook(t, store, "https://example.com/users", sqlc.EventUserDeleted)
+
+	created, err := store.NewOrderTx(context.Background(), randomOrderParams())
+	require.NoError(t, err)
+	item := "Anklet"
+	_, err = store.PatchOrderTx(context.Background(), sqlc.PatchOrderTxParams{OrderID: created.OrderMade.OrderID, PurchasedItem: &item})
+	require.NoError(t, err)
+	_, err = store.DeleteOrderTx(context.Background(), sqlc.DeleteOrderTxParams{OrderID: created.OrderMade.OrderID})
+	require.NoError(t, err)
+	_, err = store.DeleteUserTx(context.Background(), sqlc.DeleteUserTxParams{ID: created.EditedUser.ID})
+	require.NoError(t, err)
+
+	// Newest first
+	deliveries := deliveriesOf(t, store, orderHook)
+	require.Len(t, deliveries, 3)
+	events := []string{sqlc.EventOrderDeleted, sqlc.EventOrderUpdated, sqlc.EventOrderCreated}
+	for i, delivery := range deliveries {
+		require.Equal(t, events[i], delivery.Event)
+		require.Equal(t, sqlc.DeliveryPending, delivery.Status)
+
+		var payload struct {
+			Event string
+			Data  sqlc.Order
+		}
+		require.NoError(t, json.Unmarshal([]byte(delivery.Payload), &payload))
+		require.Equal(t, events[i], payload.Event)
+		require.Equal(t, created.OrderMade.OrderID, payload.Data.OrderID)
+		require.Equal(t, created.OrderMade.FullName, payload.Data.FullName) // Decrypted
+		if delivery.Event == sqlc.EventOrderCreated {
+			require.Equal(t, created.OrderMade.PurchasedItem, payload.Data.PurchasedItem)
+		} else {
+			require.Equal(t, item, payload.Data.PurchasedItem) // Deleted orders are sent as they were
+		}
+	}
+
+	// The payload holds PII, so it's encrypted in the DB
+	raw, err := testQueries.GetWebhookDelivery(context.Background(), sqlc.GetWebhookDeliveryParams{ID: deliveries[0].ID, WebhookID: orderHook.ID})
+	require.NoError(t, err)
+	require.True(t, pii.IsEncrypted(raw.Payload))
+
+	deliveries = deliveriesOf(t, store, userHook)
+	require.Len(t, deliveries, 1)
+	require.Equal(t, sqlc.EventUserDeleted, deliveries[0].Event)
+	require.Contains(t, deliveries[0].Payload, created.EditedUser.Username)
+}
+
+// Test Scenario: a failed transaction doesn't queue its event
+func TestWebhookEventRolledBack(t *testing.T){
+	store := sqlc.NewStore(testDB, nil)
+	hook := createTestWebhook(t, store, "https://example.com/hooks", sqlc.EventOrderUpdated)
+	order := createRandomOrder(t, createRandomUser(t))
+
+	item := "Anklet"
+	_, err := store.PatchOrderTx(context.Background(), sqlc.PatchOrderTxParams{OrderID: order.OrderID, Versions: []int64{order.Version + 1}, PurchasedItem: &item})
+	require.ErrorIs(t, err, sqlc.ErrVersionMismatch)
+	require.Empty(t, deliveriesOf(t, store, hook))
+}
+
+// Test Scenario: the dispatcher sends queued deliveries to the receiver, retries failures and replays stay in the log
+func TestWebhookDispatch(t *testing.T){
+	store := newEncryptedStore(t)
+
+	var mu sync.Mutex
+	fail := true
+	var bodies [][]byte
+	var signatures []string
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, body)
+		signatures = append(signatures, r.Header.Get(webhook.SignatureHeader))
+		if fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer receiver.Close()
+
+	hook := createTestWebhook(t, store, receiver.URL, sqlc.EventOrderCreated)
+	_, err := store.NewOrderTx(context.Background(), randomOrderParams())
+	require.NoError(t, err)
+
+	dispatcher := webhook.NewDispatcher(store, webhook.Options{MaxAttempts: 2, RetryBase: 0, RetryMax: time.Hour, Timeout: 5 * time.Second, BatchSize: 100, AllowPrivateNetworks: true}) // The receiver is on loopback
+
+	// First attempt fails, the retry is due right away since RetryBase is 0
+	_, err = dispatcher.DeliverDue(context.Background())
+	require.NoError(t, err)
+	delivery := deliveriesOf(t, store, hook)[0]
+	require.Equal(t, sqlc.DeliveryPending, delivery.Status)
+	require.Equal(t, int32(1), delivery.Attempts)
+	require.Equal(t, int32(http.StatusServiceUnavailable), delivery.LastStatusCode)
+
+	// Second attempt succeeds
+	mu.Lock()
+	fail = false
+	mu.Unlock()
+	_, err = dispatcher.DeliverDue(context.Background())
+	require.NoError(t, err)
+	delivery = deliveriesOf(t, store, hook)[0]
+	require.Equal(t, sqlc.DeliverySucceeded, delivery.Status)
+	require.Equal(t, int32(2), delivery.Attempts)
+	require.True(t, delivery.DeliveredAt.Valid)
+
+	mu.Lock()
+	require.Len(t, bodies, 2)
+	require.Equal(t, delivery.Payload, string(bodies[1]))
+	require.NoError(t, webhook.Verify(hook.Secret, signatures[1], bodies[1], time.Minute))
+	mu.Unlock()
+
+	// Replaying queues the same payload as a new delivery
+	replay, err := store.ReplayWebhookDeliveryTx(context.Background(), sqlc.GetWebhookDeliveryParams{ID: delivery.ID, WebhookID: hook.ID})
+	require.NoError(t, err)
+	require.Equal(t, delivery.ID, replay.ReplayOf.Int64)
+	require.Equal(t, delivery.Payload, replay.Payload)
+	_, err = dispatcher.DeliverDue(context.Background())
+	require.NoError(t, err)
+
+	deliveries := deliveriesOf(t, store, hook)
+	require.Len(t, deliveries, 2)
+	require.Equal(t, replay.ID, deliveries[0].ID)
+	require.Equal(t, sqlc.DeliverySucceeded, deliveries[0].Status)
+	mu.Lock()
+	require.Len(t, bodies, 3)
+	require.Equal(t, bodies[1], bodies[2])
+	mu.Unlock()
+
+	// Only deliveries of the webhook can be replayed through it
+	_, err = store.ReplayWebhookDeliveryTx(context.Background(), sqlc.GetWebhookDeliveryParams{ID: delivery.ID, WebhookID: hook.ID + 1})
+	require.ErrorIs(t, err, sql.ErrNoRows)
+}
@@ -5,26 +5,71 @@ package db
 
 import (
 	"context"
+
+	"github.com/lib/pq"
 )
 
+const addUserOrders = `-- name: AddUserOrders :one
+UPDATE users
+SET total_orders = total_orders + $2::bigint,
+version = version + 1
+WHERE id = $1
+RETURNING id, username, full_name, total_orders, created_at, role, version, full_name_bidx, erased_at, search_vector, pii_tokens, updated_at
+`
+
+type AddUserOrdersParams struct {
+	ID    int64 `json:"id"`
+	Count int64 `json:"count"`
+}
+
+func (q *Queries) AddUserOrders(ctx context.Context, arg AddUserOrdersParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, addUserOrders, arg.ID, arg.Count)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.FullName,
+		&i.TotalOrders,
+		&i.CreatedAt,
+		&i.Role,
+		&i.Version,
+		&i.FullNameBidx,
+		&i.ErasedAt,
+		&i.SearchVector,
+		pq.Array(&i.PiiTokens),
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (
   full_name,
+  full_name_bidx,
+  pii_tokens,
   username,
   total_orders
 ) VALUES (
-  $1, $2, $3
-) RETURNING id, username, full_name, total_orders, created_at
+  $1, $2, coalesce($5::varchar[], '{}'), $3, $4
+) RETURNING id, username, full_name, total_orders, created_at, role, version, full_name_bidx, erased_at, search_vector, pii_tokens, updated_at
 `
 
 type CreateUserParams struct {
-	FullName    string `json:"full_name"`
-	Username    string `json:"username"`
-	TotalOrders int64  `json:"total_orders"`
+	FullName     string   `json:"full_name"`
+	FullNameBidx string   `json:"-"`
+	Username     string   `json:"username"`
+	TotalOrders  int64    `json:"total_orders"`
+	PiiTokens    []string `json:"pii_tokens"`
 }
 
 func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, error) {
-	row := q.db.QueryRowContext(ctx, createUser, arg.FullName, arg.Username, arg.TotalOrders)
+	row := q.db.QueryRowContext(ctx, createUser,
+		arg.FullName,
+		arg.FullNameBidx,
+		arg.Username,
+		arg.TotalOrders,
+		pq.Array(arg.PiiTokens),
+	)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -32,6 +77,13 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.FullName,
 		&i.TotalOrders,
 		&i.CreatedAt,
+		&i.Role,
+		&i.Version,
+		&i.FullNameBidx,
+		&i.ErasedAt,
+		&i.SearchVector,
+		pq.Array(&i.PiiTokens),
+		&i.UpdatedAt,
 	)
 	return i, err
 }
@@ -46,8 +98,52 @@ func (q *Queries) DeleteUser(ctx context.Context, username string) error {
 	return err
 }
 
+const eraseUser = `-- name: EraseUser :one
+UPDATE users
+SET username = $2,
+full_name = $3,
+full_name_bidx = $4,
+pii_tokens = '{}',
+erased_at = now(),
+version = version + 1
+WHERE id = $1
+RETURNING id, username, full_name, total_orders, created_at, role, version, full_name_bidx, erased_at, search_vector, pii_tokens, updated_at
+`
+
+type EraseUserParams struct {
+	ID           int64  `json:"id"`
+	Username     string `json:"username"`
+	FullName     string `json:"full_name"`
+	FullNameBidx string `json:"-"`
+}
+
+func (q *Queries) EraseUser(ctx context.Context, arg EraseUserParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, eraseUser,
+		arg.ID,
+		arg.Username,
+		arg.FullName,
+		arg.FullNameBidx,
+	)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.FullName,
+		&i.TotalOrders,
+		&i.CreatedAt,
+		&i.Role,
+		&i.Version,
+		&i.FullNameBidx,
+		&i.ErasedAt,
+		&i.SearchVector,
+		pq.Array(&i.PiiTokens),
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
 const getUserById = `-- name: GetUserById :one
-SELECT id, username, full_name, total_orders, created_at FROM users
+SELECT id, username, full_name, total_orders, created_at, role, version, full_name_bidx, erased_at, search_vector, pii_tokens, updated_at FROM users
 WHERE id = $1 LIMIT 1
 `
 
@@ -60,12 +156,19 @@ func (q *Queries) GetUserById(ctx context.Context, id int64) (User, error) {
 		&i.FullName,
 		&i.TotalOrders,
 		&i.CreatedAt,
+		&i.Role,
+		&i.Version,
+		&i.FullNameBidx,
+		&i.ErasedAt,
+		&i.SearchVector,
+		pq.Array(&i.PiiTokens),
+		&i.UpdatedAt,
 	)
 	return i, err
 }
 
 const getUserByUsername = `-- name: GetUserByUsername :one
-SELECT id, username, full_name, total_orders, created_at FROM users
+SELECT id, username, full_name, total_orders, created_at, role, version, full_name_bidx, erased_at, search_vector, pii_tokens, updated_at FROM users
 WHERE username = $1 LIMIT 1
 `
 
@@ -78,12 +181,45 @@ func (q *Queries) GetUserByUsername(ctx context.Context, username string) (User,
 		&i.FullName,
 		&i.TotalOrders,
 		&i.CreatedAt,
+		&i.Role,
+		&i.Version,
+		&i.FullNameBidx,
+		&i.ErasedAt,
+		&i.SearchVector,
+		pq.Array(&i.PiiTokens),
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const getUserForUpdate = `-- name: GetUserForUpdate :one
+SELECT id, username, full_name, total_orders, created_at, role, version, full_name_bidx, erased_at, search_vector, pii_tokens, updated_at FROM users
+WHERE id = $1 LIMIT 1
+FOR UPDATE
+`
+
+func (q *Queries) GetUserForUpdate(ctx context.Context, id int64) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserForUpdate, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.FullName,
+		&i.TotalOrders,
+		&i.CreatedAt,
+		&i.Role,
+		&i.Version,
+		&i.FullNameBidx,
+		&i.ErasedAt,
+		&i.SearchVector,
+		pq.Array(&i.PiiTokens),
+		&i.UpdatedAt,
 	)
 	return i, err
 }
 
 const listUsers = `-- name: ListUsers :many
-SELECT id, username, full_name, total_orders, created_at FROM users
+SELECT id, username, full_name, total_orders, created_at, role, version, full_name_bidx, erased_at, search_vector, pii_tokens, updated_at FROM users
 ORDER BY id
 LIMIT $1
 OFFSET $2
@@ -109,6 +245,152 @@ func (q *Queries) ListUsers(ctx context.Context, arg ListUsersParams) ([]User, e
 			&i.FullName,
 			&i.TotalOrders,
 			&i.CreatedAt,
+			&i.Role,
+			&i.Version,
+			&i.FullNameBidx,
+			&i.ErasedAt,
+			&i.SearchVector,
+			pq.Array(&i.PiiTokens),
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUsersAfterId = `-- name: ListUsersAfterId :many
+SELECT id, username, full_name, total_orders, created_at, role, version, full_name_bidx, erased_at, search_vector, pii_tokens, updated_at FROM users
+WHERE id > $1
+ORDER BY id
+LIMIT $2
+`
+
+type ListUsersAfterIdParams struct {
+	ID    int64 `json:"id"`
+	Limit int32 `json:"limit"`
+}
+
+func (q *Queries) ListUsersAfterId(ctx context.Context, arg ListUsersAfterIdParams) ([]User, error) {
+	rows, err := q.db.QueryContext(ctx, listUsersAfterId, arg.ID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []User{}
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.Username,
+			&i.FullName,
+			&i.TotalOrders,
+			&i.CreatedAt,
+			&i.Role,
+			&i.Version,
+			&i.FullNameBidx,
+			&i.ErasedAt,
+			&i.SearchVector,
+			pq.Array(&i.PiiTokens),
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUsersByFullName = `-- name: ListUsersByFullName :many
+SELECT id, username, full_name, total_orders, created_at, role, version, full_name_bidx, erased_at, search_vector, pii_tokens, updated_at FROM users
+WHERE full_name_bidx = $1
+ORDER BY id
+LIMIT $2
+OFFSET $3
+`
+
+type ListUsersByFullNameParams struct {
+	FullNameBidx string `json:"-"`
+	Limit        int32  `json:"limit"`
+	Offset       int32  `json:"offset"`
+}
+
+func (q *Queries) ListUsersByFullName(ctx context.Context, arg ListUsersByFullNameParams) ([]User, error) {
+	rows, err := q.db.QueryContext(ctx, listUsersByFullName, arg.FullNameBidx, arg.Limit, arg.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []User{}
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.Username,
+			&i.FullName,
+			&i.TotalOrders,
+			&i.CreatedAt,
+			&i.Role,
+			&i.Version,
+			&i.FullNameBidx,
+			&i.ErasedAt,
+			&i.SearchVector,
+			pq.Array(&i.PiiTokens),
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listUsersByUsernames = `-- name: ListUsersByUsernames :many
+SELECT id, username, full_name, total_orders, created_at, role, version, full_name_bidx, erased_at, search_vector, pii_tokens, updated_at FROM users
+WHERE username = ANY($1::varchar[])
+`
+
+func (q *Queries) ListUsersByUsernames(ctx context.Context, usernames []string) ([]User, error) {
+	rows, err := q.db.QueryContext(ctx, listUsersByUsernames, pq.Array(usernames))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []User{}
+	for rows.Next() {
+		var i User
+		if err := rows.Scan(
+			&i.ID,
+			&i.Username,
+			&i.FullName,
+			&i.TotalOrders,
+			&i.CreatedAt,
+			&i.Role,
+			&i.Version,
+			&i.FullNameBidx,
+			&i.ErasedAt,
+			&i.SearchVector,
+			pq.Array(&i.PiiTokens),
+			&i.UpdatedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -125,9 +407,10 @@ func (q *Queries) ListUsers(ctx context.Context, arg ListUsersParams) ([]User, e
 
 const updateUser = `-- name: UpdateUser :one
 UPDATE users
-SET total_orders = $2
+SET total_orders = $2,
+version = version + 1
 WHERE id = $1
-RETURNING id, username, full_name, total_orders, created_at
+RETURNING id, username, full_name, total_orders, created_at, role, version, full_name_bidx, erased_at, search_vector, pii_tokens, updated_at
 `
 
 type UpdateUserParams struct {
@@ -144,6 +427,71 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, e
 		&i.FullName,
 		&i.TotalOrders,
 		&i.CreatedAt,
+		&i.Role,
+		&i.Version,
+		&i.FullNameBidx,
+		&i.ErasedAt,
+		&i.SearchVector,
+		pq.Array(&i.PiiTokens),
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const updateUserPII = `-- name: UpdateUserPII :exec
+UPDATE users
+SET full_name = $2,
+full_name_bidx = $3,
+pii_tokens = coalesce($4::varchar[], '{}')
+WHERE id = $1
+`
+
+type UpdateUserPIIParams struct {
+	ID           int64    `json:"id"`
+	FullName     string   `json:"full_name"`
+	FullNameBidx string   `json:"-"`
+	PiiTokens    []string `json:"pii_tokens"`
+}
+
+func (q *Queries) UpdateUserPII(ctx context.Context, arg UpdateUserPIIParams) error {
+	_, err := q.db.ExecContext(ctx, updateUserPII,
+		arg.ID,
+		arg.FullName,
+		arg.FullNameBidx,
+		pq.Array(arg.PiiTokens),
+	)
+	return err
+}
+
+const updateUserRole = `-- name: UpdateUserRole :one
+UPDATE users
+SET role = $2,
+version = version + 1
+WHERE username = $1
+RETURNING id, username, full_name, total_orders, created_at, role, version, full_name_bidx, erased_at, search_vector, pii_tokens, updated_at
+`
+
+type UpdateUserRoleParams struct {
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+func (q *Queries) UpdateUserRole(ctx context.Context, arg UpdateUserRoleParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, updateUserRole, arg.Username, arg.Role)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Username,
+		&i.FullName,
+		&i.TotalOrders,
+		&i.CreatedAt,
+		&i.Role,
+		&i.Version,
+		&i.FullNameBidx,
+		&i.ErasedAt,
+		&i.SearchVector,
+		pq.Array(&i.PiiTokens),
+		&i.UpdatedAt,
 	)
 	return i, err
 }
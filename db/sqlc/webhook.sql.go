@@ -0,0 +1,461 @@
+// Code generated by sqlc. DO NOT EDIT.
+// source: webhook.sql
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const claimWebhookDeliveries = `-- name: ClaimWebhookDeliveries :many
+UPDATE webhook_deliveries
+SET next_attempt_at = $1
+WHERE id IN (
+  SELECT id FROM webhook_deliveries
+  WHERE status = 'pending' AND next_attempt_at <= now()
+  ORDER BY next_attempt_at
+  LIMIT $2
+  FOR UPDATE SKIP LOCKED
+)
+RETURNING id, webhook_id, event, payload, status, attempts, next_attempt_at, last_status_code, last_error, delivered_at, replay_of, created_at
+`
+
+type ClaimWebhookDeliveriesParams struct {
+	LeaseUntil time.Time `json:"lease_until"`
+	MaxRows    int32     `json:"max_rows"`
+}
+
+// Due deliveries are pushed back until lease_until so no other dispatcher sends them in the meantime,
+// if the dispatcher dies before recording the attempt they're sent again after the lease
+func (q *Queries) ClaimWebhookDeliveries(ctx context.Context, arg ClaimWebhookDeliveriesParams) ([]WebhookDelivery, error) {
+	rows, err := q.db.QueryContext(ctx, claimWebhookDeliveries, arg.LeaseUntil, arg.MaxRows)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []WebhookDelivery{}
+	for rows.Next() {
+		var i WebhookDelivery
+		if err := rows.Scan(
+			&i.ID,
+			&i.WebhookID,
+			&i.Event,
+			&i.Payload,
+			&i.Status,
+			&i.Attempts,
+			&i.NextAttemptAt,
+			&i.LastStatusCode,
+			&i.LastError,
+			&i.DeliveredAt,
+			&i.ReplayOf,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const createWebhook = `-- name: CreateWebhook :one
+INSERT INTO webhooks (
+  url,
+  events,
+  secret
+) VALUES (
+  $1, $2, $3
+) RETURNING id, url, events, secret, created_at
+`
+
+type CreateWebhookParams struct {
+	Url    string   `json:"url"`
+	Events []string `json:"events"`
+	Secret string   `json:"-"`
+}
+
+func (q *Queries) CreateWebhook(ctx context.Context, arg CreateWebhookParams) (Webhook, error) {
+	row := q.db.QueryRowContext(ctx, createWebhook, arg.Url, pq.Array(arg.Events), arg.Secret)
+	var i Webhook
+	err := row.Scan(
+		&i.ID,
+		&i.Url,
+		pq.Array(&i.Events),
+		&i.Secret,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const createWebhookDelivery = `-- name: CreateWebhookDelivery :one
+INSERT INTO webhook_deliveries (
+  webhook_id,
+  event,
+  payload,
+  replay_of
+) VALUES (
+  $1, $2, $3, $4
+) RETURNING id, webhook_id, event, payload, status, attempts, next_attempt_at, last_status_code, last_error, delivered_at, replay_of, created_at
+`
+
+type CreateWebhookDeliveryParams struct {
+	WebhookID int64         `json:"webhook_id"`
+	Event     string        `json:"event"`
+	Payload   string        `json:"payload"`
+	ReplayOf  sql.NullInt64 `json:"replay_of"`
+}
+
+func (q *Queries) CreateWebhookDelivery(ctx context.Context, arg CreateWebhookDeliveryParams) (WebhookDelivery, error) {
+	row := q.db.QueryRowContext(ctx, createWebhookDelivery,
+		arg.WebhookID,
+		arg.Event,
+		arg.Payload,
+		arg.ReplayOf,
+	)
+	var i WebhookDelivery
+	err := row.Scan(
+		&i.ID,
+		&i.WebhookID,
+		&i.Event,
+		&i.Payload,
+		&i.Status,
+		&i.Attempts,
+		&i.NextAttemptAt,
+		&i.LastStatusCode,
+		&i.LastError,
+		&i.DeliveredAt,
+		&i.ReplayOf,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const deleteWebhook = `-- name: DeleteWebhook :one
+DELETE FROM webhooks
+WHERE id = $1
+RETURNING id, url, events, secret, created_at
+`
+
+func (q *Queries) DeleteWebhook(ctx context.Context, id int64) (Webhook, error) {
+	row := q.db.QueryRowContext(ctx, deleteWebhook, id)
+	var i Webhook
+	err := row.Scan(
+		&i.ID,
+		&i.Url,
+		pq.Array(&i.Events),
+		&i.Secret,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getWebhook = `-- name: GetWebhook :one
+SELECT id, url, events, secret, created_at FROM webhooks
+WHERE id = $1 LIMIT 1
+`
+
+func (q *Queries) GetWebhook(ctx context.Context, id int64) (Webhook, error) {
+	row := q.db.QueryRowContext(ctx, getWebhook, id)
+	var i Webhook
+	err := row.Scan(
+		&i.ID,
+		&i.Url,
+		pq.Array(&i.Events),
+		&i.Secret,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getWebhookDelivery = `-- name: GetWebhookDelivery :one
+SELECT id, webhook_id, event, payload, status, attempts, next_attempt_at, last_status_code, last_error, delivered_at, replay_of, created_at FROM webhook_deliveries
+WHERE id = $1 AND webhook_id = $2 LIMIT 1
+`
+
+type GetWebhookDeliveryParams struct {
+	ID        int64 `json:"id"`
+	WebhookID int64 `json:"webhook_id"`
+}
+
+func (q *Queries) GetWebhookDelivery(ctx context.Context, arg GetWebhookDeliveryParams) (WebhookDelivery, error) {
+	row := q.db.QueryRowContext(ctx, getWebhookDelivery, arg.ID, arg.WebhookID)
+	var i WebhookDelivery
+	err := row.Scan(
+		&i.ID,
+		&i.WebhookID,
+		&i.Event,
+		&i.Payload,
+		&i.Status,
+		&i.Attempts,
+		&i.NextAttemptAt,
+		&i.LastStatusCode,
+		&i.LastError,
+		&i.DeliveredAt,
+		&i.ReplayOf,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const listWebhookDeliveries = `-- name: ListWebhookDeliveries :many
+SELECT id, webhook_id, event, payload, status, attempts, next_attempt_at, last_status_code, last_error, delivered_at, replay_of, created_at FROM webhook_deliveries
+WHERE webhook_id = $1
+AND ($2::varchar IS NULL OR status = $2)
+AND ($3::bigint IS NULL OR id < $3)
+ORDER BY id DESC
+LIMIT $4
+`
+
+type ListWebhookDeliveriesParams struct {
+	WebhookID int64          `json:"webhook_id"`
+	Status    sql.NullString `json:"status"`
+	BeforeID  sql.NullInt64  `json:"before_id"`
+	MaxRows   int32          `json:"max_rows"`
+}
+
+func (q *Queries) ListWebhookDeliveries(ctx context.Context, arg ListWebhookDeliveriesParams) ([]WebhookDelivery, error) {
+	rows, err := q.db.QueryContext(ctx, listWebhookDeliveries,
+		arg.WebhookID,
+		arg.Status,
+		arg.BeforeID,
+		arg.MaxRows,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []WebhookDelivery{}
+	for rows.Next() {
+		var i WebhookDelivery
+		if err := rows.Scan(
+			&i.ID,
+			&i.WebhookID,
+			&i.Event,
+			&i.Payload,
+			&i.Status,
+			&i.Attempts,
+			&i.NextAttemptAt,
+			&i.LastStatusCode,
+			&i.LastError,
+			&i.DeliveredAt,
+			&i.ReplayOf,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listWebhookDeliveriesAfterId = `-- name: ListWebhookDeliveriesAfterId :many
+SELECT id, webhook_id, event, payload, status, attempts, next_attempt_at, last_status_code, last_error, delivered_at, replay_of, created_at FROM webhook_deliveries
+WHERE id > $1
+ORDER BY id
+LIMIT $2
+`
+
+type ListWebhookDeliveriesAfterIdParams struct {
+	ID    int64 `json:"id"`
+	Limit int32 `json:"limit"`
+}
+
+func (q *Queries) ListWebhookDeliveriesAfterId(ctx context.Context, arg ListWebhookDeliveriesAfterIdParams) ([]WebhookDelivery, error) {
+	rows, err := q.db.QueryContext(ctx, listWebhookDeliveriesAfterId, arg.ID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []WebhookDelivery{}
+	for rows.Next() {
+		var i WebhookDelivery
+		if err := rows.Scan(
+			&i.ID,
+			&i.WebhookID,
+			&i.Event,
+			&i.Payload,
+			&i.Status,
+			&i.Attempts,
+			&i.NextAttemptAt,
+			&i.LastStatusCode,
+			&i.LastError,
+			&i.DeliveredAt,
+			&i.ReplayOf,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listWebhooks = `-- name: ListWebhooks :many
+SELECT id, url, events, secret, created_at FROM webhooks
+ORDER BY id
+`
+
+func (q *Queries) ListWebhooks(ctx context.Context) ([]Webhook, error) {
+	rows, err := q.db.QueryContext(ctx, listWebhooks)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Webhook{}
+	for rows.Next() {
+		var i Webhook
+		if err := rows.Scan(
+			&i.ID,
+			&i.Url,
+			pq.Array(&i.Events),
+			&i.Secret,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listWebhooksForEvent = `-- name: ListWebhooksForEvent :many
+SELECT id, url, events, secret, created_at FROM webhooks
+WHERE $1::varchar = ANY(events)
+ORDER BY id
+`
+
+func (q *Queries) ListWebhooksForEvent(ctx context.Context, event string) ([]Webhook, error) {
+	rows, err := q.db.QueryContext(ctx, listWebhooksForEvent, event)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	items := []Webhook{}
+	for rows.Next() {
+		var i Webhook
+		if err := rows.Scan(
+			&i.ID,
+			&i.Url,
+			pq.Array(&i.Events),
+			&i.Secret,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const recordWebhookAttempt = `-- name: RecordWebhookAttempt :one
+UPDATE webhook_deliveries
+SET attempts = attempts + 1,
+status = $1,
+next_attempt_at = $2,
+last_status_code = $3,
+last_error = $4,
+delivered_at = $5
+WHERE id = $6
+RETURNING id, webhook_id, event, payload, status, attempts, next_attempt_at, last_status_code, last_error, delivered_at, replay_of, created_at
+`
+
+type RecordWebhookAttemptParams struct {
+	Status         string       `json:"status"`
+	NextAttemptAt  time.Time    `json:"next_attempt_at"`
+	LastStatusCode int32        `json:"last_status_code"`
+	LastError      string       `json:"last_error"`
+	DeliveredAt    sql.NullTime `json:"delivered_at"`
+	ID             int64        `json:"id"`
+}
+
+func (q *Queries) RecordWebhookAttempt(ctx context.Context, arg RecordWebhookAttemptParams) (WebhookDelivery, error) {
+	row := q.db.QueryRowContext(ctx, recordWebhookAttempt,
+		arg.Status,
+		arg.NextAttemptAt,
+		arg.LastStatusCode,
+		arg.LastError,
+		arg.DeliveredAt,
+		arg.ID,
+	)
+	var i WebhookDelivery
+	err := row.Scan(
+		&i.ID,
+		&i.WebhookID,
+		&i.Event,
+		&i.Payload,
+		&i.Status,
+		&i.Attempts,
+		&i.NextAttemptAt,
+		&i.LastStatusCode,
+		&i.LastError,
+		&i.DeliveredAt,
+		&i.ReplayOf,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const updateWebhookDeliveryPayload = `-- name: UpdateWebhookDeliveryPayload :exec
+UPDATE webhook_deliveries
+SET payload = $2
+WHERE id = $1
+`
+
+type UpdateWebhookDeliveryPayloadParams struct {
+	ID      int64  `json:"id"`
+	Payload string `json:"payload"`
+}
+
+func (q *Queries) UpdateWebhookDeliveryPayload(ctx context.Context, arg UpdateWebhookDeliveryPayloadParams) error {
+	_, err := q.db.ExecContext(ctx, updateWebhookDeliveryPayload, arg.ID, arg.Payload)
+	return err
+}
+
+const updateWebhookSecret = `-- name: UpdateWebhookSecret :exec
+UPDATE webhooks
+SET secret = $2
+WHERE id = $1
+`
+
+type UpdateWebhookSecretParams struct {
+	ID     int64  `json:"id"`
+	Secret string `json:"-"`
+}
+
+func (q *Queries) UpdateWebhookSecret(ctx context.Context, arg UpdateWebhookSecretParams) error {
+	_, err := q.db.ExecContext(ctx, updateWebhookSecret, arg.ID, arg.Secret)
+	return err
+}
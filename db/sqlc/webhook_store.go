@@ -0,0 +1,171 @@
+// Outbound webhooks: events are queued as deliveries in the transaction that caused them,
+// the webhook package sends them once the transaction has committed
+// Secrets and payloads are encrypted like PII, the Store methods here shadow the generated ones to decrypt them
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// Events a webhook can subscribe to
+const (
+	EventOrderCreated = "order.created"
+	EventOrderUpdated = "order.updated"
+	EventOrderDeleted = "order.deleted"
+	EventUserDeleted  = "user.deleted" // Also covers the user's orders, they don't get their own order.deleted
+)
+
+var WebhookEvents = []string{EventOrderCreated, EventOrderUpdated, EventOrderDeleted, EventUserDeleted}
+
+// Status of a delivery
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed" // Every attempt failed, it can still be replayed
+)
+
+// Body sent to the webhook, data is the order or user as it is after the event (before it for deletions)
+type WebhookEvent struct {
+	Event     string      `json:"event"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// A claimed delivery with the webhook it goes to, the payload and secret are decrypted
+type DueWebhookDelivery struct {
+	Delivery WebhookDelivery
+	Webhook  Webhook
+}
+
+/********* Events *********/
+
+// Queues a delivery of the event to every webhook subscribed to it, once per data item
+// Runs in the caller's transaction so events are only sent for changes that were committed
+func (store *Store) queueWebhookEvent(ctx context.Context, q *Queries, event string, data ...interface{}) error {
+	webhooks, err := q.ListWebhooksForEvent(ctx, event)
+	if err != nil || len(webhooks) == 0 {return err}
+
+	now := time.Now().UTC()
+	for _, item := range data {
+		body, err := json.Marshal(WebhookEvent{Event: event, CreatedAt: now, Data: item})
+		if err != nil {return err}
+		payload, err := store.cipher.Encrypt(string(body))
+		if err != nil {return err}
+
+		for _, webhook := range webhooks {
+			_, err = q.CreateWebhookDelivery(ctx, CreateWebhookDeliveryParams{WebhookID: webhook.ID, Event: event, Payload: payload})
+			if err != nil {return err}
+		}
+	}
+	return nil
+}
+
+/********* Webhooks *********/
+
+func (store *Store) decryptWebhook(webhook Webhook) (Webhook, error) {
+	var err error
+	webhook.Secret, err = store.cipher.Decrypt(webhook.Secret)
+	return webhook, err
+}
+
+func (store *Store) CreateWebhook(ctx context.Context, arg CreateWebhookParams) (Webhook, error) {
+	var err error
+	if arg.Secret, err = store.cipher.Encrypt(arg.Secret); err != nil {return Webhook{}, err}
+	webhook, err := store.Queries.CreateWebhook(ctx, arg)
+	if err != nil {return webhook, err}
+	return store.decryptWebhook(webhook)
+}
+
+func (store *Store) GetWebhook(ctx context.Context, id int64) (Webhook, error) {
+	webhook, err := store.Queries.GetWebhook(ctx, id)
+	if err != nil {return webhook, err}
+	return store.decryptWebhook(webhook)
+}
+
+func (store *Store) ListWebhooks(ctx context.Context) ([]Webhook, error) {
+	webhooks, err := store.Queries.ListWebhooks(ctx)
+	if err != nil {return nil, err}
+	for i := range webhooks {
+		if webhooks[i], err = store.decryptWebhook(webhooks[i]); err != nil {return nil, err}
+	}
+	return webhooks, nil
+}
+
+/********* Deliveries *********/
+
+func (store *Store) decryptDelivery(delivery WebhookDelivery) (WebhookDelivery, error) {
+	var err error
+	delivery.Payload, err = store.cipher.Decrypt(delivery.Payload)
+	return delivery, err
+}
+
+func (store *Store) GetWebhookDelivery(ctx context.Context, arg GetWebhookDeliveryParams) (WebhookDelivery, error) {
+	delivery, err := store.Queries.GetWebhookDelivery(ctx, arg)
+	if err != nil {return delivery, err}
+	return store.decryptDelivery(delivery)
+}
+
+func (store *Store) ListWebhookDeliveries(ctx context.Context, arg ListWebhookDeliveriesParams) ([]WebhookDelivery, error) {
+	deliveries, err := store.Queries.ListWebhookDeliveries(ctx, arg)
+	if err != nil {return nil, err}
+	for i := range deliveries {
+		if deliveries[i], err = store.decryptDelivery(deliveries[i]); err != nil {return nil, err}
+	}
+	return deliveries, nil
+}
+
+func (store *Store) RecordWebhookAttempt(ctx context.Context, arg RecordWebhookAttemptParams) (WebhookDelivery, error) {
+	delivery, err := store.Queries.RecordWebhookAttempt(ctx, arg)
+	if err != nil {return delivery, err}
+	return store.decryptDelivery(delivery)
+}
+
+// Claims up to limit due deliveries until leaseUntil, see ClaimWebhookDeliveries
+// Deliveries whose webhook was deleted in the meantime are left out
+func (store *Store) ClaimDueWebhookDeliveries(ctx context.Context, leaseUntil time.Time, limit int32) ([]DueWebhookDelivery, error) {
+	deliveries, err := store.Queries.ClaimWebhookDeliveries(ctx, ClaimWebhookDeliveriesParams{LeaseUntil: leaseUntil, MaxRows: limit})
+	if err != nil {return nil, err}
+
+	webhooks := map[int64]Webhook{}
+	due := make([]DueWebhookDelivery, 0, len(deliveries))
+	for _, delivery := range deliveries {
+		webhook, ok := webhooks[delivery.WebhookID]
+		if !ok {
+			webhook, err = store.GetWebhook(ctx, delivery.WebhookID)
+			if err == sql.ErrNoRows {continue}
+			if err != nil {return nil, err}
+			webhooks[delivery.WebhookID] = webhook
+		}
+		if delivery, err = store.decryptDelivery(delivery); err != nil {return nil, err}
+		due = append(due, DueWebhookDelivery{Delivery: delivery, Webhook: webhook})
+	}
+	return due, nil
+}
+
+// Queues the delivery again as a new delivery with the same payload, the original stays in the log as it was
+// Returns sql.ErrNoRows if the webhook has no such delivery
+func (store *Store) ReplayWebhookDeliveryTx(ctx context.Context, arg GetWebhookDeliveryParams) (WebhookDelivery, error) {
+	var result WebhookDelivery
+
+	err := store.execTx(ctx, func(q *Queries) error{
+		original, err := q.GetWebhookDelivery(ctx, arg)
+		if err != nil {return err}
+
+		delivery, err := q.CreateWebhookDelivery(ctx, CreateWebhookDeliveryParams{
+			WebhookID: original.WebhookID,
+			Event: original.Event,
+			Payload: original.Payload, // Still encrypted
+			ReplayOf: sql.NullInt64{Int64: original.ID, Valid: true},
+		})
+		if err != nil {return err}
+
+		result, err = store.decryptDelivery(delivery)
+		return err
+	})
+
+	return result, err
+}
@@ -0,0 +1,162 @@
+// Writes tables of rows as CSV, NDJSON or XLSX one row at a time, so exports never hold the whole table in memory
+
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Formats a table can be written in
+const (
+	CSV    = "csv"
+	NDJSON = "ndjson" // One JSON object per line, keyed by column
+	XLSX   = "xlsx"   // Excel workbook with one sheet
+)
+
+var contentTypes = map[string]string{
+	CSV:    "text/csv; charset=utf-8",
+	NDJSON: "application/x-ndjson",
+	XLSX:   "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+// Whether tables can be written in the format
+func IsFormat(format string) bool {
+	_, ok := contentTypes[format]
+	return ok
+}
+
+// Content type of files in the format, empty if it's unknown
+func ContentType(format string) string {
+	return contentTypes[format]
+}
+
+// Writes the rows of a table
+// Values can be strings, integers, floats, bools, times or nil
+type Writer interface {
+	WriteRow(values []interface{}) error
+	Close() error // Ends the file, doesn't close the io.Writer
+}
+
+// Starts a table with the columns, CSV and XLSX write them as the first row
+func NewWriter(format string, w io.Writer, columns []string) (Writer, error) {
+	switch format {
+	case CSV:
+		return newCSVWriter(w, columns)
+	case NDJSON:
+		return newNDJSONWriter(w, columns)
+	case XLSX:
+		return newXLSXWriter(w, columns)
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+}
+
+// Value as text, times are RFC 3339 in UTC
+func formatValue(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case int64:
+		return strconv.FormatInt(value, 10)
+	case int:
+		return strconv.Itoa(value)
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(value)
+	case time.Time:
+		return value.UTC().Format(time.RFC3339)
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+/**** CSV ****/
+
+type csvWriter struct {
+	writer *csv.Writer
+	record []string // Reused for every row
+}
+
+func newCSVWriter(w io.Writer, columns []string) (*csvWriter, error) {
+	writer := &csvWriter{writer: csv.NewWriter(w), record: make([]string, len(columns))}
+	if err := writer.writer.Write(columns); err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
+
+func (writer *csvWriter) WriteRow(values []interface{}) error {
+	for i, value := range values {
+		writer.record[i] = formatValue(value)
+		if _, ok := value.(string); ok {
+			writer.record[i] = escapeFormula(writer.record[i])
+		}
+	}
+	return writer.writer.Write(writer.record[:len(values)])
+}
+
+func (writer *csvWriter) Close() error {
+	writer.writer.Flush()
+	return writer.writer.Error()
+}
+
+// Spreadsheets run cells starting with these as formulas, e.g. a purchased item of "=HYPERLINK(...)"
+// A leading quote makes them text, numbers are never escaped
+func escapeFormula(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+/**** NDJSON ****/
+
+type ndjsonWriter struct {
+	writer *bufio.Writer
+	keys   [][]byte // Column names as JSON strings
+}
+
+func newNDJSONWriter(w io.Writer, columns []string) (*ndjsonWriter, error) {
+	writer := &ndjsonWriter{writer: bufio.NewWriter(w)}
+	for _, column := range columns {
+		key, err := json.Marshal(column)
+		if err != nil {
+			return nil, err
+		}
+		writer.keys = append(writer.keys, key)
+	}
+	return writer, nil
+}
+
+// Keys are written in column order, a map would sort them
+func (writer *ndjsonWriter) WriteRow(values []interface{}) error {
+	writer.writer.WriteByte('{')
+	for i, value := range values {
+		if i > 0 {
+			writer.writer.WriteByte(',')
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		writer.writer.Write(writer.keys[i])
+		writer.writer.WriteByte(':')
+		writer.writer.Write(data)
+	}
+	_, err := writer.writer.WriteString("}\n")
+	return err
+}
+
+func (writer *ndjsonWriter) Close() error {
+	return writer.writer.Flush()
+}
@@ -0,0 +1,109 @@
+// Unit tests for writing tables as CSV, NDJSON and XLSX
+
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+/* Helper Functions */
+
+var testColumns = []string{"order_id", "purchased_item", "purchase_amount", "created_at"}
+
+var testRows = [][]interface{}{
+	{int64(1), "Beaded necklace", 25.5, time.Date(2022, 10, 15, 13, 45, 0, 0, time.UTC)},
+	{int64(2), `=HYPERLINK("x"), "quoted" & <tagged>`, 8.0, nil},
+}
+
+// Writes the test rows in the format
+func writeTable(t *testing.T, format string) []byte {
+	buffer := &bytes.Buffer{}
+	writer, err := NewWriter(format, buffer, testColumns)
+	require.NoError(t, err)
+	for _, row := range testRows {
+		require.NoError(t, writer.WriteRow(row))
+	}
+	require.NoError(t, writer.Close())
+	return buffer.Bytes()
+}
+
+// Content of a file in the zip
+func readZipFile(t *testing.T, archive *zip.Reader, name string) []byte {
+	file, err := archive.Open(name)
+	require.NoError(t, err)
+	defer file.Close()
+	content, err := io.ReadAll(file)
+	require.NoError(t, err)
+	return content
+}
+
+/* Test Functions */
+
+// Test Scenario: CSV has a header row and cells that would run as formulas are escaped
+func TestWriteCSV(t *testing.T){
+	require.Equal(t, "order_id,purchased_item,purchase_amount,created_at\n"+
+		"1,Beaded necklace,25.5,2022-10-15T13:45:00Z\n"+
+		`2,"'=HYPERLINK(""x""), ""quoted"" & <tagged>",8,`+"\n", string(writeTable(t, CSV)))
+}
+
+// Test Scenario: NDJSON has an object per row with keys in column order
+func TestWriteNDJSON(t *testing.T){
+	require.Equal(t, `{"order_id":1,"purchased_item":"Beaded necklace","purchase_amount":25.5,"created_at":"2022-10-15T13:45:00Z"}`+"\n"+
+		`{"order_id":2,"purchased_item":"=HYPERLINK(\"x\"), \"quoted\" \u0026 \u003ctagged\u003e","purchase_amount":8,"created_at":null}`+"\n",
+		string(writeTable(t, NDJSON)))
+}
+
+// Test Scenario: XLSX is a workbook whose sheet has the header, numbers as numbers and strings as text
+func TestWriteXLSX(t *testing.T){
+	content := writeTable(t, XLSX)
+	archive, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	require.NoError(t, err)
+	for _, part := range xlsxParts {
+		require.Equal(t, part.content, string(readZipFile(t, archive, part.name)))
+	}
+
+	var sheet struct {
+		Rows []struct {
+			Number string `xml:"r,attr"`
+			Cells  []struct {
+				Type   string `xml:"t,attr"`
+				Value  string `xml:"v"`
+				Inline string `xml:"is>t"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	require.NoError(t, xml.Unmarshal(readZipFile(t, archive, "xl/worksheets/sheet1.xml"), &sheet))
+	require.Len(t, sheet.Rows, 3)
+	require.Equal(t, "3", sheet.Rows[2].Number)
+	require.Equal(t, "order_id", sheet.Rows[0].Cells[0].Inline)
+
+	cells := sheet.Rows[2].Cells
+	require.Len(t, cells, 4)
+	require.Equal(t, "", cells[0].Type)
+	require.Equal(t, "2", cells[0].Value)
+	require.Equal(t, "inlineStr", cells[1].Type)
+	require.Equal(t, testRows[1][1], cells[1].Inline) // Escaped in the XML, not changed
+	require.Equal(t, "8", cells[2].Value)
+	require.Equal(t, "2022-10-15T13:45:00Z", sheet.Rows[1].Cells[3].Inline)
+}
+
+// Test Scenario: a table with no rows still has its header, unknown formats are rejected
+func TestWriteEmptyTable(t *testing.T){
+	buffer := &bytes.Buffer{}
+	writer, err := NewWriter(CSV, buffer, testColumns)
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	require.Equal(t, "order_id,purchased_item,purchase_amount,created_at\n", buffer.String())
+
+	_, err = NewWriter("pdf", buffer, testColumns)
+	require.Error(t, err)
+	require.False(t, IsFormat("pdf"))
+	require.Equal(t, "application/x-ndjson", ContentType(NDJSON))
+}
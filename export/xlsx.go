@@ -0,0 +1,111 @@
+package export
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strconv"
+)
+
+// Rows a sheet can have in Excel, the header included
+const maxXLSXRows = 1048576
+
+var ErrTooManyRows = errors.New("xlsx sheets can't have more than 1048576 rows")
+
+// Parts of the workbook around the sheet, they never change
+var xlsxParts = []struct {
+	name    string
+	content string
+}{
+	{"[Content_Types].xml", xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`</Types>`},
+	{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`},
+	{"xl/workbook.xml", xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+		`<sheets><sheet name="Export" sheetId="1" r:id="rId1"/></sheets>` +
+		`</workbook>`},
+	{"xl/_rels/workbook.xml.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`</Relationships>`},
+}
+
+// Writes the sheet while the rows come in, the zip is streamed so nothing waits in memory
+// Strings are inline instead of in a shared strings table, which would need every row before the sheet
+type xlsxWriter struct {
+	archive *zip.Writer
+	sheet   *bufio.Writer
+	rows    int
+}
+
+func newXLSXWriter(w io.Writer, columns []string) (*xlsxWriter, error) {
+	archive := zip.NewWriter(w)
+	for _, part := range xlsxParts {
+		file, err := archive.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(file, part.content); err != nil {
+			return nil, err
+		}
+	}
+
+	// The sheet is the last part, Close ends it
+	file, err := archive.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	writer := &xlsxWriter{archive: archive, sheet: bufio.NewWriter(file)}
+	writer.sheet.WriteString(xml.Header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+
+	header := make([]interface{}, len(columns))
+	for i, column := range columns {
+		header[i] = column
+	}
+	return writer, writer.WriteRow(header)
+}
+
+func (writer *xlsxWriter) WriteRow(values []interface{}) error {
+	if writer.rows == maxXLSXRows {
+		return ErrTooManyRows
+	}
+	writer.rows++
+
+	writer.sheet.WriteString(`<row r="` + strconv.Itoa(writer.rows) + `">`)
+	for _, value := range values {
+		switch value := value.(type) {
+		case nil:
+			writer.sheet.WriteString(`<c/>`)
+		case int64, int, float64:
+			writer.sheet.WriteString(`<c><v>` + formatValue(value) + `</v></c>`)
+		case bool:
+			cell := `<c t="b"><v>0</v></c>`
+			if value {
+				cell = `<c t="b"><v>1</v></c>`
+			}
+			writer.sheet.WriteString(cell)
+		default: // Times are text too, a date cell would need a styles part
+			writer.sheet.WriteString(`<c t="inlineStr"><is><t xml:space="preserve">`)
+			if err := xml.EscapeText(writer.sheet, []byte(formatValue(value))); err != nil {
+				return err
+			}
+			writer.sheet.WriteString(`</t></is></c>`)
+		}
+	}
+	_, err := writer.sheet.WriteString(`</row>`)
+	return err
+}
+
+func (writer *xlsxWriter) Close() error {
+	writer.sheet.WriteString(`</sheetData></worksheet>`)
+	if err := writer.sheet.Flush(); err != nil {
+		return err
+	}
+	return writer.archive.Close()
+}
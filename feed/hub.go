@@ -0,0 +1,242 @@
+// Live order feed shared by every SSE and WebSocket client of an API instance
+// The hub reads new rows of order_events when Postgres NOTIFYs it and fans them out to its subscribers,
+// so events made through any instance reach clients of every instance
+
+package feed
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	db "github.com/samanthatb1/beadBashStorage/db/sqlc"
+)
+
+const (
+	pageSize = 500 // Events read per query
+	maxBacklog = 10000 // Events a resuming client may have missed before it's told to reset instead
+	maxGap = 1000 // Ids skipped at once that are waited for, bigger jumps are the sequence's cache being thrown away
+	pruneInterval = time.Hour
+)
+
+// Where events are read from, *db.Store in production
+type Store interface {
+	ListOrderEventsAfter(ctx context.Context, arg db.ListOrderEventsAfterParams) ([]db.OrderEvent, error)
+	GetOrderEventBounds(ctx context.Context) (db.GetOrderEventBoundsRow, error)
+	PruneOrderEvents(ctx context.Context, retention time.Duration) (int64, error)
+}
+
+// One change of an order, Data is the order as it is after it (before it for order.deleted)
+type Event struct {
+	ID      int64           `json:"id"`
+	Event   string          `json:"event"`
+	OrderID int64           `json:"order_id"`
+	Data    json.RawMessage `json:"data"`
+}
+
+func newEvent(row db.OrderEvent) Event {
+	return Event{ID: row.ID, Event: row.Event, OrderID: row.OrderID, Data: json.RawMessage(row.Payload)}
+}
+
+type Options struct {
+	PollInterval time.Duration // Events are also looked for this often, in case a notification was lost
+	GapTimeout   time.Duration // How long a skipped id is waited for, its transaction may still commit
+	Retention    time.Duration // Events older than this are deleted, 0 keeps them
+	BufferSize   int           // Events a subscriber may fall behind by before it's dropped
+}
+
+type Hub struct {
+	store   Store
+	options Options
+
+	mu          sync.Mutex
+	cursor      int64               // Highest id sent to subscribers
+	gaps        map[int64]time.Time // Ids below the cursor that weren't committed yet, with when they were noticed
+	subscribers map[*Subscription]bool
+}
+
+func NewHub(store Store, options Options) *Hub {
+	if options.BufferSize < 1 {
+		options.BufferSize = 256
+	}
+	return &Hub{
+		store: store,
+		options: options,
+		gaps: map[int64]time.Time{},
+		subscribers: map[*Subscription]bool{},
+	}
+}
+
+// A client's view of the feed, Events is closed when the client fell behind or was closed
+type Subscription struct {
+	hub    *Hub
+	events chan Event
+}
+
+func (sub *Subscription) Events() <-chan Event {
+	return sub.events
+}
+
+func (sub *Subscription) Close() {
+	sub.hub.mu.Lock()
+	defer sub.hub.mu.Unlock()
+	sub.hub.drop(sub)
+}
+
+// Must hold the lock
+func (hub *Hub) drop(sub *Subscription) {
+	if hub.subscribers[sub] {
+		delete(hub.subscribers, sub)
+		close(sub.events)
+	}
+}
+
+// Starts sending new events to the subscription
+// Subscribe before reading the Backlog, so no event falls between the two
+func (hub *Hub) Subscribe() *Subscription {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	sub := &Subscription{hub: hub, events: make(chan Event, hub.options.BufferSize)}
+	hub.subscribers[sub] = true
+	return sub
+}
+
+// Events after afterID for a client that's resuming, in id order
+// complete is false if some of them were already deleted, or there are too many, and the client should reload instead
+func (hub *Hub) Backlog(ctx context.Context, afterID int64) (events []Event, complete bool, err error) {
+	bounds, err := hub.store.GetOrderEventBounds(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	if bounds.OldestID > afterID+1 || bounds.LatestID-afterID > maxBacklog {
+		return nil, false, nil
+	}
+
+	for {
+		rows, err := hub.store.ListOrderEventsAfter(ctx, db.ListOrderEventsAfterParams{ID: afterID, Limit: pageSize})
+		if err != nil {
+			return nil, false, err
+		}
+		for _, row := range rows {
+			events = append(events, newEvent(row))
+			afterID = row.ID
+		}
+		if len(rows) < pageSize {
+			return events, true, nil
+		}
+	}
+}
+
+// Sends new events to the subscribers until the context is done
+// wake receives a value whenever Postgres notifies order_events, and when the connection was lost and is back
+func (hub *Hub) Run(ctx context.Context, wake <-chan struct{}) {
+	// Only events from now on are sent live, earlier ones are in the backlog
+	for {
+		bounds, err := hub.store.GetOrderEventBounds(ctx)
+		if err == nil {
+			hub.mu.Lock()
+			hub.cursor = bounds.LatestID
+			hub.mu.Unlock()
+			break
+		}
+		log.Println("cannot start order feed:", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(hub.options.PollInterval):
+		}
+	}
+
+	poll := time.NewTicker(hub.options.PollInterval)
+	defer poll.Stop()
+	lastPrune := time.Time{}
+
+	for {
+		if err := hub.Fetch(ctx); err != nil && ctx.Err() == nil {
+			log.Println("cannot read order events:", err)
+		}
+		if hub.options.Retention > 0 && time.Since(lastPrune) > pruneInterval {
+			lastPrune = time.Now()
+			if _, err := hub.store.PruneOrderEvents(ctx, hub.options.Retention); err != nil && ctx.Err() == nil {
+				log.Println("cannot prune order events:", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			hub.mu.Lock()
+			for sub := range hub.subscribers {
+				hub.drop(sub)
+			}
+			hub.mu.Unlock()
+			return
+		case <-wake:
+		case <-poll.C:
+		}
+	}
+}
+
+// Reads the events committed since the last fetch and sends them to every subscriber
+// Ids come from a sequence when rows are inserted, not when they commit, so a skipped id is waited for
+// until its transaction commits or GapTimeout passes
+func (hub *Hub) Fetch(ctx context.Context) error {
+	hub.mu.Lock()
+	from := hub.cursor
+	for id := range hub.gaps {
+		if id-1 < from {
+			from = id - 1
+		}
+	}
+	hub.mu.Unlock()
+
+	for {
+		rows, err := hub.store.ListOrderEventsAfter(ctx, db.ListOrderEventsAfterParams{ID: from, Limit: pageSize})
+		if err != nil {
+			return err
+		}
+
+		hub.mu.Lock()
+		now := time.Now()
+		for _, row := range rows {
+			from = row.ID
+			if row.ID <= hub.cursor {
+				if _, waiting := hub.gaps[row.ID]; !waiting {
+					continue // Already sent
+				}
+				delete(hub.gaps, row.ID)
+			} else {
+				if row.ID-hub.cursor <= maxGap {
+					for id := hub.cursor + 1; id < row.ID; id++ {
+						hub.gaps[id] = now
+					}
+				}
+				hub.cursor = row.ID
+			}
+			hub.broadcast(newEvent(row))
+		}
+		for id, noticed := range hub.gaps {
+			if now.Sub(noticed) >= hub.options.GapTimeout {
+				delete(hub.gaps, id) // Rolled back
+			}
+		}
+		hub.mu.Unlock()
+
+		if len(rows) < pageSize {
+			return nil
+		}
+	}
+}
+
+// Must hold the lock
+// Subscribers that can't keep up are dropped rather than holding up the others, they resume with Last-Event-ID
+func (hub *Hub) broadcast(event Event) {
+	for sub := range hub.subscribers {
+		select {
+		case sub.events <- event:
+		default:
+			hub.drop(sub)
+		}
+	}
+}
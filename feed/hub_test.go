@@ -0,0 +1,204 @@
+// Unit tests for fanning out order events to subscribers
+
+package feed
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	db "github.com/samanthatb1/beadBashStorage/db/sqlc"
+	"github.com/stretchr/testify/require"
+)
+
+/* Helper Functions */
+
+// Holds the committed events, commit adds them in any id order like concurrent transactions do
+type fakeStore struct {
+	mu     sync.Mutex
+	events []db.OrderEvent
+	pruned time.Duration
+}
+
+func (store *fakeStore) commit(ids ...int64) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	for _, id := range ids {
+		store.events = append(store.events, db.OrderEvent{ID: id, Event: db.EventOrderCreated, OrderID: id * 10, Payload: `{"order_id":1}`})
+	}
+	sort.Slice(store.events, func(i, j int) bool { return store.events[i].ID < store.events[j].ID })
+}
+
+func (store *fakeStore) ListOrderEventsAfter(ctx context.Context, arg db.ListOrderEventsAfterParams) ([]db.OrderEvent, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	events := []db.OrderEvent{}
+	for _, event := range store.events {
+		if event.ID > arg.ID && len(events) < int(arg.Limit) {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (store *fakeStore) GetOrderEventBounds(ctx context.Context) (db.GetOrderEventBoundsRow, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if len(store.events) == 0 {
+		return db.GetOrderEventBoundsRow{}, nil
+	}
+	return db.GetOrderEventBoundsRow{OldestID: store.events[0].ID, LatestID: store.events[len(store.events)-1].ID}, nil
+}
+
+func (store *fakeStore) PruneOrderEvents(ctx context.Context, retention time.Duration) (int64, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.pruned = retention
+	return 0, nil
+}
+
+// Ids of the events waiting in the subscription
+func received(sub *Subscription) []int64 {
+	ids := []int64{}
+	for {
+		select {
+		case event, ok := <-sub.Events():
+			if !ok {
+				return ids
+			}
+			ids = append(ids, event.ID)
+		default:
+			return ids
+		}
+	}
+}
+
+/* Test Functions */
+
+// Test Scenario: subscribers get events committed after the hub started, once each
+func TestHubFetch(t *testing.T){
+	store := &fakeStore{}
+	store.commit(1, 2)
+	hub := NewHub(store, Options{GapTimeout: time.Minute})
+	hub.cursor = 2 // Where Run starts
+
+	sub := hub.Subscribe()
+	store.commit(3, 4)
+	require.NoError(t, hub.Fetch(context.Background()))
+	require.NoError(t, hub.Fetch(context.Background()))
+	require.Equal(t, []int64{3, 4}, received(sub))
+
+	sub.Close()
+	_, open := <-sub.Events()
+	require.False(t, open)
+}
+
+// Test Scenario: an id that commits after a higher one is still sent, and only once
+func TestHubFetchGap(t *testing.T){
+	store := &fakeStore{}
+	hub := NewHub(store, Options{GapTimeout: time.Minute})
+	sub := hub.Subscribe()
+
+	store.commit(1, 3) // 2 is still in its transaction
+	require.NoError(t, hub.Fetch(context.Background()))
+	require.Equal(t, []int64{1, 3}, received(sub))
+
+	store.commit(2, 4)
+	require.NoError(t, hub.Fetch(context.Background()))
+	require.NoError(t, hub.Fetch(context.Background()))
+	require.Equal(t, []int64{2, 4}, received(sub))
+	require.Empty(t, hub.gaps)
+}
+
+// Test Scenario: ids that never commit stop being waited for
+func TestHubFetchGapTimeout(t *testing.T){
+	store := &fakeStore{}
+	hub := NewHub(store, Options{GapTimeout: 0})
+	store.commit(1, 5)
+	require.NoError(t, hub.Fetch(context.Background()))
+	require.Empty(t, hub.gaps)
+	require.Equal(t, int64(5), hub.cursor)
+}
+
+// Test Scenario: a subscriber that falls behind is dropped so it resumes from the backlog
+func TestHubSlowSubscriber(t *testing.T){
+	store := &fakeStore{}
+	hub := NewHub(store, Options{BufferSize: 2, GapTimeout: time.Minute})
+	slow := hub.Subscribe()
+	fast := hub.Subscribe()
+
+	store.commit(1, 2)
+	require.NoError(t, hub.Fetch(context.Background()))
+	require.Equal(t, []int64{1, 2}, received(fast))
+	store.commit(3)
+	require.NoError(t, hub.Fetch(context.Background()))
+	require.Equal(t, []int64{3}, received(fast))
+
+	require.Equal(t, []int64{1, 2}, received(slow)) // Then closed
+	_, open := <-slow.Events()
+	require.False(t, open)
+}
+
+// Test Scenario: resuming clients get what they missed, unless part of it is gone
+func TestHubBacklog(t *testing.T){
+	store := &fakeStore{}
+	store.commit(4, 5, 6, 7)
+	hub := NewHub(store, Options{})
+
+	testCases := []struct {
+		name     string
+		afterID  int64
+		ids      []int64
+		complete bool
+	}{
+		{"Missed", 5, []int64{6, 7}, true},
+		{"UpToDate", 7, nil, true},
+		{"FromOldest", 3, []int64{4, 5, 6, 7}, true},
+		{"Pruned", 1, nil, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			events, complete, err := hub.Backlog(context.Background(), tc.afterID)
+			require.NoError(t, err)
+			require.Equal(t, tc.complete, complete)
+			var ids []int64
+			for _, event := range events {
+				ids = append(ids, event.ID)
+			}
+			require.Equal(t, tc.ids, ids)
+		})
+	}
+}
+
+// Test Scenario: Run starts at the latest event, wakes up on notifications and closes subscriptions when it stops
+func TestHubRun(t *testing.T){
+	store := &fakeStore{}
+	store.commit(1)
+	hub := NewHub(store, Options{PollInterval: time.Hour, GapTimeout: time.Minute, Retention: 24 * time.Hour})
+	sub := hub.Subscribe()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	wake := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		hub.Run(ctx, wake)
+		close(done)
+	}()
+
+	wake <- struct{}{} // Handled once the hub has started
+	store.commit(2)
+	wake <- struct{}{}
+	event := <-sub.Events()
+	require.Equal(t, int64(2), event.ID)
+	require.Equal(t, int64(20), event.OrderID)
+	require.JSONEq(t, `{"order_id":1}`, string(event.Data))
+
+	cancel()
+	<-done
+	_, open := <-sub.Events()
+	require.False(t, open)
+	require.Equal(t, 24*time.Hour, store.pruned)
+}
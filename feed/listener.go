@@ -0,0 +1,35 @@
+package feed
+
+import (
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Listens on the Postgres channel on its own connection, the returned channel receives a value for every
+// notification and whenever the connection comes back, since notifications sent while it was down are lost
+// stop closes the connection
+func ListenPostgres(dbSource string, channel string) (wake <-chan struct{}, stop func() error, err error) {
+	listener := pq.NewListener(dbSource, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Println("order feed listener:", err)
+		}
+	})
+	if err := listener.Listen(channel); err != nil {
+		listener.Close()
+		return nil, nil, err
+	}
+
+	// Holds one pending wake up, more notifications before it's handled are read with the same fetch
+	woken := make(chan struct{}, 1)
+	go func() {
+		for range listener.Notify { // nil after a reconnect
+			select {
+			case woken <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return woken, listener.Close, nil
+}
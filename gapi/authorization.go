@@ -0,0 +1,144 @@
+package gapi
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/samanthatb1/beadBashStorage/db/dberr"
+	"github.com/samanthatb1/beadBashStorage/pb"
+	"github.com/samanthatb1/beadBashStorage/token"
+	"github.com/samanthatb1/beadBashStorage/util"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	authorizationHeaderKey  = "authorization"
+	authorizationTypeBearer = "bearer"
+)
+
+// Who may call an RPC
+type rpcPolicy struct {
+	roles []string // Roles that may always call the RPC
+	owner bool     // If set, customers may call it too and the RPC checks the resource is theirs
+}
+
+var (
+	adminOnly  = []string{util.AdminRole}
+	staffWrite = []string{util.AdminRole, util.FulfillmentRole}
+	staffRead  = []string{util.AdminRole, util.FulfillmentRole, util.ReadOnlyRole}
+)
+
+// Policy for every RPC, keyed by full method name
+// RPCs that are missing from this table are forbidden for everyone
+var rpcPolicies = map[string]rpcPolicy{
+	fullMethod("GetUser"):     {roles: staffRead, owner: true},
+	fullMethod("DeleteUser"):  {roles: adminOnly},
+	fullMethod("CreateOrder"): {roles: staffWrite},
+	fullMethod("GetOrder"):    {roles: staffRead, owner: true},
+	fullMethod("ListOrders"):  {roles: staffRead, owner: true},
+}
+
+// e.g. GetUser -> /pb.BeadBashStorage/GetUser
+func fullMethod(name string) string {
+	return "/" + pb.BeadBashStorage_ServiceDesc.ServiceName + "/" + name
+}
+
+type payloadKey struct{}
+
+// Verifies the access token in the "authorization: Bearer <token>" metadata and checks the RPC's policy
+// The payload is added to the returned context for the RPCs
+func (server *Server) authorize(ctx context.Context, method string) (context.Context, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil, status.Errorf(codes.Unauthenticated, "missing metadata")
+	}
+	values := md.Get(authorizationHeaderKey)
+	if len(values) == 0 {
+		return nil, status.Errorf(codes.Unauthenticated, "authorization metadata is not provided")
+	}
+
+	// Must look like "Bearer <token>"
+	fields := strings.Fields(values[0])
+	if len(fields) < 2 {
+		return nil, status.Errorf(codes.Unauthenticated, "invalid authorization metadata format")
+	}
+	if strings.ToLower(fields[0]) != authorizationTypeBearer {
+		return nil, status.Errorf(codes.Unauthenticated, "unsupported authorization type %s", fields[0])
+	}
+	payload, err := server.tokenMaker.VerifyToken(fields[1])
+	if err == nil {
+		err = payload.CheckType(token.AccessToken) // Refresh tokens are only exchanged through the REST API
+	}
+	if err != nil {
+		return nil, status.Errorf(codes.Unauthenticated, "invalid access token: %s", err)
+	}
+
+	policy, ok := rpcPolicies[method]
+	if !ok || !policy.allows(payload) {
+		return nil, status.Errorf(codes.PermissionDenied, "role %s is not allowed to call %s", payload.Role, method)
+	}
+	return context.WithValue(ctx, payloadKey{}, payload), nil
+}
+
+func (policy rpcPolicy) allows(payload *token.Payload) bool {
+	for _, role := range policy.roles {
+		if payload.Role == role {
+			return true
+		}
+	}
+	return policy.owner && payload.Role == util.CustomerRole
+}
+
+// Payload of the caller, set by the interceptors
+func payloadFrom(ctx context.Context) *token.Payload {
+	return ctx.Value(payloadKey{}).(*token.Payload)
+}
+
+// Customers only get past the policy on RPCs marked owner, this checks the resource is theirs
+func checkOwner(payload *token.Payload, username string) error {
+	if payload.Role == util.CustomerRole && payload.Username != username {
+		return errNotOwner
+	}
+	return nil
+}
+
+var errNotOwner = status.Errorf(codes.PermissionDenied, "customers can only access their own resources")
+
+// Store error of an owner RPC's lookup, customers get the same error for a missing row as for someone else's
+// so they can't find out which ids exist
+func lookupError(payload *token.Payload, err error, notFound string) error {
+	if payload.Role == util.CustomerRole && dberr.Translate(err) == sql.ErrNoRows {
+		return errNotOwner
+	}
+	return storeError(err, notFound)
+}
+
+func (server *Server) unaryAuthInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := server.authorize(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (server *Server) streamAuthInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := server.authorize(stream.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authorizedStream{ServerStream: stream, ctx: ctx})
+}
+
+// Stream whose context carries the caller's payload
+type authorizedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (stream *authorizedStream) Context() context.Context {
+	return stream.ctx
+}
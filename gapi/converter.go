@@ -0,0 +1,39 @@
+package gapi
+
+import (
+	db "github.com/samanthatb1/beadBashStorage/db/sqlc"
+	"github.com/samanthatb1/beadBashStorage/pb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func convertUser(user db.User) *pb.User {
+	converted := &pb.User{
+		Id: user.ID,
+		Username: user.Username,
+		FullName: user.FullName,
+		TotalOrders: user.TotalOrders,
+		Role: user.Role,
+		Version: user.Version,
+		CreatedAt: timestamppb.New(user.CreatedAt),
+	}
+	if user.ErasedAt.Valid {
+		converted.ErasedAt = timestamppb.New(user.ErasedAt.Time)
+	}
+	return converted
+}
+
+func convertOrder(order db.Order) *pb.Order {
+	return &pb.Order{
+		OrderId: order.OrderID,
+		AccountId: order.AccountID,
+		Username: order.Username,
+		FullName: order.FullName,
+		PurchaseAmount: order.PurchaseAmount,
+		PurchasedItem: order.PurchasedItem,
+		ShippingLocation: order.ShippingLocation,
+		Currency: order.Currency,
+		DateOrdered: order.DateOrdered,
+		Version: order.Version,
+		CreatedAt: timestamppb.New(order.CreatedAt),
+	}
+}
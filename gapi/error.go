@@ -0,0 +1,34 @@
+package gapi
+
+import (
+	"database/sql"
+
+	"github.com/samanthatb1/beadBashStorage/db/dberr"
+	db "github.com/samanthatb1/beadBashStorage/db/sqlc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Code each kind of domain error is sent with
+var kindCodes = map[dberr.Kind]codes.Code{
+	dberr.NotFound:   codes.NotFound,
+	dberr.Conflict:   codes.AlreadyExists,
+	dberr.Validation: codes.InvalidArgument,
+}
+
+// Turns a store error into a gRPC status, notFound is the message for missing rows
+func storeError(err error, notFound string) error {
+	err = dberr.Translate(err)
+	if err == sql.ErrNoRows {
+		return status.Error(codes.NotFound, notFound)
+	}
+	if err == db.ErrVersionMismatch {
+		return status.Error(codes.FailedPrecondition, "changed by someone else, fetch it again")
+	}
+	if domainErr := dberr.As(err); domainErr != nil {
+		if code, ok := kindCodes[domainErr.Kind]; ok {
+			return status.Error(code, domainErr.Message)
+		}
+	}
+	return status.Errorf(codes.Internal, "store error: %s", err)
+}
@@ -0,0 +1,64 @@
+package gapi
+
+import (
+	"context"
+
+	db "github.com/samanthatb1/beadBashStorage/db/sqlc"
+	"github.com/samanthatb1/beadBashStorage/pb"
+	"github.com/samanthatb1/beadBashStorage/util"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var currencies = map[string]bool{"USD": true, "EUR": true, "CAD": true}
+
+// Creates the order, and its customer if they're new
+func (server *Server) CreateOrder(ctx context.Context, req *pb.CreateOrderRequest) (*pb.CreateOrderResponse, error) {
+	if err := validateCreateOrderRequest(req); err != nil {
+		return nil, err
+	}
+
+	result, err := server.store.NewOrderTx(ctx, db.NewOrderTxParams{
+		Username: req.GetUsername(),
+		FullName: req.GetFullName(),
+		PurchaseAmount: req.GetPurchaseAmount(),
+		PurchasedItem: req.GetPurchasedItem(),
+		ShippingLocation: req.GetShippingLocation(),
+		Currency: req.GetCurrency(),
+		DateOrdered: req.GetDateOrdered(),
+	})
+	if err != nil {
+		return nil, storeError(err, "user doesn't exist")
+	}
+
+	return &pb.CreateOrderResponse{
+		User: convertUser(result.EditedUser),
+		Order: convertOrder(result.OrderMade),
+	}, nil
+}
+
+// Same rules as the REST API's createOrderRequest
+func validateCreateOrderRequest(req *pb.CreateOrderRequest) error {
+	required := map[string]string{
+		"username": req.GetUsername(),
+		"full_name": req.GetFullName(),
+		"purchased_item": req.GetPurchasedItem(),
+		"shipping_location": req.GetShippingLocation(),
+		"date_ordered": req.GetDateOrdered(),
+	}
+	for field, value := range required {
+		if value == "" {
+			return status.Errorf(codes.InvalidArgument, "%s is required", field)
+		}
+	}
+	if err := util.CheckUsername(req.GetUsername()); err != nil {
+		return status.Errorf(codes.InvalidArgument, "%s", err)
+	}
+	if req.GetPurchaseAmount() <= 0 {
+		return status.Errorf(codes.InvalidArgument, "purchase_amount must be positive")
+	}
+	if !currencies[req.GetCurrency()] {
+		return status.Errorf(codes.InvalidArgument, "currency must be one of USD, EUR, CAD")
+	}
+	return nil
+}
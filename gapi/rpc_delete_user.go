@@ -0,0 +1,23 @@
+package gapi
+
+import (
+	"context"
+
+	db "github.com/samanthatb1/beadBashStorage/db/sqlc"
+	"github.com/samanthatb1/beadBashStorage/pb"
+)
+
+// Deletes the user and all their orders
+func (server *Server) DeleteUser(ctx context.Context, req *pb.DeleteUserRequest) (*pb.DeleteUserResponse, error) {
+	args := db.DeleteUserTxParams{ID: req.GetId()}
+	if req.GetVersion() != 0 { // Only delete the version the client has seen
+		args.Versions = []int64{req.GetVersion()}
+	}
+
+	result, err := server.store.DeleteUserTx(ctx, args)
+	if err != nil {
+		return nil, storeError(err, "user doesn't exist")
+	}
+
+	return &pb.DeleteUserResponse{DeletionStatus: result.Status}, nil
+}
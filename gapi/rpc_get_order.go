@@ -0,0 +1,19 @@
+package gapi
+
+import (
+	"context"
+
+	"github.com/samanthatb1/beadBashStorage/pb"
+)
+
+func (server *Server) GetOrder(ctx context.Context, req *pb.GetOrderRequest) (*pb.GetOrderResponse, error) {
+	order, err := server.store.GetOrderById(ctx, req.GetOrderId())
+	if err != nil {
+		return nil, lookupError(payloadFrom(ctx), err, "order doesn't exist")
+	}
+	if err := checkOwner(payloadFrom(ctx), order.Username); err != nil {
+		return nil, err
+	}
+
+	return &pb.GetOrderResponse{Order: convertOrder(order)}, nil
+}
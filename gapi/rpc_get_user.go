@@ -0,0 +1,19 @@
+package gapi
+
+import (
+	"context"
+
+	"github.com/samanthatb1/beadBashStorage/pb"
+)
+
+func (server *Server) GetUser(ctx context.Context, req *pb.GetUserRequest) (*pb.GetUserResponse, error) {
+	user, err := server.store.GetUserById(ctx, req.GetId())
+	if err != nil {
+		return nil, lookupError(payloadFrom(ctx), err, "user doesn't exist")
+	}
+	if err := checkOwner(payloadFrom(ctx), user.Username); err != nil {
+		return nil, err
+	}
+
+	return &pb.GetUserResponse{User: convertUser(user)}, nil
+}
@@ -0,0 +1,62 @@
+package gapi
+
+import (
+	"strings"
+
+	db "github.com/samanthatb1/beadBashStorage/db/sqlc"
+	"github.com/samanthatb1/beadBashStorage/pb"
+	"github.com/samanthatb1/beadBashStorage/util"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Orders read from the DB per query while streaming
+const listOrdersBatchSize = 100
+
+// Streams every order matching the filters, reading them from the DB a batch at a time
+func (server *Server) ListOrders(req *pb.ListOrdersRequest, stream pb.BeadBashStorage_ListOrdersServer) error {
+	payload := payloadFrom(stream.Context())
+
+	filter := db.OrderFilter{
+		Username: req.GetUsername(),
+		Tag: strings.ToLower(strings.TrimSpace(req.GetTag())),
+		Currency: req.GetCurrency(),
+		MinAmount: req.GetMinAmount(),
+		MaxAmount: req.GetMaxAmount(),
+		ShippingLocation: req.GetShippingLocation(),
+		Item: req.GetItem(),
+	}
+	// Customers only ever see their own orders
+	if payload.Role == util.CustomerRole {
+		if filter.Username != "" {
+			if err := checkOwner(payload, filter.Username); err != nil {
+				return err
+			}
+		}
+		filter.Username = payload.Username
+	}
+
+	params := db.PageParams{Sort: req.GetSort(), Desc: req.GetDesc(), Limit: listOrdersBatchSize}
+	if params.Sort == "" {
+		params.Sort = "id"
+	}
+	if !db.IsOrderSort(params.Sort) {
+		return status.Errorf(codes.InvalidArgument, "sort must be one of id, date, amount, name")
+	}
+
+	for {
+		page, err := server.store.ListOrdersPage(stream.Context(), filter, params)
+		if err != nil {
+			return storeError(err, "")
+		}
+		for _, order := range page.Orders {
+			if err := stream.Send(&pb.ListOrdersResponse{Order: convertOrder(order)}); err != nil {
+				return err
+			}
+		}
+		if page.Next == nil {
+			return nil
+		}
+		params.After = page.Next
+	}
+}
@@ -0,0 +1,78 @@
+package gapi
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+
+	db "github.com/samanthatb1/beadBashStorage/db/sqlc"
+	"github.com/samanthatb1/beadBashStorage/pb"
+	"github.com/samanthatb1/beadBashStorage/token"
+	"github.com/samanthatb1/beadBashStorage/util"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/reflection"
+)
+
+// DB operations the gRPC server uses, *db.Store in production and a fake in the tests
+type Store interface {
+	GetUserById(ctx context.Context, id int64) (db.User, error)
+	GetOrderById(ctx context.Context, orderID int64) (db.Order, error)
+	NewOrderTx(ctx context.Context, args db.NewOrderTxParams) (db.NewOrderTxResult, error)
+	DeleteUserTx(ctx context.Context, args db.DeleteUserTxParams) (db.DeleteUserTxResult, error)
+	ListOrdersPage(ctx context.Context, filter db.OrderFilter, params db.PageParams) (db.OrderPage, error)
+}
+
+// Serves the BeadBashStorage gRPC service for internal tools
+type Server struct {
+	pb.UnimplementedBeadBashStorageServer
+	config util.Config
+	store Store
+	tokenMaker token.Maker // Verifies the access tokens the REST API hands out
+}
+
+// New gRPC server instance
+func NewServer(config util.Config, store Store) (*Server, error) {
+	tokenMaker, err := token.NewPasetoMaker(config.TokenSymmetricKey)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create token maker: %w", err)
+	}
+
+	server := &Server{
+		config: config,
+		store: store,
+		tokenMaker: tokenMaker,
+	}
+	return server, nil
+}
+
+// gRPC server with the service and the authorization interceptors registered, over TLS if tlsConfig isn't nil
+func (server *Server) newGRPCServer(tlsConfig *tls.Config) *grpc.Server {
+	options := []grpc.ServerOption{
+		grpc.UnaryInterceptor(server.unaryAuthInterceptor),
+		grpc.StreamInterceptor(server.streamAuthInterceptor),
+	}
+	if tlsConfig != nil {
+		options = append(options, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	grpcServer := grpc.NewServer(options...)
+	pb.RegisterBeadBashStorageServer(grpcServer, server)
+	reflection.Register(grpcServer) // Lets tools like grpcurl list the RPCs
+	return grpcServer
+}
+
+// Runs the gRPC server on a specified address port, over TLS with the REST API's certificate if one is configured
+func (server *Server) Start(address string) error {
+	tlsConfig, stopReloading, err := util.ServerTLSConfig(server.config)
+	if err != nil {
+		return err
+	}
+	defer stopReloading()
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("cannot listen on %s: %w", address, err)
+	}
+	return server.newGRPCServer(tlsConfig).Serve(listener)
+}
@@ -0,0 +1,422 @@
+// Unit tests for the gRPC server, over an in-memory bufconn listener with a fake store
+
+package gapi
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	db "github.com/samanthatb1/beadBashStorage/db/sqlc"
+	"github.com/samanthatb1/beadBashStorage/pb"
+	"github.com/samanthatb1/beadBashStorage/token"
+	"github.com/samanthatb1/beadBashStorage/util"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// 32 character key used by the tests
+const testSymmetricKey = "12345678901234567890123456789012"
+
+// Username of the customer making the requests in the tests
+const testCustomer = "bead_lover"
+
+/* Helper Functions */
+
+// Store with a few users and orders in memory
+type fakeStore struct {
+	users       map[int64]db.User
+	orders      []db.Order // Sorted by id
+	deleted     []db.DeleteUserTxParams
+	listFilters []db.OrderFilter
+}
+
+func newFakeStore() *fakeStore {
+	store := &fakeStore{users: map[int64]db.User{
+		1: {ID: 1, Username: testCustomer, FullName: "Jane Doe", Role: util.CustomerRole, Version: 2, CreatedAt: time.Now()},
+		2: {ID: 2, Username: "someone_else", FullName: "John Roe", Role: util.CustomerRole, Version: 1, CreatedAt: time.Now()},
+	}}
+	for i := int64(1); i <= 250; i++ {
+		username := testCustomer
+		if i%2 == 0 {
+			username = "someone_else"
+		}
+		store.orders = append(store.orders, db.Order{OrderID: i, Username: username, PurchasedItem: "bracelet", PurchaseAmount: float64(i), Currency: "CAD"})
+	}
+	return store
+}
+
+func (store *fakeStore) GetUserById(ctx context.Context, id int64) (db.User, error) {
+	user, ok := store.users[id]
+	if !ok {
+		return user, sql.ErrNoRows
+	}
+	return user, nil
+}
+
+func (store *fakeStore) GetOrderById(ctx context.Context, orderID int64) (db.Order, error) {
+	for _, order := range store.orders {
+		if order.OrderID == orderID {
+			return order, nil
+		}
+	}
+	return db.Order{}, sql.ErrNoRows
+}
+
+func (store *fakeStore) NewOrderTx(ctx context.Context, args db.NewOrderTxParams) (db.NewOrderTxResult, error) {
+	order := db.Order{
+		OrderID: int64(len(store.orders) + 1),
+		Username: args.Username,
+		FullName: args.FullName,
+		PurchaseAmount: args.PurchaseAmount,
+		PurchasedItem: args.PurchasedItem,
+		ShippingLocation: args.ShippingLocation,
+		Currency: args.Currency,
+		DateOrdered: args.DateOrdered,
+		Version: 1,
+	}
+	store.orders = append(store.orders, order)
+	return db.NewOrderTxResult{EditedUser: db.User{ID: 3, Username: args.Username, TotalOrders: 1}, OrderMade: order}, nil
+}
+
+func (store *fakeStore) DeleteUserTx(ctx context.Context, args db.DeleteUserTxParams) (db.DeleteUserTxResult, error) {
+	user, ok := store.users[args.ID]
+	if !ok {
+		return db.DeleteUserTxResult{}, sql.ErrNoRows
+	}
+	if len(args.Versions) > 0 && args.Versions[0] != user.Version {
+		return db.DeleteUserTxResult{}, db.ErrVersionMismatch
+	}
+	store.deleted = append(store.deleted, args)
+	return db.DeleteUserTxResult{Status: "Deleted"}, nil
+}
+
+// Pages by order id only, which is all the tests sort by
+func (store *fakeStore) ListOrdersPage(ctx context.Context, filter db.OrderFilter, params db.PageParams) (db.OrderPage, error) {
+	store.listFilters = append(store.listFilters, filter)
+
+	var matching []db.Order
+	for _, order := range store.orders {
+		if filter.Username == "" || order.Username == filter.Username {
+			matching = append(matching, order)
+		}
+	}
+	sort.Slice(matching, func(i, j int) bool { return matching[i].OrderID < matching[j].OrderID })
+
+	var page db.OrderPage
+	page.Total = int64(len(matching))
+	for _, order := range matching {
+		if params.After != nil && order.OrderID <= params.After.ID {
+			continue
+		}
+		if len(page.Orders) == int(params.Limit) {
+			last := page.Orders[len(page.Orders)-1]
+			page.Next = &db.Cursor{Value: strconv.FormatInt(last.OrderID, 10), ID: last.OrderID}
+			break
+		}
+		page.Orders = append(page.Orders, order)
+	}
+	return page, nil
+}
+
+// Starts the server on an in-memory listener and returns a client connected to it
+func newTestClient(t *testing.T, store Store) pb.BeadBashStorageClient {
+	server, err := NewServer(util.Config{TokenSymmetricKey: testSymmetricKey}, store)
+	require.NoError(t, err)
+
+	listener := bufconn.Listen(1024 * 1024)
+	grpcServer := server.newGRPCServer(nil)
+	go grpcServer.Serve(listener)
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return pb.NewBeadBashStorageClient(conn)
+}
+
+// Context with an access token for the user in the metadata
+func withAuthorization(t *testing.T, username string, role string) context.Context {
+	tokenMaker, err := token.NewPasetoMaker(testSymmetricKey)
+	require.NoError(t, err)
+	accessToken, _, err := tokenMaker.CreateToken(username, role, token.AccessToken, time.Minute)
+	require.NoError(t, err)
+
+	return metadata.AppendToOutgoingContext(context.Background(), authorizationHeaderKey, fmt.Sprintf("Bearer %s", accessToken))
+}
+
+func requireCode(t *testing.T, code codes.Code, err error) {
+	require.Error(t, err)
+	require.Equal(t, code, status.Code(err), err.Error())
+}
+
+/* Test Functions */
+
+// Test Scenario: RPCs without a valid token or allowed role are rejected before they run
+func TestAuthorization(t *testing.T){
+	store := newFakeStore()
+	client := newTestClient(t, store)
+
+	_, err := client.GetUser(context.Background(), &pb.GetUserRequest{Id: 1})
+	requireCode(t, codes.Unauthenticated, err)
+
+	badToken := metadata.AppendToOutgoingContext(context.Background(), authorizationHeaderKey, "Bearer not-a-token")
+	_, err = client.GetUser(badToken, &pb.GetUserRequest{Id: 1})
+	requireCode(t, codes.Unauthenticated, err)
+
+	// Refresh tokens aren't access tokens
+	tokenMaker, err := token.NewPasetoMaker(testSymmetricKey)
+	require.NoError(t, err)
+	refreshToken, _, err := tokenMaker.CreateToken(testCustomer, util.AdminRole, token.RefreshToken, time.Hour)
+	require.NoError(t, err)
+	refresh := metadata.AppendToOutgoingContext(context.Background(), authorizationHeaderKey, "Bearer " + refreshToken)
+	_, err = client.GetUser(refresh, &pb.GetUserRequest{Id: 1})
+	requireCode(t, codes.Unauthenticated, err)
+
+	apiKey := metadata.AppendToOutgoingContext(context.Background(), authorizationHeaderKey, "ApiKey abc")
+	_, err = client.GetUser(apiKey, &pb.GetUserRequest{Id: 1})
+	requireCode(t, codes.Unauthenticated, err)
+
+	// Only admins delete users
+	for _, role := range []string{util.CustomerRole, util.FulfillmentRole, util.ReadOnlyRole} {
+		_, err = client.DeleteUser(withAuthorization(t, testCustomer, role), &pb.DeleteUserRequest{Id: 1})
+		requireCode(t, codes.PermissionDenied, err)
+	}
+	require.Empty(t, store.deleted)
+
+	// Streams are checked too
+	stream, err := client.ListOrders(context.Background(), &pb.ListOrdersRequest{})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	requireCode(t, codes.Unauthenticated, err)
+
+	// Every RPC has a policy
+	for _, method := range pb.BeadBashStorage_ServiceDesc.Methods {
+		require.Contains(t, rpcPolicies, fullMethod(method.MethodName))
+	}
+	for _, stream := range pb.BeadBashStorage_ServiceDesc.Streams {
+		require.Contains(t, rpcPolicies, fullMethod(stream.StreamName))
+	}
+}
+
+// Test Scenario: customers can only read themselves and their own orders, staff can read anyone
+// Customers can't tell missing ids from someone else's
+func TestGetUserAndOrder(t *testing.T){
+	client := newTestClient(t, newFakeStore())
+	customer := withAuthorization(t, testCustomer, util.CustomerRole)
+
+	response, err := client.GetUser(customer, &pb.GetUserRequest{Id: 1})
+	require.NoError(t, err)
+	require.Equal(t, testCustomer, response.GetUser().GetUsername())
+	require.Equal(t, "Jane Doe", response.GetUser().GetFullName())
+	require.Equal(t, int64(2), response.GetUser().GetVersion())
+	require.Nil(t, response.GetUser().GetErasedAt())
+
+	_, err = client.GetUser(customer, &pb.GetUserRequest{Id: 2})
+	requireCode(t, codes.PermissionDenied, err)
+	_, err = client.GetUser(customer, &pb.GetUserRequest{Id: 99})
+	requireCode(t, codes.PermissionDenied, err)
+
+	_, err = client.GetUser(withAuthorization(t, "staff", util.ReadOnlyRole), &pb.GetUserRequest{Id: 2})
+	require.NoError(t, err)
+
+	_, err = client.GetUser(withAuthorization(t, "staff", util.AdminRole), &pb.GetUserRequest{Id: 99})
+	requireCode(t, codes.NotFound, err)
+
+	// Odd orders belong to the test customer
+	order, err := client.GetOrder(customer, &pb.GetOrderRequest{OrderId: 3})
+	require.NoError(t, err)
+	require.Equal(t, int64(3), order.GetOrder().GetOrderId())
+
+	_, err = client.GetOrder(customer, &pb.GetOrderRequest{OrderId: 4})
+	requireCode(t, codes.PermissionDenied, err)
+	_, err = client.GetOrder(customer, &pb.GetOrderRequest{OrderId: 999})
+	requireCode(t, codes.PermissionDenied, err)
+
+	_, err = client.GetOrder(withAuthorization(t, "staff", util.ReadOnlyRole), &pb.GetOrderRequest{OrderId: 999})
+	requireCode(t, codes.NotFound, err)
+}
+
+// Test Scenario: orders are created through NewOrderTx after the request is validated
+func TestCreateOrder(t *testing.T){
+	store := newFakeStore()
+	client := newTestClient(t, store)
+	fulfillment := withAuthorization(t, "packer", util.FulfillmentRole)
+
+	req := &pb.CreateOrderRequest{
+		Username: "new_customer",
+		FullName: "Sam Smith",
+		PurchaseAmount: 42.5,
+		PurchasedItem: "anklet",
+		ShippingLocation: "Halifax",
+		Currency: "CAD",
+		DateOrdered: "2022-08-01",
+	}
+	response, err := client.CreateOrder(fulfillment, req)
+	require.NoError(t, err)
+	require.Equal(t, "new_customer", response.GetUser().GetUsername())
+	require.Equal(t, int64(1), response.GetUser().GetTotalOrders())
+	require.Equal(t, int64(251), response.GetOrder().GetOrderId())
+	require.Equal(t, 42.5, response.GetOrder().GetPurchaseAmount())
+	require.Equal(t, "anklet", response.GetOrder().GetPurchasedItem())
+
+	req.Currency = "GBP"
+	_, err = client.CreateOrder(fulfillment, req)
+	requireCode(t, codes.InvalidArgument, err)
+
+	req.Currency, req.PurchasedItem = "CAD", ""
+	_, err = client.CreateOrder(fulfillment, req)
+	requireCode(t, codes.InvalidArgument, err)
+
+	_, err = client.CreateOrder(withAuthorization(t, "viewer", util.ReadOnlyRole), req)
+	requireCode(t, codes.PermissionDenied, err)
+}
+
+// Test Scenario: users are deleted through DeleteUserTx, stale versions are refused
+func TestDeleteUser(t *testing.T){
+	store := newFakeStore()
+	client := newTestClient(t, store)
+	admin := withAuthorization(t, "boss", util.AdminRole)
+
+	_, err := client.DeleteUser(admin, &pb.DeleteUserRequest{Id: 1, Version: 1})
+	requireCode(t, codes.FailedPrecondition, err)
+
+	response, err := client.DeleteUser(admin, &pb.DeleteUserRequest{Id: 1, Version: 2})
+	require.NoError(t, err)
+	require.Equal(t, "Deleted", response.GetDeletionStatus())
+	require.Equal(t, []db.DeleteUserTxParams{{ID: 1, Versions: []int64{2}}}, store.deleted)
+
+	_, err = client.DeleteUser(admin, &pb.DeleteUserRequest{Id: 99})
+	requireCode(t, codes.NotFound, err)
+}
+
+// Test Scenario: every matching order is streamed in order, across several DB batches
+func TestListOrders(t *testing.T){
+	store := newFakeStore()
+	client := newTestClient(t, store)
+
+	receiveAll := func(ctx context.Context, req *pb.ListOrdersRequest) ([]*pb.Order, error) {
+		stream, err := client.ListOrders(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		var orders []*pb.Order
+		for {
+			response, err := stream.Recv()
+			if err == io.EOF {
+				return orders, nil
+			}
+			if err != nil {
+				return orders, err
+			}
+			orders = append(orders, response.GetOrder())
+		}
+	}
+
+	// Staff see every order
+	orders, err := receiveAll(withAuthorization(t, "viewer", util.ReadOnlyRole), &pb.ListOrdersRequest{Currency: "CAD", Tag: " Gift "})
+	require.NoError(t, err)
+	require.Len(t, orders, 250)
+	for i, order := range orders {
+		require.Equal(t, int64(i+1), order.GetOrderId())
+	}
+	require.Len(t, store.listFilters, 3) // Batches of 100
+	require.Equal(t, db.OrderFilter{Currency: "CAD", Tag: "gift"}, store.listFilters[0])
+
+	// Customers only see their own
+	customer := withAuthorization(t, testCustomer, util.CustomerRole)
+	orders, err = receiveAll(customer, &pb.ListOrdersRequest{})
+	require.NoError(t, err)
+	require.Len(t, orders, 125)
+	for _, order := range orders {
+		require.Equal(t, testCustomer, order.GetUsername())
+	}
+
+	_, err = receiveAll(customer, &pb.ListOrdersRequest{Username: "someone_else"})
+	requireCode(t, codes.PermissionDenied, err)
+
+	_, err = receiveAll(customer, &pb.ListOrdersRequest{Sort: "colour"})
+	requireCode(t, codes.InvalidArgument, err)
+}
+
+// Test Scenario: the gRPC server serves the TLS certificate the REST API is configured with
+func TestServeTLS(t *testing.T){
+	// Self-signed certificate for 127.0.0.1
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore: time.Now().Add(-time.Hour),
+		NotAfter: time.Now().Add(time.Hour),
+		KeyUsage: x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	config := util.Config{
+		TokenSymmetricKey: testSymmetricKey,
+		TLSCertFile: filepath.Join(dir, "server.crt"),
+		TLSKeyFile: filepath.Join(dir, "server.key"),
+		TLSMinVersion: "1.2",
+	}
+	require.NoError(t, os.WriteFile(config.TLSCertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(config.TLSKeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+
+	server, err := NewServer(config, newFakeStore())
+	require.NoError(t, err)
+	tlsConfig, stopReloading, err := util.ServerTLSConfig(config)
+	require.NoError(t, err)
+	defer stopReloading()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	grpcServer := server.newGRPCServer(tlsConfig)
+	go grpcServer.Serve(listener)
+	defer grpcServer.Stop()
+
+	call := func(creds credentials.TransportCredentials) error {
+		ctx, cancel := context.WithTimeout(withAuthorization(t, testCustomer, util.CustomerRole), 2*time.Second)
+		defer cancel()
+		conn, err := grpc.DialContext(ctx, listener.Addr().String(), grpc.WithTransportCredentials(creds))
+		require.NoError(t, err)
+		defer conn.Close()
+		_, err = pb.NewBeadBashStorageClient(conn).GetUser(ctx, &pb.GetUserRequest{Id: 1})
+		return err
+	}
+
+	roots := x509.NewCertPool()
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	roots.AddCert(cert)
+	require.NoError(t, call(credentials.NewTLS(&tls.Config{RootCAs: roots})))
+	require.Error(t, call(insecure.NewCredentials())) // Plain text is refused
+}
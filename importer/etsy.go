@@ -0,0 +1,45 @@
+package importer
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Etsy "Sold Order Items" export: Shop Manager > Settings > Options > Download Data
+// Every row has the order's fields, the buyer's Etsy username becomes the username
+var etsyMapper = mapper{
+	required: []string{"Sale Date", "Item Name", "Buyer", "Quantity", "Item Total", "Currency", "Order ID"},
+	mapRow:   mapEtsyRow,
+}
+
+func mapEtsyRow(row csvRow) (line, error) {
+	result := line{
+		externalID: row.get("Order ID"),
+		username: row.get("Buyer"),
+		fullName: row.get("Ship Name"),
+		currency: strings.ToUpper(row.get("Currency")),
+		shippingLocation: joinLocation(row.get("Ship City"), row.get("Ship State"), row.get("Ship Country")),
+	}
+
+	quantity, err := row.quantity("Quantity")
+	if err != nil {
+		return result, err
+	}
+	result.item = itemName(row.get("Item Name"), quantity)
+	if result.itemAmount, err = row.amount("Item Total"); err != nil {
+		return result, err
+	}
+	result.dateOrdered, err = etsyDate(row.get("Sale Date"))
+	return result, err
+}
+
+// Etsy writes dates as MM/DD/YY, older exports as MM/DD/YYYY
+func etsyDate(value string) (string, error) {
+	for _, layout := range []string{"01/02/06", "01/02/2006", "1/2/06", "1/2/2006"} {
+		if date, err := time.Parse(layout, value); err == nil {
+			return date.Format("2006-01-02"), nil
+		}
+	}
+	return "", fmt.Errorf("Sale Date %q isn't a date", value)
+}
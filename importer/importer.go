@@ -0,0 +1,350 @@
+// Imports historical orders from the CSV exports of other shops (Etsy, Shopify)
+
+package importer
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	db "github.com/samanthatb1/beadBashStorage/db/sqlc"
+	"github.com/samanthatb1/beadBashStorage/util"
+)
+
+// Export formats, also stored as the orders' external_source
+const (
+	Etsy    = "etsy"    // "Sold Order Items" CSV from Shop Manager, one row per item
+	Shopify = "shopify" // Orders export from the admin, one row per line item
+)
+
+// Orders per transaction when Options.BatchSize isn't set
+const DefaultBatchSize = 500
+
+// Currencies orders are stored in, the same ones the API accepts
+var currencies = map[string]bool{"USD": true, "EUR": true, "CAD": true}
+
+// What a source's mapper reads from one row
+// Exports have a row per item, rows of the same order share the external id and the order's fields may only be on the first one
+type line struct {
+	externalID       string
+	username         string
+	fullName         string
+	currency         string
+	dateOrdered      string // YYYY-MM-DD
+	shippingLocation string
+	item             string  // e.g. "Beaded necklace x2"
+	itemAmount       float64 // What the item cost
+	orderAmount      float64 // What the whole order cost, 0 if the row doesn't say
+}
+
+// Reads the rows of one export format
+type mapper struct {
+	required []string // Columns every export of the format has
+	mapRow   func(row csvRow) (line, error)
+}
+
+var mappers = map[string]mapper{
+	Etsy:    etsyMapper,
+	Shopify: shopifyMapper,
+}
+
+// Whether the importer can read exports of the source
+func IsSource(source string) bool {
+	_, ok := mappers[source]
+	return ok
+}
+
+/**** Parsing ****/
+
+// A row, or all rows of an order, that can't be imported
+type RowError struct {
+	Row        int    `json:"row"` // Line in the file, the header is line 1
+	ExternalID string `json:"external_id,omitempty"`
+	Error      string `json:"error"`
+}
+
+type Parsed struct {
+	Source  string
+	Rows    int                // Rows read, without the header
+	Orders  []db.ImportedOrder // In the order they first show up
+	Invalid []RowError         // Skipped, an order with one bad row is skipped as a whole
+}
+
+// An order while its rows are read
+type pendingOrder struct {
+	line
+	row         int // First row of the order
+	items       []string
+	itemsAmount float64
+	err         error
+}
+
+// Reads the export, rows that can't be read are reported in Parsed.Invalid
+// Fails if the file isn't a CSV export of the source
+func Parse(source string, r io.Reader) (Parsed, error) {
+	result := Parsed{Source: source, Orders: []db.ImportedOrder{}, Invalid: []RowError{}}
+	mapper, ok := mappers[source]
+	if !ok {
+		return result, fmt.Errorf("unknown source %q", source)
+	}
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1 // Exports add columns over the years, missing trailing columns are read as empty
+	header, err := reader.Read()
+	if err == io.EOF {
+		return result, errors.New("file is empty")
+	}
+	if err != nil {
+		return result, fmt.Errorf("cannot read header: %w", err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))] = i // Excel adds a byte order mark
+	}
+	for _, name := range mapper.required {
+		if _, ok := columns[name]; !ok {
+			return result, fmt.Errorf("column %q is missing, is this a %s export?", name, source)
+		}
+	}
+
+	orders := map[string]*pendingOrder{}
+	var ids []string
+	for rowNumber := 2; ; rowNumber++ {
+		values, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) { // A broken row, the next ones can still be read
+				result.Rows++
+				result.Invalid = append(result.Invalid, RowError{Row: rowNumber, Error: err.Error()})
+				continue
+			}
+			return result, err
+		}
+		result.Rows++
+
+		line, err := mapper.mapRow(csvRow{columns: columns, values: values})
+		if line.externalID == "" {
+			if err == nil {
+				err = errors.New("order id is empty")
+			}
+			result.Invalid = append(result.Invalid, RowError{Row: rowNumber, Error: err.Error()})
+			continue
+		}
+
+		order, ok := orders[line.externalID]
+		if !ok {
+			order = &pendingOrder{line: line, row: rowNumber}
+			orders[line.externalID] = order
+			ids = append(ids, line.externalID)
+		}
+		if err != nil {
+			if order.err == nil {
+				order.err = fmt.Errorf("row %d: %w", rowNumber, err)
+			}
+			continue
+		}
+		order.merge(line)
+	}
+
+	for _, id := range ids {
+		order := orders[id]
+		imported, err := order.toImported()
+		if err != nil {
+			result.Invalid = append(result.Invalid, RowError{Row: order.row, ExternalID: id, Error: err.Error()})
+			continue
+		}
+		result.Orders = append(result.Orders, imported)
+	}
+	return result, nil
+}
+
+// Adds the row's item, the order's fields are taken from the first row that has them
+func (order *pendingOrder) merge(line line) {
+	setIfEmpty(&order.username, line.username)
+	setIfEmpty(&order.fullName, line.fullName)
+	setIfEmpty(&order.currency, line.currency)
+	setIfEmpty(&order.dateOrdered, line.dateOrdered)
+	setIfEmpty(&order.shippingLocation, line.shippingLocation)
+	if order.orderAmount == 0 {
+		order.orderAmount = line.orderAmount
+	}
+	if line.item != "" {
+		order.items = append(order.items, line.item)
+	}
+	order.itemsAmount += line.itemAmount
+}
+
+func setIfEmpty(field *string, value string) {
+	if *field == "" {
+		*field = value
+	}
+}
+
+// The order with every item, or why it can't be imported
+func (order *pendingOrder) toImported() (db.ImportedOrder, error) {
+	if order.err != nil {
+		return db.ImportedOrder{}, order.err
+	}
+	switch {
+	case order.username == "":
+		return db.ImportedOrder{}, errors.New("customer is empty")
+	case util.CheckUsername(order.username) != nil:
+		return db.ImportedOrder{}, fmt.Errorf("customer %q would be read as a user id", order.username)
+	case len(order.items) == 0:
+		return db.ImportedOrder{}, errors.New("order has no items")
+	case order.dateOrdered == "":
+		return db.ImportedOrder{}, errors.New("order date is empty")
+	case !currencies[order.currency]:
+		return db.ImportedOrder{}, fmt.Errorf("currency %q isn't supported", order.currency)
+	}
+
+	amount := order.orderAmount
+	if amount == 0 {
+		amount = order.itemsAmount
+	}
+	fullName := order.fullName
+	if fullName == "" { // e.g. digital items, new users still need a name
+		fullName = order.username
+	}
+	return db.ImportedOrder{
+		ExternalID: order.externalID,
+		NewOrderTxParams: db.NewOrderTxParams{
+			Username: order.username,
+			FullName: fullName,
+			PurchaseAmount: amount,
+			PurchasedItem: strings.Join(order.items, ", "),
+			ShippingLocation: order.shippingLocation,
+			Currency: order.currency,
+			DateOrdered: order.dateOrdered,
+		},
+	}, nil
+}
+
+/**** Importing ****/
+
+// Where the orders go, *db.Store in production
+type Store interface {
+	ImportOrdersTx(ctx context.Context, args db.ImportOrdersTxParams) (db.ImportOrdersTxResult, error)
+}
+
+type Options struct {
+	DryRun    bool // Only report what would be imported
+	BatchSize int  // Orders per transaction, DefaultBatchSize if 0
+}
+
+// What an import did, or would do on a dry run
+type Report struct {
+	Source     string     `json:"source"`
+	DryRun     bool       `json:"dry_run"`
+	Rows       int        `json:"rows"`       // Rows read, without the header
+	Orders     int        `json:"orders"`     // Orders found in the rows
+	Imported   int        `json:"imported"`   // Orders created, or that would be on a dry run
+	Duplicates []string   `json:"duplicates"` // External ids that were imported before, skipped
+	NewUsers   []string   `json:"new_users"`  // Usernames created for the orders
+	Invalid    []RowError `json:"invalid"`    // Rows that were skipped
+	Batches    int        `json:"batches"`    // Transactions that were committed, or checked on a dry run
+}
+
+// Imports the orders of a parsed export in batches, each batch in its own transaction
+// If a batch fails the ones before it stay imported, importing the file again skips them
+func Import(ctx context.Context, store Store, parsed Parsed, options Options) (Report, error) {
+	report := Report{Source: parsed.Source, DryRun: options.DryRun, Duplicates: []string{}, NewUsers: []string{}}
+	report.Rows = parsed.Rows
+	report.Orders = len(parsed.Orders)
+	report.Invalid = parsed.Invalid
+
+	batchSize := options.BatchSize
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+	newUsers := map[string]bool{} // A dry run reports users of later batches as new too
+	for start := 0; start < len(parsed.Orders); start += batchSize {
+		end := start + batchSize
+		if end > len(parsed.Orders) {
+			end = len(parsed.Orders)
+		}
+		result, err := store.ImportOrdersTx(ctx, db.ImportOrdersTxParams{Source: parsed.Source, Orders: parsed.Orders[start:end], DryRun: options.DryRun})
+		if err != nil {
+			return report, fmt.Errorf("batch %d (orders %d to %d): %w", report.Batches+1, start+1, end, err)
+		}
+		report.Batches++
+		report.Imported += result.Imported
+		report.Duplicates = append(report.Duplicates, result.Duplicates...)
+		for _, username := range result.NewUsers {
+			if !newUsers[username] {
+				newUsers[username] = true
+				report.NewUsers = append(report.NewUsers, username)
+			}
+		}
+	}
+	return report, nil
+}
+
+/**** Columns ****/
+
+// A row with its columns looked up by header name
+type csvRow struct {
+	columns map[string]int
+	values  []string
+}
+
+// Value of the column, empty if the export doesn't have it
+func (row csvRow) get(column string) string {
+	i, ok := row.columns[column]
+	if !ok || i >= len(row.values) {
+		return ""
+	}
+	return strings.TrimSpace(row.values[i])
+}
+
+// Amount like "1,234.50" or "$12.00", empty is 0
+func (row csvRow) amount(column string) (float64, error) {
+	value := strings.NewReplacer(",", "", "$", "", "€", "").Replace(row.get(column))
+	if value == "" {
+		return 0, nil
+	}
+	amount, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s %q isn't an amount", column, row.get(column))
+	}
+	return amount, nil
+}
+
+// Quantity of the item, empty is 1
+func (row csvRow) quantity(column string) (int, error) {
+	value := row.get(column)
+	if value == "" {
+		return 1, nil
+	}
+	quantity, err := strconv.Atoi(value)
+	if err != nil || quantity < 1 {
+		return 0, fmt.Errorf("%s %q isn't a quantity", column, value)
+	}
+	return quantity, nil
+}
+
+// "Beaded necklace x2", the quantity is left out when it's 1
+func itemName(name string, quantity int) string {
+	if quantity == 1 {
+		return name
+	}
+	return fmt.Sprintf("%s x%d", name, quantity)
+}
+
+// "City, State, Country" without the empty parts
+func joinLocation(parts ...string) string {
+	var kept []string
+	for _, part := range parts {
+		if part != "" {
+			kept = append(kept, part)
+		}
+	}
+	return strings.Join(kept, ", ")
+}
@@ -0,0 +1,184 @@
+// Unit tests for reading Etsy and Shopify exports and importing them in batches
+
+package importer
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	db "github.com/samanthatb1/beadBashStorage/db/sqlc"
+	"github.com/stretchr/testify/require"
+)
+
+/* Helper Functions */
+
+const etsyExport = "\ufeff" + `Sale Date,Item Name,Buyer,Quantity,Price,Item Total,Currency,Transaction ID,Ship Name,Ship City,Ship State,Ship Country,Order ID
+10/15/22,Beaded necklace,bead_lover,2,12.50,25.00,USD,1,Bea Lover,Toronto,ON,Canada,1001
+10/15/22,Earrings,bead_lover,1,8.00,8.00,USD,2,Bea Lover,Toronto,ON,Canada,1001
+10/16/22,Bracelet,craft_fan,1,15.00,15.00,cad,3,,,,,1002
+10/17/22,Anklet,yen_buyer,1,900,900,JPY,4,Yen Buyer,Osaka,,Japan,1003
+10/18/22,Ring,ring_buyer,one,5.00,5.00,USD,5,Ring Buyer,Paris,,France,1004
+10/19/22,Charm,12345,1,3.00,3.00,USD,6,Num Buyer,Rome,,Italy,1005
+`
+
+const shopifyExport = `Name,Email,Financial Status,Currency,Subtotal,Shipping,Total,Created at,Lineitem quantity,Lineitem name,Lineitem price,Billing Name,Shipping Name,Shipping City,Shipping Province,Shipping Country
+#1001,Bea@Example.com,paid,EUR,"1,040.00",5.00,"1,045.00",2022-10-15 13:45:12 -0400,2,Beaded necklace,500.00,Bea Lover,Bea Lover,Lyon,,FR
+#1001,,,,,,,,1,Earrings,40.00,,,,,
+#1002,fair@example.com,paid,CAD,20.00,0.00,20.00,2022-10-16 10:00:00 -0400,1,Bracelet,20.00,Fair Buyer,,,,
+,,,,,,,,1,Orphan,1.00,,,,,
+`
+
+// Records the batches and pretends orders with ids in stored were imported before
+type fakeImportStore struct {
+	stored  map[string]bool
+	users   map[string]bool
+	batches [][]string
+	failOn  int // Batch that fails, 0 for none
+}
+
+func (store *fakeImportStore) ImportOrdersTx(ctx context.Context, args db.ImportOrdersTxParams) (db.ImportOrdersTxResult, error) {
+	result := db.ImportOrdersTxResult{Duplicates: []string{}, NewUsers: []string{}}
+	var ids []string
+	for _, order := range args.Orders {
+		ids = append(ids, order.ExternalID)
+	}
+	store.batches = append(store.batches, ids)
+	if len(store.batches) == store.failOn {
+		return db.ImportOrdersTxResult{}, errors.New("connection reset")
+	}
+
+	for _, order := range args.Orders {
+		if store.stored[order.ExternalID] {
+			result.Duplicates = append(result.Duplicates, order.ExternalID)
+			continue
+		}
+		result.Imported++
+		if !store.users[order.Username] {
+			result.NewUsers = append(result.NewUsers, order.Username)
+		}
+		if !args.DryRun {
+			store.stored[order.ExternalID] = true
+			store.users[order.Username] = true
+		}
+	}
+	return result, nil
+}
+
+func newFakeImportStore() *fakeImportStore {
+	return &fakeImportStore{stored: map[string]bool{}, users: map[string]bool{}}
+}
+
+/* Test Functions */
+
+// Test Scenario: Etsy item rows are merged into orders, bad rows skip their whole order
+func TestParseEtsy(t *testing.T){
+	parsed, err := Parse(Etsy, strings.NewReader(etsyExport))
+	require.NoError(t, err)
+	require.Equal(t, 6, parsed.Rows)
+	require.Len(t, parsed.Orders, 2)
+
+	first := parsed.Orders[0]
+	require.Equal(t, "1001", first.ExternalID)
+	require.Equal(t, "bead_lover", first.Username)
+	require.Equal(t, "Bea Lover", first.FullName)
+	require.Equal(t, "Beaded necklace x2, Earrings", first.PurchasedItem)
+	require.Equal(t, 33.0, first.PurchaseAmount)
+	require.Equal(t, "USD", first.Currency)
+	require.Equal(t, "2022-10-15", first.DateOrdered)
+	require.Equal(t, "Toronto, ON, Canada", first.ShippingLocation)
+
+	// No shipping name, the username is used
+	second := parsed.Orders[1]
+	require.Equal(t, "craft_fan", second.FullName)
+	require.Equal(t, "CAD", second.Currency)
+	require.Empty(t, second.ShippingLocation)
+
+	require.Len(t, parsed.Invalid, 3)
+	require.Equal(t, RowError{Row: 5, ExternalID: "1003", Error: `currency "JPY" isn't supported`}, parsed.Invalid[0])
+	require.Equal(t, "1004", parsed.Invalid[1].ExternalID)
+	require.Contains(t, parsed.Invalid[1].Error, "Quantity")
+	require.Equal(t, RowError{Row: 7, ExternalID: "1005", Error: `customer "12345" would be read as a user id`}, parsed.Invalid[2]) // Buyers can't be numbers
+}
+
+// Test Scenario: Shopify line items are merged, order fields come from the first row
+func TestParseShopify(t *testing.T){
+	parsed, err := Parse(Shopify, strings.NewReader(shopifyExport))
+	require.NoError(t, err)
+	require.Equal(t, 4, parsed.Rows)
+	require.Len(t, parsed.Orders, 2)
+
+	first := parsed.Orders[0]
+	require.Equal(t, "#1001", first.ExternalID)
+	require.Equal(t, "bea@example.com", first.Username)
+	require.Equal(t, "Beaded necklace x2, Earrings", first.PurchasedItem)
+	require.Equal(t, 1040.0, first.PurchaseAmount) // Subtotal, without shipping
+	require.Equal(t, "EUR", first.Currency)
+	require.Equal(t, "2022-10-15", first.DateOrdered)
+	require.Equal(t, "Lyon, FR", first.ShippingLocation)
+
+	// Nothing shipped, the billing name is used
+	require.Equal(t, "Fair Buyer", parsed.Orders[1].FullName)
+
+	require.Equal(t, []RowError{{Row: 5, Error: "order id is empty"}}, parsed.Invalid)
+}
+
+// Test Scenario: files of another format are rejected before anything is imported
+func TestParseWrongFormat(t *testing.T){
+	_, err := Parse(Shopify, strings.NewReader(etsyExport))
+	require.ErrorContains(t, err, `column "Name" is missing`)
+
+	_, err = Parse(Etsy, strings.NewReader(""))
+	require.ErrorContains(t, err, "empty")
+
+	_, err = Parse("amazon", strings.NewReader(etsyExport))
+	require.Error(t, err)
+	require.False(t, IsSource("amazon"))
+}
+
+// Parses the export and imports it
+func runImport(t *testing.T, store Store, source string, export string, options Options) (Report, error) {
+	parsed, err := Parse(source, strings.NewReader(export))
+	require.NoError(t, err)
+	return Import(context.Background(), store, parsed, options)
+}
+
+// Test Scenario: orders are imported in batches and a second import skips them
+func TestImport(t *testing.T){
+	store := newFakeImportStore()
+
+	// Dry run doesn't store anything
+	report, err := runImport(t, store, Etsy, etsyExport, Options{DryRun: true, BatchSize: 1})
+	require.NoError(t, err)
+	require.True(t, report.DryRun)
+	require.Equal(t, 2, report.Imported)
+	require.Equal(t, 2, report.Batches)
+	require.Equal(t, []string{"bead_lover", "craft_fan"}, report.NewUsers)
+	require.Len(t, report.Invalid, 3)
+	require.Empty(t, store.stored)
+
+	report, err = runImport(t, store, Etsy, etsyExport, Options{BatchSize: 1})
+	require.NoError(t, err)
+	require.Equal(t, 2, report.Imported)
+	require.Equal(t, [][]string{{"1001"}, {"1002"}, {"1001"}, {"1002"}}, store.batches)
+
+	// Same file again
+	report, err = runImport(t, store, Etsy, etsyExport, Options{})
+	require.NoError(t, err)
+	require.Equal(t, 0, report.Imported)
+	require.Equal(t, []string{"1001", "1002"}, report.Duplicates)
+	require.Empty(t, report.NewUsers)
+	require.Equal(t, 1, report.Batches)
+}
+
+// Test Scenario: a failing batch stops the import, earlier batches are reported
+func TestImportFailingBatch(t *testing.T){
+	store := newFakeImportStore()
+	store.failOn = 2
+
+	report, err := runImport(t, store, Shopify, shopifyExport, Options{BatchSize: 1})
+	require.ErrorContains(t, err, "batch 2 (orders 2 to 2): connection reset")
+	require.Equal(t, 1, report.Batches)
+	require.Equal(t, 1, report.Imported)
+}
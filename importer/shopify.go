@@ -0,0 +1,57 @@
+package importer
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Shopify orders export: Orders > Export > "Plain CSV file"
+// Only the first row of an order has its email, totals and addresses, the rest only have their line item
+// The order's Name (e.g. #1001) is its id and the customer's email becomes the username
+var shopifyMapper = mapper{
+	required: []string{"Name", "Email", "Currency", "Subtotal", "Created at", "Lineitem quantity", "Lineitem name"},
+	mapRow:   mapShopifyRow,
+}
+
+func mapShopifyRow(row csvRow) (line, error) {
+	result := line{
+		externalID: row.get("Name"),
+		username: strings.ToLower(row.get("Email")),
+		fullName: row.get("Shipping Name"),
+		currency: strings.ToUpper(row.get("Currency")),
+		shippingLocation: joinLocation(row.get("Shipping City"), row.get("Shipping Province"), row.get("Shipping Country")),
+	}
+	if result.fullName == "" { // Nothing to ship, e.g. picked up at a fair
+		result.fullName = row.get("Billing Name")
+	}
+
+	quantity, err := row.quantity("Lineitem quantity")
+	if err != nil {
+		return result, err
+	}
+	result.item = itemName(row.get("Lineitem name"), quantity)
+	price, err := row.amount("Lineitem price")
+	if err != nil {
+		return result, err
+	}
+	result.itemAmount = price * float64(quantity)
+	if result.orderAmount, err = row.amount("Subtotal"); err != nil {
+		return result, err
+	}
+
+	if createdAt := row.get("Created at"); createdAt != "" {
+		result.dateOrdered, err = shopifyDate(createdAt)
+	}
+	return result, err
+}
+
+// Shopify writes times as "2022-10-15 13:45:12 -0400"
+func shopifyDate(value string) (string, error) {
+	for _, layout := range []string{"2006-01-02 15:04:05 -0700", time.RFC3339, "2006-01-02"} {
+		if date, err := time.Parse(layout, value); err == nil {
+			return date.Format("2006-01-02"), nil
+		}
+	}
+	return "", fmt.Errorf("Created at %q isn't a date", value)
+}
@@ -1,19 +1,36 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
+	"flag"
 	"log"
+	"os"
+	"time"
 
 	"github.com/samanthatb1/beadBashStorage/api"
+	"github.com/samanthatb1/beadBashStorage/cache"
 	db "github.com/samanthatb1/beadBashStorage/db/sqlc"
+	"github.com/samanthatb1/beadBashStorage/gapi"
+	"github.com/samanthatb1/beadBashStorage/importer"
+	"github.com/samanthatb1/beadBashStorage/pii"
 	"github.com/samanthatb1/beadBashStorage/util"
+	"github.com/samanthatb1/beadBashStorage/webhook"
 
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 )
 
-// Starts server and DB connection
+const (
+	rotateKeysBatchSize         = 500       // Rows re-encrypted per transaction by rotate-keys
+	idempotencyKeyPurgeInterval = time.Hour // How often expired Idempotency-Key responses are deleted
+)
+
+// Starts the REST and gRPC servers and DB connection
+// "main rotate-keys" re-encrypts stored PII with the active key instead of starting the server
+// "main import-orders -source etsy -file sales.csv [-dry-run]" imports an Etsy or Shopify export instead
 func main() {
 	// Load variables from env file
 	config, err := util.LoadConfig(".")
@@ -28,8 +45,30 @@ func main() {
 	conn, err := sql.Open(config.DBDriver, config.DBSource)
 	if err != nil { log.Fatal("Cannot connect to db: ", err) }
 
-	store := db.NewStore(conn) // Create a store instance with original and additional DB operations
-	server := api.NewServer(store) // Create server instance based on the store
+	// Encrypts customer PII before it's stored
+	cipher, err := pii.NewCipher(config.PIIKeys, config.PIIActiveKeyID, config.PIIIndexKey)
+	if err != nil { log.Fatal("Cannot load PII keys: ", err) }
+	if cipher == nil { log.Println("PII_KEYS is not set, customer PII is stored in plain text") }
+
+	store := db.NewStore(conn, cipher) // Create a store instance with original and additional DB operations
+
+	if len(os.Args) > 1 && os.Args[1] == "rotate-keys" {
+		runKeyRotation(store)
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "import-orders" {
+		runOrderImport(config, store, os.Args[2:])
+		return
+	}
+
+	store.SetCache(cache.New(config.CacheTTL, config.CacheMaxEntries)) // Hot lookups, only the servers poll them
+
+	go runGRPCServer(config, store) // Internal tools, next to the REST API
+	go runWebhookDispatcher(config, store) // Sends the events queued by the store
+	go runIdempotencyKeyPurge(store) // Expired keys are never replayed, only kept until they're reused
+
+	server, err := api.NewServer(config, store) // Create server instance based on the store
+	if err != nil { log.Fatal("Cannot create server: ", err) }
 
 	// Start server by passing in an address to run on
 	err = server.Start(config.ServerAddress)
@@ -49,4 +88,86 @@ func runDBMigration(migrationURL string, dbSource string) {
 	}
 
 	log.Println("db migrated successfully")
-}
\ No newline at end of file
+}
+
+func runGRPCServer(config util.Config, store *db.Store) {
+	server, err := gapi.NewServer(config, store)
+	if err != nil { log.Fatal("Cannot create gRPC server: ", err) }
+
+	log.Println("gRPC server listening on", config.GRPCServerAddress)
+	err = server.Start(config.GRPCServerAddress)
+	if err != nil { log.Fatal("Cannot start gRPC server: ", err) }
+}
+
+func runWebhookDispatcher(config util.Config, store *db.Store) {
+	dispatcher := webhook.NewDispatcher(store, webhook.Options{
+		MaxAttempts: config.WebhookMaxAttempts,
+		RetryBase: config.WebhookRetryBase,
+		RetryMax: config.WebhookRetryMax,
+		Timeout: config.WebhookTimeout,
+		PollInterval: config.WebhookPollInterval,
+		AllowPrivateNetworks: config.WebhookAllowPrivateNetworks,
+	})
+
+	log.Println("webhook dispatcher polling every", config.WebhookPollInterval)
+	dispatcher.Run(context.Background())
+}
+
+func runIdempotencyKeyPurge(store *db.Store) {
+	ticker := time.NewTicker(idempotencyKeyPurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := store.DeleteExpiredIdempotencyKeys(context.Background(), time.Now())
+		if err != nil {
+			log.Println("cannot purge expired idempotency keys:", err)
+		} else if purged > 0 {
+			log.Println("purged expired idempotency keys:", purged)
+		}
+		<-ticker.C
+	}
+}
+
+func runKeyRotation(store *db.Store) {
+	result, err := store.RotateKeys(context.Background(), rotateKeysBatchSize)
+	if err != nil {
+		log.Fatal("failed to rotate PII keys:", err, " (users rotated: ", result.UsersRotated, ", orders rotated: ", result.OrdersRotated, ", webhooks rotated: ", result.WebhooksRotated, ", deliveries rotated: ", result.DeliveriesRotated, ", order events rotated: ", result.OrderEventsRotated, ", responses rotated: ", result.ResponsesRotated, ")")
+	}
+
+	log.Println("PII keys rotated, users:", result.UsersRotated, "orders:", result.OrdersRotated, "webhooks:", result.WebhooksRotated, "deliveries:", result.DeliveriesRotated, "order events:", result.OrderEventsRotated, "responses:", result.ResponsesRotated)
+}
+
+func runOrderImport(config util.Config, store *db.Store, args []string) {
+	flags := flag.NewFlagSet("import-orders", flag.ExitOnError)
+	source := flags.String("source", "", "format of the export: etsy or shopify")
+	file := flags.String("file", "", "path of the CSV export")
+	dryRun := flags.Bool("dry-run", false, "only report what would be imported")
+	batchSize := flags.Int("batch-size", config.ImportBatchSize, "orders per transaction")
+	flags.Parse(args)
+	if !importer.IsSource(*source) || *file == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	csvFile, err := os.Open(*file)
+	if err != nil { log.Fatal("Cannot open export: ", err) }
+	defer csvFile.Close()
+
+	parsed, err := importer.Parse(*source, csvFile)
+	if err != nil { log.Fatal("Cannot read export: ", err) }
+	report, err := importer.Import(context.Background(), store, parsed, importer.Options{DryRun: *dryRun, BatchSize: *batchSize})
+
+	// Report goes to stdout so it can be saved, also when a batch failed
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if encodeErr := encoder.Encode(report); encodeErr != nil { log.Fatal("Cannot write report: ", encodeErr) }
+	if err != nil {
+		log.Fatal("failed to import orders: ", err, " (batches imported: ", report.Batches, ", importing the file again skips them)")
+	}
+
+	if *dryRun {
+		log.Println("dry run, orders that would be imported:", report.Imported, "duplicates:", len(report.Duplicates), "invalid rows:", len(report.Invalid))
+		return
+	}
+	log.Println("orders imported:", report.Imported, "duplicates skipped:", len(report.Duplicates), "invalid rows:", len(report.Invalid))
+}
@@ -0,0 +1,277 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             (unknown)
+// source: service_bead_bash_storage.proto
+
+package pb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// BeadBashStorageClient is the client API for BeadBashStorage service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type BeadBashStorageClient interface {
+	GetUser(ctx context.Context, in *GetUserRequest, opts ...grpc.CallOption) (*GetUserResponse, error)
+	DeleteUser(ctx context.Context, in *DeleteUserRequest, opts ...grpc.CallOption) (*DeleteUserResponse, error)
+	CreateOrder(ctx context.Context, in *CreateOrderRequest, opts ...grpc.CallOption) (*CreateOrderResponse, error)
+	GetOrder(ctx context.Context, in *GetOrderRequest, opts ...grpc.CallOption) (*GetOrderResponse, error)
+	ListOrders(ctx context.Context, in *ListOrdersRequest, opts ...grpc.CallOption) (BeadBashStorage_ListOrdersClient, error)
+}
+
+type beadBashStorageClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewBeadBashStorageClient(cc grpc.ClientConnInterface) BeadBashStorageClient {
+	return &beadBashStorageClient{cc}
+}
+
+func (c *beadBashStorageClient) GetUser(ctx context.Context, in *GetUserRequest, opts ...grpc.CallOption) (*GetUserResponse, error) {
+	out := new(GetUserResponse)
+	err := c.cc.Invoke(ctx, "/pb.BeadBashStorage/GetUser", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *beadBashStorageClient) DeleteUser(ctx context.Context, in *DeleteUserRequest, opts ...grpc.CallOption) (*DeleteUserResponse, error) {
+	out := new(DeleteUserResponse)
+	err := c.cc.Invoke(ctx, "/pb.BeadBashStorage/DeleteUser", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *beadBashStorageClient) CreateOrder(ctx context.Context, in *CreateOrderRequest, opts ...grpc.CallOption) (*CreateOrderResponse, error) {
+	out := new(CreateOrderResponse)
+	err := c.cc.Invoke(ctx, "/pb.BeadBashStorage/CreateOrder", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *beadBashStorageClient) GetOrder(ctx context.Context, in *GetOrderRequest, opts ...grpc.CallOption) (*GetOrderResponse, error) {
+	out := new(GetOrderResponse)
+	err := c.cc.Invoke(ctx, "/pb.BeadBashStorage/GetOrder", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *beadBashStorageClient) ListOrders(ctx context.Context, in *ListOrdersRequest, opts ...grpc.CallOption) (BeadBashStorage_ListOrdersClient, error) {
+	stream, err := c.cc.NewStream(ctx, &BeadBashStorage_ServiceDesc.Streams[0], "/pb.BeadBashStorage/ListOrders", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &beadBashStorageListOrdersClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type BeadBashStorage_ListOrdersClient interface {
+	Recv() (*ListOrdersResponse, error)
+	grpc.ClientStream
+}
+
+type beadBashStorageListOrdersClient struct {
+	grpc.ClientStream
+}
+
+func (x *beadBashStorageListOrdersClient) Recv() (*ListOrdersResponse, error) {
+	m := new(ListOrdersResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// BeadBashStorageServer is the server API for BeadBashStorage service.
+// All implementations must embed UnimplementedBeadBashStorageServer
+// for forward compatibility
+type BeadBashStorageServer interface {
+	GetUser(context.Context, *GetUserRequest) (*GetUserResponse, error)
+	DeleteUser(context.Context, *DeleteUserRequest) (*DeleteUserResponse, error)
+	CreateOrder(context.Context, *CreateOrderRequest) (*CreateOrderResponse, error)
+	GetOrder(context.Context, *GetOrderRequest) (*GetOrderResponse, error)
+	ListOrders(*ListOrdersRequest, BeadBashStorage_ListOrdersServer) error
+	mustEmbedUnimplementedBeadBashStorageServer()
+}
+
+// UnimplementedBeadBashStorageServer must be embedded to have forward compatible implementations.
+type UnimplementedBeadBashStorageServer struct {
+}
+
+func (UnimplementedBeadBashStorageServer) GetUser(context.Context, *GetUserRequest) (*GetUserResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetUser not implemented")
+}
+func (UnimplementedBeadBashStorageServer) DeleteUser(context.Context, *DeleteUserRequest) (*DeleteUserResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteUser not implemented")
+}
+func (UnimplementedBeadBashStorageServer) CreateOrder(context.Context, *CreateOrderRequest) (*CreateOrderResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateOrder not implemented")
+}
+func (UnimplementedBeadBashStorageServer) GetOrder(context.Context, *GetOrderRequest) (*GetOrderResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetOrder not implemented")
+}
+func (UnimplementedBeadBashStorageServer) ListOrders(*ListOrdersRequest, BeadBashStorage_ListOrdersServer) error {
+	return status.Errorf(codes.Unimplemented, "method ListOrders not implemented")
+}
+func (UnimplementedBeadBashStorageServer) mustEmbedUnimplementedBeadBashStorageServer() {}
+
+// UnsafeBeadBashStorageServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to BeadBashStorageServer will
+// result in compilation errors.
+type UnsafeBeadBashStorageServer interface {
+	mustEmbedUnimplementedBeadBashStorageServer()
+}
+
+func RegisterBeadBashStorageServer(s grpc.ServiceRegistrar, srv BeadBashStorageServer) {
+	s.RegisterService(&BeadBashStorage_ServiceDesc, srv)
+}
+
+func _BeadBashStorage_GetUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetUserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BeadBashStorageServer).GetUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.BeadBashStorage/GetUser",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BeadBashStorageServer).GetUser(ctx, req.(*GetUserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BeadBashStorage_DeleteUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteUserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BeadBashStorageServer).DeleteUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.BeadBashStorage/DeleteUser",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BeadBashStorageServer).DeleteUser(ctx, req.(*DeleteUserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BeadBashStorage_CreateOrder_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateOrderRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BeadBashStorageServer).CreateOrder(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.BeadBashStorage/CreateOrder",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BeadBashStorageServer).CreateOrder(ctx, req.(*CreateOrderRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BeadBashStorage_GetOrder_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetOrderRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(BeadBashStorageServer).GetOrder(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.BeadBashStorage/GetOrder",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(BeadBashStorageServer).GetOrder(ctx, req.(*GetOrderRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _BeadBashStorage_ListOrders_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ListOrdersRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(BeadBashStorageServer).ListOrders(m, &beadBashStorageListOrdersServer{stream})
+}
+
+type BeadBashStorage_ListOrdersServer interface {
+	Send(*ListOrdersResponse) error
+	grpc.ServerStream
+}
+
+type beadBashStorageListOrdersServer struct {
+	grpc.ServerStream
+}
+
+func (x *beadBashStorageListOrdersServer) Send(m *ListOrdersResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// BeadBashStorage_ServiceDesc is the grpc.ServiceDesc for BeadBashStorage service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var BeadBashStorage_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "pb.BeadBashStorage",
+	HandlerType: (*BeadBashStorageServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetUser",
+			Handler:    _BeadBashStorage_GetUser_Handler,
+		},
+		{
+			MethodName: "DeleteUser",
+			Handler:    _BeadBashStorage_DeleteUser_Handler,
+		},
+		{
+			MethodName: "CreateOrder",
+			Handler:    _BeadBashStorage_CreateOrder_Handler,
+		},
+		{
+			MethodName: "GetOrder",
+			Handler:    _BeadBashStorage_GetOrder_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ListOrders",
+			Handler:       _BeadBashStorage_ListOrders_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "service_bead_bash_storage.proto",
+}
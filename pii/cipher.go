@@ -0,0 +1,256 @@
+// Encrypts personal information (names, shipping locations) before it's stored
+
+package pii
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Encrypted values look like "enc:v1:<key id>:<wrapped data key>:<ciphertext>"
+const encryptedPrefix = "enc:v1:"
+
+const keySize = 32 // AES-256
+
+var ErrUnknownKey = errors.New("value was encrypted with a key that isn't configured")
+
+// Cipher does envelope encryption: every value gets its own random data key,
+// the data key is encrypted ("wrapped") with a master key from config and stored next to the value.
+// Rotating master keys re-encrypts the values with new data keys, so a leaked data key stops working too.
+//
+// A nil *Cipher is valid and stores values in plain text
+type Cipher struct {
+	masterKeys  map[string][]byte // Master keys by id, old keys are kept to decrypt rows that weren't rotated yet
+	activeKeyID string            // Master key new values are encrypted with
+	indexKey    []byte            // HMAC key for blind indexes
+}
+
+// Creates a cipher from config values
+// masterKeys looks like "2023a:<base64 key>,2024a:<base64 key>", all keys are 32 bytes encoded with base64
+// Returns a nil cipher (plain text) if no master keys are set
+func NewCipher(masterKeys string, activeKeyID string, indexKey string) (*Cipher, error) {
+	if strings.TrimSpace(masterKeys) == "" {
+		return nil, nil
+	}
+
+	c := &Cipher{masterKeys: make(map[string][]byte), activeKeyID: activeKeyID}
+	for _, entry := range strings.Split(masterKeys, ",") {
+		fields := strings.SplitN(strings.TrimSpace(entry), ":", 2)
+		if len(fields) != 2 || fields[0] == "" {
+			return nil, fmt.Errorf("invalid master key entry %q: must look like <id>:<base64 key>", entry)
+		}
+		key, err := decodeKey(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid master key %s: %w", fields[0], err)
+		}
+		c.masterKeys[fields[0]] = key
+	}
+
+	if _, ok := c.masterKeys[activeKeyID]; !ok {
+		return nil, fmt.Errorf("active key %q is not one of the master keys", activeKeyID)
+	}
+
+	var err error
+	c.indexKey, err = decodeKey(indexKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid index key: %w", err)
+	}
+	return c, nil
+}
+
+func decodeKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != keySize {
+		return nil, fmt.Errorf("key must be %d bytes, got %d", keySize, len(key))
+	}
+	return key, nil
+}
+
+// Checks if the value is stored encrypted
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, encryptedPrefix)
+}
+
+// Encrypts the value with a new data key wrapped by the active master key
+func (c *Cipher) Encrypt(plaintext string) (string, error) {
+	if c == nil {
+		return plaintext, nil
+	}
+
+	dataKey := make([]byte, keySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", err
+	}
+
+	ciphertext, err := seal(dataKey, []byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+	wrappedKey, err := seal(c.masterKeys[c.activeKeyID], dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	return encryptedPrefix + c.activeKeyID + ":" +
+		base64.RawStdEncoding.EncodeToString(wrappedKey) + ":" +
+		base64.RawStdEncoding.EncodeToString(ciphertext), nil
+}
+
+// Decrypts the value, values that aren't encrypted (rows from before encryption was turned on) are returned as is
+func (c *Cipher) Decrypt(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+	if c == nil {
+		return "", ErrUnknownKey
+	}
+
+	keyID, wrappedKey, ciphertext, err := parse(value)
+	if err != nil {
+		return "", err
+	}
+	dataKey, err := c.unwrap(keyID, wrappedKey)
+	if err != nil {
+		return "", err
+	}
+
+	plaintext, err := open(dataKey, ciphertext)
+	if err != nil {
+		return "", fmt.Errorf("cannot decrypt value: %w", err)
+	}
+	return string(plaintext), nil
+}
+
+// Checks if the value should be rewritten by key rotation: it's in plain text or wrapped by an old master key
+func (c *Cipher) NeedsRotation(value string) bool {
+	if c == nil {
+		return false
+	}
+	if !IsEncrypted(value) {
+		return true
+	}
+	keyID, _, _, err := parse(value)
+	return err == nil && keyID != c.activeKeyID
+}
+
+// Re-encrypts the value with a new data key wrapped by the active master key, plain text values are encrypted
+func (c *Cipher) Rotate(value string) (string, error) {
+	plaintext, err := c.Decrypt(value)
+	if err != nil {
+		return "", err
+	}
+	return c.Encrypt(plaintext)
+}
+
+// Deterministic index of the value so exact-match lookups work on encrypted columns
+// Case and extra spaces are ignored. Without a cipher the normalised plain text is the index
+func (c *Cipher) BlindIndex(value string) string {
+	normalised := strings.ToLower(strings.Join(strings.Fields(value), " "))
+	if c == nil {
+		return normalised
+	}
+
+	mac := hmac.New(sha256.New, c.indexKey)
+	mac.Write([]byte(normalised))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Blind index of every word of the values, sorted and without duplicates
+// Lets search match whole words of encrypted columns
+func (c *Cipher) WordTokens(values ...string) []string {
+	seen := make(map[string]bool)
+	tokens := []string{}
+	for _, value := range values {
+		for _, word := range Words(value) {
+			token := c.BlindIndex(word)
+			if !seen[token] {
+				seen[token] = true
+				tokens = append(tokens, token)
+			}
+		}
+	}
+	sort.Strings(tokens)
+	return tokens
+}
+
+// Splits the value into lowercase words, anything but letters and digits separates words
+func Words(value string) []string {
+	return strings.FieldsFunc(strings.ToLower(value), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// Splits an encrypted value into its parts
+func parse(value string) (keyID string, wrappedKey []byte, ciphertext []byte, err error) {
+	fields := strings.Split(strings.TrimPrefix(value, encryptedPrefix), ":")
+	if len(fields) != 3 {
+		return "", nil, nil, errors.New("malformed encrypted value")
+	}
+	if wrappedKey, err = base64.RawStdEncoding.DecodeString(fields[1]); err != nil {
+		return "", nil, nil, err
+	}
+	if ciphertext, err = base64.RawStdEncoding.DecodeString(fields[2]); err != nil {
+		return "", nil, nil, err
+	}
+	return fields[0], wrappedKey, ciphertext, nil
+}
+
+// Decrypts a data key with the master key it was wrapped with
+func (c *Cipher) unwrap(keyID string, wrappedKey []byte) ([]byte, error) {
+	masterKey, ok := c.masterKeys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKey, keyID)
+	}
+	dataKey, err := open(masterKey, wrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("cannot unwrap data key: %w", err)
+	}
+	return dataKey, nil
+}
+
+// AES-GCM encrypts, the nonce is put in front of the ciphertext
+func seal(key []byte, plaintext []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// AES-GCM decrypts what seal made
+func open(key []byte, sealed []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():]
+	return gcm.Open(nil, nonce, ciphertext, nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,168 @@
+// Unit tests for PII envelope encryption and blind indexes
+
+package pii
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/samanthatb1/beadBashStorage/util"
+	"github.com/stretchr/testify/require"
+)
+
+// Random 32 byte key encoded like it is in config
+func randomKey(t *testing.T) string {
+	key := make([]byte, keySize)
+	_, err := rand.Read(key)
+	require.NoError(t, err)
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+// Test Scenario: values round trip and the same value encrypts differently every time
+func TestEncryptDecrypt(t *testing.T){
+	cipher, err := NewCipher("k1:"+randomKey(t), "k1", randomKey(t))
+	require.NoError(t, err)
+
+	plaintext := util.RandomLongString()
+	encrypted, err := cipher.Encrypt(plaintext)
+	require.NoError(t, err)
+	require.True(t, IsEncrypted(encrypted))
+	require.NotContains(t, encrypted, plaintext)
+
+	again, err := cipher.Encrypt(plaintext)
+	require.NoError(t, err)
+	require.NotEqual(t, encrypted, again)
+
+	decrypted, err := cipher.Decrypt(encrypted)
+	require.NoError(t, err)
+	require.Equal(t, plaintext, decrypted)
+
+	// Rows written before encryption was turned on are read as is
+	decrypted, err = cipher.Decrypt(plaintext)
+	require.NoError(t, err)
+	require.Equal(t, plaintext, decrypted)
+
+	// Tampered ciphertext is rejected
+	_, err = cipher.Decrypt(encrypted[:len(encrypted)-2] + "AA")
+	require.Error(t, err)
+}
+
+// Test Scenario: rotating moves values to the active key and old keys are still needed until then
+func TestRotate(t *testing.T){
+	oldKey, newKey, indexKey := randomKey(t), randomKey(t), randomKey(t)
+	oldCipher, err := NewCipher("old:"+oldKey, "old", indexKey)
+	require.NoError(t, err)
+	newCipher, err := NewCipher("old:"+oldKey+",new:"+newKey, "new", indexKey)
+	require.NoError(t, err)
+
+	plaintext := util.RandomLongString()
+	encrypted, err := oldCipher.Encrypt(plaintext)
+	require.NoError(t, err)
+	require.False(t, oldCipher.NeedsRotation(encrypted))
+	require.True(t, newCipher.NeedsRotation(encrypted))
+	require.True(t, newCipher.NeedsRotation(plaintext))
+
+	rotated, err := newCipher.Rotate(encrypted)
+	require.NoError(t, err)
+	require.False(t, newCipher.NeedsRotation(rotated))
+	require.True(t, strings.HasPrefix(rotated, encryptedPrefix+"new:"))
+
+	// The value gets a new data key, the old one can't decrypt it anymore
+	require.NotEqual(t, encrypted[strings.LastIndex(encrypted, ":"):], rotated[strings.LastIndex(rotated, ":"):])
+	_, oldWrappedKey, _, err := parse(encrypted)
+	require.NoError(t, err)
+	oldDataKey, err := newCipher.unwrap("old", oldWrappedKey)
+	require.NoError(t, err)
+	_, _, rotatedCiphertext, err := parse(rotated)
+	require.NoError(t, err)
+	_, err = open(oldDataKey, rotatedCiphertext)
+	require.Error(t, err)
+
+	decrypted, err := newCipher.Decrypt(rotated)
+	require.NoError(t, err)
+	require.Equal(t, plaintext, decrypted)
+
+	// Once the old key is dropped, values still wrapped by it can't be read
+	onlyNew, err := NewCipher("new:"+newKey, "new", indexKey)
+	require.NoError(t, err)
+	_, err = onlyNew.Decrypt(encrypted)
+	require.ErrorIs(t, err, ErrUnknownKey)
+
+	// Plain text values get encrypted
+	rotated, err = newCipher.Rotate(plaintext)
+	require.NoError(t, err)
+	require.True(t, IsEncrypted(rotated))
+}
+
+// Test Scenario: blind indexes ignore case and spacing and depend on the index key
+func TestBlindIndex(t *testing.T){
+	cipher, err := NewCipher("k1:"+randomKey(t), "k1", randomKey(t))
+	require.NoError(t, err)
+	other, err := NewCipher("k1:"+randomKey(t), "k1", randomKey(t))
+	require.NoError(t, err)
+
+	index := cipher.BlindIndex("Toronto,  ON")
+	require.Equal(t, index, cipher.BlindIndex(" toronto, on "))
+	require.NotEqual(t, index, cipher.BlindIndex("Ottawa, ON"))
+	require.NotEqual(t, index, other.BlindIndex("Toronto, ON"))
+	require.NotContains(t, index, "toronto")
+}
+
+// Test Scenario: without keys values are stored in plain text
+func TestNilCipher(t *testing.T){
+	cipher, err := NewCipher("", "", "")
+	require.NoError(t, err)
+	require.Nil(t, cipher)
+
+	value, err := cipher.Encrypt("Jane Doe")
+	require.NoError(t, err)
+	require.Equal(t, "Jane Doe", value)
+	require.Equal(t, "jane doe", cipher.BlindIndex(" Jane  Doe"))
+	require.False(t, cipher.NeedsRotation(value))
+
+	// Encrypted values can't be read without keys
+	_, err = cipher.Decrypt(encryptedPrefix + "k1:a:b")
+	require.ErrorIs(t, err, ErrUnknownKey)
+}
+
+// Test Scenario: invalid key config is rejected
+func TestNewCipherInvalidConfig(t *testing.T){
+	testCases := []struct {
+		name        string
+		keys        string
+		activeKeyID string
+		indexKey    string
+	}{
+		{"MissingID", ":" + randomKey(t), "", randomKey(t)},
+		{"NotBase64", "k1:not-a-key", "k1", randomKey(t)},
+		{"ShortKey", "k1:" + base64.StdEncoding.EncodeToString([]byte("short")), "k1", randomKey(t)},
+		{"UnknownActiveKey", "k1:" + randomKey(t), "k2", randomKey(t)},
+		{"MissingIndexKey", "k1:" + randomKey(t), "k1", ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewCipher(tc.keys, tc.activeKeyID, tc.indexKey)
+			require.Error(t, err)
+		})
+	}
+}
+
+// Test Scenario: word tokens match single words of a value
+func TestWordTokens(t *testing.T){
+	require.Equal(t, []string{"water", "st", "halifax", "ns"}, Words("Water St., Halifax NS"))
+
+	cipher, err := NewCipher("k1:"+randomKey(t), "k1", randomKey(t))
+	require.NoError(t, err)
+
+	tokens := cipher.WordTokens("Jane Doe", "Halifax, NS", "jane")
+	require.Len(t, tokens, 4) // Duplicates are dropped
+	require.Contains(t, tokens, cipher.BlindIndex("HALIFAX"))
+	require.NotContains(t, tokens, "halifax")
+
+	// Without a cipher the words are the tokens
+	var plain *Cipher
+	require.Equal(t, []string{"doe", "jane"}, plain.WordTokens("Jane Doe"))
+}
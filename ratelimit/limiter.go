@@ -0,0 +1,63 @@
+// Limits how often a client can call the API
+
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit allows Requests per Period, with bursts of up to Requests at once
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// Result of checking a request against a limit
+type Result struct {
+	Allowed    bool
+	Limit      int           // Requests allowed per period
+	Remaining  int           // Requests left right now
+	ResetAfter time.Duration // Time until the client is back to the full limit
+	RetryAfter time.Duration // Time until the next request is allowed, zero if allowed now
+}
+
+// Limiter is an interface for checking requests against a limit
+// The in-memory limiter only counts requests made to this instance, a shared backend can implement this to count across instances
+type Limiter interface {
+	// Uses up one request for the key, returns if it was allowed
+	Allow(ctx context.Context, key string, limit Limit) (Result, error)
+}
+
+// Checks if the limit is turned off
+func (limit Limit) Disabled() bool {
+	return limit.Requests <= 0 || limit.Period <= 0
+}
+
+// Parses limits written as "requests/period", e.g. "60/1m" or "5/1s"
+// An empty string turns the limit off
+func ParseLimit(s string) (Limit, error) {
+	if strings.TrimSpace(s) == "" {
+		return Limit{}, nil
+	}
+
+	fields := strings.SplitN(s, "/", 2)
+	if len(fields) != 2 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q: must look like 60/1m", s)
+	}
+
+	requests, err := strconv.Atoi(strings.TrimSpace(fields[0]))
+	if err != nil || requests < 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q: requests must be a whole number", s)
+	}
+
+	period, err := time.ParseDuration(strings.TrimSpace(fields[1]))
+	if err != nil || period <= 0 {
+		return Limit{}, fmt.Errorf("invalid rate limit %q: period must be a duration like 1m", s)
+	}
+
+	return Limit{Requests: requests, Period: period}, nil
+}
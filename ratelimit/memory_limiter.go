@@ -0,0 +1,90 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// How often buckets that have refilled completely are dropped
+const sweepInterval = time.Minute
+
+// Token bucket for one key
+type bucket struct {
+	tokens   float64
+	updated  time.Time
+	refilled time.Time // When the bucket will be full again
+}
+
+// MemoryLimiter is an in-memory token bucket limiter
+type MemoryLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time // Replaced in tests
+}
+
+// Creates a new in-memory limiter
+func NewMemoryLimiter() *MemoryLimiter {
+	return &MemoryLimiter{
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}
+}
+
+// Uses up one request for the key, returns if it was allowed
+func (limiter *MemoryLimiter) Allow(ctx context.Context, key string, limit Limit) (Result, error) {
+	if limit.Disabled() {
+		return Result{Allowed: true}, nil
+	}
+
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+
+	now := limiter.now()
+	limiter.sweep(now)
+
+	capacity := float64(limit.Requests)
+	perToken := limit.Period / time.Duration(limit.Requests) // Time to refill one request
+
+	// New clients start with a full bucket
+	b, ok := limiter.buckets[key]
+	if !ok {
+		b = &bucket{tokens: capacity, updated: now}
+		limiter.buckets[key] = b
+	}
+
+	// Refill for the time since the last request
+	elapsed := now.Sub(b.updated)
+	b.tokens = math.Min(capacity, b.tokens+elapsed.Seconds()/perToken.Seconds())
+	b.updated = now
+
+	result := Result{Limit: limit.Requests}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = time.Duration((1 - b.tokens) * float64(perToken))
+	}
+
+	result.Remaining = int(math.Floor(b.tokens))
+	result.ResetAfter = time.Duration((capacity - b.tokens) * float64(perToken))
+	b.refilled = now.Add(result.ResetAfter)
+
+	return result, nil
+}
+
+// Drops buckets that are full again so idle clients don't use memory, caller must hold the lock
+func (limiter *MemoryLimiter) sweep(now time.Time) {
+	if now.Sub(limiter.lastSweep) < sweepInterval {
+		return
+	}
+	for key, b := range limiter.buckets {
+		if !now.Before(b.refilled) {
+			delete(limiter.buckets, key)
+		}
+	}
+	limiter.lastSweep = now
+}
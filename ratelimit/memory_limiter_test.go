@@ -0,0 +1,89 @@
+// Unit tests for the in-memory token bucket limiter
+
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Limiter with a clock the tests can move forward
+func newTestLimiter() (*MemoryLimiter, *time.Time) {
+	now := time.Now()
+	limiter := NewMemoryLimiter()
+	limiter.now = func() time.Time { return now }
+	return limiter, &now
+}
+
+// Test Scenario: burst is allowed up to the limit, then refills over time
+func TestMemoryLimiter(t *testing.T){
+	limiter, now := newTestLimiter()
+	limit := Limit{Requests: 3, Period: 3 * time.Second}
+
+	for i := 2; i >= 0; i-- {
+		result, err := limiter.Allow(context.Background(), "ip:1.2.3.4", limit)
+		require.NoError(t, err)
+		require.True(t, result.Allowed)
+		require.Equal(t, 3, result.Limit)
+		require.Equal(t, i, result.Remaining)
+	}
+
+	// Bucket is empty
+	result, err := limiter.Allow(context.Background(), "ip:1.2.3.4", limit)
+	require.NoError(t, err)
+	require.False(t, result.Allowed)
+	require.Equal(t, 0, result.Remaining)
+	require.Equal(t, time.Second, result.RetryAfter)
+	require.Equal(t, 3*time.Second, result.ResetAfter)
+
+	// Other clients have their own bucket
+	result, err = limiter.Allow(context.Background(), "ip:5.6.7.8", limit)
+	require.NoError(t, err)
+	require.True(t, result.Allowed)
+
+	// One request refills every second
+	*now = now.Add(time.Second)
+	result, err = limiter.Allow(context.Background(), "ip:1.2.3.4", limit)
+	require.NoError(t, err)
+	require.True(t, result.Allowed)
+}
+
+// Test Scenario: full buckets of idle clients are dropped
+func TestMemoryLimiterSweep(t *testing.T){
+	limiter, now := newTestLimiter()
+	limit := Limit{Requests: 10, Period: time.Second}
+
+	_, err := limiter.Allow(context.Background(), "user:a", limit)
+	require.NoError(t, err)
+	require.Len(t, limiter.buckets, 1)
+
+	*now = now.Add(2 * sweepInterval)
+	_, err = limiter.Allow(context.Background(), "user:b", limit)
+	require.NoError(t, err)
+	require.Len(t, limiter.buckets, 1)
+	require.Contains(t, limiter.buckets, "user:b")
+}
+
+// Test Scenario: parse limits from config
+func TestParseLimit(t *testing.T){
+	limit, err := ParseLimit("60/1m")
+	require.NoError(t, err)
+	require.Equal(t, Limit{Requests: 60, Period: time.Minute}, limit)
+
+	limit, err = ParseLimit("")
+	require.NoError(t, err)
+	require.True(t, limit.Disabled())
+
+	// Disabled limits let everything through
+	result, err := NewMemoryLimiter().Allow(context.Background(), "ip:1.2.3.4", limit)
+	require.NoError(t, err)
+	require.True(t, result.Allowed)
+
+	for _, invalid := range []string{"60", "sixty/1m", "60/minute", "-1/1m", "60/0s"} {
+		_, err = ParseLimit(invalid)
+		require.Error(t, err, invalid)
+	}
+}
@@ -0,0 +1,16 @@
+// Creates and verifies signed access and refresh tokens
+
+package token
+
+import (
+	"time"
+)
+
+// Maker is an interface for managing tokens
+type Maker interface {
+	// Creates a new token for a specific username, role, type and duration
+	CreateToken(username string, role string, tokenType TokenType, duration time.Duration) (string, *Payload, error)
+
+	// Checks if the token is valid, returns the payload stored in the token if it is
+	VerifyToken(token string) (*Payload, error)
+}
@@ -0,0 +1,73 @@
+// Unit tests for PASETO token creation and verification
+
+package token
+
+import (
+	"testing"
+	"time"
+
+	"github.com/samanthatb1/beadBashStorage/util"
+	"github.com/stretchr/testify/require"
+)
+
+// 32 character key used by the tests
+const testSymmetricKey = "12345678901234567890123456789012"
+
+// Test Scenario: token round trips and keeps its payload
+func TestPasetoMaker(t *testing.T){
+	maker, err := NewPasetoMaker(testSymmetricKey)
+	require.NoError(t, err)
+
+	username := util.RandomLongString()
+	duration := time.Minute
+	issuedAt := time.Now()
+	expiredAt := issuedAt.Add(duration)
+
+	token, payload, err := maker.CreateToken(username, util.AdminRole, AccessToken, duration)
+	require.NoError(t, err)
+	require.NotEmpty(t, token)
+	require.NotEmpty(t, payload)
+
+	payload, err = maker.VerifyToken(token)
+	require.NoError(t, err)
+	require.NotZero(t, payload.ID)
+	require.Equal(t, username, payload.Username)
+	require.Equal(t, util.AdminRole, payload.Role)
+	require.Equal(t, AccessToken, payload.Type)
+	require.NoError(t, payload.CheckType(AccessToken))
+	require.ErrorIs(t, payload.CheckType(RefreshToken), ErrWrongTokenType)
+	require.WithinDuration(t, issuedAt, payload.IssuedAt, time.Second)
+	require.WithinDuration(t, expiredAt, payload.ExpiredAt, time.Second)
+}
+
+// Test Scenario: token past its expiry is rejected
+func TestExpiredPasetoToken(t *testing.T){
+	maker, err := NewPasetoMaker(testSymmetricKey)
+	require.NoError(t, err)
+
+	token, _, err := maker.CreateToken(util.RandomLongString(), util.CustomerRole, AccessToken, -time.Minute)
+	require.NoError(t, err)
+
+	payload, err := maker.VerifyToken(token)
+	require.EqualError(t, err, ErrExpiredToken.Error())
+	require.Nil(t, payload)
+}
+
+// Test Scenario: token made with another key is rejected
+func TestInvalidPasetoToken(t *testing.T){
+	maker, err := NewPasetoMaker(testSymmetricKey)
+	require.NoError(t, err)
+	otherMaker, err := NewPasetoMaker("abcdefghijklmnopqrstuvwxyzabcdef")
+	require.NoError(t, err)
+
+	token, _, err := otherMaker.CreateToken(util.RandomLongString(), util.CustomerRole, AccessToken, time.Minute)
+	require.NoError(t, err)
+
+	payload, err := maker.VerifyToken(token)
+	require.EqualError(t, err, ErrInvalidToken.Error())
+	require.Nil(t, payload)
+
+	// Keys must be exactly 32 characters
+	_, err = NewPasetoMaker("too short")
+	require.Error(t, err)
+}
@@ -0,0 +1,68 @@
+package token
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Errors returned by VerifyToken
+var (
+	ErrInvalidToken = errors.New("token is invalid")
+	ErrExpiredToken = errors.New("token has expired")
+	ErrWrongTokenType = errors.New("token has the wrong type")
+)
+
+// What a token may be used for
+type TokenType string
+
+const (
+	AccessToken  TokenType = "access"  // Sent with every request, short lived
+	RefreshToken TokenType = "refresh" // Only exchanged for new access tokens, tied to a session
+	FeedTicket   TokenType = "feed_ticket" // Opens the live order feed from a browser, which can't send headers there, lives seconds
+)
+
+// Payload contains the data stored in the token
+type Payload struct {
+	ID        uuid.UUID `json:"id"`
+	Username  string    `json:"username"`
+	Role      string    `json:"role"`
+	Type      TokenType `json:"token_type"`
+	IssuedAt  time.Time `json:"issued_at"`
+	ExpiredAt time.Time `json:"expired_at"`
+}
+
+// Creates a new token payload for a specific username, role, type and duration
+func NewPayload(username string, role string, tokenType TokenType, duration time.Duration) (*Payload, error) {
+	tokenID, err := uuid.NewRandom()
+	if err != nil {
+		return nil, err
+	}
+
+	payload := &Payload{
+		ID:        tokenID,
+		Username:  username,
+		Role:      role,
+		Type:      tokenType,
+		IssuedAt:  time.Now(),
+		ExpiredAt: time.Now().Add(duration),
+	}
+	return payload, nil
+}
+
+// Checks if the token payload is still valid
+func (payload *Payload) Valid() error {
+	if time.Now().After(payload.ExpiredAt) {
+		return ErrExpiredToken
+	}
+	return nil
+}
+
+// Checks the token was made for this use, so a refresh token can't be sent as an access token
+func (payload *Payload) CheckType(tokenType TokenType) error {
+	if payload.Type != tokenType {
+		return ErrWrongTokenType
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+// Generates and hashes API keys for integrations
+
+package util
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+const (
+	apiKeyPrefix = "bbk_" // Makes leaked keys easy to spot
+	apiKeyPrefixLength = 12 // Characters of the key kept in plain text to tell keys apart
+)
+
+// Scopes an API key can be granted
+const (
+	UsersReadScope   = "users:read"
+	UsersWriteScope  = "users:write"
+	OrdersReadScope  = "orders:read"
+	OrdersWriteScope = "orders:write"
+)
+
+// Returns a new random API key and the prefix that identifies it
+func GenerateAPIKey() (key string, prefix string, err error) {
+	randomBytes := make([]byte, 32)
+	if _, err = rand.Read(randomBytes); err != nil {
+		return "", "", err
+	}
+
+	key = apiKeyPrefix + base64.RawURLEncoding.EncodeToString(randomBytes)
+	return key, key[:apiKeyPrefixLength], nil
+}
+
+// Returns the sha256 hash the API key is stored and looked up by
+// Keys are long and random so a fast hash is enough, unlike passwords
+func HashAPIKey(key string) string {
+	hash := sha256.Sum256([]byte(strings.TrimSpace(key)))
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,27 @@
+// Unit tests for API key generation
+
+package util
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Test Scenario: keys are unique, prefixed and hash consistently
+func TestGenerateAPIKey(t *testing.T){
+	key1, prefix1, err := GenerateAPIKey()
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(key1, apiKeyPrefix))
+	require.True(t, strings.HasPrefix(key1, prefix1))
+	require.Len(t, prefix1, apiKeyPrefixLength)
+
+	key2, _, err := GenerateAPIKey()
+	require.NoError(t, err)
+	require.NotEqual(t, key1, key2)
+
+	require.Equal(t, HashAPIKey(key1), HashAPIKey(key1))
+	require.NotEqual(t, HashAPIKey(key1), HashAPIKey(key2))
+	require.NotContains(t, HashAPIKey(key1), key1)
+}
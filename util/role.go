@@ -0,0 +1,19 @@
+// Roles a user can have, stored in users.role and carried in access tokens
+
+package util
+
+const (
+	CustomerRole    = "customer"    // Default role, may only read their own profile and orders
+	AdminRole       = "admin"       // Full access, including deletes and role changes
+	FulfillmentRole = "fulfillment" // Creates, edits and tags orders
+	ReadOnlyRole    = "read_only"   // Reads every user and order
+)
+
+// Checks if the role is one of the supported roles
+func IsSupportedRole(role string) bool {
+	switch role {
+	case CustomerRole, AdminRole, FulfillmentRole, ReadOnlyRole:
+		return true
+	}
+	return false
+}
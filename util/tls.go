@@ -0,0 +1,194 @@
+// TLS for the REST and gRPC servers, both serve the same certificates and reload them the same way
+
+package util
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Client certificate modes for mutual TLS
+const (
+	clientAuthOptional = "optional" // Certificates are checked if a client sends one
+	clientAuthRequire  = "require"  // Every client must send a certificate signed by the client CA
+)
+
+var tlsVersions = map[string]uint16{
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// Keeps the certificate and client CA in memory and reloads them when the files change on disk
+type CertReloader struct {
+	certFile     string
+	keyFile      string
+	clientCAFile string // Empty turns mutual TLS off
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	modTimes  map[string]time.Time // Last seen modification time of each file
+}
+
+func NewCertReloader(config Config) (*CertReloader, error) {
+	reloader := &CertReloader{
+		certFile: config.TLSCertFile,
+		keyFile: config.TLSKeyFile,
+		clientCAFile: config.TLSClientCAFile,
+		modTimes: make(map[string]time.Time),
+	}
+	if err := reloader.reload(); err != nil {
+		return nil, err
+	}
+	return reloader, nil
+}
+
+func (reloader *CertReloader) files() []string {
+	files := []string{reloader.certFile, reloader.keyFile}
+	if reloader.clientCAFile != "" {
+		files = append(files, reloader.clientCAFile)
+	}
+	return files
+}
+
+// Checks if any file was modified since it was last loaded
+func (reloader *CertReloader) changed() bool {
+	for _, file := range reloader.files() {
+		info, err := os.Stat(file)
+		if err != nil || !info.ModTime().Equal(reloader.modTimes[file]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Loads the files, the previous certificate is kept if they can't be loaded
+func (reloader *CertReloader) reload() error {
+	modTimes := make(map[string]time.Time)
+	for _, file := range reloader.files() {
+		info, err := os.Stat(file)
+		if err != nil {return err}
+		modTimes[file] = info.ModTime()
+	}
+
+	cert, err := tls.LoadX509KeyPair(reloader.certFile, reloader.keyFile)
+	if err != nil {
+		return fmt.Errorf("cannot load TLS certificate: %w", err)
+	}
+
+	var clientCAs *x509.CertPool
+	if reloader.clientCAFile != "" {
+		pem, err := os.ReadFile(reloader.clientCAFile)
+		if err != nil {return err}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return errors.New("client CA file has no PEM certificates")
+		}
+	}
+
+	reloader.mu.Lock()
+	defer reloader.mu.Unlock()
+	reloader.cert = &cert
+	reloader.clientCAs = clientCAs
+	reloader.modTimes = modTimes
+	return nil
+}
+
+// Reloads the files whenever they change until stop is closed
+func (reloader *CertReloader) Watch(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if !reloader.changed() {continue}
+			if err := reloader.reload(); err != nil {
+				// Files are often written one at a time, try again on the next tick
+				log.Println("cannot reload TLS certificates, keeping the current ones:", err)
+				continue
+			}
+			log.Println("TLS certificates reloaded")
+		}
+	}
+}
+
+func (reloader *CertReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	reloader.mu.RLock()
+	defer reloader.mu.RUnlock()
+	return reloader.cert, nil
+}
+
+// Builds the TLS config from the server config, handshakes always use the latest certificates
+func NewTLSConfig(config Config, reloader *CertReloader) (*tls.Config, error) {
+	minVersion, ok := tlsVersions[config.TLSMinVersion]
+	if !ok {
+		return nil, fmt.Errorf("unsupported TLS_MIN_VERSION %q, use 1.2 or 1.3", config.TLSMinVersion)
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion: minVersion,
+		GetCertificate: reloader.getCertificate,
+	}
+	if config.TLSClientCAFile == "" {
+		return tlsConfig, nil
+	}
+
+	// Mutual TLS
+	var clientAuth tls.ClientAuthType
+	switch config.TLSClientAuth {
+	case clientAuthOptional:
+		clientAuth = tls.VerifyClientCertIfGiven
+	case clientAuthRequire:
+		clientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("unsupported TLS_CLIENT_AUTH %q, use %s or %s", config.TLSClientAuth, clientAuthOptional, clientAuthRequire)
+	}
+
+	// The client CA pool can be reloaded too, so every handshake gets a config with the current one
+	tlsConfig.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		reloader.mu.RLock()
+		defer reloader.mu.RUnlock()
+		return &tls.Config{
+			MinVersion: minVersion,
+			NextProtos: []string{"h2", "http/1.1"},
+			GetCertificate: reloader.getCertificate,
+			ClientAuth: clientAuth,
+			ClientCAs: reloader.clientCAs,
+		}, nil
+	}
+	return tlsConfig, nil
+}
+
+// TLS config for a server from the TLS_* settings, nil if no certificate is set
+// Renewed certificates are picked up until stop is called
+func ServerTLSConfig(config Config) (tlsConfig *tls.Config, stop func(), err error) {
+	stop = func() {}
+	if config.TLSCertFile == "" && config.TLSKeyFile == "" {
+		return nil, stop, nil
+	}
+	if config.TLSCertFile == "" || config.TLSKeyFile == "" {
+		return nil, stop, errors.New("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+
+	reloader, err := NewCertReloader(config)
+	if err != nil {return nil, stop, err}
+	tlsConfig, err = NewTLSConfig(config, reloader)
+	if err != nil {return nil, stop, err}
+
+	// Pick up renewed certificates without a restart
+	if config.TLSReloadInterval > 0 {
+		done := make(chan struct{})
+		go reloader.Watch(config.TLSReloadInterval, done)
+		stop = func() { close(done) }
+	}
+	return tlsConfig, stop, nil
+}
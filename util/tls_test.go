@@ -0,0 +1,234 @@
+// Unit tests for TLS certificate loading, reloading and mutual TLS
+
+package util
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+/* Helper Functions */
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+// Creates a certificate signed by parent, or self-signed if parent is nil
+func newTestCert(t *testing.T, commonName string, parent *testCert, isCA bool) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{CommonName: commonName},
+		NotBefore: time.Now().Add(-time.Hour),
+		NotAfter: time.Now().Add(time.Hour),
+		KeyUsage: x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")},
+		BasicConstraintsValid: true,
+		IsCA: isCA,
+	}
+
+	signerCert, signerKey := template, key
+	if parent != nil {
+		signerCert, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signerCert, &key.PublicKey, signerKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &testCert{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+func (c *testCert) keyPEM(t *testing.T) []byte {
+	der, err := x509.MarshalECPrivateKey(c.key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+}
+
+func (c *testCert) tlsCertificate(t *testing.T) tls.Certificate {
+	cert, err := tls.X509KeyPair(c.pem, c.keyPEM(t))
+	require.NoError(t, err)
+	return cert
+}
+
+// Writes the server certificate and key where the config points, bumping the modification time
+func writeServerCert(t *testing.T, config Config, cert *testCert, modTime time.Time) {
+	require.NoError(t, os.WriteFile(config.TLSCertFile, cert.pem, 0600))
+	require.NoError(t, os.WriteFile(config.TLSKeyFile, cert.keyPEM(t), 0600))
+	require.NoError(t, os.Chtimes(config.TLSCertFile, modTime, modTime))
+	require.NoError(t, os.Chtimes(config.TLSKeyFile, modTime, modTime))
+}
+
+func newTestTLSConfig(t *testing.T) Config {
+	dir := t.TempDir()
+	return Config{
+		TLSCertFile: filepath.Join(dir, "server.crt"),
+		TLSKeyFile: filepath.Join(dir, "server.key"),
+		TLSMinVersion: "1.2",
+		TLSClientAuth: clientAuthOptional,
+	}
+}
+
+// Serves TLS with the config on a random port, returns the address
+func serveTLS(t *testing.T, tlsConfig *tls.Config) string {
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", tlsConfig)
+	require.NoError(t, err)
+	httpServer := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})}
+	go httpServer.Serve(listener)
+	t.Cleanup(func() { httpServer.Close() })
+	return listener.Addr().String()
+}
+
+// Makes a request and returns the certificate the server presented
+// The client certificate is always sent, even if the server wouldn't accept its CA
+func getOverTLS(address string, roots *x509.CertPool, clientCert *tls.Certificate) (*x509.Certificate, error) {
+	tlsConfig := &tls.Config{RootCAs: roots}
+	if clientCert != nil {
+		tlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) { return clientCert, nil }
+	}
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	defer client.CloseIdleConnections()
+
+	response, err := client.Get("https://" + address)
+	if err != nil {return nil, err}
+	defer response.Body.Close()
+	return response.TLS.PeerCertificates[0], nil
+}
+
+/* Test Functions */
+
+// Test Scenario: a renewed certificate on disk is served without restarting
+func TestCertReload(t *testing.T){
+	config := newTestTLSConfig(t)
+	oldCert := newTestCert(t, "old", nil, true)
+	writeServerCert(t, config, oldCert, time.Now().Add(-time.Minute))
+
+	reloader, err := NewCertReloader(config)
+	require.NoError(t, err)
+	tlsConfig, err := NewTLSConfig(config, reloader)
+	require.NoError(t, err)
+	address := serveTLS(t, tlsConfig)
+
+	roots := x509.NewCertPool()
+	served, err := getOverTLS(address, roots, nil)
+	require.Error(t, err) // Unknown authority
+	roots.AddCert(oldCert.cert)
+	served, err = getOverTLS(address, roots, nil)
+	require.NoError(t, err)
+	require.Equal(t, "old", served.Subject.CommonName)
+	require.False(t, reloader.changed())
+
+	// Renew the certificate on disk
+	newCert := newTestCert(t, "new", nil, true)
+	writeServerCert(t, config, newCert, time.Now())
+	require.True(t, reloader.changed())
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go reloader.Watch(10*time.Millisecond, stop)
+
+	roots.AddCert(newCert.cert)
+	require.Eventually(t, func() bool {
+		served, err := getOverTLS(address, roots, nil)
+		return err == nil && served.Subject.CommonName == "new"
+	}, 2*time.Second, 20*time.Millisecond)
+
+	// A broken certificate keeps the last good one
+	require.NoError(t, os.WriteFile(config.TLSCertFile, []byte("not a certificate"), 0600))
+	require.Error(t, reloader.reload())
+	served, err = getOverTLS(address, roots, nil)
+	require.NoError(t, err)
+	require.Equal(t, "new", served.Subject.CommonName)
+}
+
+// Test Scenario: client certificates must be signed by the client CA
+func TestMutualTLS(t *testing.T){
+	serverCA := newTestCert(t, "server-ca", nil, true)
+	serverCert := newTestCert(t, "server", serverCA, false)
+	clientCA := newTestCert(t, "partner-ca", nil, true)
+	partnerCert := newTestCert(t, "partner", clientCA, false).tlsCertificate(t)
+	strangerCert := newTestCert(t, "stranger", nil, false).tlsCertificate(t)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(serverCA.cert)
+
+	testCases := []struct {
+		clientAuth   string
+		clientCert   *tls.Certificate
+		ok           bool
+	}{
+		{clientAuthOptional, nil, true},
+		{clientAuthOptional, &partnerCert, true},
+		{clientAuthOptional, &strangerCert, false},
+		{clientAuthRequire, nil, false},
+		{clientAuthRequire, &partnerCert, true},
+		{clientAuthRequire, &strangerCert, false},
+	}
+
+	for _, tc := range testCases {
+		config := newTestTLSConfig(t)
+		config.TLSClientAuth = tc.clientAuth
+		config.TLSClientCAFile = filepath.Join(filepath.Dir(config.TLSCertFile), "client-ca.crt")
+		writeServerCert(t, config, serverCert, time.Now())
+		require.NoError(t, os.WriteFile(config.TLSClientCAFile, clientCA.pem, 0600))
+
+		reloader, err := NewCertReloader(config)
+		require.NoError(t, err)
+		tlsConfig, err := NewTLSConfig(config, reloader)
+		require.NoError(t, err)
+		address := serveTLS(t, tlsConfig)
+
+		_, err = getOverTLS(address, roots, tc.clientCert)
+		if tc.ok {
+			require.NoError(t, err, tc.clientAuth)
+		} else {
+			require.Error(t, err, tc.clientAuth)
+		}
+	}
+}
+
+// Test Scenario: invalid TLS settings are rejected
+func TestInvalidTLSConfig(t *testing.T){
+	config := newTestTLSConfig(t)
+	writeServerCert(t, config, newTestCert(t, "server", nil, true), time.Now())
+	reloader, err := NewCertReloader(config)
+	require.NoError(t, err)
+
+	config.TLSMinVersion = "1.0"
+	_, err = NewTLSConfig(config, reloader)
+	require.Error(t, err)
+
+	config.TLSMinVersion = "1.3"
+	config.TLSClientCAFile = config.TLSCertFile
+	config.TLSClientAuth = "sometimes"
+	_, err = NewTLSConfig(config, reloader)
+	require.Error(t, err)
+
+	// Missing files
+	config.TLSKeyFile = filepath.Join(t.TempDir(), "missing.key")
+	_, err = NewCertReloader(config)
+	require.Error(t, err)
+}
@@ -0,0 +1,20 @@
+// Rules for usernames that binding tags can't express
+
+package util
+
+import (
+	"errors"
+	"strconv"
+)
+
+// Routes that take an id or a username read an identifier that parses as a number as an id,
+// so a user named "1" would be confused with the user whose id is 1
+var ErrNumericUsername = errors.New("username can't be a number")
+
+// Checks that the username can't be read as a user id
+func CheckUsername(username string) error {
+	if _, err := strconv.ParseInt(username, 10, 64); err == nil {
+		return ErrNumericUsername
+	}
+	return nil
+}
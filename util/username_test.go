@@ -0,0 +1,20 @@
+// Unit tests for username rules
+
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Test Scenario: usernames that would be read as an id are rejected
+func TestCheckUsername(t *testing.T){
+	require.NoError(t, CheckUsername("bead_lover"))
+	require.NoError(t, CheckUsername("42beads"))
+	require.NoError(t, CheckUsername(""))
+	require.ErrorIs(t, CheckUsername("1"), ErrNumericUsername)
+	require.ErrorIs(t, CheckUsername("0042"), ErrNumericUsername)
+	require.ErrorIs(t, CheckUsername("-1"), ErrNumericUsername)
+	require.ErrorIs(t, CheckUsername("+7"), ErrNumericUsername)
+}
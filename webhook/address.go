@@ -0,0 +1,97 @@
+// Keeps webhooks from reaching the API's own network: receivers must be public https servers
+// The URL is checked when a webhook is created and again at dial time, after DNS has resolved it
+
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"syscall"
+)
+
+var (
+	ErrInvalidURL     = errors.New("url must be an absolute http or https URL")
+	ErrInsecureURL    = errors.New("url must use https")
+	ErrPrivateAddress = errors.New("url must point to a public address")
+)
+
+// Ranges that are not reachable on the internet but aren't covered by the net.IP methods
+var reservedNetworks = mustParseCIDRs(
+	"0.0.0.0/8",       // "This" network
+	"100.64.0.0/10",   // Carrier-grade NAT
+	"192.0.0.0/24",    // IETF protocol assignments
+	"198.18.0.0/15",   // Benchmarking
+	"240.0.0.0/4",     // Reserved, and broadcast
+	"64:ff9b::/96",    // NAT64, can map to any IPv4 address
+	"64:ff9b:1::/48",  // Local-use NAT64
+)
+
+// Deliveries are POSTed to the URL, so it has to be an absolute https URL on a public host
+// allowPrivate also allows plain http and private addresses, for local development only
+func CheckURL(rawURL string, allowPrivate bool) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return ErrInvalidURL
+	}
+	if allowPrivate {
+		return nil
+	}
+	if parsed.Scheme != "https" {
+		return ErrInsecureURL
+	}
+
+	// Hostnames are resolved when dialing, addresses and localhost can be refused right away
+	host := parsed.Hostname()
+	if strings.EqualFold(host, "localhost") || strings.HasSuffix(strings.ToLower(host), ".localhost") {
+		return ErrPrivateAddress
+	}
+	if ip := net.ParseIP(host); ip != nil && !IsPublicIP(ip) {
+		return ErrPrivateAddress
+	}
+	return nil
+}
+
+// Whether the address is reachable on the internet, loopback, private, link-local and reserved ones are not
+func IsPublicIP(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return false
+	}
+	for _, network := range reservedNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// net.Dialer Control that refuses connections to non-public addresses
+// It sees the resolved address, so DNS names pointing inside the network are caught too
+func refusePrivateAddress(network string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !IsPublicIP(ip) {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, host)
+	}
+	return nil
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
@@ -0,0 +1,212 @@
+// Sends queued webhook deliveries and retries failed ones with exponential backoff
+
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	db "github.com/samanthatb1/beadBashStorage/db/sqlc"
+)
+
+// Characters of the receiver's response kept in the delivery log when it fails
+const maxErrorLength = 500
+
+// Where deliveries are claimed and recorded, *db.Store in production
+type Store interface {
+	ClaimDueWebhookDeliveries(ctx context.Context, leaseUntil time.Time, limit int32) ([]db.DueWebhookDelivery, error)
+	RecordWebhookAttempt(ctx context.Context, arg db.RecordWebhookAttemptParams) (db.WebhookDelivery, error)
+}
+
+type Options struct {
+	MaxAttempts  int           // Attempts before a delivery is marked failed
+	RetryBase    time.Duration // Wait after the first failed attempt, doubled after every other one
+	RetryMax     time.Duration // Longest wait between attempts
+	Timeout      time.Duration // How long a receiver has to answer
+	PollInterval time.Duration // How often due deliveries are looked for
+	BatchSize    int32         // Deliveries claimed and sent at once
+	// Lets receivers on plain http and loopback or private addresses be reached, for local development only
+	AllowPrivateNetworks bool
+}
+
+type Dispatcher struct {
+	store   Store
+	options Options
+	client  *http.Client
+	now     func() time.Time // Replaced in tests
+}
+
+func NewDispatcher(store Store, options Options) *Dispatcher {
+	if options.MaxAttempts < 1 {
+		options.MaxAttempts = 1
+	}
+	if options.BatchSize < 1 {
+		options.BatchSize = 20
+	}
+	return &Dispatcher{
+		store: store,
+		options: options,
+		client: newClient(options),
+		now: time.Now,
+	}
+}
+
+// Client that only connects to public addresses and doesn't follow redirects,
+// so a receiver can't point deliveries (and the response shown in the log) at internal services
+func newClient(options Options) *http.Client {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if !options.AllowPrivateNetworks {
+		dialer.Control = refusePrivateAddress
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil // The proxy's address would be checked instead of the receiver's
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Timeout: options.Timeout,
+		Transport: transport,
+		CheckRedirect: func(request *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse // A 3xx is recorded as a failed attempt
+		},
+	}
+}
+
+// Sends due deliveries every poll interval until the context is done
+func (dispatcher *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(dispatcher.options.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		// A full batch means more are probably due, so look again right away
+		for {
+			sent, err := dispatcher.DeliverDue(ctx)
+			if err != nil {
+				log.Println("cannot send webhook deliveries:", err)
+			}
+			if err != nil || sent < int(dispatcher.options.BatchSize) {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Claims one batch of due deliveries, sends them at the same time and records how each went
+// Returns how many were sent, successfully or not
+func (dispatcher *Dispatcher) DeliverDue(ctx context.Context) (int, error) {
+	// Long enough for every delivery of the batch to time out and be recorded
+	leaseUntil := dispatcher.now().Add(dispatcher.options.Timeout + time.Minute)
+	due, err := dispatcher.store.ClaimDueWebhookDeliveries(ctx, leaseUntil, dispatcher.options.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(due))
+	for i := range due {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = dispatcher.deliver(ctx, due[i])
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return len(due), err
+		}
+	}
+	return len(due), nil
+}
+
+// Sends the delivery once and records the attempt
+func (dispatcher *Dispatcher) deliver(ctx context.Context, due db.DueWebhookDelivery) error {
+	statusCode, sendErr := dispatcher.send(ctx, due)
+	now := dispatcher.now()
+	attempt := int(due.Delivery.Attempts) + 1
+
+	params := db.RecordWebhookAttemptParams{
+		ID: due.Delivery.ID,
+		Status: db.DeliverySucceeded,
+		NextAttemptAt: now,
+		LastStatusCode: int32(statusCode),
+	}
+	switch {
+	case sendErr == nil:
+		params.DeliveredAt.Time, params.DeliveredAt.Valid = now, true
+	case attempt >= dispatcher.options.MaxAttempts:
+		params.Status = db.DeliveryFailed
+		params.LastError = sendErr.Error()
+	default:
+		params.Status = db.DeliveryPending
+		params.LastError = sendErr.Error()
+		params.NextAttemptAt = now.Add(Backoff(attempt, dispatcher.options.RetryBase, dispatcher.options.RetryMax))
+	}
+
+	_, err := dispatcher.store.RecordWebhookAttempt(ctx, params)
+	if err != nil {
+		return fmt.Errorf("delivery %d: %w", due.Delivery.ID, err)
+	}
+	return nil
+}
+
+// POSTs the signed payload, any status other than 2xx is a failure
+// Returns the receiver's status code, 0 if it didn't answer
+func (dispatcher *Dispatcher) send(ctx context.Context, due db.DueWebhookDelivery) (int, error) {
+	// Also catches webhooks created before the URL rules were tightened
+	if err := CheckURL(due.Webhook.Url, dispatcher.options.AllowPrivateNetworks); err != nil {
+		return 0, err
+	}
+
+	body := []byte(due.Delivery.Payload)
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, due.Webhook.Url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "beadBashStorage-Webhooks/1")
+	request.Header.Set(EventHeader, due.Delivery.Event)
+	request.Header.Set(DeliveryHeader, fmt.Sprint(due.Delivery.ID))
+	request.Header.Set(SignatureHeader, Sign(due.Webhook.Secret, dispatcher.now(), body))
+
+	response, err := dispatcher.client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		text, _ := io.ReadAll(io.LimitReader(response.Body, maxErrorLength))
+		return response.StatusCode, fmt.Errorf("receiver answered %s: %s", response.Status, bytes.TrimSpace(text))
+	}
+	io.Copy(io.Discard, io.LimitReader(response.Body, maxErrorLength)) // Lets the connection be reused
+	return response.StatusCode, nil
+}
+
+// Wait before the next attempt after attempt failed: base, 2*base, 4*base... up to max
+func Backoff(attempt int, base time.Duration, max time.Duration) time.Duration {
+	wait := base
+	for i := 1; i < attempt; i++ {
+		wait *= 2
+		if wait >= max || wait <= 0 {
+			return max
+		}
+	}
+	if wait > max {
+		return max
+	}
+	return wait
+}
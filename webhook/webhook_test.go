@@ -0,0 +1,293 @@
+// Unit tests for signing webhook deliveries and sending them to an httptest receiver
+
+package webhook
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	db "github.com/samanthatb1/beadBashStorage/db/sqlc"
+	"github.com/stretchr/testify/require"
+)
+
+/* Helper Functions */
+
+const testSecret = "whsec_test"
+
+// Hands out the queued deliveries once and keeps every recorded attempt
+type fakeStore struct {
+	mu       sync.Mutex
+	due      []db.DueWebhookDelivery
+	attempts []db.RecordWebhookAttemptParams
+}
+
+func (store *fakeStore) ClaimDueWebhookDeliveries(ctx context.Context, leaseUntil time.Time, limit int32) ([]db.DueWebhookDelivery, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	due := store.due
+	store.due = nil
+	return due, nil
+}
+
+func (store *fakeStore) RecordWebhookAttempt(ctx context.Context, arg db.RecordWebhookAttemptParams) (db.WebhookDelivery, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.attempts = append(store.attempts, arg)
+	return db.WebhookDelivery{ID: arg.ID, Status: arg.Status}, nil
+}
+
+func (store *fakeStore) attemptsOf(t *testing.T) []db.RecordWebhookAttemptParams {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	require.NotEmpty(t, store.attempts)
+	return store.attempts
+}
+
+// Sends fine but can't record the attempt
+type failingRecordStore struct {
+	fakeStore
+}
+
+func (store *failingRecordStore) RecordWebhookAttempt(ctx context.Context, arg db.RecordWebhookAttemptParams) (db.WebhookDelivery, error) {
+	return db.WebhookDelivery{}, errors.New("connection reset")
+}
+
+func newTestDelivery(url string, attempts int32) db.DueWebhookDelivery {
+	return db.DueWebhookDelivery{
+		Delivery: db.WebhookDelivery{ID: 7, Event: db.EventOrderCreated, Payload: `{"event":"order.created","data":{"order_id":3}}`, Attempts: attempts},
+		Webhook: db.Webhook{ID: 2, Url: url, Secret: testSecret},
+	}
+}
+
+func newTestDispatcher(store Store, now time.Time) *Dispatcher {
+	// httptest receivers listen on loopback
+	dispatcher := NewDispatcher(store, Options{MaxAttempts: 3, RetryBase: time.Minute, RetryMax: time.Hour, Timeout: time.Second, AllowPrivateNetworks: true})
+	dispatcher.now = func() time.Time { return now }
+	return dispatcher
+}
+
+/* Test Functions */
+
+// Test Scenario: a signature only verifies with the same secret, body and a recent time
+func TestSignAndVerify(t *testing.T){
+	body := []byte(`{"event":"user.deleted"}`)
+	header := Sign(testSecret, time.Now(), body)
+	require.True(t, strings.HasPrefix(header, "t="))
+	require.NoError(t, Verify(testSecret, header, body, time.Minute))
+
+	require.ErrorIs(t, Verify("whsec_other", header, body, time.Minute), ErrInvalidSignature)
+	require.ErrorIs(t, Verify(testSecret, header, []byte(`{"event":"order.deleted"}`), time.Minute), ErrInvalidSignature)
+	require.ErrorIs(t, Verify(testSecret, "v1=abcd", body, time.Minute), ErrInvalidSignature)
+
+	old := Sign(testSecret, time.Now().Add(-time.Hour), body)
+	require.ErrorIs(t, Verify(testSecret, old, body, time.Minute), ErrExpiredSignature)
+	require.NoError(t, Verify(testSecret, old, body, 0))
+}
+
+// Test Scenario: secrets are random and easy to spot
+func TestGenerateSecret(t *testing.T){
+	first, err := GenerateSecret()
+	require.NoError(t, err)
+	second, err := GenerateSecret()
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(first, secretPrefix))
+	require.NotEqual(t, first, second)
+}
+
+// Test Scenario: the wait doubles after every failed attempt and stops at the max
+func TestBackoff(t *testing.T){
+	require.Equal(t, 30*time.Second, Backoff(1, 30*time.Second, time.Hour))
+	require.Equal(t, time.Minute, Backoff(2, 30*time.Second, time.Hour))
+	require.Equal(t, 4*time.Minute, Backoff(4, 30*time.Second, time.Hour))
+	require.Equal(t, time.Hour, Backoff(10, 30*time.Second, time.Hour))
+	require.Equal(t, time.Hour, Backoff(200, 30*time.Second, time.Hour)) // Doesn't overflow
+}
+
+// Test Scenario: the receiver gets the payload with headers it can check, the delivery is recorded as succeeded
+func TestDeliverDue(t *testing.T){
+	var received *http.Request
+	var receivedBody []byte
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		receivedBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	now := time.Now()
+	store := &fakeStore{due: []db.DueWebhookDelivery{newTestDelivery(receiver.URL, 0)}}
+	sent, err := newTestDispatcher(store, now).DeliverDue(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, sent)
+
+	require.Equal(t, http.MethodPost, received.Method)
+	require.Equal(t, "application/json", received.Header.Get("Content-Type"))
+	require.Equal(t, db.EventOrderCreated, received.Header.Get(EventHeader))
+	require.Equal(t, "7", received.Header.Get(DeliveryHeader))
+	require.NoError(t, Verify(testSecret, received.Header.Get(SignatureHeader), receivedBody, time.Minute))
+	require.JSONEq(t, `{"event":"order.created","data":{"order_id":3}}`, string(receivedBody))
+
+	attempt := store.attemptsOf(t)[0]
+	require.Equal(t, int64(7), attempt.ID)
+	require.Equal(t, db.DeliverySucceeded, attempt.Status)
+	require.Equal(t, int32(http.StatusNoContent), attempt.LastStatusCode)
+	require.True(t, attempt.DeliveredAt.Valid)
+	require.Empty(t, attempt.LastError)
+}
+
+// Test Scenario: failed attempts are retried later, the last one marks the delivery failed
+func TestDeliverDueFailure(t *testing.T){
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "out of beads", http.StatusInternalServerError)
+	}))
+	defer receiver.Close()
+
+	testCases := []struct {
+		name     string
+		attempts int32 // Before this one
+		status   string
+		wait     time.Duration
+	}{
+		{"FirstAttempt", 0, db.DeliveryPending, time.Minute},
+		{"SecondAttempt", 1, db.DeliveryPending, 2 * time.Minute},
+		{"LastAttempt", 2, db.DeliveryFailed, 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			now := time.Now()
+			store := &fakeStore{due: []db.DueWebhookDelivery{newTestDelivery(receiver.URL, tc.attempts)}}
+			_, err := newTestDispatcher(store, now).DeliverDue(context.Background())
+			require.NoError(t, err)
+
+			attempt := store.attemptsOf(t)[0]
+			require.Equal(t, tc.status, attempt.Status)
+			require.Equal(t, now.Add(tc.wait), attempt.NextAttemptAt)
+			require.Equal(t, int32(http.StatusInternalServerError), attempt.LastStatusCode)
+			require.Contains(t, attempt.LastError, "out of beads")
+			require.False(t, attempt.DeliveredAt.Valid)
+		})
+	}
+}
+
+// Test Scenario: a receiver that can't be reached is a failed attempt with no status code
+func TestDeliverDueUnreachable(t *testing.T){
+	receiver := httptest.NewServer(http.NotFoundHandler())
+	url := receiver.URL
+	receiver.Close()
+
+	store := &fakeStore{due: []db.DueWebhookDelivery{newTestDelivery(url, 0)}}
+	_, err := newTestDispatcher(store, time.Now()).DeliverDue(context.Background())
+	require.NoError(t, err)
+
+	attempt := store.attemptsOf(t)[0]
+	require.Equal(t, db.DeliveryPending, attempt.Status)
+	require.Equal(t, int32(0), attempt.LastStatusCode)
+	require.NotEmpty(t, attempt.LastError)
+}
+
+// Test Scenario: an attempt that can't be recorded is reported
+func TestDeliverDueRecordError(t *testing.T){
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer receiver.Close()
+
+	store := &failingRecordStore{fakeStore{due: []db.DueWebhookDelivery{newTestDelivery(receiver.URL, 0)}}}
+	_, err := newTestDispatcher(store, time.Now()).DeliverDue(context.Background())
+	require.ErrorContains(t, err, "delivery 7")
+}
+
+// Test Scenario: only absolute https URLs on public hosts are accepted, unless private networks are allowed
+func TestCheckURL(t *testing.T){
+	testCases := []struct {
+		name         string
+		url          string
+		err          error
+		allowPrivate bool
+	}{
+		{"Public", "https://example.com/hooks", nil, false},
+		{"PublicIP", "https://93.184.216.34/hooks", nil, false},
+		{"Relative", "/hooks", ErrInvalidURL, false},
+		{"NotHTTP", "ftp://example.com/hooks", ErrInvalidURL, false},
+		{"PlainHTTP", "http://example.com/hooks", ErrInsecureURL, false},
+		{"Localhost", "https://localhost:8080/hooks", ErrPrivateAddress, false},
+		{"Loopback", "https://127.0.0.1/hooks", ErrPrivateAddress, false},
+		{"LoopbackIPv6", "https://[::1]/hooks", ErrPrivateAddress, false},
+		{"Private", "https://10.0.0.8/hooks", ErrPrivateAddress, false},
+		{"LinkLocal", "https://169.254.169.254/latest/meta-data", ErrPrivateAddress, false},
+		{"CarrierGradeNAT", "https://100.64.0.1/hooks", ErrPrivateAddress, false},
+		{"MappedIPv4", "https://[::ffff:192.168.0.1]/hooks", ErrPrivateAddress, false},
+		{"AllowedPrivate", "http://127.0.0.1:8080/hooks", nil, true},
+		{"AllowedStillAbsolute", "/hooks", ErrInvalidURL, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := CheckURL(tc.url, tc.allowPrivate)
+			if tc.err == nil {
+				require.NoError(t, err)
+			} else {
+				require.ErrorIs(t, err, tc.err)
+			}
+		})
+	}
+}
+
+// Test Scenario: the dispatcher's dialer refuses private addresses, which is what catches hostnames resolving to one
+func TestRefusePrivateAddress(t *testing.T){
+	receiver := httptest.NewServer(http.NotFoundHandler())
+	defer receiver.Close()
+
+	dialer := net.Dialer{Control: refusePrivateAddress}
+	_, err := dialer.Dial("tcp", receiver.Listener.Addr().String())
+	require.ErrorIs(t, err, ErrPrivateAddress)
+
+	require.NoError(t, refusePrivateAddress("tcp", "93.184.216.34:443", nil))
+}
+
+// Test Scenario: without private networks allowed, a plain http receiver never gets the payload
+func TestDeliverDueInsecureURL(t *testing.T){
+	called := false
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer receiver.Close()
+
+	store := &fakeStore{due: []db.DueWebhookDelivery{newTestDelivery(receiver.URL, 0)}}
+	dispatcher := NewDispatcher(store, Options{MaxAttempts: 3, RetryBase: time.Minute, RetryMax: time.Hour, Timeout: time.Second})
+	_, err := dispatcher.DeliverDue(context.Background())
+	require.NoError(t, err)
+
+	attempt := store.attemptsOf(t)[0]
+	require.Equal(t, db.DeliveryPending, attempt.Status)
+	require.Equal(t, int32(0), attempt.LastStatusCode)
+	require.Equal(t, ErrInsecureURL.Error(), attempt.LastError)
+	require.False(t, called)
+}
+
+// Test Scenario: redirects aren't followed, they are a failed attempt
+func TestDeliverDueRedirect(t *testing.T){
+	called := false
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer target.Close()
+	receiver := httptest.NewServer(http.RedirectHandler(target.URL, http.StatusTemporaryRedirect))
+	defer receiver.Close()
+
+	store := &fakeStore{due: []db.DueWebhookDelivery{newTestDelivery(receiver.URL, 0)}}
+	_, err := newTestDispatcher(store, time.Now()).DeliverDue(context.Background())
+	require.NoError(t, err)
+
+	attempt := store.attemptsOf(t)[0]
+	require.Equal(t, db.DeliveryPending, attempt.Status)
+	require.Equal(t, int32(http.StatusTemporaryRedirect), attempt.LastStatusCode)
+	require.False(t, called)
+}